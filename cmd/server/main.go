@@ -1,40 +1,81 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"lewdarchive/internal/config"
+	"lewdarchive/internal/events"
 	"lewdarchive/internal/handler"
+	"lewdarchive/internal/job"
+	"lewdarchive/internal/model"
 	"lewdarchive/internal/repository"
+	"lewdarchive/internal/scheduler"
 	"lewdarchive/internal/service"
+	"lewdarchive/internal/telemetry"
 	"lewdarchive/pkg/database"
 
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
+	startedAt := time.Now()
+
 	if err := godotenv.Load(); err != nil {
 		log.Println("Warning: Error loading .env file:", err)
 	}
 
+	dedupeURLs := flag.Bool("dedupe-urls", false, "delete the posts whose URL was already archived, keeping the oldest, then exit")
+	flag.Parse()
+
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	if *dedupeURLs {
+		if _, err := database.DeduplicateURLsFile(cfg.DBPath); err != nil {
+			log.Fatal("Failed to deduplicate URLs:", err)
+		}
+		return
+	}
 	
-	if cfg.MinifluxSecretKey == "" {
-		log.Println("WARNING: MINIFLUX_SECRET is not set. HMAC verification will be skipped.")
+	if cfg.MinifluxSecretKey == "" && len(cfg.MinifluxSecrets) == 0 {
+		log.Println("WARNING: MINIFLUX_SECRET and MINIFLUX_SECRETS are not set. HMAC verification will be skipped.")
+	} else if cfg.MinifluxSecretKey == "" {
+		log.Println("MINIFLUX_SECRET is not set, webhooks must name a source from MINIFLUX_SECRETS.")
 	}
 
-	if cfg.DiscordWebhookURL == "" {
+	if cfg.DiscordWebhookURL == "" && len(cfg.DiscordCategoryWebhooks) == 0 {
 		log.Println("WARNING: DISCORD_WEBHOOK_URL is not set. Discord notifications will be skipped.")
 	}
 
+	if cfg.ChibisafeAPIKeyFile != "" {
+		key, err := service.ReadAPIKeyFile(cfg.ChibisafeAPIKeyFile)
+		if err != nil {
+			log.Fatalf("Invalid CHIBISAFE_API_KEY_FILE: %v", err)
+		}
+		cfg.ChibisafeAPIKey = key
+	}
 	if cfg.ChibisafeAPIURL == "" || cfg.ChibisafeAPIKey == "" {
 		log.Println("WARNING: CHIBISAFE_API_URL or CHIBISAFE_API_KEY is not set. Chibisafe uploads will be skipped.")
 	}
 
+	shutdownTracing, err := telemetry.Setup(context.Background(), cfg.OtelExporterEndpoint)
+	if err != nil {
+		log.Fatal("Failed to initialize tracing:", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	db, err := database.NewSQLite(cfg.DBPath)
 	if err != nil {
 		log.Fatal("Failed to initialize database:", err)
@@ -45,21 +86,305 @@ func main() {
 		log.Fatal("Error creating archive directory:", err)
 	}
 
+	for category, dir := range cfg.CategoryArchiveDirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Fatalf("Error creating archive directory %s for category %s: %v", dir, category, err)
+		}
+	}
+
+	emitter, err := service.NewEventEmitter(service.EventConfig{
+		NATSURL:           cfg.NATSURL,
+		NATSSubjectPrefix: cfg.NATSSubjectPrefix,
+		RedisURL:          cfg.RedisURL,
+		RedisStream:       cfg.RedisStream,
+	})
+	if err != nil {
+		log.Fatal("Failed to initialize event emitter:", err)
+	}
+	defer emitter.Close()
+
+	eventBus := events.NewBus()
+
+	var imagePatterns []string
+	if cfg.ContentImageRegex != "" {
+		imagePatterns = append(imagePatterns, cfg.ContentImageRegex)
+	}
+	imagePatterns = append(imagePatterns, cfg.ContentImageRegexes...)
+	// The patterns and the other settings parsed below were checked by
+	// cfg.Validate, so their errors are not handled again.
+	service.SetContentImagePatterns(imagePatterns)
+
 	postRepo := repository.NewPostRepository(db)
+	downloadLogRepo := repository.NewDownloadLogRepository(db)
+	idempotencyRepo := repository.NewIdempotencyRepository(db)
+	deliveryRepo := repository.NewWebhookDeliveryRepository(db)
+	filterRepo := repository.NewFeedFilterRepository(db)
+	retryQueueRepo := repository.NewRetryQueueRepository(db)
+	uploadRepo := repository.NewUploadRepository(db)
+	postFileRepo := repository.NewPostFileRepository(db)
+	fileHashRepo := repository.NewFileHashRepository(db)
+	feedRepo := repository.NewFeedRepository(db)
+	jobRunRepo := repository.NewJobRunRepository(db)
+	retryInterval := time.Duration(cfg.ChibisafeRetryIntervalMinutes) * time.Minute
+	filenameTemplate, _ := service.ParseFilenameTemplate(cfg.ChibisafeFilenameTemplate)
+	chibisafeProxyURL, _ := service.ParseProxyURL(cfg.ChibisafeProxyURL)
+	chibisafeCertPin, _ := service.ParseCertPin(cfg.ChibisafeCertPinSHA256)
 
-	chibisafeService := service.NewChibisafeService(cfg.ChibisafeAPIURL, cfg.ChibisafeAPIKey)
-	archiveService := service.NewArchiveService(cfg.ArchiveDir, chibisafeService, cfg.CleanupAfterUpload)
-	minifluxService := service.NewMinifluxService(cfg.MinifluxAPIURL, cfg.MinifluxAPIToken)
-	discordService := service.NewDiscordService(cfg.DiscordWebhookURL)
+	chibisafeService := service.NewChibisafeService(service.ChibisafeConfig{
+		APIURL:                  cfg.ChibisafeAPIURL,
+		APIKey:                  cfg.ChibisafeAPIKey,
+		APIKeyFile:              cfg.ChibisafeAPIKeyFile,
+		APIKeyRefreshURL:        cfg.ChibisafeAPIKeyRefreshURL,
+		ProxyURL:                chibisafeProxyURL,
+		InsecureTLS:             cfg.ChibisafeInsecureTLS,
+		CertPinSHA256:           chibisafeCertPin,
+		MaxFileSizeMB:           cfg.ChibisafeMaxFileSizeMB,
+		MaxSizeByMime:           cfg.ChibisafeMaxSizeByMime,
+		RetryQueue:              retryQueueRepo,
+		RetryInterval:           retryInterval,
+		GenerateVideoThumbnails: cfg.GenerateVideoThumbnails,
+		Uploads:                 uploadRepo,
+		FileHashes:              fileHashRepo,
+		FilenameTemplate:        filenameTemplate,
+		ExtraAlbums:             extraAlbums(cfg.ChibisafeExtraAlbums),
+	})
+	go chibisafeService.WatchAPIKey(context.Background())
+	archiveService := service.NewArchiveService(cfg.ArchiveDir, cfg.CategoryArchiveDirs, chibisafeService, postRepo, downloadLogRepo, postFileRepo, emitter, eventBus, cfg.CleanupAfterUpload)
+	archiveService.UpdateDiskUsage()
+	archiveService.SetGalleryDLOptions(galleryDLOptions(cfg))
+	archiveService.SetAuthorRateLimit(authorRateLimits(cfg))
+	archiveService.StartWorkers(int(cfg.DownloadWorkers))
+	minifluxService := service.NewMinifluxService(service.MinifluxConfig{
+		APIURL:   cfg.MinifluxAPIURL,
+		APIToken: cfg.MinifluxAPIToken,
+		Username: cfg.MinifluxUsername,
+		Password: cfg.MinifluxPassword,
 
-	webhookHandler := handler.NewWebhookHandler(cfg, postRepo, archiveService, minifluxService, discordService)
+		ClientID:     cfg.MinifluxClientID,
+		ClientSecret: cfg.MinifluxClientSecret,
+		TokenURL:     cfg.MinifluxTokenURL,
+	})
+	if minifluxService.IsConfigured() {
+		// Not fatal: the credentials may be fine while Miniflux is briefly
+		// unreachable or rate limiting.
+		ctx, cancel := context.WithTimeout(context.Background(), minifluxStartupCheckTimeout)
+		if user, err := minifluxService.GetUserInfo(ctx); err != nil {
+			log.Printf("WARNING: Could not verify the Miniflux credentials: %v", err)
+		} else {
+			log.Printf("Authenticated to Miniflux as %s", user.Username)
+		}
+		cancel()
+	}
+	if cfg.MinifluxArchivedStatus != "" {
+		archiveService.OnComplete(minifluxService.OnArchived(cfg.MinifluxArchivedStatus))
+	}
+	imageProxy, _ := service.NewImageProxy(cfg.DiscordImageProxyURL)
+	discordService := service.NewDiscordService(service.DiscordConfig{
+		WebhookURL:        cfg.DiscordWebhookURL,
+		CategoryWebhooks:  cfg.DiscordCategoryWebhooks,
+		SpoilerCategories: cfg.DiscordSpoilerCategories,
+		CategoryColors:    cfg.DiscordCategoryColors,
+		CategoryIcons:     cfg.DiscordCategoryIcons,
+		Miniflux:          minifluxService,
+		ForumMode:         cfg.DiscordForumMode,
+		ForumThreads:      repository.NewForumThreadRepository(db),
+		ImageProxy:        imageProxy,
+	}, postRepo)
+	if discordService != nil {
+		archiveService.OnComplete(discordService.NotifyArchiveResult)
+	}
 
-	http.HandleFunc("/webhook", webhookHandler.HandleWebhook)
-	http.HandleFunc("/health", healthHandler)
+	var notifiers []service.NotifierRoute
+	if telegramService := service.NewTelegramService(service.TelegramConfig{
+		BotToken: cfg.TelegramBotToken,
+		ChatID:   cfg.TelegramChatID,
+	}); telegramService != nil {
+		notifiers = append(notifiers, service.NotifierRoute{Notifier: telegramService, Categories: cfg.TelegramCategories})
+	}
+	if ntfyService := service.NewNtfyService(service.NtfyConfig{
+		ServerURL:          cfg.NtfyURL,
+		Topic:              cfg.NtfyTopic,
+		Token:              cfg.NtfyToken,
+		CategoryPriorities: cfg.NtfyCategoryPriorities,
+	}); ntfyService != nil {
+		notifiers = append(notifiers, service.NotifierRoute{Notifier: ntfyService, Categories: cfg.NtfyCategories})
+	}
+	if gotifyService := service.NewGotifyService(service.GotifyConfig{
+		ServerURL:          cfg.GotifyURL,
+		AppToken:           cfg.GotifyAppToken,
+		CategoryPriorities: cfg.GotifyCategoryPriorities,
+	}); gotifyService != nil {
+		notifiers = append(notifiers, service.NotifierRoute{Notifier: gotifyService, Categories: cfg.GotifyCategories})
+	}
+	if pushoverService := service.NewPushoverService(service.PushoverConfig{
+		UserKey:            cfg.PushoverUserKey,
+		AppToken:           cfg.PushoverAppToken,
+		AuthorPriorities:   cfg.PushoverAuthorPriorities,
+		CategoryPriorities: cfg.PushoverCategoryPriorities,
+		AuthorSounds:       cfg.PushoverAuthorSounds,
+		CategorySounds:     cfg.PushoverCategorySounds,
+	}); pushoverService != nil {
+		notifiers = append(notifiers, service.NotifierRoute{Notifier: pushoverService, Categories: cfg.PushoverCategories})
+	}
+	if slackService := service.NewSlackService(service.SlackConfig{
+		WebhookURL:       cfg.SlackWebhookURL,
+		CategoryWebhooks: cfg.SlackCategoryWebhooks,
+	}); slackService != nil {
+		notifiers = append(notifiers, service.NotifierRoute{Notifier: slackService, Categories: cfg.SlackCategories})
+	}
+	emailService := service.NewEmailService(service.EmailConfig{
+		Host:     cfg.SMTPHost,
+		Port:     int(cfg.SMTPPort),
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+		To:       cfg.SMTPTo,
+		TLSMode:  cfg.SMTPTLS,
+	})
+	if emailService != nil && cfg.EmailNotifyPosts {
+		notifiers = append(notifiers, service.NotifierRoute{Notifier: emailService, Categories: cfg.EmailCategories})
+	}
+	if outgoingWebhook := service.NewOutgoingWebhookService(service.OutgoingWebhookConfig{
+		URL:    cfg.OutgoingWebhookURL,
+		Secret: cfg.OutgoingWebhookSecret,
+	}, postRepo); outgoingWebhook != nil {
+		route := service.NotifierRoute{}
+		events := cfg.OutgoingWebhookEvents
+		if len(events) == 0 {
+			events = []string{service.OutgoingEventCompleted}
+		}
+		for _, event := range events {
+			switch event {
+			case service.OutgoingEventReceived:
+				route.Notifier = outgoingWebhook
+			case service.OutgoingEventCompleted:
+				route.ArchiveNotifier = outgoingWebhook
+			}
+		}
+		notifiers = append(notifiers, route)
+	}
+	notifications := service.NewNotificationDispatcher(notifiers)
+	if notifications != nil {
+		archiveService.OnComplete(notifications.DispatchArchived)
+	}
+
+	requeueDownloads(postRepo, archiveService)
+
+	tasks := scheduler.New()
+
+	cleanupJob := job.NewCleanupJob(postRepo, archiveService, idempotencyRepo, deliveryRepo, archiveService.ArchiveRoots(), int(cfg.MaxRetries))
+	addTask(tasks, "cleanup", cronSpec(cfg.CronCleanup, time.Duration(cfg.CleanupIntervalHours)*time.Hour), cleanupJob.Run)
+
+	retryProcessor := job.NewRetryQueueProcessor(retryQueueRepo, chibisafeService, archiveService, retryInterval, int(cfg.MaxUploadRetries))
+	addTask(tasks, "upload-retry", cronSpec(cfg.CronRetryQueue, retryInterval), retryProcessor.Run)
+
+	if emailService != nil {
+		failureReport := job.NewFailureReportJob(postRepo, jobRunRepo, emailService)
+		addTask(tasks, "failure-report", cronSpec(cfg.CronFailureReport, time.Duration(cfg.EmailFailureReportHours)*time.Hour), failureReport.Run)
+	}
+
+	if minifluxService.IsConfigured() {
+		syncJob := job.NewMinifluxSyncJob(minifluxService, feedRepo)
+		addTask(tasks, "miniflux-sync", cronSpec(cfg.CronMinifluxSync, time.Duration(cfg.MinifluxSyncHours)*time.Hour), syncJob.Run)
+		if err := tasks.Trigger("miniflux-sync"); err != nil {
+			log.Printf("Miniflux sync not run at startup: %v", err)
+		}
+	}
+
+	resticService := service.NewResticService(service.ResticConfig{
+		Repository: cfg.ResticRepository,
+		Password:   cfg.ResticPassword,
+		Paths:      archiveService.ArchiveRoots(),
+		KeepDaily:  7,
+		KeepWeekly: 4,
+	})
+	if resticService != nil {
+		backupJob := job.NewBackupJob(resticService, discordService)
+		addTask(tasks, "backup", cfg.ResticBackupCron, backupJob.Run)
+	}
+	tasks.Start()
+
+	jobService := service.NewJobService(postRepo, downloadLogRepo, retryQueueRepo, archiveService, int(cfg.MaxUploadRetries), func() {
+		if err := tasks.Trigger("upload-retry"); err != nil {
+			log.Printf("Upload retry not triggered: %v", err)
+		}
+	})
+
+	webhookHandler := handler.NewWebhookHandler(cfg, postRepo, idempotencyRepo, deliveryRepo, filterRepo, archiveService, minifluxService, discordService, notifications, emitter, eventBus)
+	adminHandler := handler.NewAdminHandler(discordService)
+	postHandler := handler.NewPostHandler(postRepo, downloadLogRepo, postFileRepo, archiveService, discordService, minifluxService, cfg.ContentSanitize)
+	feedHandler := handler.NewFeedHandler(postRepo, uploadRepo)
+	statsHandler := handler.NewStatsHandler(postRepo, feedRepo)
+	feedFilterHandler := handler.NewFeedFilterHandler(filterRepo)
+	authorHandler := handler.NewAuthorHandler(postRepo)
+	uiHandler := handler.NewUIHandler(cfg.AdminAPIKey)
+	jobHandler := handler.NewJobHandler(jobService)
+	exportHandler := handler.NewExportHandler(postRepo, postFileRepo)
+	importHandler := handler.NewImportHandler(archiveService)
+	searchHandler := handler.NewSearchHandler(postRepo)
+	healthHandler := handler.NewHealthHandler(db, archiveService, chibisafeService, discordService, minifluxService, retryQueueRepo, tasks, startedAt)
+	pingHandler := handler.NewPingHandler(db, minifluxService, chibisafeService, discordService)
+	eventsHandler := handler.NewEventsHandler(eventBus)
+
+	apiMux := http.NewServeMux()
+	apiMux.HandleFunc("GET /api/posts", postHandler.HandleList)
+	apiMux.HandleFunc("GET /api/posts/{hash}", postHandler.HandleGet)
+	apiMux.HandleFunc("PATCH /api/posts/{hash}", postHandler.HandlePatch)
+	apiMux.HandleFunc("DELETE /api/posts/{hash}", postHandler.HandleDelete)
+	apiMux.HandleFunc("GET /api/search", searchHandler.HandleSearch)
+	apiMux.HandleFunc("GET /api/posts/{hash}/download-log", postHandler.HandleDownloadLog)
+	apiMux.HandleFunc("GET /api/posts/{hash}/files", postHandler.HandleFiles)
+	apiMux.HandleFunc("POST /api/posts/{hash}/discord", postHandler.HandleResendDiscord)
+	apiMux.HandleFunc("POST /api/posts/{hash}/refresh-content", postHandler.HandleRefreshContent)
+	apiMux.HandleFunc("POST /api/posts/{hash}/redownload", postHandler.HandleRedownload)
+	apiMux.HandleFunc("POST /api/posts/{hash}/reupload", postHandler.HandleReupload)
+	apiMux.HandleFunc("GET /api/health", healthHandler.HandleDetails)
+	apiMux.HandleFunc("GET /api/ping", pingHandler.HandlePing)
+	apiMux.HandleFunc("GET /api/stats", statsHandler.HandleStats)
+	apiMux.HandleFunc("GET /api/stats/downloads", statsHandler.HandleDownloads)
+	apiMux.HandleFunc("GET /api/feeds/{id}/stats", statsHandler.HandleFeed)
+	apiMux.HandleFunc("GET /api/feeds/{id}/filters", feedFilterHandler.HandleList)
+	apiMux.HandleFunc("POST /api/feeds/{id}/filters", feedFilterHandler.HandleCreate)
+	apiMux.HandleFunc("DELETE /api/feeds/{id}/filters/{filterID}", feedFilterHandler.HandleDelete)
+	apiMux.HandleFunc("GET /api/authors", authorHandler.HandleList)
+	apiMux.HandleFunc("GET /api/jobs", jobHandler.HandleList)
+	apiMux.HandleFunc("POST /api/jobs/{id}/retry", jobHandler.HandleRetry)
+	apiMux.HandleFunc("POST /api/jobs/retry-all", jobHandler.HandleRetryAll)
+	apiMux.HandleFunc("GET /api/export", exportHandler.HandleExport)
+	apiMux.HandleFunc("POST /api/import", importHandler.HandleImport)
+
+	limitWebhook := func(h http.Handler) http.Handler { return h }
+	if cfg.WebhookRateLimitPerMinute > 0 {
+		perMinute := cfg.WebhookRateLimitPerMinute
+		limitWebhook = handler.RateLimitMiddleware(float64(perMinute)/60, int(perMinute))
+	}
+
+	http.Handle("/webhook", limitWebhook(http.HandlerFunc(webhookHandler.HandleWebhook)))
+	http.Handle("/webhook/freshrss", limitWebhook(http.HandlerFunc(webhookHandler.HandleFreshRSS)))
+	http.Handle("/webhook/ttrss", limitWebhook(http.HandlerFunc(webhookHandler.HandleTTRSS)))
+	http.HandleFunc("/health", healthHandler.HandleReady)
+	http.HandleFunc("/livez", healthHandler.HandleLive)
+	http.HandleFunc("/readyz", healthHandler.HandleReady)
+	http.HandleFunc("GET /health/details", healthHandler.HandleDetails)
+	http.Handle("GET /ws", eventsHandler)
+	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/api/", handler.GzipMiddleware(handler.JSONErrors(apiMux)))
+	http.Handle("GET /feed.xml", handler.GzipMiddleware(http.HandlerFunc(feedHandler.HandleAtom)))
+	http.Handle("GET /feed.json", handler.GzipMiddleware(http.HandlerFunc(feedHandler.HandleJSON)))
+	http.Handle("GET /ui/", uiHandler)
+	http.HandleFunc("POST /ui/login", uiHandler.HandleLogin)
+	http.HandleFunc("POST /ui/logout", uiHandler.HandleLogout)
+	// Admin endpoints are disabled rather than open when ADMIN_API_KEY is
+	// unset, even for GET.
+	http.HandleFunc("/admin/discord/test", handler.RequireAPIKey(cfg.AdminAPIKey, adminHandler.HandleDiscordTest))
+	http.HandleFunc("/admin/backfill", handler.RequireAPIKey(cfg.AdminAPIKey, webhookHandler.HandleBackfill))
 
 	log.Printf("🚀 Server starting on port %s", cfg.Port)
 	log.Printf("💾 Database: %s", cfg.DBPath)
 	log.Printf("📁 Archive directory: %s", cfg.ArchiveDir)
+	for category, dir := range cfg.CategoryArchiveDirs {
+		log.Printf("📁 Archive directory for %s: %s", category, dir)
+	}
 	if cfg.CleanupAfterUpload {
 		log.Printf("🧹 Cleanup after upload: ENABLED")
 	} else {
@@ -67,29 +392,205 @@ func main() {
 	}
 	if chibisafeService.IsConfigured() {
 		log.Printf("☁️ Chibisafe: %s", cfg.ChibisafeAPIURL)
+		if chibisafeProxyURL != nil {
+			log.Printf("☁️ Chibisafe proxy: %s", chibisafeProxyURL.Redacted())
+		}
+	}
+	if cfg.TelegramBotToken != "" && cfg.TelegramChatID != "" {
+		log.Printf("✈️ Telegram notifications: chat %s", cfg.TelegramChatID)
+	}
+	if cfg.NtfyURL != "" && cfg.NtfyTopic != "" {
+		log.Printf("🔔 ntfy notifications: %s/%s", cfg.NtfyURL, cfg.NtfyTopic)
+	}
+	if cfg.GotifyURL != "" && cfg.GotifyAppToken != "" {
+		log.Printf("🔔 Gotify notifications: %s", cfg.GotifyURL)
+	}
+	if cfg.PushoverUserKey != "" && cfg.PushoverAppToken != "" {
+		log.Printf("🔔 Pushover notifications enabled")
+	}
+	if cfg.SlackWebhookURL != "" || len(cfg.SlackCategoryWebhooks) > 0 {
+		log.Printf("💬 Slack notifications: ENABLED")
+	}
+	if emailService != nil {
+		log.Printf("📧 Email via %s to %s", cfg.SMTPHost, strings.Join(cfg.SMTPTo, ", "))
+	}
+	if cfg.OutgoingWebhookURL != "" {
+		log.Printf("🔗 Outgoing webhook: %s", cfg.OutgoingWebhookURL)
+	}
+	if cfg.OtelExporterEndpoint != "" {
+		log.Printf("🔭 Tracing: %s", cfg.OtelExporterEndpoint)
+	}
+	if resticService != nil {
+		log.Printf("🗄️ Restic backups: %s (%s)", cfg.ResticRepository, cfg.ResticBackupCron)
 	}
 	log.Printf("")
 	log.Printf("📡 Available endpoints:")
 	log.Printf("   Health Check: http://localhost:%s/health", cfg.Port)
+	log.Printf("   Liveness:     http://localhost:%s/livez", cfg.Port)
+	log.Printf("   Readiness:    http://localhost:%s/readyz", cfg.Port)
+	log.Printf("   Health Details: http://localhost:%s/health/details", cfg.Port)
+	log.Printf("   Ping:         http://localhost:%s/api/ping", cfg.Port)
 	log.Printf("   Webhook:      http://localhost:%s/webhook", cfg.Port)
+	if cfg.FreshRSSWebhookToken != "" {
+		log.Printf("   FreshRSS:     http://localhost:%s/webhook/freshrss", cfg.Port)
+	}
+	if cfg.TTRSSWebhookSecret != "" {
+		log.Printf("   Tiny Tiny RSS: http://localhost:%s/webhook/ttrss", cfg.Port)
+	}
+	log.Printf("   Feed:         http://localhost:%s/feed.xml", cfg.Port)
+	log.Printf("   JSON Feed:    http://localhost:%s/feed.json", cfg.Port)
+	log.Printf("   Web UI:       http://localhost:%s/ui/", cfg.Port)
+	log.Printf("   Posts:        http://localhost:%s/api/posts", cfg.Port)
+	log.Printf("   Search:       http://localhost:%s/api/search?q=", cfg.Port)
+	log.Printf("   Stats:        http://localhost:%s/api/stats", cfg.Port)
+	log.Printf("   Downloads:    http://localhost:%s/api/stats/downloads", cfg.Port)
+	log.Printf("   Authors:      http://localhost:%s/api/authors", cfg.Port)
+	log.Printf("   Jobs:         http://localhost:%s/api/jobs", cfg.Port)
+	log.Printf("   Export:       http://localhost:%s/api/export?format=json", cfg.Port)
+	log.Printf("   Metrics:      http://localhost:%s/metrics", cfg.Port)
+	log.Printf("   Events:       ws://localhost:%s/ws", cfg.Port)
+	if cfg.AdminAPIKey == "" {
+		log.Printf("🔒 Admin endpoints: DISABLED, API read-only and open, export, metrics and events localhost only (set ADMIN_API_KEY to enable)")
+	} else {
+		log.Printf("🔒 API key required on all endpoints but the webhooks and the health probes")
+	}
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		log.Printf("🌐 CORS allowed for: %s", strings.Join(cfg.CORSAllowedOrigins, ", "))
+	}
 	log.Printf("")
 	log.Printf("✅ Server is ready to receive requests!")
 	
-	if err := http.ListenAndServe(":"+cfg.Port, nil); err != nil {
+	server := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: handler.CORSMiddleware(cfg.CORSAllowedOrigins, handler.APIKeyMiddleware(cfg.AdminAPIKey, http.DefaultServeMux)),
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	select {
+	case err := <-serverErr:
 		log.Fatal("⛔ Server failed to start:", err)
+	case <-ctx.Done():
+	}
+
+	// A second signal while draining stops the server right away.
+	stop()
+	log.Printf("🛑 Shutting down...")
+	healthHandler.Drain()
+	if drain := time.Duration(cfg.ShutdownDrainSeconds) * time.Second; drain > 0 {
+		log.Printf("Draining traffic for %s", drain)
+		time.Sleep(drain)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down the server: %v", err)
 	}
+	tasks.Stop()
 }
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	
-	response := map[string]interface{}{
-		"status": "OK",
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
-		"service": "lewdarchive",
-		"version": "1.1.2",
+// shutdownTimeout bounds how long in-flight requests may take to finish on
+// shutdown.
+const shutdownTimeout = 30 * time.Second
+
+// minifluxStartupCheckTimeout bounds the credentials check at startup.
+const minifluxStartupCheckTimeout = 10 * time.Second
+
+// requeueDownloads queues again the downloads the server was running or had
+// pending when it last stopped.
+func requeueDownloads(postRepo *repository.PostRepository, archiveService *service.ArchiveService) {
+	interrupted, err := postRepo.ResetStuckDownloads(time.Now())
+	if err != nil {
+		log.Printf("Error resetting interrupted downloads: %v", err)
+		return
 	}
-	
-	json.NewEncoder(w).Encode(response)
-}
\ No newline at end of file
+	pending, err := postRepo.List(repository.PostFilter{Status: model.DownloadStatusPending})
+	if err != nil {
+		log.Printf("Error listing pending downloads: %v", err)
+		return
+	}
+	if len(pending) > 0 {
+		log.Printf("Requeueing %d pending downloads, %d of them interrupted", len(pending), len(interrupted))
+		archiveService.Requeue(context.Background(), pending)
+	}
+}
+
+// cronSpec returns the CRON_* schedule of a task, falling back to running it
+// every interval.
+func cronSpec(spec string, interval time.Duration) string {
+	if spec != "" {
+		return spec
+	}
+	return scheduler.Every(interval)
+}
+
+// addTask registers a scheduled task. Its schedule was checked by
+// cfg.Validate.
+func addTask(tasks *scheduler.Scheduler, name, spec string, run scheduler.Task) {
+	if err := tasks.Add(name, spec, run); err != nil {
+		log.Printf("Error scheduling task %s: %v", name, err)
+	}
+}
+
+// galleryDLOptions builds the global gallery-dl options and applies
+// FEED_OVERRIDES on top of them. Config files that can't be read only warn,
+// since gallery-dl may still run with its defaults.
+func galleryDLOptions(cfg config.Config) (service.GalleryDLOptions, map[int]service.GalleryDLOptions) {
+	defaults := service.GalleryDLOptions{
+		ConfigFile: cfg.GalleryDLConfigFile,
+		NoConfig:   cfg.GalleryDLNoConfig,
+	}
+	checkGalleryDLConfigFile("GALLERY_DL_CONFIG_FILE", defaults.ConfigFile)
+
+	perFeed := make(map[int]service.GalleryDLOptions)
+	for feedID, override := range cfg.FeedOverrides {
+		opts := defaults
+		if override.GalleryDLConfigFile != "" {
+			opts.ConfigFile = override.GalleryDLConfigFile
+			checkGalleryDLConfigFile(fmt.Sprintf("FEED_OVERRIDES feed %d", feedID), opts.ConfigFile)
+		}
+		if override.GalleryDLNoConfig != nil {
+			opts.NoConfig = *override.GalleryDLNoConfig
+		}
+		perFeed[feedID] = opts
+	}
+	return defaults, perFeed
+}
+
+// authorRateLimits returns AUTHOR_DOWNLOAD_RATE_PER_MINUTE and its
+// replacements from FEED_OVERRIDES.
+func authorRateLimits(cfg config.Config) (float64, map[int]float64) {
+	perFeed := make(map[int]float64)
+	for feedID, override := range cfg.FeedOverrides {
+		if override.AuthorDownloadRatePerMinute != nil {
+			perFeed[feedID] = *override.AuthorDownloadRatePerMinute
+		}
+	}
+	return cfg.AuthorDownloadRatePerMinute, perFeed
+}
+
+// extraAlbums converts CHIBISAFE_EXTRA_ALBUMS into the service type.
+func extraAlbums(albums []config.ChibisafeExtraAlbum) []service.ExtraAlbum {
+	result := make([]service.ExtraAlbum, 0, len(albums))
+	for _, album := range albums {
+		result = append(result, service.ExtraAlbum{
+			Name:        album.Name,
+			AddAllPosts: album.AddAllPosts,
+			Categories:  album.Categories,
+		})
+	}
+	return result
+}
+
+func checkGalleryDLConfigFile(source, path string) {
+	if path == "" {
+		return
+	}
+	if err := service.CheckGalleryDLConfigFile(path); err != nil {
+		log.Printf("WARNING: gallery-dl config file from %s is not readable: %v", source, err)
+	}
+}
@@ -1,33 +1,307 @@
 package config
 
-import "os"
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
 
 type Config struct {
-	Port               string
-	DBPath             string
-	MinifluxSecretKey  string
-	MinifluxAPIURL     string
-	MinifluxAPIToken   string
-	ArchiveDir         string
-	DiscordWebhookURL  string
-	ChibisafeAPIURL    string
-	ChibisafeAPIKey    string
-	CleanupAfterUpload bool
+	Port                      string
+	ShutdownDrainSeconds      int64
+	DBPath                    string
+	MinifluxSecretKey         string
+	MinifluxSecretPrevious    string
+	MinifluxSecrets           map[string]string
+	MinifluxAPIURL            string
+	MinifluxAPIToken          string
+	MinifluxUsername          string
+	MinifluxPassword          string
+	MinifluxClientID          string
+	MinifluxClientSecret      string
+	MinifluxTokenURL          string
+	FetchOriginalContent      bool
+	ContentSanitize           bool
+	MinifluxEntryAction       string
+	MinifluxArchivedStatus    string
+	RedownloadOnUpdate        bool
+	ArchiveDir                string
+	DiscordWebhookURL         string
+	ChibisafeAPIURL           string
+	ChibisafeAPIKey           string
+	ChibisafeAPIKeyFile       string
+	ChibisafeAPIKeyRefreshURL string
+	ChibisafeProxyURL         string
+	ChibisafeInsecureTLS      bool
+	ChibisafeCertPinSHA256    string
+	CleanupAfterUpload        bool
+
+	DiscordCategoryWebhooks   map[string]string
+	AdminAPIKey               string
+	CORSAllowedOrigins        []string
+	CategoryArchiveDirs       map[string]string
+	DiscordSpoilerCategories  []string
+	ChibisafeMaxFileSizeMB    int64
+	ChibisafeMaxSizeByMime    map[string]int64
+	GenerateVideoThumbnails   bool
+	ChibisafeFilenameTemplate string
+	ChibisafeExtraAlbums      []ChibisafeExtraAlbum
+
+	NATSURL           string
+	NATSSubjectPrefix string
+	RedisURL          string
+	RedisStream       string
+
+	CleanupIntervalHours        int64
+	MaxRetries                  int64
+	DownloadWorkers             int64
+	AuthorDownloadRatePerMinute float64
+	MinifluxSyncHours           int64
+
+	ChibisafeRetryIntervalMinutes int64
+	MaxUploadRetries              int64
+
+	TelegramBotToken   string
+	TelegramChatID     string
+	TelegramCategories []string
+
+	DiscordCategoryColors map[string]int
+	DiscordCategoryIcons  map[string]string
+	DiscordForumMode      bool
+	DiscordImageProxyURL  string
+	ContentImageRegex     string
+	ContentImageRegexes   []string
+
+	NtfyURL                string
+	NtfyTopic              string
+	NtfyToken              string
+	NtfyCategoryPriorities map[string]int
+	NtfyCategories         []string
+
+	GotifyURL                string
+	GotifyAppToken           string
+	GotifyCategoryPriorities map[string]int
+	GotifyCategories         []string
+
+	PushoverUserKey            string
+	PushoverAppToken           string
+	PushoverAuthorPriorities   map[string]int
+	PushoverCategoryPriorities map[string]int
+	PushoverAuthorSounds       map[string]string
+	PushoverCategorySounds     map[string]string
+	PushoverCategories         []string
+
+	OutgoingWebhookURL    string
+	OutgoingWebhookSecret string
+	OutgoingWebhookEvents []string
+
+	SMTPHost                string
+	SMTPPort                int64
+	SMTPUsername            string
+	SMTPPassword            string
+	SMTPFrom                string
+	SMTPTo                  []string
+	SMTPTLS                 string
+	EmailNotifyPosts        bool
+	EmailCategories         []string
+	EmailFailureReportHours int64
+
+	SlackWebhookURL       string
+	SlackCategoryWebhooks map[string]string
+	SlackCategories       []string
+
+	WebhookSuccessResponseBody string
+	WebhookSuccessContentType  string
+	WebhookRateLimitPerMinute  int64
+	WebhookMaxBodyMB           int64
+	WebhookEntryParallelism    int64
+	WebhookDedupWindowMinutes  int64
+	FreshRSSWebhookToken       string
+	TTRSSWebhookSecret         string
+
+	OtelExporterEndpoint string
+
+	GalleryDLConfigFile string
+	GalleryDLNoConfig   bool
+	FeedOverrides       map[int]FeedOverride
+
+	ResticRepository string
+	ResticPassword   string
+	ResticBackupCron string
+
+	// CRON_* schedules of the maintenance tasks. Empty ones fall back to the
+	// matching *_INTERVAL_* setting.
+	CronCleanup       string
+	CronRetryQueue    string
+	CronFailureReport string
+	CronMinifluxSync  string
+
+	// parseErrs holds the values Load could not parse; Validate reports them.
+	parseErrs []error
+}
+
+// ChibisafeExtraAlbum is an album from CHIBISAFE_EXTRA_ALBUMS that receives a
+// copy of every post, or of the posts in its categories.
+type ChibisafeExtraAlbum struct {
+	Name        string   `json:"name"`
+	AddAllPosts bool     `json:"addAllPosts"`
+	Categories  []string `json:"categories"`
+}
+
+// FeedOverride holds per-feed settings from FEED_OVERRIDES, keyed by Miniflux
+// feed ID. Unset fields keep the global value.
+type FeedOverride struct {
+	GalleryDLConfigFile         string   `json:"gallery_dl_config_file"`
+	GalleryDLNoConfig           *bool    `json:"gallery_dl_no_config"`
+	AuthorDownloadRatePerMinute *float64 `json:"author_download_rate_per_minute"`
 }
 
 func Load() Config {
-	return Config{
-		Port:               getEnv("PORT", "8080"),
-		DBPath:             getEnv("DB_PATH", "./data/lewdarchive.db"),
-		MinifluxSecretKey:  getEnv("MINIFLUX_SECRET", ""),
-		MinifluxAPIURL:     getEnv("MINIFLUX_API_URL", ""),
-		MinifluxAPIToken:   getEnv("MINIFLUX_API_TOKEN", ""),
-		ArchiveDir:         getEnv("ARCHIVE_DIR", "./data/archive"),
-		DiscordWebhookURL:  getEnv("DISCORD_WEBHOOK_URL", ""),
-		ChibisafeAPIURL:    getEnv("CHIBISAFE_API_URL", ""),
-		ChibisafeAPIKey:    getEnv("CHIBISAFE_API_KEY", ""),
-		CleanupAfterUpload: getBoolEnv("CLEANUP_AFTER_UPLOAD", false),
+	p := &envParser{}
+	cfg := Config{
+		Port:                      getEnv("PORT", "8080"),
+		ShutdownDrainSeconds:      p.getInt64Env("SHUTDOWN_DRAIN_SECONDS", 5),
+		DBPath:                    getEnv("DB_PATH", "./data/lewdarchive.db"),
+		MinifluxSecretKey:         getEnv("MINIFLUX_SECRET", ""),
+		MinifluxSecretPrevious:    getEnv("MINIFLUX_SECRET_PREVIOUS", ""),
+		MinifluxSecrets:           p.getJSONMapEnv("MINIFLUX_SECRETS"),
+		MinifluxAPIURL:            getEnv("MINIFLUX_API_URL", ""),
+		MinifluxAPIToken:          getEnv("MINIFLUX_API_TOKEN", ""),
+		MinifluxUsername:          getEnv("MINIFLUX_USERNAME", ""),
+		MinifluxPassword:          getEnv("MINIFLUX_PASSWORD", ""),
+		MinifluxClientID:          getEnv("MINIFLUX_CLIENT_ID", ""),
+		MinifluxClientSecret:      getEnv("MINIFLUX_CLIENT_SECRET", ""),
+		MinifluxTokenURL:          getEnv("MINIFLUX_TOKEN_URL", ""),
+		FetchOriginalContent:      getBoolEnv("FETCH_ORIGINAL_CONTENT", false),
+		ContentSanitize:           getBoolEnv("CONTENT_SANITIZE", true),
+		MinifluxEntryAction:       getEnv("MINIFLUX_ENTRY_ACTION", "read"),
+		MinifluxArchivedStatus:    getEnv("MINIFLUX_ARCHIVED_STATUS", ""),
+		RedownloadOnUpdate:        getBoolEnv("REDOWNLOAD_ON_UPDATE", false),
+		ArchiveDir:                getEnv("ARCHIVE_DIR", absPath("./data/archive")),
+		DiscordWebhookURL:         getEnv("DISCORD_WEBHOOK_URL", ""),
+		ChibisafeAPIURL:           getEnv("CHIBISAFE_API_URL", ""),
+		ChibisafeAPIKey:           getEnv("CHIBISAFE_API_KEY", ""),
+		ChibisafeAPIKeyFile:       getEnv("CHIBISAFE_API_KEY_FILE", ""),
+		ChibisafeAPIKeyRefreshURL: getEnv("CHIBISAFE_API_KEY_REFRESH_URL", ""),
+		ChibisafeProxyURL:         getEnv("CHIBISAFE_PROXY_URL", ""),
+		ChibisafeInsecureTLS:      getBoolEnv("CHIBISAFE_INSECURE_TLS", false),
+		ChibisafeCertPinSHA256:    getEnv("CHIBISAFE_CERT_PIN_SHA256", ""),
+		CleanupAfterUpload:        getBoolEnv("CLEANUP_AFTER_UPLOAD", false),
+
+		DiscordCategoryWebhooks:   getMapEnv("DISCORD_CATEGORY_WEBHOOKS"),
+		AdminAPIKey:               getEnv("ADMIN_API_KEY", ""),
+		CORSAllowedOrigins:        getListEnv("CORS_ALLOWED_ORIGINS"),
+		CategoryArchiveDirs:       p.getJSONMapEnv("CATEGORY_ARCHIVE_DIRS"),
+		DiscordSpoilerCategories:  getListEnv("DISCORD_SPOILER_CATEGORIES"),
+		ChibisafeMaxFileSizeMB:    p.getInt64Env("CHIBISAFE_MAX_FILE_SIZE_MB", 500),
+		ChibisafeMaxSizeByMime:    p.getInt64MapEnv("CHIBISAFE_MAX_SIZE_BY_MIME"),
+		GenerateVideoThumbnails:   getBoolEnv("GENERATE_VIDEO_THUMBNAILS", true),
+		ChibisafeFilenameTemplate: getEnv("CHIBISAFE_FILENAME_TEMPLATE", ""),
+		ChibisafeExtraAlbums:      p.getExtraAlbumsEnv("CHIBISAFE_EXTRA_ALBUMS"),
+
+		NATSURL:           getEnv("NATS_URL", ""),
+		NATSSubjectPrefix: getEnv("NATS_SUBJECT_PREFIX", "lewdarchive"),
+		RedisURL:          getEnv("REDIS_URL", ""),
+		RedisStream:       getEnv("REDIS_STREAM", "lewdarchive:events"),
+
+		CleanupIntervalHours:        p.getInt64Env("CLEANUP_INTERVAL_HOURS", 6),
+		MaxRetries:                  p.getInt64Env("MAX_RETRIES", 3),
+		DownloadWorkers:             p.getInt64Env("DOWNLOAD_WORKERS", 4),
+		AuthorDownloadRatePerMinute: p.getFloatEnv("AUTHOR_DOWNLOAD_RATE_PER_MINUTE", 2),
+		MinifluxSyncHours:           p.getInt64Env("MINIFLUX_SYNC_INTERVAL_HOURS", 6),
+
+		ChibisafeRetryIntervalMinutes: p.getInt64Env("CHIBISAFE_RETRY_INTERVAL_MINUTES", 15),
+		MaxUploadRetries:              p.getInt64Env("MAX_UPLOAD_RETRIES", 5),
+
+		TelegramBotToken:   getEnv("TELEGRAM_BOT_TOKEN", ""),
+		TelegramChatID:     getEnv("TELEGRAM_CHAT_ID", ""),
+		TelegramCategories: getListEnv("TELEGRAM_CATEGORIES"),
+
+		DiscordCategoryColors: p.getColorMapEnv("DISCORD_CATEGORY_COLORS"),
+		DiscordCategoryIcons:  p.getURLMapEnv("DISCORD_CATEGORY_ICONS"),
+		DiscordForumMode:      getBoolEnv("DISCORD_FORUM_MODE", false),
+		DiscordImageProxyURL:  getEnv("DISCORD_IMAGE_PROXY_URL", ""),
+		ContentImageRegex:     getEnv("CONTENT_IMAGE_REGEX", ""),
+		ContentImageRegexes:   getSplitEnv("CONTENT_IMAGE_REGEXES", contentImageRegexSeparator),
+
+		NtfyURL:                getEnv("NTFY_URL", ""),
+		NtfyTopic:              getEnv("NTFY_TOPIC", ""),
+		NtfyToken:              getEnv("NTFY_TOKEN", ""),
+		NtfyCategoryPriorities: p.getRangeMapEnv("NTFY_CATEGORY_PRIORITIES", 1, 5),
+		NtfyCategories:         getListEnv("NTFY_CATEGORIES"),
+
+		GotifyURL:                getEnv("GOTIFY_URL", ""),
+		GotifyAppToken:           getEnv("GOTIFY_APP_TOKEN", getEnv("GOTIFY_TOKEN", "")),
+		GotifyCategoryPriorities: p.getRangeMapEnv("GOTIFY_CATEGORY_PRIORITIES", 0, 10),
+		GotifyCategories:         getListEnv("GOTIFY_CATEGORIES"),
+
+		PushoverUserKey:            getEnv("PUSHOVER_USER_KEY", ""),
+		PushoverAppToken:           getEnv("PUSHOVER_APP_TOKEN", ""),
+		PushoverAuthorPriorities:   p.getRangeMapEnv("PUSHOVER_AUTHOR_PRIORITIES", -2, 2),
+		PushoverCategoryPriorities: p.getRangeMapEnv("PUSHOVER_CATEGORY_PRIORITIES", -2, 2),
+		PushoverAuthorSounds:       getMapEnv("PUSHOVER_AUTHOR_SOUNDS"),
+		PushoverCategorySounds:     getMapEnv("PUSHOVER_CATEGORY_SOUNDS"),
+		PushoverCategories:         getListEnv("PUSHOVER_CATEGORIES"),
+
+		OutgoingWebhookURL:    getEnv("OUTGOING_WEBHOOK_URL", ""),
+		OutgoingWebhookSecret: getEnv("OUTGOING_WEBHOOK_SECRET", ""),
+		OutgoingWebhookEvents: getListEnv("OUTGOING_WEBHOOK_EVENTS"),
+
+		SMTPHost:                getEnv("SMTP_HOST", ""),
+		SMTPPort:                p.getInt64Env("SMTP_PORT", 587),
+		SMTPUsername:            getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:            getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:                getEnv("SMTP_FROM", ""),
+		SMTPTo:                  getListEnv("SMTP_TO"),
+		SMTPTLS:                 getEnv("SMTP_TLS", "starttls"),
+		EmailNotifyPosts:        getBoolEnv("EMAIL_NOTIFY_POSTS", false),
+		EmailCategories:         getListEnv("EMAIL_CATEGORIES"),
+		EmailFailureReportHours: p.getInt64Env("EMAIL_FAILURE_REPORT_HOURS", 24),
+
+		SlackWebhookURL:       getEnv("SLACK_WEBHOOK_URL", ""),
+		SlackCategoryWebhooks: getMapEnv("SLACK_CATEGORY_WEBHOOKS"),
+		SlackCategories:       getListEnv("SLACK_CATEGORIES"),
+
+		WebhookSuccessResponseBody: getEnv("WEBHOOK_SUCCESS_RESPONSE_BODY", ""),
+		WebhookSuccessContentType:  getEnv("WEBHOOK_SUCCESS_CONTENT_TYPE", "text/plain"),
+		WebhookRateLimitPerMinute:  p.getInt64Env("WEBHOOK_RATE_LIMIT_PER_MINUTE", 60),
+		WebhookMaxBodyMB:           p.getInt64Env("WEBHOOK_MAX_BODY_MB", 10),
+		WebhookEntryParallelism:    p.getInt64Env("WEBHOOK_ENTRY_PARALLELISM", 5),
+		WebhookDedupWindowMinutes:  p.getInt64Env("WEBHOOK_DEDUP_WINDOW_MINUTES", 60),
+		FreshRSSWebhookToken:       getEnv("FRESHRSS_WEBHOOK_TOKEN", ""),
+		TTRSSWebhookSecret:         getEnv("TTRSS_WEBHOOK_SECRET", ""),
+
+		OtelExporterEndpoint: getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+
+		GalleryDLConfigFile: getEnv("GALLERY_DL_CONFIG_FILE", ""),
+		GalleryDLNoConfig:   getBoolEnv("GALLERY_DL_NO_CONFIG", false),
+		FeedOverrides:       p.getFeedOverridesEnv("FEED_OVERRIDES"),
+
+		ResticRepository: getEnv("RESTIC_REPOSITORY", ""),
+		ResticPassword:   getEnv("RESTIC_PASSWORD", ""),
+		ResticBackupCron: getEnv("RESTIC_BACKUP_CRON", "0 3 * * *"),
+
+		CronCleanup:       getEnv("CRON_CLEANUP", ""),
+		CronRetryQueue:    getEnv("CRON_RETRY_QUEUE", ""),
+		CronFailureReport: getEnv("CRON_FAILURE_REPORT", ""),
+		CronMinifluxSync:  getEnv("CRON_MINIFLUX_SYNC", ""),
 	}
+	cfg.parseErrs = p.errs
+	return cfg
+}
+
+// envParser collects parse errors from the typed getters so Validate can
+// report them together with every other problem.
+type envParser struct {
+	errs []error
+}
+
+func (p *envParser) fail(format string, args ...any) {
+	p.errs = append(p.errs, fmt.Errorf(format, args...))
 }
 
 func getEnv(key, defaultValue string) string {
@@ -37,10 +311,208 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// absPath resolves a relative default against the working directory. Values
+// read from the environment are kept as given so Validate can reject a
+// relative one. The path is kept as is when the working directory is unknown.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
 func getBoolEnv(key string, defaultValue bool) bool {
 	value := os.Getenv(key)
 	if value == "" {
 		return defaultValue
 	}
 	return value == "true" || value == "1" || value == "yes"
-}
\ No newline at end of file
+}
+
+func (p *envParser) getInt64Env(key string, defaultValue int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		p.fail("invalid %s: expected an integer, got %q", key, value)
+		return defaultValue
+	}
+	return parsed
+}
+
+func (p *envParser) getFloatEnv(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		p.fail("invalid %s: expected a number, got %q", key, value)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getInt64MapEnv parses key=value pairs with integer values,
+// e.g. "video/*=2000,image/*=100".
+func (p *envParser) getInt64MapEnv(key string) map[string]int64 {
+	result := make(map[string]int64)
+	for k, v := range getMapEnv(key) {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			p.fail("invalid %s: value for %q must be an integer, got %q", key, k, v)
+			continue
+		}
+		result[k] = parsed
+	}
+	return result
+}
+
+// getRangeMapEnv parses key=value pairs with integer values between min and
+// max inclusive, e.g. "Patreon=5,default=3".
+func (p *envParser) getRangeMapEnv(key string, min, max int64) map[string]int {
+	result := make(map[string]int)
+	for k, v := range p.getInt64MapEnv(key) {
+		if v < min || v > max {
+			p.fail("invalid %s: value for %q must be between %d and %d, got %d", key, k, min, max, v)
+			continue
+		}
+		result[k] = int(v)
+	}
+	return result
+}
+
+// getColorMapEnv parses key=color pairs where colors are 24-bit RGB values in
+// decimal, 0x or # hex notation, e.g. "Patreon=16734464,MyFeed=#0000FF".
+func (p *envParser) getColorMapEnv(key string) map[string]int {
+	result := make(map[string]int)
+	for k, v := range getMapEnv(key) {
+		parsed, err := strconv.ParseInt(strings.Replace(v, "#", "0x", 1), 0, 64)
+		if err != nil || parsed < 0 || parsed > 0xFFFFFF {
+			p.fail("invalid %s: color for %q must be a 24-bit RGB value, got %q", key, k, v)
+			continue
+		}
+		result[k] = int(parsed)
+	}
+	return result
+}
+
+// getURLMapEnv parses key=url pairs and requires absolute http(s) URLs.
+func (p *envParser) getURLMapEnv(key string) map[string]string {
+	result := getMapEnv(key)
+	for k, v := range result {
+		u, err := url.Parse(v)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.fail("invalid %s: value for %q must be an http(s) URL, got %q", key, k, v)
+			delete(result, k)
+		}
+	}
+	return result
+}
+
+// getListEnv parses a comma-separated list, dropping empty items.
+func getListEnv(key string) []string {
+	return getSplitEnv(key, ",")
+}
+
+// contentImageRegexSeparator splits CONTENT_IMAGE_REGEXES. Commas can't be
+// used since they appear in quantifiers like {2,5}.
+const contentImageRegexSeparator = ";;"
+
+// getSplitEnv parses a list separated by sep, dropping empty items.
+func getSplitEnv(key, sep string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(key), sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getMapEnv parses a comma-separated list of key=value pairs,
+// e.g. "Patreon=https://a,Fanbox=https://b".
+func getMapEnv(key string) map[string]string {
+	result := make(map[string]string)
+	value := os.Getenv(key)
+	if value == "" {
+		return result
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		k = strings.TrimSpace(k)
+		v = strings.TrimSpace(v)
+		if k == "" || v == "" {
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// getJSONMapEnv parses a JSON object of strings, e.g.
+// {"Patreon": "/mnt/nvme/archive"}.
+func (p *envParser) getJSONMapEnv(key string) map[string]string {
+	result := make(map[string]string)
+	value := os.Getenv(key)
+	if value == "" {
+		return result
+	}
+
+	if err := json.Unmarshal([]byte(value), &result); err != nil {
+		p.fail("invalid %s: expected a JSON object of strings like {\"Patreon\": \"/path\"}: %v", key, err)
+		return make(map[string]string)
+	}
+	return result
+}
+
+func (p *envParser) getFeedOverridesEnv(key string) map[int]FeedOverride {
+	result := make(map[int]FeedOverride)
+	value := os.Getenv(key)
+	if value == "" {
+		return result
+	}
+
+	var raw map[string]FeedOverride
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		p.fail("invalid %s: expected a JSON object keyed by feed ID like {\"42\": {\"gallery_dl_no_config\": true}}: %v", key, err)
+		return result
+	}
+	for feedID, override := range raw {
+		id, err := strconv.Atoi(feedID)
+		if err != nil {
+			p.fail("invalid %s: feed ID %q is not a number", key, feedID)
+			continue
+		}
+		result[id] = override
+	}
+	return result
+}
+
+func (p *envParser) getExtraAlbumsEnv(key string) []ChibisafeExtraAlbum {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+
+	var albums []ChibisafeExtraAlbum
+	if err := json.Unmarshal([]byte(value), &albums); err != nil {
+		p.fail("invalid %s: expected a JSON array like [{\"name\": \"All 2024\", \"addAllPosts\": true}]: %v", key, err)
+		return nil
+	}
+	for _, album := range albums {
+		if strings.TrimSpace(album.Name) == "" {
+			p.fail("invalid %s: every album needs a name", key)
+			return nil
+		}
+	}
+	return albums
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiscordCategoryColorsAndIcons(t *testing.T) {
+	t.Setenv("DISCORD_CATEGORY_COLORS", "Patreon=16734464, MyFeed=#0000FF,Other=0xff")
+	t.Setenv("DISCORD_CATEGORY_ICONS", "MyFeed=https://example.com/icon.png")
+
+	cfg := Load()
+	wantColors := map[string]int{"Patreon": 16734464, "MyFeed": 0x0000FF, "Other": 0xFF}
+	if !reflect.DeepEqual(cfg.DiscordCategoryColors, wantColors) {
+		t.Errorf("DiscordCategoryColors = %v, want %v", cfg.DiscordCategoryColors, wantColors)
+	}
+	wantIcons := map[string]string{"MyFeed": "https://example.com/icon.png"}
+	if !reflect.DeepEqual(cfg.DiscordCategoryIcons, wantIcons) {
+		t.Errorf("DiscordCategoryIcons = %v, want %v", cfg.DiscordCategoryIcons, wantIcons)
+	}
+	if len(cfg.parseErrs) != 0 {
+		t.Errorf("parse errors: %v", cfg.parseErrs)
+	}
+}
+
+func TestDiscordCategoryColorsAndIconsInvalid(t *testing.T) {
+	tests := []struct {
+		key, value string
+	}{
+		{"DISCORD_CATEGORY_COLORS", "Patreon=16777216"},
+		{"DISCORD_CATEGORY_COLORS", "Patreon=-1"},
+		{"DISCORD_CATEGORY_COLORS", "Patreon=orange"},
+		{"DISCORD_CATEGORY_COLORS", "Patreon=#GGGGGG"},
+		{"DISCORD_CATEGORY_ICONS", "Patreon=not a url"},
+		{"DISCORD_CATEGORY_ICONS", "Patreon=ftp://example.com/icon.png"},
+		{"DISCORD_CATEGORY_ICONS", "Patreon=https://"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			cfg := Load()
+			if len(cfg.parseErrs) != 1 || !strings.Contains(cfg.parseErrs[0].Error(), tt.key) {
+				t.Errorf("parse errors = %v, want one for %s", cfg.parseErrs, tt.key)
+			}
+		})
+	}
+}
+
+func TestContentImageRegexes(t *testing.T) {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	t.Setenv("CONTENT_IMAGE_REGEXES", `src="([^"]{10,200})" ;; (https://cdn\.example\.com/\w{2,5}/\d+);;`)
+
+	cfg := Load()
+	want := []string{`src="([^"]{10,200})"`, `(https://cdn\.example\.com/\w{2,5}/\d+)`}
+	if !reflect.DeepEqual(cfg.ContentImageRegexes, want) {
+		t.Errorf("ContentImageRegexes = %q, want %q", cfg.ContentImageRegexes, want)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	// A list still separated by commas reads as one pattern with two groups.
+	t.Setenv("CONTENT_IMAGE_REGEXES", `src="([^"]+)",data-src="([^"]+)"`)
+	if err := Load().Validate(); err == nil || !strings.Contains(err.Error(), "separated by ;;") {
+		t.Errorf("Validate() = %v, want the comma-separated list rejected", err)
+	}
+}
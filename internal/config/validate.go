@@ -0,0 +1,120 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"lewdarchive/internal/scheduler"
+	"lewdarchive/internal/service"
+)
+
+// Validate reports every setting that can't work, or a combination of
+// settings that would fail silently, joined into one error.
+func (c Config) Validate() error {
+	errs := append([]error(nil), c.parseErrs...)
+
+	if _, err := strconv.ParseUint(c.Port, 10, 16); err != nil {
+		errs = append(errs, fmt.Errorf("PORT %q is not a port number", c.Port))
+	}
+	if err := checkWritableDir(filepath.Dir(c.DBPath)); err != nil {
+		errs = append(errs, fmt.Errorf("DB_PATH directory is not writable: %w", err))
+	}
+	// Only the default ARCHIVE_DIR is resolved by Load, so this checks the
+	// value as it was set.
+	if !filepath.IsAbs(c.ArchiveDir) {
+		errs = append(errs, fmt.Errorf("ARCHIVE_DIR %q must be an absolute path", c.ArchiveDir))
+	}
+
+	if c.ChibisafeAPIURL != "" && c.ChibisafeAPIKey == "" && c.ChibisafeAPIKeyFile == "" {
+		errs = append(errs, errors.New("CHIBISAFE_API_URL is set but CHIBISAFE_API_KEY and CHIBISAFE_API_KEY_FILE are not"))
+	}
+
+	if c.MinifluxAPIURL != "" && c.MinifluxAPIToken == "" && c.MinifluxUsername == "" && c.MinifluxClientID == "" {
+		errs = append(errs, errors.New("MINIFLUX_API_URL is set but MINIFLUX_API_TOKEN, MINIFLUX_USERNAME and MINIFLUX_CLIENT_ID are not"))
+	}
+	if c.MinifluxAPIToken != "" && (c.MinifluxUsername != "" || c.MinifluxPassword != "") {
+		errs = append(errs, errors.New("set either MINIFLUX_API_TOKEN or MINIFLUX_USERNAME/MINIFLUX_PASSWORD, not both"))
+	}
+	if (c.MinifluxUsername == "") != (c.MinifluxPassword == "") {
+		errs = append(errs, errors.New("MINIFLUX_USERNAME and MINIFLUX_PASSWORD must be set together"))
+	}
+	if c.MinifluxClientID != "" && (c.MinifluxClientSecret == "" || c.MinifluxTokenURL == "") {
+		errs = append(errs, errors.New("MINIFLUX_CLIENT_ID requires MINIFLUX_CLIENT_SECRET and MINIFLUX_TOKEN_URL"))
+	}
+	switch c.MinifluxEntryAction {
+	case service.MinifluxEntryActionRead, service.MinifluxEntryActionStar, service.MinifluxEntryActionReadStar, service.MinifluxEntryActionNone:
+	default:
+		errs = append(errs, fmt.Errorf("MINIFLUX_ENTRY_ACTION %q: expected read, star, read+star or none", c.MinifluxEntryAction))
+	}
+	switch c.MinifluxArchivedStatus {
+	case "", service.MinifluxEntryStatusRead, service.MinifluxEntryStatusRemoved:
+	default:
+		errs = append(errs, fmt.Errorf("MINIFLUX_ARCHIVED_STATUS %q: expected read or removed", c.MinifluxArchivedStatus))
+	}
+
+	if _, err := service.ParseFilenameTemplate(c.ChibisafeFilenameTemplate); err != nil {
+		errs = append(errs, fmt.Errorf("invalid CHIBISAFE_FILENAME_TEMPLATE: %w", err))
+	}
+	if _, err := service.ParseProxyURL(c.ChibisafeProxyURL); err != nil {
+		errs = append(errs, fmt.Errorf("invalid CHIBISAFE_PROXY_URL: %w", err))
+	}
+	if _, err := service.ParseCertPin(c.ChibisafeCertPinSHA256); err != nil {
+		errs = append(errs, fmt.Errorf("invalid CHIBISAFE_CERT_PIN_SHA256: %w", err))
+	}
+
+	if c.ContentImageRegex != "" {
+		if _, err := service.CompileContentImagePattern(c.ContentImageRegex); err != nil {
+			errs = append(errs, fmt.Errorf("invalid CONTENT_IMAGE_REGEX: %w", err))
+		}
+	}
+	for _, pattern := range c.ContentImageRegexes {
+		if _, err := service.CompileContentImagePattern(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("invalid CONTENT_IMAGE_REGEXES, whose patterns are separated by %s: %w", contentImageRegexSeparator, err))
+		}
+	}
+	if _, err := service.NewImageProxy(c.DiscordImageProxyURL); err != nil {
+		errs = append(errs, fmt.Errorf("invalid DISCORD_IMAGE_PROXY_URL: %w", err))
+	}
+
+	switch c.SMTPTLS {
+	case service.EmailTLSStartTLS, service.EmailTLSImplicit, service.EmailTLSNone:
+	default:
+		errs = append(errs, fmt.Errorf("SMTP_TLS %q: expected starttls, tls or none", c.SMTPTLS))
+	}
+	for _, event := range c.OutgoingWebhookEvents {
+		if event != service.OutgoingEventReceived && event != service.OutgoingEventCompleted {
+			errs = append(errs, fmt.Errorf("OUTGOING_WEBHOOK_EVENTS: unknown event %q, expected received or completed", event))
+		}
+	}
+
+	schedules := []struct{ setting, spec string }{
+		{"CRON_CLEANUP", c.CronCleanup},
+		{"CRON_RETRY_QUEUE", c.CronRetryQueue},
+		{"CRON_FAILURE_REPORT", c.CronFailureReport},
+		{"CRON_MINIFLUX_SYNC", c.CronMinifluxSync},
+		{"RESTIC_BACKUP_CRON", c.ResticBackupCron},
+	}
+	for _, s := range schedules {
+		if err := scheduler.ValidateSchedule(s.spec); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", s.setting, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkWritableDir creates dir if needed and a temporary file in it.
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateReportsParseErrorsTogether(t *testing.T) {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	t.Setenv("SHUTDOWN_DRAIN_SECONDS", "soon")
+	t.Setenv("DISCORD_CATEGORY_COLORS", "Patreon=#zzzzzz")
+	t.Setenv("MINIFLUX_SECRETS", "{bad")
+	t.Setenv("PORT", "99999")
+
+	err := Load().Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil, want errors")
+	}
+	for _, want := range []string{"SHUTDOWN_DRAIN_SECONDS", "DISCORD_CATEGORY_COLORS", "MINIFLUX_SECRETS", "PORT"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error does not mention %s:\n%v", want, err)
+		}
+	}
+}
+
+func TestValidateArchiveDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"default", "", false},
+		{"absolute", t.TempDir(), false},
+		{"relative", "./archive", true},
+		{"bare name", "archive", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+			t.Setenv("ARCHIVE_DIR", tt.value)
+
+			err := Load().Validate()
+			if gotErr := err != nil && strings.Contains(err.Error(), "ARCHIVE_DIR"); gotErr != tt.wantErr {
+				t.Errorf("Validate() = %v, want ARCHIVE_DIR error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateReportsServiceSettingsTogether(t *testing.T) {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	settings := map[string]string{
+		"MINIFLUX_ENTRY_ACTION":       "archive",
+		"MINIFLUX_ARCHIVED_STATUS":    "gone",
+		"SMTP_TLS":                    "ssl",
+		"OUTGOING_WEBHOOK_EVENTS":     "received,deleted",
+		"CHIBISAFE_FILENAME_TEMPLATE": "{{.Title",
+		"CHIBISAFE_PROXY_URL":         "ftp://proxy",
+		"CHIBISAFE_CERT_PIN_SHA256":   "zz",
+		"CONTENT_IMAGE_REGEX":         "(unclosed",
+		"DISCORD_IMAGE_PROXY_URL":     "not a url",
+		"CRON_CLEANUP":                "every day",
+		"RESTIC_BACKUP_CRON":          "61 * * * *",
+	}
+	for key, value := range settings {
+		t.Setenv(key, value)
+	}
+
+	err := Load().Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil, want errors")
+	}
+	for key := range settings {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Validate() error does not mention %s:\n%v", key, err)
+		}
+	}
+}
+
+func TestValidateDefaults(t *testing.T) {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	if err := Load().Validate(); err != nil {
+		t.Errorf("Validate() with the defaults = %v", err)
+	}
+}
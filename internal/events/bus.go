@@ -0,0 +1,76 @@
+package events
+
+import (
+	"log"
+	"sync"
+)
+
+// Event types published on the bus.
+const (
+	TypeEntrySaved        = "entry.saved"
+	TypeDownloadStarted   = "download.started"
+	TypeDownloadCompleted = "download.completed"
+	TypeUploadCompleted   = "upload.completed"
+)
+
+// subscriberBuffer is how many events a subscriber may lag behind before
+// further events are dropped for it.
+const subscriberBuffer = 64
+
+// Event is a progress notification about a post, as sent to WebSocket clients.
+type Event struct {
+	Type  string   `json:"type"`
+	Hash  string   `json:"hash"`
+	Title string   `json:"title,omitempty"`
+	Files int      `json:"files,omitempty"`
+	URLs  []string `json:"urls,omitempty"`
+}
+
+// Bus fans out events to in-process subscribers. Publishing never blocks: a
+// subscriber that doesn't keep up misses events rather than stalling
+// downloads. A nil *Bus discards everything.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[chan Event]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel receiving every event published from now on and
+// a function that unsubscribes and closes the channel.
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish sends the event to all current subscribers.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Event subscriber is lagging, dropping %s event for %s", event.Type, event.Hash)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/service"
+)
+
+type AdminHandler struct {
+	discordService *service.DiscordService
+}
+
+func NewAdminHandler(discordService *service.DiscordService) *AdminHandler {
+	return &AdminHandler{
+		discordService: discordService,
+	}
+}
+
+type discordTestRequest struct {
+	Category string `json:"category"`
+	Author   string `json:"author"`
+	Title    string `json:"title"`
+	Image    string `json:"image"`
+}
+
+// HandleDiscordTest sends a synthetic entry through SendEmbed so embed colors,
+// icons and per-category webhook routing can be checked without a live post.
+func (h *AdminHandler) HandleDiscordTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.discordService == nil {
+		writeError(w, http.StatusServiceUnavailable, "Discord is not configured")
+		return
+	}
+
+	req := discordTestRequest{
+		Category: "default",
+		Author:   "LewdArchive",
+		Title:    "LewdArchive test notification",
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("Error reading request body: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+	}
+
+	feed := model.Feed{
+		Title:    "LewdArchive",
+		Category: model.Category{Title: req.Category},
+	}
+	entry := model.Entry{
+		Hash:        "test",
+		Title:       req.Title,
+		URL:         "https://github.com/Bakalhau/LewdArchive",
+		PublishedAt: time.Now().UTC().Format(time.RFC3339),
+		Author:      req.Author,
+	}
+	if req.Image != "" {
+		entry.Enclosures = []model.Enclosure{{URL: req.Image, MimeType: "image/*"}}
+	}
+
+	response := map[string]interface{}{
+		"category": req.Category,
+	}
+
+	result, err := h.discordService.SendEmbed(feed, entry)
+	if result != nil {
+		response["discord_status"] = result.StatusCode
+	}
+	if err != nil {
+		log.Printf("Discord test notification failed for category '%s': %v", req.Category, err)
+		writeErrorDetails(w, http.StatusBadGateway, "Discord request failed", response)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
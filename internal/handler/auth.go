@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// apiKeyCookie holds the API key of a web UI session.
+const apiKeyCookie = "lewdarchive_api_key"
+
+// RequireAPIKey guards an admin endpoint with ADMIN_API_KEY. The key may be
+// sent as "Authorization: Bearer <key>", "X-Api-Key: <key>" or in the web UI
+// session cookie. When no key is configured the endpoint is disabled rather
+// than left open.
+func RequireAPIKey(apiKey string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if apiKey == "" {
+			log.Printf("Rejected %s %s: ADMIN_API_KEY is not configured", r.Method, r.URL.Path)
+			writeError(w, http.StatusServiceUnavailable, "Admin API disabled")
+			return
+		}
+
+		if !validAPIKey(apiKey, requestAPIKey(r)) {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// APIKeyMiddleware requires ADMIN_API_KEY on every request except the
+// webhooks, which have their own signature or token, the /health, /livez and
+// /readyz probes and the static web UI, which only holds pages and fetches its
+// data from the API. Feed readers can't send headers, so the Atom and JSON
+// feeds also take the key as ?token=. Without a key, GET and HEAD requests
+// stay open so that a fresh install can be browsed, except the full export,
+// the metrics and the event stream, which only answer loopback clients.
+// Everything else is rejected as by RequireAPIKey.
+func APIKeyMiddleware(apiKey string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if isFeedPath(r.URL.Path) && apiKey != "" && validAPIKey(apiKey, r.URL.Query().Get("token")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if apiKey == "" && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			if isLoopbackOnlyPath(r.URL.Path) && !isLoopbackRequest(r) {
+				log.Printf("Rejected %s %s from %s: ADMIN_API_KEY is not configured", r.Method, r.URL.Path, r.RemoteAddr)
+				writeError(w, http.StatusForbidden, "Only available from localhost until ADMIN_API_KEY is set")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		RequireAPIKey(apiKey, next.ServeHTTP)(w, r)
+	})
+}
+
+// isPublicPath reports whether a path is reachable without the API key. Only
+// the bare probes are public; /health/details lists the services and queues.
+func isPublicPath(path string) bool {
+	return path == "/webhook" || strings.HasPrefix(path, "/webhook/") || path == "/health" ||
+		path == "/livez" || path == "/readyz" ||
+		path == "/ui" || strings.HasPrefix(path, "/ui/")
+}
+
+func isFeedPath(path string) bool {
+	return path == "/feed.xml" || path == "/feed.json"
+}
+
+// isLoopbackOnlyPath reports whether a path exposes too much to be left open
+// to the network when no API key is configured.
+func isLoopbackOnlyPath(path string) bool {
+	return path == "/api/export" || path == "/metrics" || path == "/ws"
+}
+
+func isLoopbackRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func requestAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	if key := r.Header.Get("X-Api-Key"); key != "" {
+		return key
+	}
+	if cookie, err := r.Cookie(apiKeyCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+func validAPIKey(expected, provided string) bool {
+	if provided == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(provided)) == 1
+}
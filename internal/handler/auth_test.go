@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	const key = "k3y"
+	const lan = "192.168.1.20:51000"
+	const loopback = "127.0.0.1:51000"
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		method     string
+		target     string
+		remoteAddr string
+		header     map[string]string
+		want       int
+	}{
+		{"webhook is public", key, http.MethodPost, "/webhook", lan, nil, http.StatusOK},
+		{"readiness is public", key, http.MethodGet, "/readyz", lan, nil, http.StatusOK},
+		{"health is public", key, http.MethodGet, "/health", lan, nil, http.StatusOK},
+		{"health details without key", key, http.MethodGet, "/health/details", lan, nil, http.StatusUnauthorized},
+		{"health details with key", key, http.MethodGet, "/health/details", lan, map[string]string{"X-Api-Key": key}, http.StatusOK},
+		{"ui is public", key, http.MethodGet, "/ui/", lan, nil, http.StatusOK},
+		{"api without key", key, http.MethodGet, "/api/posts", lan, nil, http.StatusUnauthorized},
+		{"api with bearer", key, http.MethodGet, "/api/posts", lan, map[string]string{"Authorization": "Bearer " + key}, http.StatusOK},
+		{"api with header", key, http.MethodGet, "/api/posts", lan, map[string]string{"X-Api-Key": key}, http.StatusOK},
+		{"api with cookie", key, http.MethodGet, "/api/posts", lan, map[string]string{"Cookie": apiKeyCookie + "=" + key}, http.StatusOK},
+		{"api with wrong key", key, http.MethodGet, "/api/posts", lan, map[string]string{"X-Api-Key": "nope"}, http.StatusUnauthorized},
+		{"api token not accepted", key, http.MethodGet, "/api/posts?token=" + key, lan, nil, http.StatusUnauthorized},
+		{"feed with token", key, http.MethodGet, "/feed.xml?token=" + key, lan, nil, http.StatusOK},
+		{"json feed with token", key, http.MethodGet, "/feed.json?token=" + key, lan, nil, http.StatusOK},
+		{"feed with wrong token", key, http.MethodGet, "/feed.xml?token=nope", lan, nil, http.StatusUnauthorized},
+		{"feed without token", key, http.MethodGet, "/feed.xml", lan, nil, http.StatusUnauthorized},
+		{"no key: read open", "", http.MethodGet, "/api/posts", lan, nil, http.StatusOK},
+		{"no key: write refused", "", http.MethodDelete, "/api/posts/abc", loopback, nil, http.StatusServiceUnavailable},
+		{"no key: feed open", "", http.MethodGet, "/feed.xml", lan, nil, http.StatusOK},
+		{"no key: export from lan", "", http.MethodGet, "/api/export", lan, nil, http.StatusForbidden},
+		{"no key: metrics from lan", "", http.MethodGet, "/metrics", lan, nil, http.StatusForbidden},
+		{"no key: events from lan", "", http.MethodGet, "/ws", lan, nil, http.StatusForbidden},
+		{"no key: export from loopback", "", http.MethodGet, "/api/export", loopback, nil, http.StatusOK},
+		{"no key: metrics from ipv6 loopback", "", http.MethodGet, "/metrics", "[::1]:51000", nil, http.StatusOK},
+		{"key set: export from lan with key", key, http.MethodGet, "/api/export", lan, map[string]string{"X-Api-Key": key}, http.StatusOK},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			APIKeyMiddleware(tt.apiKey, next).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireAPIKeyWithoutKey(t *testing.T) {
+	called := false
+	h := RequireAPIKey("", func(w http.ResponseWriter, r *http.Request) { called = true })
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/admin/backfill", nil))
+	if called || rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d, called %v; want 503 without calling the handler", rec.Code, called)
+	}
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"lewdarchive/internal/repository"
+)
+
+const (
+	authorsPageSize    = 50
+	maxAuthorsPageSize = 500
+)
+
+type AuthorHandler struct {
+	postRepo *repository.PostRepository
+}
+
+func NewAuthorHandler(postRepo *repository.PostRepository) *AuthorHandler {
+	return &AuthorHandler{
+		postRepo: postRepo,
+	}
+}
+
+// HandleList serves GET /api/authors, paged with ?page= and ?page_size= and
+// ordered by post count unless ?sort=name or ?sort=latest_post is given.
+func (h *AuthorHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	page, err := positiveIntParam(query.Get("page"), 1)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid page")
+		return
+	}
+	pageSize, err := positiveIntParam(query.Get("page_size"), authorsPageSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid page_size")
+		return
+	}
+	pageSize = min(pageSize, maxAuthorsPageSize)
+
+	sort := query.Get("sort")
+	switch sort {
+	case "", repository.AuthorSortPostCount, repository.AuthorSortName, repository.AuthorSortLatestPost:
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid sort, expected post_count, name or latest_post")
+		return
+	}
+
+	authors, err := h.postRepo.ListAuthors(repository.AuthorFilter{
+		Sort:   sort,
+		Limit:  pageSize,
+		Offset: (page - 1) * pageSize,
+	})
+	if err != nil {
+		log.Printf("Error listing authors: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, authors)
+}
+
+// positiveIntParam parses an optional positive integer query parameter.
+func positiveIntParam(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, strconv.ErrRange
+	}
+	return n, nil
+}
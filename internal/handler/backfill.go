@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// backfillPageSize is how many entries are requested from Miniflux at once.
+const backfillPageSize = 100
+
+const backfillSource = "backfill"
+
+// BackfillProgress reports how far the backfill of a feed got.
+type BackfillProgress struct {
+	FeedID     int        `json:"feed_id"`
+	Total      int        `json:"total"`
+	Scanned    int        `json:"scanned"`
+	New        int        `json:"new"`
+	Skipped    int        `json:"skipped"`
+	Failed     int        `json:"failed"`
+	Running    bool       `json:"running"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+type backfillTracker struct {
+	mu    sync.Mutex
+	feeds map[int]*BackfillProgress
+}
+
+// start registers a new run for the feed unless one is already running.
+func (t *backfillTracker) start(feedID int) (*BackfillProgress, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.feeds == nil {
+		t.feeds = make(map[int]*BackfillProgress)
+	}
+	if p, ok := t.feeds[feedID]; ok && p.Running {
+		return nil, false
+	}
+	p := &BackfillProgress{FeedID: feedID, Running: true, StartedAt: time.Now().UTC()}
+	t.feeds[feedID] = p
+	return p, true
+}
+
+func (t *backfillTracker) update(fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn()
+}
+
+func (t *backfillTracker) snapshot() []BackfillProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	progress := make([]BackfillProgress, 0, len(t.feeds))
+	for _, p := range t.feeds {
+		progress = append(progress, *p)
+	}
+	sort.Slice(progress, func(i, j int) bool { return progress[i].FeedID < progress[j].FeedID })
+	return progress
+}
+
+// HandleBackfill serves /admin/backfill. POST ?feed_id=N starts archiving the
+// whole back catalogue of a Miniflux feed in the background; GET reports the
+// progress of every backfill since startup.
+func (h *WebhookHandler) HandleBackfill(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, h.backfills.snapshot())
+		return
+	case http.MethodPost:
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	feedID, err := strconv.Atoi(r.URL.Query().Get("feed_id"))
+	if err != nil || feedID <= 0 {
+		writeError(w, http.StatusBadRequest, "Invalid feed_id")
+		return
+	}
+
+	progress, ok := h.backfills.start(feedID)
+	if !ok {
+		writeError(w, http.StatusConflict, "Backfill already running for this feed")
+		return
+	}
+
+	go h.backfill(feedID, progress)
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"feed_id": feedID,
+		"status":  "started",
+	})
+}
+
+// backfill pages through the feed's entries, oldest first, and runs the ones
+// not archived yet through processEntry.
+func (h *WebhookHandler) backfill(feedID int, progress *BackfillProgress) {
+	log.Printf("Backfill of feed %d started", feedID)
+	ctx := context.Background()
+
+	var runErr error
+	for offset := 0; ; offset += backfillPageSize {
+		page, err := h.minifluxService.GetFeedEntries(ctx, feedID, offset, backfillPageSize)
+		if err != nil {
+			runErr = err
+			break
+		}
+		h.backfills.update(func() { progress.Total = page.Total })
+
+		for _, feedEntry := range page.Entries {
+			exists, err := h.postRepo.ExistsByHash(feedEntry.Hash)
+			if err == nil && !exists {
+				err = h.processEntry(ctx, feedEntry.Feed, feedEntry.Entry, backfillSource, true, nil)
+			}
+
+			h.backfills.update(func() {
+				progress.Scanned++
+				switch {
+				case err != nil:
+					progress.Failed++
+				case exists:
+					progress.Skipped++
+				default:
+					progress.New++
+				}
+			})
+			if err != nil {
+				log.Printf("Backfill of feed %d: error processing entry %s: %v", feedID, feedEntry.Hash, err)
+			}
+		}
+
+		log.Printf("Backfill of feed %d: %d/%d entries scanned", feedID, progress.Scanned, page.Total)
+		if len(page.Entries) < backfillPageSize || offset+len(page.Entries) >= page.Total {
+			break
+		}
+	}
+
+	h.backfills.update(func() {
+		now := time.Now().UTC()
+		progress.Running = false
+		progress.FinishedAt = &now
+		if runErr != nil {
+			progress.Error = runErr.Error()
+		}
+	})
+
+	if runErr != nil {
+		log.Printf("Backfill of feed %d stopped after %d entries: %v", feedID, progress.Scanned, runErr)
+		return
+	}
+	log.Printf("Backfill of feed %d finished: %d scanned, %d new, %d skipped, %d failed",
+		feedID, progress.Scanned, progress.New, progress.Skipped, progress.Failed)
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	corsAllowedMethods = "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsAllowedHeaders = "Authorization, Content-Type, X-Api-Key"
+	corsExposedHeaders = "Content-Disposition, Retry-After"
+	// corsMaxAge is how long browsers may cache a preflight answer.
+	corsMaxAge = 10 * time.Minute
+)
+
+// CORSMiddleware lets pages from allowedOrigins call the API from the
+// browser, "*" allowing any origin. It answers preflight requests itself,
+// ahead of the API key check, since browsers send them without credentials.
+// The webhooks are left out as they are only called by feed readers, and an
+// empty list disables CORS.
+func CORSMiddleware(allowedOrigins []string, next http.Handler) http.Handler {
+	if len(allowedOrigins) == 0 {
+		return next
+	}
+	anyOrigin := false
+	origins := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			anyOrigin = true
+		}
+		origins[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || r.URL.Path == "/webhook" || strings.HasPrefix(r.URL.Path, "/webhook/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		if !anyOrigin && !origins[origin] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if anyOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
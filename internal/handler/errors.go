@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"net/http"
+)
+
+// Error codes of API error responses, one per status class a client is
+// expected to handle differently.
+const (
+	ErrorCodeInvalidRequest   = "invalid_request"
+	ErrorCodeUnauthorized     = "unauthorized"
+	ErrorCodeNotFound         = "not_found"
+	ErrorCodeMethodNotAllowed = "method_not_allowed"
+	ErrorCodeConflict         = "conflict"
+	ErrorCodeUnavailable      = "unavailable"
+	ErrorCodeBadGateway       = "bad_gateway"
+	ErrorCodeInternal         = "internal_error"
+)
+
+// APIError is the body of every API error response:
+// {"error": {"code": "...", "message": "..."}}. Messages are meant for people
+// and never carry internal error details, which are only logged.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// writeError writes an APIError whose code is derived from the status.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: APIError{Code: errorCode(status), Message: message}})
+}
+
+// writeErrorDetails writes an APIError along with other top-level fields
+// describing what was done before the failure.
+func writeErrorDetails(w http.ResponseWriter, status int, message string, details map[string]interface{}) {
+	body := make(map[string]interface{}, len(details)+1)
+	for key, value := range details {
+		body[key] = value
+	}
+	body["error"] = APIError{Code: errorCode(status), Message: message}
+	writeJSON(w, status, body)
+}
+
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusRequestEntityTooLarge:
+		return ErrorCodeInvalidRequest
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrorCodeUnauthorized
+	case http.StatusNotFound:
+		return ErrorCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrorCodeMethodNotAllowed
+	case http.StatusConflict:
+		return ErrorCodeConflict
+	case http.StatusServiceUnavailable:
+		return ErrorCodeUnavailable
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return ErrorCodeBadGateway
+	default:
+		return ErrorCodeInternal
+	}
+}
+
+// JSONErrors answers requests matching no route of mux with an APIError
+// instead of the mux's plain text 404 or 405, keeping its Allow header.
+func JSONErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		status := &statusOnlyWriter{header: w.Header(), status: http.StatusOK}
+		h.ServeHTTP(status, r)
+		if status.status < http.StatusBadRequest {
+			w.WriteHeader(status.status)
+			return
+		}
+		writeError(w, status.status, http.StatusText(status.status))
+	})
+}
+
+// statusOnlyWriter records the status and headers of a response, discarding
+// its body.
+type statusOnlyWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *statusOnlyWriter) Header() http.Header { return w.header }
+
+func (w *statusOnlyWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func (w *statusOnlyWriter) WriteHeader(status int) { w.status = status }
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"lewdarchive/internal/config"
+	"lewdarchive/internal/repository"
+)
+
+// decodeAPIError checks that rec holds a JSON error envelope and returns its
+// error object.
+func decodeAPIError(t *testing.T, rec *httptest.ResponseRecorder) APIError {
+	t.Helper()
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/json") {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q is not a JSON object: %v", rec.Body.String(), err)
+	}
+	var apiErr APIError
+	if err := json.Unmarshal(body["error"], &apiErr); err != nil {
+		t.Fatalf("body %q has no error object: %v", rec.Body.String(), err)
+	}
+	var fields map[string]json.RawMessage
+	json.Unmarshal(body["error"], &fields)
+	if len(fields) != 2 || apiErr.Code == "" || apiErr.Message == "" {
+		t.Errorf("error = %s, want exactly a code and a message", body["error"])
+	}
+	return apiErr
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		status int
+		code   string
+	}{
+		{http.StatusBadRequest, ErrorCodeInvalidRequest},
+		{http.StatusUnsupportedMediaType, ErrorCodeInvalidRequest},
+		{http.StatusUnauthorized, ErrorCodeUnauthorized},
+		{http.StatusForbidden, ErrorCodeUnauthorized},
+		{http.StatusNotFound, ErrorCodeNotFound},
+		{http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed},
+		{http.StatusConflict, ErrorCodeConflict},
+		{http.StatusServiceUnavailable, ErrorCodeUnavailable},
+		{http.StatusBadGateway, ErrorCodeBadGateway},
+		{http.StatusInternalServerError, ErrorCodeInternal},
+		{http.StatusTeapot, ErrorCodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeError(rec, tt.status, "Something went wrong")
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d", rec.Code, tt.status)
+			}
+			apiErr := decodeAPIError(t, rec)
+			if apiErr.Code != tt.code || apiErr.Message != "Something went wrong" {
+				t.Errorf("error = %+v, want code %q", apiErr, tt.code)
+			}
+		})
+	}
+}
+
+func TestWriteErrorDetails(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeErrorDetails(rec, http.StatusConflict, "Job already queued or running", map[string]interface{}{
+		"post_id": 7,
+		"error":   "overwritten",
+	})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if apiErr := decodeAPIError(t, rec); apiErr.Code != ErrorCodeConflict {
+		t.Errorf("code = %q, want %q", apiErr.Code, ErrorCodeConflict)
+	}
+	var body struct {
+		PostID int `json:"post_id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.PostID != 7 {
+		t.Errorf("body %q lost the post_id detail", rec.Body.String())
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/posts", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	h := JSONErrors(mux)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		status int
+		code   string
+	}{
+		{"unknown route", http.MethodGet, "/api/nope", http.StatusNotFound, ErrorCodeNotFound},
+		{"wrong method", http.MethodDelete, "/api/posts", http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d", rec.Code, tt.status)
+			}
+			if apiErr := decodeAPIError(t, rec); apiErr.Code != tt.code {
+				t.Errorf("code = %q, want %q", apiErr.Code, tt.code)
+			}
+			if tt.status == http.StatusMethodNotAllowed && !strings.Contains(rec.Header().Get("Allow"), http.MethodGet) {
+				t.Errorf("Allow = %q, want GET kept", rec.Header().Get("Allow"))
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/posts", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"ok"`) {
+		t.Errorf("matched route = %d %q, want it served unchanged", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandlerErrorEnvelopes(t *testing.T) {
+	db := newTestDB(t)
+	posts := NewPostHandler(repository.NewPostRepository(db), repository.NewDownloadLogRepository(db), repository.NewPostFileRepository(db), nil, nil, nil, false)
+	broken := newTestDB(t)
+	broken.Close()
+	brokenPosts := NewPostHandler(repository.NewPostRepository(broken), nil, nil, nil, nil, nil, false)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/posts", posts.HandleList)
+	mux.HandleFunc("GET /api/posts/{hash}", posts.HandleGet)
+	mux.HandleFunc("GET /api/broken/{hash}", brokenPosts.HandleGet)
+	mux.HandleFunc("POST /api/admin", RequireAPIKey("k3y", posts.HandleList))
+	h := JSONErrors(mux)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		status int
+		code   string
+	}{
+		{"validation", http.MethodGet, "/api/posts?limit=abc", http.StatusBadRequest, ErrorCodeInvalidRequest},
+		{"auth", http.MethodPost, "/api/admin", http.StatusUnauthorized, ErrorCodeUnauthorized},
+		{"missing", http.MethodGet, "/api/posts/unknown", http.StatusNotFound, ErrorCodeNotFound},
+		{"internal", http.MethodGet, "/api/broken/unknown", http.StatusInternalServerError, ErrorCodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if apiErr := decodeAPIError(t, rec); apiErr.Code != tt.code {
+				t.Errorf("code = %q, want %q", apiErr.Code, tt.code)
+			}
+			if strings.Contains(rec.Body.String(), "sql") {
+				t.Errorf("body %q leaks the database error", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestWebhookErrorsStayPlainText(t *testing.T) {
+	h, _ := newProcessingHandler(t, config.Config{MinifluxSecretKey: "secret"})
+	rec := postWebhook(h, newEntriesPayload("hash"), "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Errorf("Content-Type = %q, want the plain text Miniflux expects", got)
+	}
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"io"
+	"log"
+	"net/http"
+
+	"golang.org/x/net/websocket"
+
+	"lewdarchive/internal/events"
+)
+
+type EventsHandler struct {
+	bus *events.Bus
+}
+
+func NewEventsHandler(bus *events.Bus) *EventsHandler {
+	return &EventsHandler{
+		bus: bus,
+	}
+}
+
+// ServeHTTP serves GET /ws, a WebSocket streaming every bus event as a JSON
+// message. Any origin is accepted so that dashboards hosted elsewhere can
+// connect.
+func (h *EventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server := websocket.Server{
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler:   h.stream,
+	}
+	server.ServeHTTP(w, r)
+}
+
+func (h *EventsHandler) stream(conn *websocket.Conn) {
+	defer conn.Close()
+
+	ch, unsubscribe := h.bus.Subscribe()
+	defer unsubscribe()
+
+	// Clients aren't expected to send anything; reading only detects when
+	// they go away.
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(closed)
+	}()
+
+	log.Printf("WebSocket client connected: %s", conn.Request().RemoteAddr)
+	for {
+		select {
+		case <-closed:
+			log.Printf("WebSocket client disconnected: %s", conn.Request().RemoteAddr)
+			return
+		case event := <-ch:
+			if err := websocket.JSON.Send(conn, event); err != nil {
+				log.Printf("Error sending event to WebSocket client %s: %v", conn.Request().RemoteAddr, err)
+				return
+			}
+		}
+	}
+}
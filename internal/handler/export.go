@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/repository"
+)
+
+// exportBatchSize is how many posts are read from the database at once while
+// streaming an export.
+const exportBatchSize = 200
+
+// exportColumns is the header row of the CSV export. Multi-valued cells are
+// joined with exportSeparator.
+var exportColumns = []string{
+	"id", "hash", "title", "url", "author", "category", "site_url", "feed_id", "source",
+	"published_at", "created_at", "updated_at", "download_status", "download_attempts",
+	"download_size_bytes", "tags", "files", "chibisafe_urls",
+}
+
+const exportSeparator = "\n"
+
+type ExportHandler struct {
+	postRepo     *repository.PostRepository
+	postFileRepo *repository.PostFileRepository
+}
+
+func NewExportHandler(postRepo *repository.PostRepository, postFileRepo *repository.PostFileRepository) *ExportHandler {
+	return &ExportHandler{
+		postRepo:     postRepo,
+		postFileRepo: postFileRepo,
+	}
+}
+
+// exportedPost is a post in the JSON export.
+type exportedPost struct {
+	model.Post
+	Files []model.PostFile `json:"files"`
+}
+
+// exportWriter writes the posts of an export one at a time.
+type exportWriter interface {
+	write(post model.Post, files []model.PostFile) error
+	// flush sends what was written so far to the client.
+	flush() error
+	close() error
+}
+
+// HandleExport serves GET /api/export, every post matching the filters of
+// GET /api/posts, plus ?since= on the archive time, with its tags and files.
+// ?format= is json (the default), an array of posts, or csv. The export is
+// streamed in batches so its size is not bounded by memory.
+func (h *ExportHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	filter, problem := postFilter(r)
+	if problem != "" {
+		writeError(w, http.StatusBadRequest, problem)
+		return
+	}
+	since, _, err := timeParam(r.URL.Query().Get("since"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid since, expected RFC 3339 or YYYY-MM-DD")
+		return
+	}
+	filter.Since = since
+	filter.Limit = exportBatchSize
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	var out exportWriter
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		out = &jsonExportWriter{w: w}
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		out = newCSVExportWriter(w)
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid format, expected json or csv")
+		return
+	}
+	filename := fmt.Sprintf("lewdarchive-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	exported := 0
+	for {
+		posts, err := h.postRepo.ListAfter(filter)
+		if err == nil && len(posts) > 0 {
+			err = h.writeBatch(out, posts)
+		}
+		if err != nil {
+			// The status line is gone once the first batch is written, so
+			// the connection is dropped to keep a truncated export from
+			// looking complete.
+			log.Printf("Export stopped after %d posts: %v", exported, err)
+			if exported == 0 {
+				w.Header().Del("Content-Disposition")
+				writeError(w, http.StatusInternalServerError, "Internal error")
+				return
+			}
+			panic(http.ErrAbortHandler)
+		}
+		exported += len(posts)
+		if len(posts) < exportBatchSize {
+			break
+		}
+		filter.AfterID = posts[len(posts)-1].ID
+	}
+
+	if err := out.close(); err != nil {
+		log.Printf("Error finishing export: %v", err)
+	}
+}
+
+// writeBatch writes a batch of posts with their tags and files.
+func (h *ExportHandler) writeBatch(out exportWriter, posts []model.Post) error {
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	tags, err := h.postRepo.ListTagsByPostIDs(ids)
+	if err != nil {
+		return err
+	}
+	files, err := h.postFileRepo.ListByPostIDs(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		post.Tags = tags[post.ID]
+		if err := out.write(post, files[post.ID]); err != nil {
+			return err
+		}
+	}
+	return out.flush()
+}
+
+type jsonExportWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (e *jsonExportWriter) write(post model.Post, files []model.PostFile) error {
+	if files == nil {
+		files = []model.PostFile{}
+	}
+	body, err := json.Marshal(exportedPost{Post: post, Files: files})
+	if err != nil {
+		return err
+	}
+	separator := ",\n"
+	if !e.started {
+		separator = "[\n"
+		e.started = true
+	}
+	if _, err := e.w.Write([]byte(separator)); err != nil {
+		return err
+	}
+	_, err = e.w.Write(body)
+	return err
+}
+
+func (e *jsonExportWriter) flush() error {
+	return http.NewResponseController(e.w).Flush()
+}
+
+func (e *jsonExportWriter) close() error {
+	end := "\n]\n"
+	if !e.started {
+		end = "[]\n"
+	}
+	_, err := e.w.Write([]byte(end))
+	return err
+}
+
+type csvExportWriter struct {
+	w   http.ResponseWriter
+	csv *csv.Writer
+}
+
+func newCSVExportWriter(w http.ResponseWriter) *csvExportWriter {
+	e := &csvExportWriter{w: w, csv: csv.NewWriter(w)}
+	e.csv.Write(exportColumns)
+	return e
+}
+
+func (e *csvExportWriter) write(post model.Post, files []model.PostFile) error {
+	var names, urls []string
+	for _, file := range files {
+		name := file.Path
+		if name == "" {
+			name = file.Name
+		}
+		names = append(names, name)
+		if file.ChibisafeURL != "" {
+			urls = append(urls, file.ChibisafeURL)
+		}
+	}
+
+	return e.csv.Write([]string{
+		strconv.Itoa(post.ID),
+		post.Hash,
+		post.Title,
+		post.URL,
+		post.Author,
+		post.CategoryTitle,
+		post.SiteURL,
+		strconv.Itoa(post.FeedID),
+		post.Source,
+		post.PublishedAt.UTC().Format(time.RFC3339),
+		post.CreatedAt.UTC().Format(time.RFC3339),
+		post.UpdatedAt.UTC().Format(time.RFC3339),
+		post.DownloadStatus.String(),
+		strconv.Itoa(post.DownloadAttempts),
+		strconv.FormatInt(post.DownloadSizeBytes, 10),
+		strings.Join(post.Tags, exportSeparator),
+		strings.Join(names, exportSeparator),
+		strings.Join(urls, exportSeparator),
+	})
+}
+
+func (e *csvExportWriter) flush() error {
+	e.csv.Flush()
+	if err := e.csv.Error(); err != nil {
+		return err
+	}
+	return http.NewResponseController(e.w).Flush()
+}
+
+func (e *csvExportWriter) close() error {
+	return e.flush()
+}
@@ -0,0 +1,355 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/repository"
+)
+
+const (
+	feedSize    = 50
+	maxFeedSize = 500
+)
+
+var feedContentTemplate = template.Must(template.New("content").Parse(
+	`<p>by <strong>{{.Post.Author}}</strong> in {{.Post.CategoryTitle}}</p>` +
+		`<p>Archive status: {{.Post.DownloadStatus}}</p>` +
+		`<p><a href="{{.Post.URL}}">Original post</a></p>` +
+		`{{if .Uploads}}<ul>{{range .Uploads}}<li><a href="{{.URL}}">{{.Name}}</a></li>{{end}}</ul>{{end}}`,
+))
+
+type FeedHandler struct {
+	postRepo   *repository.PostRepository
+	uploadRepo *repository.UploadRepository
+}
+
+func NewFeedHandler(postRepo *repository.PostRepository, uploadRepo *repository.UploadRepository) *FeedHandler {
+	return &FeedHandler{
+		postRepo:   postRepo,
+		uploadRepo: uploadRepo,
+	}
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Author     atomPerson     `xml:"author"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category,omitempty"`
+	Content    atomContent    `xml:"content"`
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedAttachment struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	Title    string `json:"title,omitempty"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Authors       []jsonFeedAuthor     `json:"authors,omitempty"`
+	Tags          []string             `json:"tags,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments,omitempty"`
+	Archive       jsonFeedArchive      `json:"_lewdarchive"`
+}
+
+// jsonFeedArchive is the JSON Feed extension object carrying archive state.
+type jsonFeedArchive struct {
+	Hash              string               `json:"hash"`
+	Status            model.DownloadStatus `json:"status"`
+	DownloadSizeBytes int64                `json:"download_size_bytes"`
+}
+
+// feedPosts loads the posts for a feed request along with their uploads,
+// applying the ?author= and ?category= filters.
+func (h *FeedHandler) feedPosts(r *http.Request, filter repository.PostFilter) ([]model.Post, map[int][]model.Upload, error) {
+	filter.Author = r.URL.Query().Get("author")
+	filter.Category = r.URL.Query().Get("category")
+
+	posts, err := h.postRepo.List(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	uploads, err := h.uploadRepo.ListByPostIDs(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	return posts, uploads, nil
+}
+
+// renderFeedContent renders the HTML summary shared by the Atom and JSON feeds.
+func renderFeedContent(post model.Post, uploads []model.Upload) (string, error) {
+	var content bytes.Buffer
+	data := struct {
+		Post    model.Post
+		Uploads []model.Upload
+	}{Post: post, Uploads: uploads}
+	if err := feedContentTemplate.Execute(&content, data); err != nil {
+		return "", err
+	}
+	return content.String(), nil
+}
+
+// HandleAtom serves GET /feed.xml, an Atom feed of the most recently archived posts.
+func (h *FeedHandler) HandleAtom(w http.ResponseWriter, r *http.Request) {
+	posts, uploads, err := h.feedPosts(r, repository.PostFilter{Limit: feedSize})
+	if err != nil {
+		log.Printf("Error loading posts for feed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	selfURL := requestURL(r)
+	lastModified := latestUpdate(posts)
+	updated := lastModified
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	feed := atomFeed{
+		ID:      "urn:lewdarchive:feed",
+		Title:   "LewdArchive",
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links:   []atomLink{{Href: selfURL, Rel: "self"}},
+	}
+
+	for _, post := range posts {
+		content, err := renderFeedContent(post, uploads[post.ID])
+		if err != nil {
+			log.Printf("Error rendering feed entry %s: %v", post.Hash, err)
+			continue
+		}
+
+		entry := atomEntry{
+			ID:        "urn:lewdarchive:post:" + post.Hash,
+			Title:     post.Title,
+			Updated:   post.UpdatedAt.UTC().Format(time.RFC3339),
+			Published: post.PublishedAt.UTC().Format(time.RFC3339),
+			Author:    atomPerson{Name: post.Author},
+			Links:     []atomLink{{Href: post.URL, Rel: "alternate"}},
+			Content:   atomContent{Type: "html", Body: content},
+		}
+		if post.CategoryTitle != "" {
+			entry.Categories = []atomCategory{{Term: post.CategoryTitle}}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		log.Printf("Error encoding Atom feed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	serveCacheable(w, r, "application/atom+xml; charset=utf-8", append([]byte(xml.Header), body...), lastModified)
+}
+
+// HandleJSON serves GET /feed.json, a JSON Feed 1.1 document of archived posts
+// whose attachments are the files uploaded to Chibisafe. Besides ?author= and
+// ?category= it accepts ?limit= and ?since= (RFC 3339).
+func (h *FeedHandler) HandleJSON(w http.ResponseWriter, r *http.Request) {
+	filter := repository.PostFilter{Limit: feedSize}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		filter.Limit = min(n, maxFeedSize)
+	}
+	if since := r.URL.Query().Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid since, expected RFC 3339")
+			return
+		}
+		filter.Since = t
+	}
+
+	posts, uploads, err := h.feedPosts(r, filter)
+	if err != nil {
+		log.Printf("Error loading posts for feed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       "LewdArchive",
+		FeedURL:     requestURL(r),
+		Description: "Recently archived posts",
+		Items:       []jsonFeedItem{},
+	}
+
+	for _, post := range posts {
+		content, err := renderFeedContent(post, uploads[post.ID])
+		if err != nil {
+			log.Printf("Error rendering feed entry %s: %v", post.Hash, err)
+			continue
+		}
+
+		item := jsonFeedItem{
+			ID:            "urn:lewdarchive:post:" + post.Hash,
+			URL:           post.URL,
+			Title:         post.Title,
+			ContentHTML:   content,
+			DatePublished: post.PublishedAt.UTC().Format(time.RFC3339),
+			DateModified:  post.UpdatedAt.UTC().Format(time.RFC3339),
+			Archive: jsonFeedArchive{
+				Hash:              post.Hash,
+				Status:            post.DownloadStatus,
+				DownloadSizeBytes: post.DownloadSizeBytes,
+			},
+		}
+		if post.Author != "" {
+			item.Authors = []jsonFeedAuthor{{Name: post.Author}}
+		}
+		if post.CategoryTitle != "" {
+			item.Tags = []string{post.CategoryTitle}
+		}
+		for _, upload := range uploads[post.ID] {
+			if upload.URL == "" {
+				continue
+			}
+			item.Attachments = append(item.Attachments, jsonFeedAttachment{
+				URL:      upload.URL,
+				MimeType: attachmentMimeType(upload.Name),
+				Title:    upload.Name,
+			})
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	body, err := json.Marshal(feed)
+	if err != nil {
+		log.Printf("Error encoding JSON feed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	serveCacheable(w, r, "application/feed+json; charset=utf-8", body, latestUpdate(posts))
+}
+
+// attachmentMimeType guesses the MIME type of an uploaded file from its name.
+func attachmentMimeType(name string) string {
+	if mimeType := mime.TypeByExtension(filepath.Ext(name)); mimeType != "" {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
+// latestUpdate returns the most recent UpdatedAt of the posts.
+func latestUpdate(posts []model.Post) time.Time {
+	var latest time.Time
+	for _, post := range posts {
+		if post.UpdatedAt.After(latest) {
+			latest = post.UpdatedAt
+		}
+	}
+	return latest
+}
+
+// requestURL reconstructs the absolute URL of a request, honouring
+// X-Forwarded-Proto from a reverse proxy.
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+// serveCacheable writes body with an ETag derived from its content and a
+// Last-Modified header, answering conditional requests with 304.
+func serveCacheable(w http.ResponseWriter, r *http.Request, contentType string, body []byte, lastModified time.Time) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if match == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastModified.IsZero() {
+		if !lastModified.Truncate(time.Second).After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
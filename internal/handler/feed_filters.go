@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/repository"
+)
+
+type FeedFilterHandler struct {
+	filterRepo *repository.FeedFilterRepository
+}
+
+func NewFeedFilterHandler(filterRepo *repository.FeedFilterRepository) *FeedFilterHandler {
+	return &FeedFilterHandler{
+		filterRepo: filterRepo,
+	}
+}
+
+type createFeedFilterRequest struct {
+	FilterType string `json:"filter_type"`
+	Pattern    string `json:"pattern"`
+}
+
+// HandleList serves GET /api/feeds/{id}/filters.
+func (h *FeedFilterHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	feedID, ok := feedIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	filters, err := h.filterRepo.List(r.Context(), feedID)
+	if err != nil {
+		log.Printf("Error listing filters of feed %d: %v", feedID, err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, filters)
+}
+
+// HandleCreate serves POST /api/feeds/{id}/filters, adding a filter given as
+// {"filter_type": "...", "pattern": "..."}. url_pattern_block patterns must
+// be valid regular expressions.
+func (h *FeedFilterHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	feedID, ok := feedIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req createFeedFilterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	filter := model.FeedFilter{FeedID: feedID, FilterType: req.FilterType, Pattern: strings.TrimSpace(req.Pattern)}
+	switch filter.FilterType {
+	case model.FeedFilterAuthorBlock, model.FeedFilterAuthorAllow:
+	case model.FeedFilterURLPatternBlock:
+		if _, err := regexp.Compile(filter.Pattern); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid pattern, must be a regular expression")
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid filter_type, expected author_block, url_pattern_block or author_allow")
+		return
+	}
+	if filter.Pattern == "" {
+		writeError(w, http.StatusBadRequest, "Invalid pattern, must not be empty")
+		return
+	}
+
+	if err := h.filterRepo.Add(r.Context(), &filter); err != nil {
+		log.Printf("Error adding filter to feed %d: %v", feedID, err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	log.Printf("Added %s filter %q to feed %d", filter.FilterType, filter.Pattern, feedID)
+	writeJSON(w, http.StatusCreated, filter)
+}
+
+// HandleDelete serves DELETE /api/feeds/{id}/filters/{filterID}.
+func (h *FeedFilterHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	feedID, ok := feedIDParam(w, r)
+	if !ok {
+		return
+	}
+	filterID, err := strconv.Atoi(r.PathValue("filterID"))
+	if err != nil || filterID <= 0 {
+		writeError(w, http.StatusBadRequest, "Invalid filter ID")
+		return
+	}
+
+	err = h.filterRepo.Remove(r.Context(), feedID, filterID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "Filter not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error removing filter %d of feed %d: %v", filterID, feedID, err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func feedIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	feedID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || feedID <= 0 {
+		writeError(w, http.StatusBadRequest, "Invalid feed ID")
+		return 0, false
+	}
+	return feedID, true
+}
+
+// filteredReason returns why the filters of its feed exclude an entry, or ""
+// when it is kept. Authors are compared case-insensitively and invalid URL
+// patterns, which the API refuses, are ignored.
+func filteredReason(filters []model.FeedFilter, entry model.Entry) string {
+	author := strings.TrimSpace(entry.Author)
+	allowlist, allowed := false, false
+	for _, filter := range filters {
+		switch filter.FilterType {
+		case model.FeedFilterAuthorBlock:
+			if strings.EqualFold(author, filter.Pattern) {
+				return "author " + author + " is blocked"
+			}
+		case model.FeedFilterURLPatternBlock:
+			re, err := regexp.Compile(filter.Pattern)
+			if err == nil && re.MatchString(entry.URL) {
+				return "URL matches blocked pattern " + filter.Pattern
+			}
+		case model.FeedFilterAuthorAllow:
+			allowlist = true
+			if strings.EqualFold(author, filter.Pattern) {
+				allowed = true
+			}
+		}
+	}
+	if allowlist && !allowed {
+		return "author " + author + " is not allowed"
+	}
+	return ""
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// gzipMinSize is the smallest response body worth compressing.
+const gzipMinSize = 1024
+
+// GzipMiddleware compresses responses for clients that accept gzip. Bodies
+// smaller than gzipMinSize are sent as-is.
+func GzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		defer gw.Close()
+
+		next.ServeHTTP(gw, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		encoding := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if strings.EqualFold(encoding, "gzip") {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the first gzipMinSize bytes of the response to
+// decide whether compression is worthwhile before any header is written.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buf         bytes.Buffer
+	gz          *gzip.Writer
+	passthrough bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf.Write(p)
+	if w.buf.Len() < gzipMinSize {
+		return len(p), nil
+	}
+
+	if err := w.startGzip(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *gzipResponseWriter) startGzip() error {
+	header := w.ResponseWriter.Header()
+	if header.Get("Content-Encoding") != "" {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(w.status)
+		_, err := w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+		return err
+	}
+
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+	_, err := w.gz.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// Close flushes any buffered data. Responses that never reached gzipMinSize
+// are written uncompressed.
+func (w *gzipResponseWriter) Close() error {
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	if w.passthrough {
+		return nil
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	return err
+}
+
+func (w *gzipResponseWriter) Flush() {
+	if w.gz == nil && !w.passthrough && w.buf.Len() > 0 {
+		if err := w.startGzip(); err != nil {
+			return
+		}
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serveGzip(t *testing.T, acceptEncoding string, status int, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	h := GzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGzipMiddlewareCompressesLargeResponses(t *testing.T) {
+	body := `{"posts":[` + strings.Repeat(`{"title":"post"},`, 200) + `{}]}`
+	rec := serveGzip(t, "deflate, gzip;q=0.9", http.StatusCreated, body)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if rec.Code != http.StatusCreated {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusCreated)
+	}
+	if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want Accept-Encoding", got)
+	}
+	if rec.Body.Len() >= len(body) {
+		t.Errorf("compressed body is %d bytes, not smaller than %d", rec.Body.Len(), len(body))
+	}
+
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	decompressed, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("decompressing: %v", err)
+	}
+	if string(decompressed) != body {
+		t.Errorf("decompressed body differs from the original")
+	}
+}
+
+func TestGzipMiddlewareSkips(t *testing.T) {
+	large := strings.Repeat("a", gzipMinSize)
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		body           string
+	}{
+		{"gzip not accepted", "", large},
+		{"other encoding only", "br, deflate", large},
+		{"below threshold", "gzip", strings.Repeat("a", gzipMinSize-1)},
+		{"empty body", "gzip", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveGzip(t, tt.acceptEncoding, http.StatusOK, tt.body)
+			if got := rec.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("Content-Encoding = %q, want none", got)
+			}
+			if rec.Body.String() != tt.body {
+				t.Errorf("body = %d bytes, want the %d bytes sent", rec.Body.Len(), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestGzipMiddlewareKeepsExistingEncoding(t *testing.T) {
+	body := strings.Repeat("b", 2*gzipMinSize)
+	h := GzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		io.WriteString(w, body)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/export", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "br" {
+		t.Errorf("Content-Encoding = %q, want br", got)
+	}
+	if rec.Body.String() != body {
+		t.Error("body was changed despite an existing Content-Encoding")
+	}
+}
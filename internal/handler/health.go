@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"lewdarchive/internal/repository"
+	"lewdarchive/internal/scheduler"
+	"lewdarchive/internal/service"
+	"lewdarchive/pkg/database"
+)
+
+const (
+	// healthCheckTimeout bounds each check of /health/details.
+	healthCheckTimeout = 5 * time.Second
+	// databaseCheckTTL is how long /health reuses the last database check, so
+	// that frequent load balancer probes don't each write to the database.
+	databaseCheckTTL = 30 * time.Second
+)
+
+type HealthHandler struct {
+	db               *sql.DB
+	archiveService   *service.ArchiveService
+	chibisafeService *service.ChibisafeService
+	discordService   *service.DiscordService
+	minifluxService  *service.MinifluxService
+	retryQueue       *repository.RetryQueueRepository
+	tasks            *scheduler.Scheduler
+	startedAt        time.Time
+
+	dbCheck     databaseHealth
+	dbCheckedAt time.Time
+	dbCheckMu   sync.Mutex
+	// migrated is set once the schema was found up to date, which it stays.
+	migrated atomic.Bool
+	// draining is set on shutdown so that /readyz turns traffic away.
+	draining atomic.Bool
+}
+
+func NewHealthHandler(db *sql.DB, archiveService *service.ArchiveService, chibisafeService *service.ChibisafeService, discordService *service.DiscordService, minifluxService *service.MinifluxService, retryQueue *repository.RetryQueueRepository, tasks *scheduler.Scheduler, startedAt time.Time) *HealthHandler {
+	return &HealthHandler{
+		db:               db,
+		archiveService:   archiveService,
+		chibisafeService: chibisafeService,
+		discordService:   discordService,
+		minifluxService:  minifluxService,
+		retryQueue:       retryQueue,
+		tasks:            tasks,
+		startedAt:        startedAt,
+	}
+}
+
+type databaseHealth struct {
+	Reachable bool   `json:"reachable"`
+	Writable  bool   `json:"writable"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (d databaseHealth) usable() bool {
+	return d.Reachable && d.Writable
+}
+
+type galleryDLHealth struct {
+	Available bool   `json:"available"`
+	Version   string `json:"version,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type queueHealth struct {
+	DownloadsQueued int `json:"downloads_queued"`
+	DownloadsActive int `json:"downloads_active"`
+	DiscordPending  int `json:"discord_pending"`
+	UploadRetries   int `json:"upload_retries"`
+}
+
+// dependencyHealth tells when a call to an external service last succeeded.
+type dependencyHealth struct {
+	Configured  bool       `json:"configured"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+}
+
+type healthDetails struct {
+	Status        string                      `json:"status"`
+	Timestamp     string                      `json:"timestamp"`
+	StartedAt     string                      `json:"started_at"`
+	UptimeSeconds int64                       `json:"uptime_seconds"`
+	Database      databaseHealth              `json:"database"`
+	GalleryDL     galleryDLHealth             `json:"gallery_dl"`
+	ArchiveDirs   []service.DirStatus         `json:"archive_dirs"`
+	Queues        queueHealth                 `json:"queues"`
+	Dependencies  map[string]dependencyHealth `json:"dependencies"`
+	Miniflux      service.MinifluxHealth      `json:"miniflux"`
+	Tasks         []scheduler.TaskStatus      `json:"tasks"`
+}
+
+// checkDatabase runs a query and a write against the database.
+func (h *HealthHandler) checkDatabase(ctx context.Context) databaseHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	var health databaseHealth
+	if err := database.Ping(ctx, h.db); err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.Reachable = true
+	if err := database.CheckWritable(ctx, h.db); err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.Writable = true
+	return health
+}
+
+// cachedDatabaseCheck returns the last database check unless it is older than
+// databaseCheckTTL or failed.
+func (h *HealthHandler) cachedDatabaseCheck(ctx context.Context) databaseHealth {
+	h.dbCheckMu.Lock()
+	defer h.dbCheckMu.Unlock()
+
+	if h.dbCheck.usable() && time.Since(h.dbCheckedAt) < databaseCheckTTL {
+		return h.dbCheck
+	}
+	h.dbCheck = h.checkDatabase(ctx)
+	h.dbCheckedAt = time.Now()
+	return h.dbCheck
+}
+
+// Drain makes /readyz answer 503 from now on, so that load balancers stop
+// sending requests before the server shuts down.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// checkMigrated reports whether every migration was applied, only checking
+// the schema until it is.
+func (h *HealthHandler) checkMigrated() bool {
+	if h.migrated.Load() {
+		return true
+	}
+	if err := database.CheckMigrated(h.db); err != nil {
+		log.Printf("Readiness check failed: %v", err)
+		return false
+	}
+	h.migrated.Store(true)
+	return true
+}
+
+// HandleLive serves /livez, the liveness probe. It always answers 200 since
+// answering at all shows the process isn't stuck; the dependencies are left
+// to /readyz so that their outages don't get the process restarted.
+func (h *HealthHandler) HandleLive(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":    "OK",
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// HandleReady serves /readyz, the readiness probe, and /health, kept as its
+// alias. It answers 503 while shutting down, when the database can't be read
+// or written or its migrations are missing, and before the download workers
+// started; the external services don't affect it.
+func (h *HealthHandler) HandleReady(w http.ResponseWriter, r *http.Request) {
+	db := h.cachedDatabaseCheck(r.Context())
+	checks := map[string]bool{
+		"database":   db.usable(),
+		"migrations": db.Reachable && h.checkMigrated(),
+		"workers":    h.archiveService.WorkersStarted(),
+	}
+	response := map[string]interface{}{
+		"status":    "OK",
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"service":   "lewdarchive",
+		"version":   "1.1.2",
+		"checks":    checks,
+	}
+
+	if h.draining.Load() {
+		response["status"] = "SHUTTING_DOWN"
+		writeJSON(w, http.StatusServiceUnavailable, response)
+		return
+	}
+	if !db.usable() {
+		log.Printf("Readiness check failed: %s", db.Error)
+	}
+	for _, ok := range checks {
+		if !ok {
+			response["status"] = "UNAVAILABLE"
+			writeJSON(w, http.StatusServiceUnavailable, response)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleDetails serves GET /health/details and GET /api/health, reporting
+// the state of the database, gallery-dl, the archive directories and the
+// download queues, when the external services last answered and when the
+// scheduled tasks last ran. Unlike /readyz it may wait for a probe, so
+// probes should keep using /livez and /readyz. Like /readyz it answers 503
+// when the database is unusable; any other problem only makes it DEGRADED.
+func (h *HealthHandler) HandleDetails(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	details := healthDetails{
+		Status:        "OK",
+		Timestamp:     now.Format(time.RFC3339),
+		StartedAt:     h.startedAt.UTC().Format(time.RFC3339),
+		UptimeSeconds: int64(now.Sub(h.startedAt).Seconds()),
+		Database:      h.checkDatabase(r.Context()),
+		Miniflux:      h.minifluxService.Health(r.Context()),
+		Tasks:         h.tasks.Status(),
+		Dependencies: map[string]dependencyHealth{
+			"miniflux": {
+				Configured:  h.minifluxService.IsConfigured(),
+				LastSuccess: h.minifluxService.LastSuccess(),
+			},
+			"chibisafe": {
+				Configured:  h.chibisafeService.IsConfigured(),
+				LastSuccess: h.chibisafeService.LastSuccess(),
+			},
+			"discord": {Configured: h.discordService != nil},
+		},
+	}
+	degraded := details.Miniflux.Status == service.MinifluxStatusDegraded
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	version, err := service.GalleryDLVersion(ctx)
+	cancel()
+	if err != nil {
+		details.GalleryDL.Error = err.Error()
+		degraded = true
+	} else {
+		details.GalleryDL = galleryDLHealth{Available: true, Version: version}
+	}
+
+	for _, dir := range h.archiveService.ArchiveRoots() {
+		status := service.CheckDir(dir)
+		degraded = degraded || !status.Writable
+		details.ArchiveDirs = append(details.ArchiveDirs, status)
+	}
+
+	details.Queues.DownloadsQueued, details.Queues.DownloadsActive = h.archiveService.QueueDepth()
+	if h.discordService != nil {
+		details.Queues.DiscordPending = h.discordService.Pending()
+		details.Dependencies["discord"] = dependencyHealth{Configured: true, LastSuccess: h.discordService.LastSuccess()}
+	}
+	if details.Database.Reachable {
+		if details.Queues.UploadRetries, err = h.retryQueue.Count(); err != nil {
+			log.Printf("Error counting upload retries: %v", err)
+		}
+	}
+
+	status := http.StatusOK
+	switch {
+	case !details.Database.usable():
+		details.Status = "UNAVAILABLE"
+		status = http.StatusServiceUnavailable
+	case degraded:
+		details.Status = "DEGRADED"
+	}
+	writeJSON(w, status, details)
+}
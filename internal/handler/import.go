@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/service"
+)
+
+type ImportHandler struct {
+	archiveService *service.ArchiveService
+}
+
+func NewImportHandler(archiveService *service.ArchiveService) *ImportHandler {
+	return &ImportHandler{
+		archiveService: archiveService,
+	}
+}
+
+// importResponse is the body of POST /api/import.
+type importResponse struct {
+	Created int                  `json:"created"`
+	Skipped int                  `json:"skipped"`
+	Failed  int                  `json:"failed"`
+	Results []model.ImportResult `json:"results"`
+}
+
+// importDecoder reads the records of a JSON array or of NDJSON one at a time.
+type importDecoder struct {
+	dec     *json.Decoder
+	inArray bool
+}
+
+func newImportDecoder(body io.Reader) (*importDecoder, error) {
+	br := bufio.NewReader(body)
+	d := &importDecoder{}
+	for {
+		b, err := br.Peek(1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(b)) > 0 {
+			d.inArray = b[0] == '['
+			break
+		}
+		br.ReadByte()
+	}
+
+	d.dec = json.NewDecoder(br)
+	if d.inArray {
+		if _, err := d.dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// next returns the next record, or io.EOF after the last one.
+func (d *importDecoder) next() (json.RawMessage, error) {
+	if d.inArray && !d.dec.More() {
+		if _, err := d.dec.Token(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	var raw json.RawMessage
+	if err := d.dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// HandleImport serves POST /api/import, storing posts archived by another
+// tool. The body is a JSON array or NDJSON stream of model.ImportRecord,
+// imported one at a time; records whose hash or URL is already archived are
+// skipped, so an import can be re-run. Records with a path are marked as
+// downloaded, and with ?download=true the others are queued for download at
+// low priority.
+func (h *ImportHandler) HandleImport(w http.ResponseWriter, r *http.Request) {
+	download, err := boolParam(r.URL.Query().Get("download"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid download")
+		return
+	}
+
+	dec, err := newImportDecoder(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	response := importResponse{Results: []model.ImportResult{}}
+	var queue []*model.Post
+	var invalid string
+	for index := 0; ; index++ {
+		raw, err := dec.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			invalid = fmt.Sprintf("Invalid JSON after %d records: %v", index, err)
+			break
+		}
+
+		var result model.ImportResult
+		var record model.ImportRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			result = model.ImportResult{Status: model.ImportStatusError, Error: "invalid record: " + err.Error()}
+		} else {
+			var post *model.Post
+			result, post = h.archiveService.Import(record)
+			if post != nil && download {
+				queue = append(queue, post)
+			}
+		}
+		result.Index = index
+
+		switch result.Status {
+		case model.ImportStatusCreated:
+			response.Created++
+		case model.ImportStatusSkipped:
+			response.Skipped++
+		default:
+			response.Failed++
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	log.Printf("Import finished: %d created, %d skipped, %d failed", response.Created, response.Skipped, response.Failed)
+
+	// The low priority queue only takes a download when a worker is idle, so
+	// the imported posts are queued after responding.
+	if len(queue) > 0 {
+		ctx := context.WithoutCancel(r.Context())
+		go func() {
+			for _, post := range queue {
+				h.archiveService.Enqueue(ctx, post, service.DownloadPriorityLow)
+			}
+		}()
+	}
+
+	// The records before invalid JSON are imported all the same, so they are
+	// reported along with the error.
+	if invalid != "" {
+		writeErrorDetails(w, http.StatusBadRequest, invalid, map[string]interface{}{
+			"created": response.Created,
+			"skipped": response.Skipped,
+			"failed":  response.Failed,
+			"results": response.Results,
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/service"
+)
+
+type JobHandler struct {
+	jobService *service.JobService
+}
+
+func NewJobHandler(jobService *service.JobService) *JobHandler {
+	return &JobHandler{
+		jobService: jobService,
+	}
+}
+
+// jobFilter reads ?type=, ?status= and ?error_class=.
+func jobFilter(r *http.Request) (service.JobFilter, string) {
+	query := r.URL.Query()
+	filter := service.JobFilter{
+		Type:       model.JobType(query.Get("type")),
+		Status:     model.JobStatus(query.Get("status")),
+		ErrorClass: model.ErrorClass(query.Get("error_class")),
+	}
+	switch filter.Type {
+	case "", model.JobTypeDownload, model.JobTypeUpload:
+	default:
+		return filter, "Invalid type, expected download or upload"
+	}
+	switch filter.Status {
+	case "", model.JobStatusQueued, model.JobStatusRunning, model.JobStatusFailed:
+	default:
+		return filter, "Invalid status, expected queued, running or failed"
+	}
+	switch filter.ErrorClass {
+	case "", model.ErrorClassTransient, model.ErrorClassPermanent:
+	default:
+		return filter, "Invalid error_class, expected transient or permanent"
+	}
+	return filter, ""
+}
+
+// HandleList serves GET /api/jobs, the downloads and Chibisafe uploads that
+// have not succeeded, filtered on ?type=, ?status= and ?error_class=.
+func (h *JobHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	filter, problem := jobFilter(r)
+	if problem != "" {
+		writeError(w, http.StatusBadRequest, problem)
+		return
+	}
+
+	jobs, err := h.jobService.List(filter)
+	if err != nil {
+		log.Printf("Error listing jobs: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// HandleRetry serves POST /api/jobs/{id}/retry, requeueing a failed job. A job
+// that is already queued or running answers 409 along with its state.
+func (h *JobHandler) HandleRetry(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobService.Retry(r.Context(), r.PathValue("id"))
+	if errors.Is(err, service.ErrJobNotFound) {
+		writeError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	if errors.Is(err, service.ErrJobActive) {
+		writeErrorDetails(w, http.StatusConflict, "Job already queued or running", map[string]interface{}{
+			"job": job,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error retrying job %s: %v", r.PathValue("id"), err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	log.Printf("Job %s requeued", job.ID)
+	writeJSON(w, http.StatusOK, job)
+}
+
+// HandleRetryAll serves POST /api/jobs/retry-all, requeueing every failed job
+// matching ?type= and ?error_class=. ?status= may only be failed.
+func (h *JobHandler) HandleRetryAll(w http.ResponseWriter, r *http.Request) {
+	filter, problem := jobFilter(r)
+	if problem == "" && filter.Status != "" && filter.Status != model.JobStatusFailed {
+		problem = "Only failed jobs can be retried"
+	}
+	if problem != "" {
+		writeError(w, http.StatusBadRequest, problem)
+		return
+	}
+
+	jobs, err := h.jobService.RetryAll(r.Context(), filter)
+	if err != nil {
+		log.Printf("Error retrying jobs: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"retried": len(jobs),
+		"jobs":    jobs,
+	})
+}
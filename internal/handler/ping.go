@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"lewdarchive/internal/service"
+)
+
+const pingTimeout = 5 * time.Second
+
+type PingHandler struct {
+	db               *sql.DB
+	minifluxService  *service.MinifluxService
+	chibisafeService *service.ChibisafeService
+	discordService   *service.DiscordService
+}
+
+func NewPingHandler(db *sql.DB, minifluxService *service.MinifluxService, chibisafeService *service.ChibisafeService, discordService *service.DiscordService) *PingHandler {
+	return &PingHandler{
+		db:               db,
+		minifluxService:  minifluxService,
+		chibisafeService: chibisafeService,
+		discordService:   discordService,
+	}
+}
+
+// pingResponse holds the round-trip latencies. A latency is null when the
+// dependency is not configured or the request failed, in which case Errors
+// says why.
+type pingResponse struct {
+	SQLiteMS         *float64          `json:"sqlite_ms"`
+	MinifluxMS       *float64          `json:"miniflux_ms"`
+	ChibisafeMS      *float64          `json:"chibisafe_ms"`
+	DiscordReachable bool              `json:"discord_reachable"`
+	Errors           map[string]string `json:"errors,omitempty"`
+}
+
+// HandlePing serves GET /api/ping, measuring concurrently how long a minimal
+// request to each dependency takes. It is a diagnostic rather than a health
+// check, so it always answers 200.
+func (h *PingHandler) HandlePing(w http.ResponseWriter, r *http.Request) {
+	var resp pingResponse
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	measure := func(name string, latency **float64, ping func(context.Context) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), pingTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := ping(ctx)
+			ms := float64(time.Since(start).Microseconds()) / 1000
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if resp.Errors == nil {
+					resp.Errors = make(map[string]string)
+				}
+				resp.Errors[name] = err.Error()
+				log.Printf("DEBUG: ping %s failed after %.1fms: %v", name, ms, err)
+				return
+			}
+			if latency != nil {
+				*latency = &ms
+			}
+			log.Printf("DEBUG: ping %s took %.1fms", name, ms)
+		}()
+	}
+
+	measure("sqlite", &resp.SQLiteMS, func(ctx context.Context) error {
+		var one int
+		return h.db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+	})
+	if h.minifluxService.IsConfigured() {
+		measure("miniflux", &resp.MinifluxMS, h.minifluxService.Ping)
+	}
+	if h.chibisafeService.IsConfigured() {
+		measure("chibisafe", &resp.ChibisafeMS, h.chibisafeService.Ping)
+	}
+	if h.discordService != nil {
+		measure("discord", nil, func(ctx context.Context) error {
+			err := h.discordService.Ping(ctx)
+			if err == nil {
+				mu.Lock()
+				resp.DiscordReachable = true
+				mu.Unlock()
+			}
+			return err
+		})
+	}
+	wg.Wait()
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,636 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/repository"
+	"lewdarchive/internal/service"
+	"lewdarchive/internal/utils"
+)
+
+const (
+	downloadLogLimit = 10
+	postsLimit       = 50
+	maxPostsLimit    = 500
+)
+
+type PostHandler struct {
+	postRepo        *repository.PostRepository
+	downloadLogRepo *repository.DownloadLogRepository
+	postFileRepo    *repository.PostFileRepository
+	archiveService  *service.ArchiveService
+	discordService  *service.DiscordService
+	minifluxService *service.MinifluxService
+	sanitizeContent bool
+}
+
+func NewPostHandler(postRepo *repository.PostRepository, downloadLogRepo *repository.DownloadLogRepository, postFileRepo *repository.PostFileRepository, archiveService *service.ArchiveService, discordService *service.DiscordService, minifluxService *service.MinifluxService, sanitizeContent bool) *PostHandler {
+	return &PostHandler{
+		postRepo:        postRepo,
+		downloadLogRepo: downloadLogRepo,
+		postFileRepo:    postFileRepo,
+		archiveService:  archiveService,
+		discordService:  discordService,
+		minifluxService: minifluxService,
+		sanitizeContent: sanitizeContent,
+	}
+}
+
+// patchPostRequest is the body of PATCH /api/posts/{hash}; omitted fields are
+// left unchanged.
+type patchPostRequest struct {
+	Title         *string `json:"title"`
+	Author        *string `json:"author"`
+	CategoryTitle *string `json:"category_title"`
+}
+
+type resendDiscordRequest struct {
+	OverrideWebhookURL string `json:"override_webhook_url"`
+}
+
+// postListResponse is a page of GET /api/posts. NextOffset is null on the
+// last page.
+type postListResponse struct {
+	Posts      []model.Post `json:"posts"`
+	Total      int          `json:"total"`
+	Limit      int          `json:"limit"`
+	Offset     int          `json:"offset"`
+	NextOffset *int         `json:"next_offset"`
+}
+
+// HandleList serves GET /api/posts, the most recently archived posts with
+// their tags, a page at a time. It filters on ?author=, ?category=, ?tag=,
+// ?site=, ?status=, ?q= (title substring) and ?from=/?to= (publication time,
+// RFC 3339 or YYYY-MM-DD, to being exclusive for timestamps and inclusive for
+// dates), and pages with ?limit= (default 50, max 500) and ?offset=.
+func (h *PostHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := positiveIntParam(query.Get("limit"), postsLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+	offset := 0
+	if value := query.Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid offset")
+			return
+		}
+	}
+
+	filter, problem := postFilter(r)
+	if problem != "" {
+		writeError(w, http.StatusBadRequest, problem)
+		return
+	}
+	filter.Limit = min(limit, maxPostsLimit)
+	filter.Offset = offset
+
+	total, err := h.postRepo.Count(filter)
+	if err != nil {
+		log.Printf("Error counting posts: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	posts, err := h.postRepo.List(filter)
+	if err != nil {
+		log.Printf("Error listing posts: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	tags, err := h.postRepo.ListTagsByPostIDs(ids)
+	if err != nil {
+		log.Printf("Error loading post tags: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	for i := range posts {
+		posts[i].Tags = tags[posts[i].ID]
+	}
+
+	response := postListResponse{
+		Posts:  posts,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}
+	if response.Posts == nil {
+		response.Posts = []model.Post{}
+	}
+	if next := filter.Offset + len(posts); next < total {
+		response.NextOffset = &next
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// postFilter reads the ?author=, ?category=, ?tag=, ?site=, ?status=, ?q=,
+// ?from= and ?to= filters shared by the post list and the export.
+func postFilter(r *http.Request) (repository.PostFilter, string) {
+	query := r.URL.Query()
+	filter := repository.PostFilter{
+		Author:   query.Get("author"),
+		Category: query.Get("category"),
+		Tag:      query.Get("tag"),
+		Site:     query.Get("site"),
+		Status:   model.DownloadStatus(query.Get("status")),
+		Query:    query.Get("q"),
+	}
+	if filter.Status != "" && !filter.Status.IsValid() {
+		return filter, "Invalid status"
+	}
+	var err error
+	if filter.From, _, err = timeParam(query.Get("from")); err != nil {
+		return filter, "Invalid from, expected RFC 3339 or YYYY-MM-DD"
+	}
+	to, dateOnly, err := timeParam(query.Get("to"))
+	if err != nil {
+		return filter, "Invalid to, expected RFC 3339 or YYYY-MM-DD"
+	}
+	if dateOnly {
+		to = to.AddDate(0, 0, 1)
+	}
+	filter.To = to
+	return filter, ""
+}
+
+// timeParam parses an optional RFC 3339 timestamp or YYYY-MM-DD date (UTC)
+// query parameter, reporting whether it was a date.
+func timeParam(value string) (time.Time, bool, error) {
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// postDetailResponse is the post returned by GET /api/posts/{hash}.
+type postDetailResponse struct {
+	Post          model.Post             `json:"post"`
+	Files         []model.PostFile       `json:"files"`
+	Download      postDownloadDetail     `json:"download"`
+	Notifications postNotificationDetail `json:"notifications"`
+}
+
+type postDownloadDetail struct {
+	Status    model.DownloadStatus `json:"status"`
+	Attempts  int                  `json:"attempts"`
+	LastError string               `json:"last_error,omitempty"`
+	History   []model.DownloadLog  `json:"history"`
+}
+
+type postNotificationDetail struct {
+	DiscordSent      bool   `json:"discord_sent"`
+	DiscordMessageID string `json:"discord_message_id,omitempty"`
+}
+
+// HandleGet serves GET /api/posts/{hash}: the post with its tags, its archived
+// files and their Chibisafe uploads, its recent download attempts and whether
+// it was announced on Discord.
+func (h *PostHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	post, err := h.postRepo.GetByHash(r.PathValue("hash"))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading post %s: %v", r.PathValue("hash"), err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	if post.Tags, err = h.postRepo.GetTags(post.ID); err != nil {
+		log.Printf("Error loading tags for post %s: %v", post.Hash, err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	files, err := h.postFileRepo.ListByPostID(post.ID)
+	if err != nil {
+		log.Printf("Error loading files for post %s: %v", post.Hash, err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	logs, err := h.downloadLogRepo.ListByPostID(post.ID, downloadLogLimit)
+	if err != nil {
+		log.Printf("Error loading download log for post %s: %v", post.Hash, err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	response := postDetailResponse{
+		Post:  *post,
+		Files: files,
+		Download: postDownloadDetail{
+			Status:   post.DownloadStatus,
+			Attempts: post.DownloadAttempts,
+			History:  logs,
+		},
+		Notifications: postNotificationDetail{
+			DiscordSent:      post.DiscordMessageID != "",
+			DiscordMessageID: post.DiscordMessageID,
+		},
+	}
+	if response.Files == nil {
+		response.Files = []model.PostFile{}
+	}
+	if response.Download.History == nil {
+		response.Download.History = []model.DownloadLog{}
+	}
+	if len(logs) > 0 && logs[0].ExitCode != 0 {
+		response.Download.LastError = lastLine(logs[0].StderrLines)
+		if response.Download.LastError == "" {
+			response.Download.LastError = "gallery-dl exited with code " + strconv.Itoa(logs[0].ExitCode)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// lastLine returns the last non-blank line of s.
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// HandleDownloadLog serves GET /api/posts/{hash}/download-log.
+func (h *PostHandler) HandleDownloadLog(w http.ResponseWriter, r *http.Request) {
+	post, err := h.postRepo.GetByHash(r.PathValue("hash"))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading post %s: %v", r.PathValue("hash"), err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	logs, err := h.downloadLogRepo.ListByPostID(post.ID, downloadLogLimit)
+	if err != nil {
+		log.Printf("Error loading download log for post %s: %v", post.Hash, err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, logs)
+}
+
+// HandleFiles serves GET /api/posts/{hash}/files, the files in the post's
+// archive directory. It answers 404 when the post was not downloaded yet or
+// its files were cleaned up after uploading.
+func (h *PostHandler) HandleFiles(w http.ResponseWriter, r *http.Request) {
+	post, err := h.postRepo.GetByHash(r.PathValue("hash"))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading post %s: %v", r.PathValue("hash"), err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	files, err := h.archiveService.LocalFiles(post)
+	if errors.Is(err, fs.ErrNotExist) {
+		writeError(w, http.StatusNotFound, "Archive directory not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing files of post %s: %v", post.Hash, err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, files)
+}
+
+// HandleRedownload serves POST /api/posts/{hash}/redownload, queueing the post
+// for download at high priority. gallery-dl skips the files it already has
+// and only new ones are uploaded.
+func (h *PostHandler) HandleRedownload(w http.ResponseWriter, r *http.Request) {
+	post, err := h.postRepo.GetByHash(r.PathValue("hash"))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading post %s: %v", r.PathValue("hash"), err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	if !h.archiveService.TryEnqueue(context.WithoutCancel(r.Context()), post, service.DownloadPriorityHigh) {
+		writeError(w, http.StatusConflict, "Download already queued or running")
+		return
+	}
+	log.Printf("Re-download of %s requested", post.Hash)
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"hash":   post.Hash,
+		"status": "queued",
+	})
+}
+
+// HandleReupload serves POST /api/posts/{hash}/reupload, uploading the post's
+// archived files to Chibisafe again in the background. It fails with 409 when
+// the files are no longer on disk, in which case the post must be
+// re-downloaded instead.
+func (h *PostHandler) HandleReupload(w http.ResponseWriter, r *http.Request) {
+	if !h.archiveService.UploadsEnabled() {
+		writeError(w, http.StatusServiceUnavailable, "Chibisafe is not configured")
+		return
+	}
+
+	post, err := h.postRepo.GetByHash(r.PathValue("hash"))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading post %s: %v", r.PathValue("hash"), err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	if _, err := h.archiveService.ArchiveDirFor(post); err != nil {
+		writeError(w, http.StatusConflict, "Archived files not found, re-download the post instead")
+		return
+	}
+
+	go func() {
+		if _, err := h.archiveService.Reupload(context.WithoutCancel(r.Context()), post); err != nil {
+			log.Printf("Re-upload of %s failed: %v", post.Hash, err)
+		}
+	}()
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"hash":   post.Hash,
+		"status": "uploading",
+	})
+}
+
+// HandleDelete serves DELETE /api/posts/{hash}, removing the post's rows and
+// archive directory and, with ?purge_remote=true, its Chibisafe uploads.
+// ?dry_run=true only reports what would be removed. Deleting a post that is
+// already gone answers 404.
+func (h *PostHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	dryRun, err := boolParam(query.Get("dry_run"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid dry_run")
+		return
+	}
+	purgeRemote, err := boolParam(query.Get("purge_remote"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid purge_remote")
+		return
+	}
+	if purgeRemote && !h.archiveService.UploadsEnabled() {
+		writeError(w, http.StatusServiceUnavailable, "Chibisafe is not configured")
+		return
+	}
+
+	post, err := h.postRepo.GetByHash(r.PathValue("hash"))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading post %s: %v", r.PathValue("hash"), err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	if h.archiveService.IsActive(post.ID) && !dryRun {
+		writeError(w, http.StatusConflict, "Download queued or running, try again once it finished")
+		return
+	}
+
+	summary, err := h.archiveService.DeletePost(r.Context(), post, service.DeleteOptions{
+		PurgeRemote: purgeRemote,
+		DryRun:      dryRun,
+	})
+	if err == service.ErrRemotePurgeIncomplete {
+		log.Printf("Deleting post %s: %d Chibisafe files could not be deleted", post.Hash, len(summary.RemoteErrors))
+		writeErrorDetails(w, http.StatusBadGateway, "Some Chibisafe files could not be deleted", map[string]interface{}{
+			"summary": summary,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting post %s: %v", post.Hash, err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// HandlePatch serves PATCH /api/posts/{hash}, correcting the post's title,
+// author or category title and answering with the updated post. The archive
+// directory, named after the author and category, is not moved.
+func (h *PostHandler) HandlePatch(w http.ResponseWriter, r *http.Request) {
+	var req patchPostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	fields := make(map[string]string)
+	for column, value := range map[string]*string{
+		"title":          req.Title,
+		"author":         req.Author,
+		"category_title": req.CategoryTitle,
+	} {
+		if value == nil {
+			continue
+		}
+		if strings.TrimSpace(*value) == "" {
+			writeError(w, http.StatusBadRequest, "Invalid "+column+", must not be empty")
+			return
+		}
+		fields[column] = strings.TrimSpace(*value)
+	}
+	if len(fields) == 0 {
+		writeError(w, http.StatusBadRequest, "Nothing to update, expected title, author or category_title")
+		return
+	}
+
+	post, err := h.postRepo.GetByHash(r.PathValue("hash"))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading post %s: %v", r.PathValue("hash"), err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	archiveDir, dirErr := h.archiveService.ArchiveDirFor(post)
+
+	if err := h.postRepo.PatchMetadata(post.Hash, fields); err != nil {
+		log.Printf("Error patching post %s: %v", post.Hash, err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	updated, err := h.postRepo.GetByHash(post.Hash)
+	if err == nil {
+		updated.Tags, err = h.postRepo.GetTags(updated.ID)
+	}
+	if err != nil {
+		log.Printf("Error loading post %s: %v", post.Hash, err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	log.Printf("Metadata of post %s corrected: %v", post.Hash, fields)
+
+	moved := updated.Author != post.Author || updated.CategoryTitle != post.CategoryTitle
+	if moved && dirErr == nil {
+		log.Printf("WARNING: Archive directory %s of post %s is named after its old author or category and must be renamed manually", archiveDir, post.Hash)
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// boolParam parses an optional boolean query parameter, false when absent.
+func boolParam(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// HandleResendDiscord serves POST /api/posts/{hash}/discord, sending the post's
+// embed again, optionally to override_webhook_url instead of the configured
+// webhook, e.g. after the original message was deleted.
+func (h *PostHandler) HandleResendDiscord(w http.ResponseWriter, r *http.Request) {
+	if h.discordService == nil {
+		writeError(w, http.StatusServiceUnavailable, "Discord is not configured")
+		return
+	}
+
+	var req resendDiscordRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("Error reading request body: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+	}
+	if req.OverrideWebhookURL != "" {
+		u, err := url.Parse(req.OverrideWebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			writeError(w, http.StatusBadRequest, "Invalid override_webhook_url")
+			return
+		}
+	}
+
+	post, err := h.postRepo.GetByHash(r.PathValue("hash"))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading post %s: %v", r.PathValue("hash"), err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	feed, entry := post.Feed(), post.Entry()
+	var result *service.DiscordResponse
+	if req.OverrideWebhookURL != "" {
+		result, err = h.discordService.SendEmbedTo(req.OverrideWebhookURL, feed, entry)
+	} else {
+		result, err = h.discordService.SendEmbed(feed, entry)
+	}
+
+	response := map[string]interface{}{
+		"hash": post.Hash,
+	}
+	if result != nil {
+		response["discord_status"] = result.StatusCode
+		if result.MessageID != "" {
+			response["message_id"] = result.MessageID
+		}
+	}
+	if err != nil {
+		log.Printf("Resending Discord notification for %s failed: %v", post.Hash, err)
+		writeErrorDetails(w, http.StatusBadGateway, "Discord request failed", response)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleRefreshContent serves POST /api/posts/{hash}/refresh-content, replacing
+// the stored content with the entry's current content in Miniflux, for feeds
+// whose content is filled in after the entry was first delivered.
+func (h *PostHandler) HandleRefreshContent(w http.ResponseWriter, r *http.Request) {
+	if !h.minifluxService.IsConfigured() {
+		writeError(w, http.StatusServiceUnavailable, "Miniflux API is not configured")
+		return
+	}
+
+	post, err := h.postRepo.GetByHash(r.PathValue("hash"))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading post %s: %v", r.PathValue("hash"), err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	entry, err := h.minifluxService.GetEntryByID(r.Context(), post.EntryID)
+	if err == service.ErrMinifluxEntryNotFound {
+		writeError(w, http.StatusNotFound, "Entry not found in Miniflux")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching entry %d for post %s: %v", post.EntryID, post.Hash, err)
+		writeErrorDetails(w, http.StatusBadGateway, "Miniflux request failed", map[string]interface{}{
+			"hash": post.Hash,
+		})
+		return
+	}
+
+	content := entry.Content
+	if h.sanitizeContent {
+		content = utils.SanitizeHTML(content)
+	}
+	if err := h.postRepo.Update(post.Hash, map[string]interface{}{"content": content}); err != nil {
+		log.Printf("Error updating content of post %s: %v", post.Hash, err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	log.Printf("Content refreshed for post %s from entry %d", post.Hash, post.EntryID)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"hash":    post.Hash,
+		"content": content,
+	})
+}
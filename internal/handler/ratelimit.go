@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitPruneInterval is how often idle per-IP limiters are dropped. A
+// limiter unused for a whole interval has refilled its bucket anyway.
+const rateLimitPruneInterval = 5 * time.Minute
+
+type ipLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen atomic.Int64
+}
+
+// RateLimitMiddleware allows each client IP rps requests per second with
+// bursts of up to burst requests, answering 429 with Retry-After beyond that.
+// Clients are told apart by the connection's remote address.
+func RateLimitMiddleware(rps float64, burst int) func(http.Handler) http.Handler {
+	var limiters sync.Map
+
+	go func() {
+		ticker := time.NewTicker(rateLimitPruneInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			cutoff := time.Now().Add(-rateLimitPruneInterval).UnixNano()
+			limiters.Range(func(key, value any) bool {
+				if value.(*ipLimiter).lastSeen.Load() < cutoff {
+					limiters.Delete(key)
+				}
+				return true
+			})
+		}
+	}()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := clientIP(r)
+			value, ok := limiters.Load(ip)
+			if !ok {
+				value, _ = limiters.LoadOrStore(ip, &ipLimiter{limiter: rate.NewLimiter(rate.Limit(rps), burst)})
+			}
+			entry := value.(*ipLimiter)
+			entry.lastSeen.Store(time.Now().UnixNano())
+
+			reservation := entry.limiter.Reserve()
+			if delay := reservation.Delay(); delay > 0 {
+				reservation.Cancel()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/telemetry"
+)
+
+// Sources recorded for posts received from readers other than Miniflux.
+const (
+	SourceFreshRSS = "freshrss"
+	SourceTTRSS    = "ttrss"
+)
+
+// HandleFreshRSS serves POST /webhook/freshrss, one new entry sent by the
+// FreshRSS Webhook extension as a model.FreshRSSEntry. The extension can't
+// sign requests, so FRESHRSS_WEBHOOK_TOKEN must be sent as
+// "Authorization: Bearer <token>", "X-Webhook-Token" or ?token=. The endpoint
+// is disabled until the token is set.
+func (h *WebhookHandler) HandleFreshRSS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.config.FreshRSSWebhookToken == "" {
+		log.Printf("Rejected FreshRSS webhook: FRESHRSS_WEBHOOK_TOKEN is not configured")
+		http.Error(w, "FreshRSS webhook disabled", http.StatusServiceUnavailable)
+		return
+	}
+	if !validAPIKey(h.config.FreshRSSWebhookToken, freshRSSToken(r)) {
+		log.Printf("Invalid FreshRSS webhook token")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, span := telemetry.StartSpan(r.Context(), "HandleFreshRSS")
+	defer span.End()
+
+	body, ok := h.readBody(w, r)
+	if !ok {
+		return
+	}
+	var entry model.FreshRSSEntry
+	if err := json.Unmarshal(body, &entry); err != nil {
+		log.Printf("Error parsing FreshRSS JSON: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	payload, err := freshRSSPayload(entry)
+	if err != nil {
+		log.Printf("Rejected FreshRSS entry: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.deliver(ctx, w, body, SourceFreshRSS, payload)
+}
+
+// HandleTTRSS serves POST /webhook/ttrss, the new articles of a Tiny Tiny RSS
+// feed as a model.TTRSSPayload. The body must be signed like Miniflux
+// webhooks, with the hex HMAC-SHA256 of the body keyed by TTRSS_WEBHOOK_SECRET
+// in X-TTRSS-Signature. The endpoint is disabled until the secret is set.
+func (h *WebhookHandler) HandleTTRSS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.config.TTRSSWebhookSecret == "" {
+		log.Printf("Rejected Tiny Tiny RSS webhook: TTRSS_WEBHOOK_SECRET is not configured")
+		http.Error(w, "Tiny Tiny RSS webhook disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, span := telemetry.StartSpan(r.Context(), "HandleTTRSS")
+	defer span.End()
+
+	body, ok := h.readBody(w, r)
+	if !ok {
+		return
+	}
+	if !hmacMatches(body, r.Header.Get("X-TTRSS-Signature"), h.config.TTRSSWebhookSecret) {
+		log.Printf("Invalid Tiny Tiny RSS webhook signature")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var ttrss model.TTRSSPayload
+	if err := json.Unmarshal(body, &ttrss); err != nil {
+		log.Printf("Error parsing Tiny Tiny RSS JSON: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	payload, err := ttrssPayload(ttrss)
+	if err != nil {
+		log.Printf("Rejected Tiny Tiny RSS articles: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.deliver(ctx, w, body, SourceTTRSS, payload)
+}
+
+// deliver runs a payload translated from another reader through the Miniflux
+// pipeline, skipping duplicate deliveries.
+func (h *WebhookHandler) deliver(ctx context.Context, w http.ResponseWriter, body []byte, source string, payload model.WebhookPayload) {
+	if !h.recordDelivery(body, source, payload) {
+		h.processPayload(ctx, payload, source)
+	}
+	h.writeSuccess(w)
+}
+
+func freshRSSToken(r *http.Request) string {
+	if token := requestAPIKey(r); token != "" {
+		return token
+	}
+	if token := r.Header.Get("X-Webhook-Token"); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("token")
+}
+
+// freshRSSPayload maps a FreshRSS entry to a new_entries payload.
+func freshRSSPayload(entry model.FreshRSSEntry) (model.WebhookPayload, error) {
+	siteURL, err := entrySiteURL(entry.URL)
+	if err != nil {
+		return model.WebhookPayload{}, err
+	}
+	if entry.SiteURL != "" {
+		siteURL = entry.SiteURL
+	}
+
+	publishedAt := entry.Date
+	if entry.DateTimestamp > 0 {
+		publishedAt = time.Unix(entry.DateTimestamp, 0).UTC().Format(time.RFC3339)
+	}
+	var enclosures []model.Enclosure
+	if entry.ThumbnailURL != "" {
+		enclosures = append(enclosures, model.Enclosure{URL: entry.ThumbnailURL, MimeType: "image/*"})
+	}
+
+	return model.WebhookPayload{
+		EventType: "new_entries",
+		Feed: model.Feed{
+			SiteURL:  siteURL,
+			Title:    entry.FeedName,
+			FeedURL:  entry.FeedURL,
+			Category: model.Category{Title: entry.Category},
+		},
+		Entries: []model.Entry{{
+			Hash:        readerEntryHash(entry.URL),
+			Title:       entry.Title,
+			URL:         strings.TrimSpace(entry.URL),
+			PublishedAt: publishedAt,
+			Content:     entry.Content,
+			Author:      entry.Authors,
+			Enclosures:  enclosures,
+		}},
+	}, nil
+}
+
+// ttrssPayload maps the articles of a Tiny Tiny RSS feed to a new_entries
+// payload.
+func ttrssPayload(ttrss model.TTRSSPayload) (model.WebhookPayload, error) {
+	payload := model.WebhookPayload{
+		EventType: "new_entries",
+		Feed: model.Feed{
+			SiteURL:  ttrss.Feed.SiteURL,
+			Title:    ttrss.Feed.Title,
+			FeedURL:  ttrss.Feed.FeedURL,
+			Category: model.Category{Title: ttrss.Feed.CatTitle},
+		},
+	}
+
+	for _, article := range ttrss.Articles {
+		siteURL, err := entrySiteURL(article.Link)
+		if err != nil {
+			return model.WebhookPayload{}, err
+		}
+		if payload.Feed.SiteURL == "" {
+			payload.Feed.SiteURL = siteURL
+		}
+
+		var publishedAt string
+		if article.Updated > 0 {
+			publishedAt = time.Unix(article.Updated, 0).UTC().Format(time.RFC3339)
+		}
+		var enclosures []model.Enclosure
+		for _, attachment := range article.Attachments {
+			enclosures = append(enclosures, model.Enclosure{URL: attachment.ContentURL, MimeType: attachment.ContentType})
+		}
+
+		payload.Entries = append(payload.Entries, model.Entry{
+			Hash:        readerEntryHash(article.Link),
+			Title:       article.Title,
+			URL:         strings.TrimSpace(article.Link),
+			PublishedAt: publishedAt,
+			Content:     article.Content,
+			Author:      article.Author,
+			Enclosures:  enclosures,
+		})
+	}
+	return payload, nil
+}
+
+// entrySiteURL validates an entry URL and returns its scheme and host, the
+// site URL when the reader doesn't send one.
+func entrySiteURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("entry url must be an absolute http(s) URL")
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// readerEntryHash identifies an entry of another reader by the SHA-256 of its
+// URL, as imported posts are.
+func readerEntryHash(entryURL string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(entryURL)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"lewdarchive/internal/repository"
+)
+
+const (
+	searchLimit    = 20
+	maxSearchLimit = 100
+)
+
+type SearchHandler struct {
+	postRepo *repository.PostRepository
+}
+
+func NewSearchHandler(postRepo *repository.PostRepository) *SearchHandler {
+	return &SearchHandler{
+		postRepo: postRepo,
+	}
+}
+
+// HandleSearch serves GET /api/search?q=, the posts whose title, content or
+// author contain every word of q, best matches first, optionally narrowed
+// with ?author= and ?category=. ?limit= defaults to 20, max 100.
+func (h *SearchHandler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		writeError(w, http.StatusBadRequest, "Missing q")
+		return
+	}
+	limit, err := positiveIntParam(query.Get("limit"), searchLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+
+	results, err := h.postRepo.Search(repository.SearchFilter{
+		Query:    q,
+		Author:   query.Get("author"),
+		Category: query.Get("category"),
+		Limit:    min(limit, maxSearchLimit),
+	})
+	if errors.Is(err, repository.ErrSearchUnavailable) {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error searching posts: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
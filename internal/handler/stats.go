@@ -0,0 +1,262 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/repository"
+)
+
+const (
+	// statsCacheTTL bounds how often a polling dashboard recomputes the
+	// aggregates of GET /api/stats.
+	statsCacheTTL = time.Minute
+	// feedStatsCacheTTL is how long GET /api/feeds/{id}/stats is cached.
+	feedStatsCacheTTL = 60 * time.Second
+	statsTopAuthors   = 50
+	maxStatsDays      = 3650
+	failureRateDays   = 7
+)
+
+type StatsHandler struct {
+	postRepo *repository.PostRepository
+	feedRepo *repository.FeedRepository
+	cacheMu  sync.Mutex
+	cache    map[int]cachedStats
+
+	feedCacheMu sync.Mutex
+	feedCache   map[int]cachedFeedStats
+}
+
+func NewStatsHandler(postRepo *repository.PostRepository, feedRepo *repository.FeedRepository) *StatsHandler {
+	return &StatsHandler{
+		postRepo:  postRepo,
+		feedRepo:  feedRepo,
+		cache:     make(map[int]cachedStats),
+		feedCache: make(map[int]cachedFeedStats),
+	}
+}
+
+// statsResponse is GET /api/stats. Posts per day, authors and categories
+// cover the ?days= window, or the whole archive when Days is 0; storage and
+// status counts always cover the whole archive.
+type statsResponse struct {
+	model.ArchiveStats
+	Days          int                          `json:"days,omitempty"`
+	PostsPerDay   []model.DailyCount           `json:"posts_per_day"`
+	Authors       []model.NamedCount           `json:"authors"`
+	Categories    []model.NamedCount           `json:"categories"`
+	Statuses      map[model.DownloadStatus]int `json:"statuses"`
+	FailureRate7d float64                      `json:"failure_rate_7d"`
+	GeneratedAt   time.Time                    `json:"generated_at"`
+}
+
+type cachedStats struct {
+	stats   *statsResponse
+	expires time.Time
+}
+
+type cachedFeedStats struct {
+	stats   *model.FeedStats
+	expires time.Time
+}
+
+// HandleStats serves GET /api/stats: totals, posts archived per day, the
+// top authors, categories, counts by download status and the share of
+// downloads that failed over the last week. Results are cached for
+// statsCacheTTL per ?days= value.
+func (h *StatsHandler) HandleStats(w http.ResponseWriter, r *http.Request) {
+	days := 0
+	if value := r.URL.Query().Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxStatsDays {
+			writeError(w, http.StatusBadRequest, "Invalid days")
+			return
+		}
+		days = n
+	}
+
+	h.cacheMu.Lock()
+	defer h.cacheMu.Unlock()
+	if cached, ok := h.cache[days]; ok && time.Now().Before(cached.expires) {
+		writeJSON(w, http.StatusOK, cached.stats)
+		return
+	}
+
+	stats, err := h.loadStats(days)
+	if err != nil {
+		log.Printf("Error loading stats: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	now := time.Now()
+	for key, cached := range h.cache {
+		if now.After(cached.expires) {
+			delete(h.cache, key)
+		}
+	}
+	h.cache[days] = cachedStats{stats: stats, expires: now.Add(statsCacheTTL)}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// loadStats runs the aggregate queries of HandleStats.
+func (h *StatsHandler) loadStats(days int) (*statsResponse, error) {
+	now := time.Now().UTC()
+	var since time.Time
+	if days > 0 {
+		since = now.Truncate(24*time.Hour).AddDate(0, 0, -(days - 1))
+	}
+
+	totals, err := h.postRepo.Stats()
+	if err != nil {
+		return nil, err
+	}
+	stats := &statsResponse{ArchiveStats: *totals, Days: days, GeneratedAt: now}
+
+	if stats.PostsPerDay, err = h.postRepo.CountByDay(since); err != nil {
+		return nil, err
+	}
+	if stats.Authors, err = h.postRepo.CountBy("author", since, statsTopAuthors); err != nil {
+		return nil, err
+	}
+	if stats.Categories, err = h.postRepo.CountBy("category_title", since, 0); err != nil {
+		return nil, err
+	}
+	if stats.Statuses, err = h.postRepo.CountByStatus(); err != nil {
+		return nil, err
+	}
+
+	week, err := h.postRepo.DownloadStatsByDay(now.Truncate(24*time.Hour).AddDate(0, 0, -(failureRateDays - 1)))
+	if err != nil {
+		return nil, err
+	}
+	var finished, failed int
+	for _, day := range week {
+		finished += day.Total
+		failed += day.Failed
+	}
+	if finished > 0 {
+		stats.FailureRate7d = float64(failed) / float64(finished)
+	}
+	return stats, nil
+}
+
+// HandleFeed serves GET /api/feeds/{id}/stats, the post counts, size and
+// post dates of a feed. Feeds are known from the Miniflux sync, or from their
+// posts since those may arrive before the next sync; others get 404. Results
+// are cached for feedStatsCacheTTL per feed.
+func (h *StatsHandler) HandleFeed(w http.ResponseWriter, r *http.Request) {
+	feedID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || feedID <= 0 {
+		writeError(w, http.StatusBadRequest, "Invalid feed ID")
+		return
+	}
+
+	h.feedCacheMu.Lock()
+	defer h.feedCacheMu.Unlock()
+	if cached, ok := h.feedCache[feedID]; ok && time.Now().Before(cached.expires) {
+		writeJSON(w, http.StatusOK, cached.stats)
+		return
+	}
+
+	stats, err := h.postRepo.GetFeedStats(r.Context(), feedID)
+	if err != nil {
+		log.Printf("Error loading stats of feed %d: %v", feedID, err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	feed, err := h.feedRepo.Get(r.Context(), feedID)
+	switch {
+	case err == nil:
+		stats.Title = feed.Title
+	case !errors.Is(err, sql.ErrNoRows):
+		log.Printf("Error loading feed %d: %v", feedID, err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	case stats.TotalPosts == 0:
+		writeError(w, http.StatusNotFound, "Feed not found")
+		return
+	}
+
+	now := time.Now()
+	for key, cached := range h.feedCache {
+		if now.After(cached.expires) {
+			delete(h.feedCache, key)
+		}
+	}
+	h.feedCache[feedID] = cachedFeedStats{stats: stats, expires: now.Add(feedStatsCacheTTL)}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// downloadStatsPeriods maps the ?period= values of HandleDownloads to their
+// length in days; 0 means the whole history.
+var downloadStatsPeriods = map[string]int{
+	"7d":  7,
+	"30d": 30,
+	"all": 0,
+}
+
+// HandleDownloads serves GET /api/stats/downloads?period=7d|30d|all, the
+// number of downloads that completed or failed and of posts uploaded per day.
+// Days without downloads within the period are reported with zero counts.
+func (h *StatsHandler) HandleDownloads(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "7d"
+	}
+	days, ok := downloadStatsPeriods[period]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid period, expected 7d, 30d or all")
+		return
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	var since time.Time
+	if days > 0 {
+		since = today.AddDate(0, 0, -(days - 1))
+	}
+
+	stats, err := h.postRepo.DownloadStatsByDay(since)
+	if err != nil {
+		log.Printf("Error loading download stats: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	if since.IsZero() && len(stats) > 0 {
+		since, _ = time.Parse(time.DateOnly, stats[0].Date)
+	}
+	writeJSON(w, http.StatusOK, fillDownloadStats(stats, since, today))
+}
+
+// fillDownloadStats returns one entry per day from start to end, taking the
+// counts from stats and zero for the days missing there.
+func fillDownloadStats(stats []model.DailyDownloadStats, start, end time.Time) []model.DailyDownloadStats {
+	byDate := make(map[string]model.DailyDownloadStats, len(stats))
+	for _, day := range stats {
+		byDate[day.Date] = day
+	}
+
+	series := []model.DailyDownloadStats{}
+	if start.IsZero() {
+		return series
+	}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format(time.DateOnly)
+		if counts, ok := byDate[date]; ok {
+			series = append(series, counts)
+		} else {
+			series = append(series, model.DailyDownloadStats{Date: date})
+		}
+	}
+	return series
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"embed"
+	"io/fs"
+	"log"
+	"net/http"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+// uiSessionMaxAge is how long the login cookie of the web UI lasts.
+const uiSessionMaxAge = 30 * 24 * 60 * 60
+
+// UIHandler serves the web UI under /ui/, static pages that browse the
+// archive through the JSON API. Signing in stores ADMIN_API_KEY in an
+// HttpOnly cookie which APIKeyMiddleware accepts in place of the header.
+type UIHandler struct {
+	apiKey string
+	static http.Handler
+}
+
+func NewUIHandler(apiKey string) *UIHandler {
+	sub, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	return &UIHandler{
+		apiKey: apiKey,
+		static: http.StripPrefix("/ui/", http.FileServerFS(sub)),
+	}
+}
+
+// ServeHTTP serves the pages and assets of the UI.
+func (h *UIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Frame-Options", "DENY")
+	h.static.ServeHTTP(w, r)
+}
+
+// HandleLogin serves POST /ui/login, checking the submitted key and storing it
+// in the session cookie.
+func (h *UIHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	if h.apiKey == "" {
+		http.Error(w, "Admin API disabled", http.StatusServiceUnavailable)
+		return
+	}
+	if !validAPIKey(h.apiKey, r.PostFormValue("key")) {
+		log.Printf("Rejected UI login from %s", r.RemoteAddr)
+		http.Redirect(w, r, "/ui/login.html?error=1", http.StatusSeeOther)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     apiKeyCookie,
+		Value:    h.apiKey,
+		Path:     "/",
+		MaxAge:   uiSessionMaxAge,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/ui/", http.StatusSeeOther)
+}
+
+// HandleLogout serves POST /ui/logout, clearing the session cookie.
+func (h *UIHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     apiKeyCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/ui/login.html", http.StatusSeeOther)
+}
+
+// isHTTPS reports whether the client reached the server over TLS, directly or
+// through a reverse proxy setting X-Forwarded-Proto.
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
@@ -0,0 +1,228 @@
+// LewdArchive web UI. Pages are static; everything is loaded from the JSON API
+// with the session cookie set by /ui/login.
+(function () {
+  "use strict";
+
+  var pageSize = 48;
+  var maxAuthors = 200;
+
+  function api(method, path) {
+    return fetch(path, { method: method, credentials: "same-origin" }).then(function (resp) {
+      if (resp.status === 401) {
+        location.href = "login.html";
+        throw new Error("Unauthorized");
+      }
+      if (!resp.ok) {
+        return resp.json().catch(function () { return {}; }).then(function (body) {
+          throw new Error((body.error && body.error.message) || resp.statusText);
+        });
+      }
+      return resp.json();
+    });
+  }
+
+  function el(tag, attrs, children) {
+    var node = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (key) {
+      if (key === "text") {
+        node.textContent = attrs[key];
+      } else {
+        node.setAttribute(key, attrs[key]);
+      }
+    });
+    (children || []).forEach(function (child) {
+      node.appendChild(child);
+    });
+    return node;
+  }
+
+  // thumbnailURL returns the first image of the post content, if any.
+  function thumbnailURL(post) {
+    if (!post.content) {
+      return "";
+    }
+    var doc = new DOMParser().parseFromString(post.content, "text/html");
+    var img = doc.querySelector("img[src]");
+    if (!img) {
+      return "";
+    }
+    var src = img.getAttribute("src");
+    return /^https?:\/\//i.test(src) ? src : "";
+  }
+
+  function formatSize(bytes) {
+    if (!bytes) {
+      return "";
+    }
+    var units = ["B", "KB", "MB", "GB", "TB"];
+    var i = 0;
+    while (bytes >= 1024 && i < units.length - 1) {
+      bytes /= 1024;
+      i++;
+    }
+    return bytes.toFixed(i === 0 ? 0 : 1) + " " + units[i];
+  }
+
+  function formatDate(value) {
+    var date = new Date(value);
+    return isNaN(date) ? "" : date.toLocaleString();
+  }
+
+  function statusBadge(status) {
+    return el("span", { class: "status status-" + status, text: status });
+  }
+
+  function postCard(post) {
+    var thumb = thumbnailURL(post);
+    var image = thumb
+      ? el("img", { src: thumb, alt: "", loading: "lazy", referrerpolicy: "no-referrer" })
+      : el("div", { class: "placeholder", text: "No preview" });
+
+    return el("a", { class: "card", href: "post.html?hash=" + encodeURIComponent(post.hash) }, [
+      image,
+      el("div", { class: "card-body" }, [
+        el("strong", { text: post.title || post.hash }),
+        el("span", { class: "muted", text: post.author + " · " + post.category_title }),
+        statusBadge(post.download_status),
+      ]),
+    ]);
+  }
+
+  function initList() {
+    var form = document.getElementById("filters");
+    var grid = document.getElementById("grid");
+    var summary = document.getElementById("summary");
+    var prev = document.getElementById("prev");
+    var next = document.getElementById("next");
+    var params = new URLSearchParams(location.search);
+
+    ["author", "category", "status"].forEach(function (name) {
+      form.elements[name].value = params.get(name) || "";
+    });
+    var offset = parseInt(params.get("offset"), 10) || 0;
+
+    function go(newOffset) {
+      var query = new URLSearchParams();
+      ["author", "category", "status"].forEach(function (name) {
+        if (form.elements[name].value) {
+          query.set(name, form.elements[name].value);
+        }
+      });
+      if (newOffset > 0) {
+        query.set("offset", newOffset);
+      }
+      location.search = query.toString();
+    }
+
+    form.addEventListener("submit", function (event) {
+      event.preventDefault();
+      go(0);
+    });
+    prev.addEventListener("click", function () {
+      go(Math.max(0, offset - pageSize));
+    });
+    next.addEventListener("click", function () {
+      go(offset + pageSize);
+    });
+
+    var query = new URLSearchParams(params);
+    query.set("limit", pageSize);
+    query.set("offset", offset);
+    api("GET", "/api/posts?" + query.toString()).then(function (page) {
+      grid.textContent = "";
+      page.posts.forEach(function (post) {
+        grid.appendChild(postCard(post));
+      });
+      summary.textContent = page.total === 0
+        ? "No posts found."
+        : (page.offset + 1) + "–" + (page.offset + page.posts.length) + " of " + page.total + " posts";
+      prev.disabled = page.offset === 0;
+      next.disabled = page.next_offset === null;
+    }).catch(function (err) {
+      summary.textContent = "Error loading posts: " + err.message;
+    });
+
+    api("GET", "/api/authors?page_size=" + maxAuthors).then(function (authors) {
+      var list = document.getElementById("authors");
+      (authors || []).forEach(function (author) {
+        list.appendChild(el("option", { value: author.author }));
+      });
+    }).catch(function () {});
+  }
+
+  function initPost() {
+    var hash = new URLSearchParams(location.search).get("hash");
+    var result = document.getElementById("action-result");
+    var errorBox = document.getElementById("error");
+
+    function showError(err) {
+      errorBox.textContent = err.message;
+      errorBox.hidden = false;
+    }
+
+    function action(button, path) {
+      button.addEventListener("click", function () {
+        button.disabled = true;
+        result.textContent = "";
+        api("POST", "/api/posts/" + encodeURIComponent(hash) + "/" + path).then(function (resp) {
+          result.textContent = "Status: " + resp.status;
+        }).catch(function (err) {
+          result.textContent = err.message;
+        }).then(function () {
+          button.disabled = false;
+        });
+      });
+    }
+
+    if (!hash) {
+      showError(new Error("No post selected."));
+      return;
+    }
+    action(document.getElementById("redownload"), "redownload");
+    action(document.getElementById("reupload"), "reupload");
+
+    api("GET", "/api/posts/" + encodeURIComponent(hash)).then(function (detail) {
+      var post = detail.post;
+      document.title = post.title + " - LewdArchive";
+      document.getElementById("title").textContent = post.title || post.hash;
+
+      var meta = document.getElementById("meta");
+      meta.textContent = post.author + " · " + post.category_title + " · " + formatDate(post.published_at) + " · ";
+      meta.appendChild(statusBadge(detail.download.status));
+      if (detail.download.last_error) {
+        meta.appendChild(el("span", { class: "error", text: " " + detail.download.last_error }));
+      }
+      if (/^https?:\/\//i.test(post.url)) {
+        document.getElementById("original").href = post.url;
+      }
+
+      var files = document.getElementById("files");
+      detail.files.forEach(function (file) {
+        var link = file.chibisafe_url
+          ? el("a", { href: file.chibisafe_url, target: "_blank", rel: "noreferrer", text: "Open" })
+          : el("span", { class: "muted", text: "Not uploaded" });
+        files.appendChild(el("tr", {}, [
+          el("td", { text: file.name }),
+          el("td", { text: formatSize(file.size_bytes) }),
+          el("td", {}, [link]),
+        ]));
+      });
+      if (detail.files.length === 0) {
+        files.appendChild(el("tr", {}, [el("td", { colspan: "3", class: "muted", text: "No files recorded." })]));
+      }
+
+      var history = document.getElementById("history");
+      detail.download.history.forEach(function (attempt) {
+        history.appendChild(el("tr", {}, [
+          el("td", { text: formatDate(attempt.started_at) }),
+          el("td", { text: String(attempt.exit_code) }),
+          el("td", { text: String(attempt.files_downloaded) }),
+        ]));
+      });
+
+      document.getElementById("post").hidden = false;
+    }).catch(showError);
+  }
+
+  window.LewdArchive = { initList: initList, initPost: initPost };
+})();
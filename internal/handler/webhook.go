@@ -1,37 +1,63 @@
 package handler
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"golang.org/x/sync/errgroup"
+
 	"lewdarchive/internal/config"
+	"lewdarchive/internal/events"
 	"lewdarchive/internal/model"
 	"lewdarchive/internal/repository"
 	"lewdarchive/internal/service"
+	"lewdarchive/internal/telemetry"
+	"lewdarchive/internal/utils"
 )
 
 type WebhookHandler struct {
 	config          config.Config
 	postRepo        *repository.PostRepository
+	idempotencyRepo *repository.IdempotencyRepository
+	deliveryRepo    *repository.WebhookDeliveryRepository
+	filterRepo      *repository.FeedFilterRepository
 	archiveService  *service.ArchiveService
 	minifluxService *service.MinifluxService
 	discordService  *service.DiscordService
+	notifications   *service.NotificationDispatcher
+	emitter         service.EventEmitter
+	bus             *events.Bus
+	backfills       backfillTracker
+	// deliveryMu makes checking for a duplicate delivery and recording it
+	// atomic, since Miniflux may retry while the first one still runs.
+	deliveryMu sync.Mutex
 }
 
-func NewWebhookHandler(cfg config.Config, postRepo *repository.PostRepository, archiveService *service.ArchiveService, minifluxService *service.MinifluxService, discordService *service.DiscordService) *WebhookHandler {
+func NewWebhookHandler(cfg config.Config, postRepo *repository.PostRepository, idempotencyRepo *repository.IdempotencyRepository, deliveryRepo *repository.WebhookDeliveryRepository, filterRepo *repository.FeedFilterRepository, archiveService *service.ArchiveService, minifluxService *service.MinifluxService, discordService *service.DiscordService, notifications *service.NotificationDispatcher, emitter service.EventEmitter, bus *events.Bus) *WebhookHandler {
 	return &WebhookHandler{
 		config:          cfg,
 		postRepo:        postRepo,
+		idempotencyRepo: idempotencyRepo,
+		deliveryRepo:    deliveryRepo,
+		filterRepo:      filterRepo,
 		archiveService:  archiveService,
 		minifluxService: minifluxService,
 		discordService:  discordService,
+		notifications:   notifications,
+		emitter:         emitter,
+		bus:             bus,
 	}
 }
 
@@ -41,26 +67,69 @@ func (h *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		log.Printf("Error reading request body: %v", err)
-		http.Error(w, "Internal error", http.StatusInternalServerError)
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	ctx, span := telemetry.StartSpan(r.Context(), "HandleWebhook")
+	defer span.End()
+
+	body, ok := h.readBody(w, r)
+	if !ok {
 		return
 	}
 
-	if h.config.MinifluxSecretKey != "" {
+	source := r.URL.Query().Get("source")
+	secrets, known := h.secretsFor(source)
+	if !known {
+		log.Printf("Rejected webhook from unknown source %q", source)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if len(secrets) > 0 {
 		signature := r.Header.Get("X-Miniflux-Signature")
-		if !h.verifySignature(body, signature) {
-			log.Println("Invalid HMAC signature")
+		if !h.verifySignature(body, signature, source) {
+			log.Printf("Invalid HMAC signature (source %q)", source)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 	}
 
+	// Redeliveries carrying an Idempotency-Key we already answered get the
+	// original status without being processed again. Server errors are not
+	// remembered so that a retry can still succeed.
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		status, seen, err := h.idempotencyRepo.Get(key, time.Now().Add(-repository.IdempotencyKeyTTL))
+		if err != nil {
+			log.Printf("Error checking idempotency key %s: %v", key, err)
+		} else if seen {
+			log.Printf("Duplicate delivery for idempotency key %s, replying %d", key, status)
+			if status == http.StatusOK {
+				h.writeSuccess(w)
+			} else {
+				w.WriteHeader(status)
+			}
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		w = rec
+		defer func() {
+			if rec.status >= http.StatusInternalServerError {
+				return
+			}
+			if err := h.idempotencyRepo.Save(key, rec.status); err != nil {
+				log.Printf("Error saving idempotency key %s: %v", key, err)
+			}
+		}()
+	}
+
 	eventType := r.Header.Get("X-Miniflux-Event-Type")
-	if eventType != "new_entries" {
+	if eventType != "new_entries" && eventType != "entry_updated" {
 		log.Printf("Ignored event type: %s", eventType)
-		w.WriteHeader(http.StatusOK)
+		h.writeSuccess(w)
 		return
 	}
 
@@ -71,23 +140,168 @@ func (h *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if payload.EventType != "new_entries" {
+	if payload.EventType != eventType {
 		log.Printf("Ignored event type in payload: %s", payload.EventType)
-		w.WriteHeader(http.StatusOK)
+		h.writeSuccess(w)
+		return
+	}
+
+	if h.recordDelivery(body, source, payload) {
+		h.writeSuccess(w)
 		return
 	}
 
+	h.processPayload(ctx, payload, source)
+	h.writeSuccess(w)
+}
+
+// readBody reads a webhook body of up to WEBHOOK_MAX_BODY_MB, both as sent
+// and once decompressed, answering the request itself when it can't.
+func (h *WebhookHandler) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	maxBytes := h.config.WebhookMaxBodyMB * 1024 * 1024
+	if maxBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	}
+	body, err := io.ReadAll(r.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		log.Printf("Rejected webhook body larger than %d bytes", tooLarge.Limit)
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error reading request body: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	body, err = decodeBody(r.Header.Get("Content-Encoding"), body, maxBytes)
+	switch {
+	case errors.Is(err, errUnsupportedEncoding):
+		log.Printf("Rejected webhook body: %v", err)
+		http.Error(w, "Content-Encoding must be gzip, br or deflate", http.StatusUnsupportedMediaType)
+		return nil, false
+	case errors.Is(err, errDecodedTooLarge):
+		log.Printf("Rejected webhook body larger than %d bytes once decompressed", maxBytes)
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	case err != nil:
+		log.Printf("Rejected webhook body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// processPayload saves the entries of a delivery and marks them as read in
+// Miniflux. Entries are independent, so a large delivery is processed a few
+// at a time. Failures are only logged and never cancel the other entries.
+func (h *WebhookHandler) processPayload(ctx context.Context, payload model.WebhookPayload, source string) {
+	batch := &readBatch{}
+	var group errgroup.Group
+	group.SetLimit(max(int(h.config.WebhookEntryParallelism), 1))
 	for _, entry := range payload.Entries {
-		if err := h.processEntry(payload.Feed, entry); err != nil {
-			log.Printf("Error processing entry %s: %v", entry.Hash, err)
-			continue
+		group.Go(func() error {
+			var err error
+			if payload.EventType == "entry_updated" {
+				err = h.processUpdatedEntry(ctx, payload.Feed, entry, source, batch)
+			} else {
+				err = h.processEntry(ctx, payload.Feed, entry, source, false, batch)
+			}
+			if err != nil {
+				log.Printf("Error processing entry %s: %v", entry.Hash, err)
+			}
+			return nil
+		})
+	}
+	group.Wait()
+
+	if err := h.minifluxService.MarkEntriesAsRead(ctx, batch.entryIDs); err != nil {
+		log.Printf("Error marking %d entries as read: %v", len(batch.entryIDs), err)
+	}
+}
+
+// recordDelivery stores a delivery in webhook_deliveries and reports whether
+// the same payload from the same source was already processed within
+// WEBHOOK_DEDUP_WINDOW_MINUTES. Without the check a retried delivery would
+// mark its entries as read again and could notify twice. Database errors only
+// let the delivery through.
+func (h *WebhookHandler) recordDelivery(body []byte, source string, payload model.WebhookPayload) bool {
+	sum := sha256.Sum256(body)
+	delivery := &model.WebhookDelivery{
+		PayloadHash: hex.EncodeToString(sum[:]),
+		Source:      source,
+		EventType:   payload.EventType,
+		EntryCount:  len(payload.Entries),
+	}
+
+	h.deliveryMu.Lock()
+	defer h.deliveryMu.Unlock()
+
+	if window := time.Duration(h.config.WebhookDedupWindowMinutes) * time.Minute; window > 0 {
+		first, err := h.deliveryRepo.FindProcessed(delivery.PayloadHash, source, time.Now().Add(-window))
+		switch {
+		case err == nil:
+			delivery.Duplicate = true
+			log.Printf("Duplicate webhook delivery %s of %d entries, first received at %s, skipping",
+				delivery.PayloadHash[:12], delivery.EntryCount, first.ReceivedAt.Format(time.RFC3339))
+		case !errors.Is(err, sql.ErrNoRows):
+			log.Printf("Error checking for duplicate webhook delivery: %v", err)
 		}
 	}
 
+	if err := h.deliveryRepo.Create(delivery); err != nil {
+		log.Printf("Error recording webhook delivery: %v", err)
+	}
+	return delivery.Duplicate
+}
+
+// writeSuccess answers 200 with the optional WEBHOOK_SUCCESS_RESPONSE_BODY so
+// health checks that match on the body can tell the endpoint is working.
+func (h *WebhookHandler) writeSuccess(w http.ResponseWriter) {
+	if h.config.WebhookSuccessResponseBody == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Content-Type", h.config.WebhookSuccessContentType)
 	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, h.config.WebhookSuccessResponseBody)
 }
 
-func (h *WebhookHandler) processEntry(feed model.Feed, entry model.Entry) error {
+// readBatch collects the IDs of stored entries so that a whole webhook payload
+// is marked as read in Miniflux with one request.
+type readBatch struct {
+	mu       sync.Mutex
+	entryIDs []int64
+}
+
+func (b *readBatch) add(entryID int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entryIDs = append(b.entryIDs, int64(entryID))
+}
+
+// processEntry saves a new entry and queues its download, unless the filters
+// of its feed exclude it. Backfilled entries are downloaded at low priority
+// and send no notifications. With a nil batch the entry is marked as read
+// right away.
+func (h *WebhookHandler) processEntry(ctx context.Context, feed model.Feed, entry model.Entry, source string, backfill bool, batch *readBatch) (err error) {
+	ctx = telemetry.WithAttributes(ctx, telemetry.EntryAttributes(feed, entry)...)
+	ctx, span := telemetry.StartSpan(ctx, "processEntry")
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	// Entries of other readers have no Miniflux feed to filter by.
+	if feed.ID != 0 {
+		filters, err := h.filterRepo.List(ctx, feed.ID)
+		if err != nil {
+			return err
+		}
+		if reason := filteredReason(filters, entry); reason != "" {
+			log.Printf("Skipping entry %s of feed %d: %s", entry.Hash, feed.ID, reason)
+			return nil
+		}
+	}
+
 	exists, err := h.postRepo.ExistsByHash(entry.Hash)
 	if err != nil {
 		return err
@@ -98,9 +312,22 @@ func (h *WebhookHandler) processEntry(feed model.Feed, entry model.Entry) error
 		return nil
 	}
 
-	publishedAt, err := time.Parse(time.RFC3339, entry.PublishedAt)
-	if err != nil {
-		log.Printf("Error parsing date %s: %v", entry.PublishedAt, err)
+	// Several Miniflux instances hash the same entry differently.
+	if existing, err := h.postRepo.FindByURL(ctx, entry.URL); err == nil {
+		log.Printf("URL already archived under different hash: %s (%s, archived as %s)", entry.URL, entry.Hash, existing.Hash)
+		return nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	// Entries of other readers have no Miniflux ID to look up.
+	if h.config.FetchOriginalContent && entry.ID != 0 {
+		h.fetchOriginalContent(ctx, &entry)
+	}
+
+	publishedAt, ok := utils.ParsePublishedAt(entry.PublishedAt)
+	if !ok {
+		log.Printf("Error parsing date %q, using current time", entry.PublishedAt)
 		publishedAt = time.Now()
 	}
 
@@ -111,43 +338,211 @@ func (h *WebhookHandler) processEntry(feed model.Feed, entry model.Entry) error
 		Title:         entry.Title,
 		URL:           entry.URL,
 		PublishedAt:   publishedAt,
-		Content:       entry.Content,
+		Content:       h.storedContent(entry.Content),
 		Author:        entry.Author,
 		CategoryID:    feed.Category.ID,
 		CategoryTitle: feed.Category.Title,
+		FeedID:        feed.ID,
+		Source:        source,
 	}
 
 	if err := h.postRepo.Create(post); err != nil {
 		return err
 	}
 
-	log.Printf("Post saved: %s - %s", entry.Title, entry.Hash)
+	log.Printf("Post saved: %s - %s (source %q)", entry.Title, entry.Hash, source)
 
-	if err := h.minifluxService.MarkEntryAsRead(entry.ID); err != nil {
-		log.Printf("Error marking entry %d as read: %v", entry.ID, err)
-	}
+	h.saveTags(post.ID, entry.Content)
+
+	service.EmitEvent(h.emitter, model.ArchiveEvent{
+		EventType:     model.EventEntrySaved,
+		PostHash:      post.Hash,
+		PostURL:       post.URL,
+		Author:        post.Author,
+		CategoryTitle: post.CategoryTitle,
+	})
+	h.bus.Publish(events.Event{Type: events.TypeEntrySaved, Hash: post.Hash, Title: post.Title})
+
+	h.applyEntryAction(ctx, entry.ID, batch)
 
-	go h.archiveService.DownloadContent(entry.URL, entry.Author, feed.Category.Title, entry.Title, publishedAt, entry.Hash)
+	// The download outlives the request, so only its trace is carried over.
+	if backfill {
+		h.archiveService.Enqueue(context.WithoutCancel(ctx), post, service.DownloadPriorityLow)
+		return nil
+	}
+	h.archiveService.Enqueue(context.WithoutCancel(ctx), post, service.DownloadPriorityHigh)
 
 	if h.discordService != nil {
-		if err := h.discordService.SendEmbed(feed, entry); err != nil {
-			log.Printf("Error sending Discord notification for entry %s: %v", entry.Hash, err)
+		h.discordService.Enqueue(feed, entry)
+	}
+	if h.notifications != nil {
+		h.notifications.Dispatch(feed, entry)
+	}
+
+	return nil
+}
+
+// storedContent returns the entry content as it is saved with the post,
+// sanitized unless CONTENT_SANITIZE is disabled.
+func (h *WebhookHandler) storedContent(content string) string {
+	if !h.config.ContentSanitize {
+		return content
+	}
+	return utils.SanitizeHTML(content)
+}
+
+// saveTags stores the hashtags found in the entry content as the post's tags.
+// A failure is only logged since tags are not essential to the archive.
+func (h *WebhookHandler) saveTags(postID int, content string) {
+	if err := h.postRepo.SetTags(postID, utils.ExtractHashtags(content)); err != nil {
+		log.Printf("Error saving tags for post %d: %v", postID, err)
+	}
+}
+
+// applyEntryAction marks the saved entry as read and/or stars it in Miniflux,
+// as selected by MINIFLUX_ENTRY_ACTION. Marking as read is deferred to the
+// batch when there is one, and left to the archive completion callback when
+// MINIFLUX_ARCHIVED_STATUS is set. Entries of other readers are left alone.
+func (h *WebhookHandler) applyEntryAction(ctx context.Context, entryID int, batch *readBatch) {
+	if entryID == 0 {
+		return
+	}
+	action := h.config.MinifluxEntryAction
+	markRead := action == service.MinifluxEntryActionRead || action == service.MinifluxEntryActionReadStar
+	if markRead && h.config.MinifluxArchivedStatus == "" {
+		if batch != nil {
+			batch.add(entryID)
+		} else if err := h.minifluxService.MarkEntryAsRead(ctx, entryID); err != nil {
+			log.Printf("Error marking entry %d as read: %v", entryID, err)
 		}
 	}
+	if action == service.MinifluxEntryActionStar || action == service.MinifluxEntryActionReadStar {
+		if err := h.minifluxService.ToggleBookmark(ctx, entryID); err != nil {
+			log.Printf("Error starring entry %d: %v", entryID, err)
+		}
+	}
+}
+
+// fetchOriginalContent replaces the webhook content with the full article
+// scraped by Miniflux. Any failure keeps the webhook content.
+func (h *WebhookHandler) fetchOriginalContent(ctx context.Context, entry *model.Entry) {
+	content, err := h.minifluxService.FetchOriginalContent(ctx, entry.ID)
+	if err != nil {
+		log.Printf("Error fetching original content for entry %d, keeping webhook content: %v", entry.ID, err)
+		return
+	}
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+	entry.Content = content
+}
+
+// processUpdatedEntry refreshes an already archived post with the edited entry.
+// A new download is started when the entry URL changed, or for every update
+// with REDOWNLOAD_ON_UPDATE; unknown entries are handled as new ones.
+func (h *WebhookHandler) processUpdatedEntry(ctx context.Context, feed model.Feed, entry model.Entry, source string, batch *readBatch) (err error) {
+	ctx = telemetry.WithAttributes(ctx, telemetry.EntryAttributes(feed, entry)...)
+	ctx, span := telemetry.StartSpan(ctx, "processUpdatedEntry")
+	defer func() { telemetry.EndSpan(span, err) }()
+
+	existing, err := h.postRepo.GetByHash(entry.Hash)
+	if err == sql.ErrNoRows {
+		log.Printf("Updated entry not found, treating as new: %s", entry.Hash)
+		return h.processEntry(ctx, feed, entry, source, false, batch)
+	}
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"title":   entry.Title,
+		"content": h.storedContent(entry.Content),
+		"url":     entry.URL,
+		"author":  entry.Author,
+	}
+	if err := h.postRepo.Update(entry.Hash, updates); err != nil {
+		return err
+	}
+
+	log.Printf("Post updated: %s - %s (source %q)", entry.Title, entry.Hash, source)
+
+	h.saveTags(existing.ID, entry.Content)
+
+	redownload := h.config.RedownloadOnUpdate
+	if existing.URL != entry.URL {
+		log.Printf("URL changed for %s (%s -> %s), re-downloading", entry.Hash, existing.URL, entry.URL)
+		redownload = true
+	} else if redownload {
+		log.Printf("Entry %s updated, re-downloading to pick up new files", entry.Hash)
+	}
+
+	if redownload {
+		updated, err := h.postRepo.GetByHash(entry.Hash)
+		if err != nil {
+			return err
+		}
+		h.archiveService.Enqueue(context.WithoutCancel(ctx), updated, service.DownloadPriorityHigh)
+	}
 
 	return nil
 }
 
-func (h *WebhookHandler) verifySignature(body []byte, signature string) bool {
-	if signature == "" {
-		return false
+// secretsFor returns the HMAC secrets accepted for a webhook source: its entry
+// in MINIFLUX_SECRETS, or else MINIFLUX_SECRET followed by
+// MINIFLUX_SECRET_PREVIOUS while a rotation is in progress. Once
+// MINIFLUX_SECRETS is set, sources missing from it are unknown, as are
+// requests without a source unless MINIFLUX_SECRET covers them, so that they
+// can't skip verification.
+func (h *WebhookHandler) secretsFor(source string) (secrets []string, known bool) {
+	if secret, ok := h.config.MinifluxSecrets[source]; ok && source != "" {
+		return []string{secret}, true
+	}
+	if len(h.config.MinifluxSecrets) > 0 && (source != "" || h.config.MinifluxSecretKey == "") {
+		return nil, false
+	}
+	for _, secret := range []string{h.config.MinifluxSecretKey, h.config.MinifluxSecretPrevious} {
+		if secret != "" {
+			secrets = append(secrets, secret)
+		}
 	}
+	return secrets, true
+}
 
-	signature = strings.TrimPrefix(signature, "sha256=")
+// verifySignature accepts a signature made with any of the source's secrets.
+// Matches of MINIFLUX_SECRET_PREVIOUS are logged so that the end of a
+// rotation can be told apart from senders still using the old key.
+func (h *WebhookHandler) verifySignature(body []byte, signature, source string) bool {
+	secrets, _ := h.secretsFor(source)
+	for _, secret := range secrets {
+		if hmacMatches(body, signature, secret) {
+			if secret == h.config.MinifluxSecretPrevious && secret != h.config.MinifluxSecretKey {
+				log.Printf("Webhook signature matched MINIFLUX_SECRET_PREVIOUS (source %q)", source)
+			}
+			return true
+		}
+	}
+	return false
+}
 
-	mac := hmac.New(sha256.New, []byte(h.config.MinifluxSecretKey))
+// hmacMatches reports whether signature is the hex HMAC-SHA256 of body keyed
+// by secret, optionally prefixed with "sha256=".
+func hmacMatches(body []byte, signature, secret string) bool {
+	if signature == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
 	mac.Write(body)
 	expectedSignature := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(strings.TrimPrefix(signature, "sha256=")), []byte(expectedSignature))
+}
 
-	return hmac.Equal([]byte(signature), []byte(expectedSignature))
-}
\ No newline at end of file
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
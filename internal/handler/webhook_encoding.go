@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+var (
+	errUnsupportedEncoding = errors.New("unsupported Content-Encoding")
+	errDecodedTooLarge     = errors.New("decompressed body too large")
+)
+
+// decodeBody undoes the Content-Encoding of a webhook body, applied in the
+// order listed, so that signatures are checked against what the sender
+// signed. gzip, br and deflate are supported, the latter zlib-wrapped as
+// HTTP specifies or raw as some clients send it. limit bounds the decoded
+// size, 0 meaning no limit.
+func decodeBody(contentEncoding string, body []byte, limit int64) ([]byte, error) {
+	encodings := strings.Split(contentEncoding, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		var decoder io.ReadCloser
+		var err error
+		switch encoding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			decoder, err = gzip.NewReader(bytes.NewReader(body))
+		case "br":
+			decoder = io.NopCloser(brotli.NewReader(bytes.NewReader(body)))
+		case "deflate":
+			decoder, err = zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				decoder, err = flate.NewReader(bytes.NewReader(body)), nil
+			}
+		default:
+			return nil, fmt.Errorf("%w %q", errUnsupportedEncoding, encoding)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s body: %w", encoding, err)
+		}
+
+		body, err = readDecoded(decoder, limit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s body: %w", encoding, err)
+		}
+	}
+	return body, nil
+}
+
+func readDecoded(decoder io.ReadCloser, limit int64) ([]byte, error) {
+	defer decoder.Close()
+	if limit <= 0 {
+		return io.ReadAll(decoder)
+	}
+	decoded, err := io.ReadAll(io.LimitReader(decoder, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decoded)) > limit {
+		return nil, errDecodedTooLarge
+	}
+	return decoded, nil
+}
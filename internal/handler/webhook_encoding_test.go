@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+
+	"lewdarchive/internal/config"
+)
+
+const testPayload = `{"event_type":"new_entries","feed":{"id":1},"entries":[]}`
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = fw
+	case "br":
+		w = brotli.NewWriter(&buf)
+	default:
+		t.Fatalf("unknown encoding %q", encoding)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestDecodeBodyRoundTrip(t *testing.T) {
+	tests := []struct {
+		header   string
+		encoding string
+	}{
+		{"gzip", "gzip"},
+		{"x-gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"deflate", "raw-deflate"},
+		{"br", "br"},
+		{" BR ", "br"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header+"/"+tt.encoding, func(t *testing.T) {
+			got, err := decodeBody(tt.header, compress(t, tt.encoding, []byte(testPayload)), 1024)
+			if err != nil {
+				t.Fatalf("decodeBody: %v", err)
+			}
+			if string(got) != testPayload {
+				t.Errorf("decodeBody = %q, want %q", got, testPayload)
+			}
+		})
+	}
+}
+
+func TestDecodeBodyStacked(t *testing.T) {
+	body := compress(t, "br", compress(t, "gzip", []byte(testPayload)))
+	got, err := decodeBody("gzip, br", body, 0)
+	if err != nil {
+		t.Fatalf("decodeBody: %v", err)
+	}
+	if string(got) != testPayload {
+		t.Errorf("decodeBody = %q, want %q", got, testPayload)
+	}
+}
+
+func TestDecodeBodyIdentity(t *testing.T) {
+	for _, header := range []string{"", "identity"} {
+		got, err := decodeBody(header, []byte(testPayload), 0)
+		if err != nil || string(got) != testPayload {
+			t.Errorf("decodeBody(%q) = %q, %v", header, got, err)
+		}
+	}
+}
+
+func TestDecodeBodyErrors(t *testing.T) {
+	if _, err := decodeBody("compress", []byte("x"), 0); !errors.Is(err, errUnsupportedEncoding) {
+		t.Errorf("unknown encoding: got %v, want errUnsupportedEncoding", err)
+	}
+	if _, err := decodeBody("gzip", []byte("not gzip"), 0); err == nil {
+		t.Error("corrupt gzip: got nil error")
+	}
+	bomb := compress(t, "gzip", bytes.Repeat([]byte("a"), 4096))
+	if _, err := decodeBody("gzip", bomb, 1024); !errors.Is(err, errDecodedTooLarge) {
+		t.Errorf("oversized body: got %v, want errDecodedTooLarge", err)
+	}
+}
+
+func TestHandleWebhookCompressedSignature(t *testing.T) {
+	const secret = "s3cret"
+	h := NewWebhookHandler(config.Config{MinifluxSecretKey: secret, WebhookMaxBodyMB: 1}, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	for _, encoding := range []string{"gzip", "deflate", "br"} {
+		t.Run(encoding, func(t *testing.T) {
+			body := compress(t, encoding, []byte(testPayload))
+			for _, tt := range []struct {
+				name      string
+				signature string
+				want      int
+			}{
+				{"signed decompressed", sign([]byte(testPayload), secret), http.StatusOK},
+				{"signed compressed", sign(body, secret), http.StatusUnauthorized},
+			} {
+				req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Content-Encoding", encoding)
+				req.Header.Set("X-Miniflux-Signature", tt.signature)
+				rec := httptest.NewRecorder()
+				h.HandleWebhook(rec, req)
+				if rec.Code != tt.want {
+					t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleWebhookUnsupportedEncoding(t *testing.T) {
+	h := NewWebhookHandler(config.Config{}, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader([]byte(testPayload)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "compress")
+	rec := httptest.NewRecorder()
+	h.HandleWebhook(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+}
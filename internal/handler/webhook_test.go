@@ -0,0 +1,324 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lewdarchive/internal/config"
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/repository"
+	"lewdarchive/internal/service"
+	"lewdarchive/pkg/database"
+)
+
+func TestHandleWebhookSourceSecrets(t *testing.T) {
+	body := []byte(testPayload)
+	tests := []struct {
+		name      string
+		cfg       config.Config
+		source    string
+		signature string
+		want      int
+	}{
+		{"no secrets accepts unsigned", config.Config{}, "", "", http.StatusOK},
+		{"global secret", config.Config{MinifluxSecretKey: "global"}, "", sign(body, "global"), http.StatusOK},
+		{"global secret unsigned", config.Config{MinifluxSecretKey: "global"}, "", "", http.StatusUnauthorized},
+		{"previous secret", config.Config{MinifluxSecretKey: "new", MinifluxSecretPrevious: "old"}, "", sign(body, "old"), http.StatusOK},
+		{"known source", config.Config{MinifluxSecrets: map[string]string{"alice": "a"}}, "alice", sign(body, "a"), http.StatusOK},
+		{"known source wrong secret", config.Config{MinifluxSecrets: map[string]string{"alice": "a"}}, "alice", sign(body, "b"), http.StatusUnauthorized},
+		{"unknown source unsigned", config.Config{MinifluxSecrets: map[string]string{"alice": "a"}}, "mallory", "", http.StatusUnauthorized},
+		{"unknown source with global secret", config.Config{MinifluxSecretKey: "global", MinifluxSecrets: map[string]string{"alice": "a"}}, "mallory", sign(body, "global"), http.StatusUnauthorized},
+		{"missing source without global secret", config.Config{MinifluxSecrets: map[string]string{"alice": "a"}}, "", "", http.StatusUnauthorized},
+		{"missing source with global secret", config.Config{MinifluxSecretKey: "global", MinifluxSecrets: map[string]string{"alice": "a"}}, "", sign(body, "global"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewWebhookHandler(tt.cfg, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+			target := "/webhook"
+			if tt.source != "" {
+				target += "?source=" + tt.source
+			}
+			req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Miniflux-Signature", tt.signature)
+			rec := httptest.NewRecorder()
+			h.HandleWebhook(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(testPayload)
+	tampered := []byte(`{"event_type":"new_entries","feed":{"id":2},"entries":[]}`)
+	rotating := config.Config{MinifluxSecretKey: "new", MinifluxSecretPrevious: "old"}
+	rotated := config.Config{MinifluxSecretKey: "new"}
+	flipped := []byte(sign(body, "new"))
+	flipped[0] ^= 1
+
+	tests := []struct {
+		name      string
+		cfg       config.Config
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{"new key", rotating, body, sign(body, "new"), true},
+		{"old key during rotation", rotating, body, sign(body, "old"), true},
+		{"sha256= prefix", rotating, body, "sha256=" + sign(body, "new"), true},
+		{"stale key after rotation", rotated, body, sign(body, "old"), false},
+		{"unknown key", rotating, body, sign(body, "guess"), false},
+		{"tampered body", rotating, tampered, sign(body, "new"), false},
+		{"tampered signature", rotating, body, string(flipped), false},
+		{"truncated signature", rotating, body, sign(body, "new")[:32], false},
+		{"empty signature", rotating, body, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewWebhookHandler(tt.cfg, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+			if got := h.verifySignature(tt.body, tt.signature, ""); got != tt.want {
+				t.Errorf("verifySignature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := database.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestProcessUpdatedEntry(t *testing.T) {
+	tests := []struct {
+		name           string
+		newURL         string
+		wantRedownload bool
+	}{
+		{"same URL", "https://example.com/post", false},
+		{"changed URL", "https://example.com/post-moved", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			postRepo := repository.NewPostRepository(newTestDB(t))
+			// No workers are started, so a re-download stays queued.
+			archiveService := service.NewArchiveService(t.TempDir(), nil, nil, postRepo, nil, nil, nil, nil, false)
+			h := NewWebhookHandler(config.Config{}, postRepo, nil, nil, nil, archiveService, nil, nil, nil, nil, nil)
+
+			post := &model.Post{Hash: "hash", URL: "https://example.com/post", Title: "Old title", Author: "Alice", Content: "old"}
+			if err := postRepo.Create(post); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			entry := model.Entry{Hash: "hash", URL: tt.newURL, Title: "New title", Author: "Alice B", Content: "new #tag"}
+			if err := h.processUpdatedEntry(context.Background(), model.Feed{}, entry, "", nil); err != nil {
+				t.Fatalf("processUpdatedEntry: %v", err)
+			}
+
+			got, err := postRepo.GetByHash("hash")
+			if err != nil {
+				t.Fatalf("GetByHash: %v", err)
+			}
+			if got.Title != entry.Title || got.URL != entry.URL || got.Author != entry.Author || got.Content != entry.Content {
+				t.Errorf("post = %q %q %q %q, want the updated entry", got.Title, got.URL, got.Author, got.Content)
+			}
+			if got.ID != post.ID {
+				t.Errorf("post ID = %d, want %d updated in place", got.ID, post.ID)
+			}
+			if active := archiveService.IsActive(post.ID); active != tt.wantRedownload {
+				t.Errorf("re-download queued = %v, want %v", active, tt.wantRedownload)
+			}
+		})
+	}
+}
+
+// newProcessingHandler returns a webhook handler that saves entries to a
+// test database and queues their downloads without running them.
+func newProcessingHandler(t *testing.T, cfg config.Config) (*WebhookHandler, *repository.PostRepository) {
+	t.Helper()
+	db := newTestDB(t)
+	postRepo := repository.NewPostRepository(db)
+	archiveService := service.NewArchiveService(t.TempDir(), nil, nil, postRepo, nil, nil, nil, nil, false)
+	h := NewWebhookHandler(cfg, postRepo, repository.NewIdempotencyRepository(db), repository.NewWebhookDeliveryRepository(db),
+		repository.NewFeedFilterRepository(db), archiveService, service.NewMinifluxService(service.MinifluxConfig{}), nil, nil, nil, nil)
+	return h, postRepo
+}
+
+func newEntriesPayload(hash string) string {
+	return `{"event_type":"new_entries","feed":{"id":0},"entries":[{"hash":"` + hash + `","title":"Post","url":"https://example.com/` + hash + `"}]}`
+}
+
+func postWebhook(h *WebhookHandler, body, idempotencyKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Miniflux-Event-Type", "new_entries")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	rec := httptest.NewRecorder()
+	h.HandleWebhook(rec, req)
+	return rec
+}
+
+func TestHandleWebhookIdempotencyKey(t *testing.T) {
+	h, postRepo := newProcessingHandler(t, config.Config{WebhookSuccessResponseBody: "ok", WebhookSuccessContentType: "text/plain"})
+
+	if rec := postWebhook(h, newEntriesPayload("first"), "key-1"); rec.Code != http.StatusOK {
+		t.Fatalf("first delivery: status %d", rec.Code)
+	}
+	// A redelivery with the same key is answered without looking at the body,
+	// so the entry it carries is never saved.
+	rec := postWebhook(h, newEntriesPayload("second"), "key-1")
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Errorf("redelivery: status %d body %q, want the original 200 %q", rec.Code, rec.Body.String(), "ok")
+	}
+	if exists, err := postRepo.ExistsByHash("second"); err != nil || exists {
+		t.Errorf("redelivery was processed: exists=%v err=%v", exists, err)
+	}
+
+	if rec := postWebhook(h, newEntriesPayload("third"), "key-2"); rec.Code != http.StatusOK {
+		t.Fatalf("new key: status %d", rec.Code)
+	}
+	for _, hash := range []string{"first", "third"} {
+		if exists, err := postRepo.ExistsByHash(hash); err != nil || !exists {
+			t.Errorf("entry %s not saved: exists=%v err=%v", hash, exists, err)
+		}
+	}
+}
+
+func TestHandleWebhookIdempotencyKeyReplaysClientErrors(t *testing.T) {
+	h, postRepo := newProcessingHandler(t, config.Config{})
+
+	if rec := postWebhook(h, "{not json", "key-1"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid delivery: status %d, want 400", rec.Code)
+	}
+	if rec := postWebhook(h, newEntriesPayload("fixed"), "key-1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("redelivery: status %d, want the original 400", rec.Code)
+	}
+	if exists, _ := postRepo.ExistsByHash("fixed"); exists {
+		t.Error("redelivery was processed")
+	}
+}
+
+func TestHandleWebhookSuccessResponseBody(t *testing.T) {
+	const successBody = "webhook-ok"
+	cfg := config.Config{
+		MinifluxSecretKey:          "secret",
+		WebhookMaxBodyMB:           1,
+		WebhookDedupWindowMinutes:  60,
+		WebhookSuccessResponseBody: successBody,
+		WebhookSuccessContentType:  "text/x-health",
+	}
+	h, _ := newProcessingHandler(t, cfg)
+	payload := newEntriesPayload("entry")
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		eventType   string
+		body        string
+		signature   string
+		want        int
+	}{
+		{"processed", http.MethodPost, "application/json", "new_entries", payload, sign([]byte(payload), "secret"), http.StatusOK},
+		{"duplicate delivery", http.MethodPost, "application/json", "new_entries", payload, sign([]byte(payload), "secret"), http.StatusOK},
+		{"ignored event", http.MethodPost, "application/json", "save_entry", payload, sign([]byte(payload), "secret"), http.StatusOK},
+		{"wrong method", http.MethodGet, "application/json", "new_entries", "", "", http.StatusMethodNotAllowed},
+		{"wrong content type", http.MethodPost, "text/plain", "new_entries", payload, sign([]byte(payload), "secret"), http.StatusUnsupportedMediaType},
+		{"bad signature", http.MethodPost, "application/json", "new_entries", payload, sign([]byte(payload), "wrong"), http.StatusUnauthorized},
+		{"invalid JSON", http.MethodPost, "application/json", "new_entries", "{", sign([]byte("{"), "secret"), http.StatusBadRequest},
+		{"too large", http.MethodPost, "application/json", "new_entries", strings.Repeat(" ", 2<<20), "", http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/webhook", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("X-Miniflux-Event-Type", tt.eventType)
+			req.Header.Set("X-Miniflux-Signature", tt.signature)
+			rec := httptest.NewRecorder()
+			h.HandleWebhook(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d", rec.Code, tt.want)
+			}
+			gotBody := strings.Contains(rec.Body.String(), successBody)
+			if success := tt.want == http.StatusOK; gotBody != success {
+				t.Errorf("body %q: success body present = %v, want %v", rec.Body.String(), gotBody, success)
+			}
+			if tt.want == http.StatusOK && rec.Header().Get("Content-Type") != "text/x-health" {
+				t.Errorf("Content-Type = %q, want text/x-health", rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestHandleWebhookBodyLimit(t *testing.T) {
+	h := NewWebhookHandler(config.Config{WebhookMaxBodyMB: 1}, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	limit := 1 << 20
+	// JSON whitespace pads the payload to an exact size.
+	pad := func(size int) string { return testPayload + strings.Repeat(" ", size-len(testPayload)) }
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"at the limit", pad(limit), http.StatusOK},
+		{"one byte over", pad(limit + 1), http.StatusRequestEntityTooLarge},
+		{"far over", pad(8 * limit), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			h.HandleWebhook(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleWebhookContentType(t *testing.T) {
+	h := NewWebhookHandler(config.Config{WebhookMaxBodyMB: 1}, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	tests := []struct {
+		contentType string
+		want        int
+	}{
+		{"application/json", http.StatusOK},
+		{"application/json; charset=utf-8", http.StatusOK},
+		{"Application/JSON", http.StatusOK},
+		{"", http.StatusUnsupportedMediaType},
+		{"text/plain", http.StatusUnsupportedMediaType},
+		{"application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"application/jsonp", http.StatusUnsupportedMediaType},
+		{"application/json; charset", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(testPayload))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			h.HandleWebhook(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
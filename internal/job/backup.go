@@ -0,0 +1,37 @@
+package job
+
+import (
+	"context"
+	"log"
+
+	"lewdarchive/internal/service"
+)
+
+// BackupJob runs a restic backup and reports failures to Discord.
+type BackupJob struct {
+	resticService  *service.ResticService
+	discordService *service.DiscordService
+}
+
+// NewBackupJob accepts a nil discordService, in which case failures are only
+// logged.
+func NewBackupJob(resticService *service.ResticService, discordService *service.DiscordService) *BackupJob {
+	return &BackupJob{
+		resticService:  resticService,
+		discordService: discordService,
+	}
+}
+
+func (j *BackupJob) Run(ctx context.Context) error {
+	err := j.resticService.Backup(ctx)
+	if err == nil {
+		return nil
+	}
+
+	if j.discordService != nil {
+		if alertErr := j.discordService.SendAlert("Restic backup failed", err.Error()); alertErr != nil {
+			log.Printf("Error sending Discord alert for failed backup: %v", alertErr)
+		}
+	}
+	return err
+}
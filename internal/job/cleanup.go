@@ -0,0 +1,103 @@
+package job
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"lewdarchive/internal/repository"
+	"lewdarchive/internal/service"
+)
+
+// stuckDownloadTimeout is how long a download may stay running before it is
+// assumed dead (e.g. the process restarted mid-download), reset and queued
+// again.
+const stuckDownloadTimeout = time.Hour
+
+type CleanupJob struct {
+	postRepo        *repository.PostRepository
+	archiveService  *service.ArchiveService
+	idempotencyRepo *repository.IdempotencyRepository
+	deliveryRepo    *repository.WebhookDeliveryRepository
+	archiveRoots    []string
+	maxRetries      int
+	now             func() time.Time
+}
+
+func NewCleanupJob(postRepo *repository.PostRepository, archiveService *service.ArchiveService, idempotencyRepo *repository.IdempotencyRepository, deliveryRepo *repository.WebhookDeliveryRepository, archiveRoots []string, maxRetries int) *CleanupJob {
+	return &CleanupJob{
+		postRepo:        postRepo,
+		archiveService:  archiveService,
+		idempotencyRepo: idempotencyRepo,
+		deliveryRepo:    deliveryRepo,
+		archiveRoots:    archiveRoots,
+		maxRetries:      maxRetries,
+		now:             time.Now,
+	}
+}
+
+// Run resets and requeues stuck downloads, finalizes posts that exhausted their retries,
+// prunes expired idempotency keys and webhook deliveries and removes empty
+// directories left behind in the archive roots.
+func (j *CleanupJob) Run(ctx context.Context) error {
+	reset, err := j.postRepo.ResetStuckDownloads(j.now().Add(-stuckDownloadTimeout))
+	if err != nil {
+		return err
+	}
+	j.archiveService.Requeue(context.WithoutCancel(ctx), reset)
+
+	finalized, err := j.postRepo.FinalizeFailedDownloads(j.maxRetries)
+	if err != nil {
+		return err
+	}
+
+	pruned, err := j.idempotencyRepo.PruneBefore(j.now().Add(-repository.IdempotencyKeyTTL))
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := j.deliveryRepo.PruneBefore(j.now().Add(-repository.WebhookDeliveryRetention))
+	if err != nil {
+		return err
+	}
+
+	var removed int
+	for _, root := range j.archiveRoots {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		removed += removeEmptyDirs(root)
+	}
+
+	log.Printf("Cleanup job: %d posts reset and requeued, %d posts finalized, %d idempotency keys and %d webhook deliveries pruned, %d directories removed", len(reset), finalized, pruned, deliveries, removed)
+	return nil
+}
+
+// removeEmptyDirs deletes empty directories below root, deepest first, and
+// returns how many were removed. The root itself is kept.
+func removeEmptyDirs(root string) int {
+	var dirs []string
+	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && path != root {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+
+	removed := 0
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil || len(entries) > 0 {
+			continue
+		}
+		if err := os.Remove(dirs[i]); err == nil {
+			removed++
+		}
+	}
+	return removed
+}
@@ -0,0 +1,97 @@
+package job
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/repository"
+	"lewdarchive/internal/service"
+	"lewdarchive/pkg/database"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := database.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func createPost(t *testing.T, db *sql.DB, postRepo *repository.PostRepository, hash string, status model.DownloadStatus, updatedAt time.Time) *model.Post {
+	t.Helper()
+	post := &model.Post{Hash: hash, URL: "https://example.com/" + hash, Title: hash, PublishedAt: updatedAt}
+	if err := postRepo.Create(post); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := db.Exec(
+		`UPDATE posts SET download_status = ?, download_status_updated_at = ? WHERE id = ?`,
+		status.String(), updatedAt.UTC(), post.ID,
+	); err != nil {
+		t.Fatalf("set status: %v", err)
+	}
+	return post
+}
+
+func TestCleanupJobRequeuesStuckDownloads(t *testing.T) {
+	db := newTestDB(t)
+	postRepo := repository.NewPostRepository(db)
+	// No workers are started, so requeued downloads stay queued.
+	archiveService := service.NewArchiveService(t.TempDir(), nil, nil, postRepo, nil, nil, nil, nil, false)
+	j := NewCleanupJob(postRepo, archiveService, repository.NewIdempotencyRepository(db), repository.NewWebhookDeliveryRepository(db), nil, 3)
+
+	startedAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	stuck := createPost(t, db, postRepo, "stuck", model.DownloadStatusRunning, startedAt)
+	recent := createPost(t, db, postRepo, "recent", model.DownloadStatusRunning, startedAt.Add(45*time.Minute))
+	done := createPost(t, db, postRepo, "done", model.DownloadStatusCompleted, startedAt)
+
+	tests := []struct {
+		name       string
+		now        time.Time
+		wantStatus map[*model.Post]model.DownloadStatus
+	}{
+		{
+			name: "before the timeout",
+			now:  startedAt.Add(stuckDownloadTimeout - time.Minute),
+			wantStatus: map[*model.Post]model.DownloadStatus{
+				stuck:  model.DownloadStatusRunning,
+				recent: model.DownloadStatusRunning,
+				done:   model.DownloadStatusCompleted,
+			},
+		},
+		{
+			name: "after the timeout",
+			now:  startedAt.Add(stuckDownloadTimeout + time.Minute),
+			wantStatus: map[*model.Post]model.DownloadStatus{
+				stuck:  model.DownloadStatusPending,
+				recent: model.DownloadStatusRunning,
+				done:   model.DownloadStatusCompleted,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j.now = func() time.Time { return tt.now }
+			if err := j.Run(context.Background()); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			for post, want := range tt.wantStatus {
+				got, err := postRepo.GetByID(post.ID)
+				if err != nil {
+					t.Fatalf("GetByID: %v", err)
+				}
+				if got.DownloadStatus != want {
+					t.Errorf("post %s: status %s, want %s", post.Hash, got.DownloadStatus, want)
+				}
+				if queued := archiveService.IsActive(post.ID); queued != (want == model.DownloadStatusPending) {
+					t.Errorf("post %s: queued = %v, want %v", post.Hash, queued, !queued)
+				}
+			}
+		})
+	}
+}
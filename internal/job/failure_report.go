@@ -0,0 +1,60 @@
+package job
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"lewdarchive/internal/repository"
+	"lewdarchive/internal/service"
+)
+
+// failureReportJobName keys the report window in the job_runs table.
+const failureReportJobName = "failure-report"
+
+// FailureReportJob emails the posts that failed since the previous report.
+type FailureReportJob struct {
+	postRepo     *repository.PostRepository
+	jobRunRepo   *repository.JobRunRepository
+	emailService *service.EmailService
+	startedAt    time.Time
+	now          func() time.Time
+}
+
+// NewFailureReportJob continues the report window stored in the database, or
+// starts it at startup when no report was ever sent.
+func NewFailureReportJob(postRepo *repository.PostRepository, jobRunRepo *repository.JobRunRepository, emailService *service.EmailService) *FailureReportJob {
+	return &FailureReportJob{
+		postRepo:     postRepo,
+		jobRunRepo:   jobRunRepo,
+		emailService: emailService,
+		startedAt:    time.Now(),
+		now:          time.Now,
+	}
+}
+
+// Run sends a report when anything failed since the last one. The window only
+// moves forward after a successful send so failures are not lost.
+func (j *FailureReportJob) Run(ctx context.Context) error {
+	now := j.now()
+	lastReport, err := j.jobRunRepo.LastRun(failureReportJobName)
+	if err != nil {
+		return err
+	}
+	if lastReport.IsZero() {
+		lastReport = j.startedAt
+	}
+
+	posts, err := j.postRepo.ListFailedSince(lastReport)
+	if err != nil {
+		return err
+	}
+	if len(posts) > 0 {
+		if err := j.emailService.SendFailureReport(posts, lastReport); err != nil {
+			return err
+		}
+		log.Printf("Failure report job: emailed %d failed posts", len(posts))
+	}
+
+	return j.jobRunRepo.SaveRun(failureReportJobName, now)
+}
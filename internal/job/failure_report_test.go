@@ -0,0 +1,58 @@
+package job
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/repository"
+	"lewdarchive/internal/service"
+)
+
+func TestFailureReportWindowSurvivesRestart(t *testing.T) {
+	db := newTestDB(t)
+	postRepo := repository.NewPostRepository(db)
+	jobRunRepo := repository.NewJobRunRepository(db)
+	// Nothing listens on port 1, so any report that is sent fails.
+	emailService := service.NewEmailService(service.EmailConfig{
+		Host:    "127.0.0.1",
+		Port:    1,
+		From:    "archive@example.com",
+		To:      []string{"me@example.com"},
+		TLSMode: service.EmailTLSNone,
+	})
+
+	lastReport := time.Now().Add(-2 * time.Hour).UTC().Truncate(time.Second)
+	if err := jobRunRepo.SaveRun(failureReportJobName, lastReport); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	createPost(t, db, postRepo, "failed", model.DownloadStatusFailed, time.Now().Add(-time.Hour))
+
+	// A job created after the failure still reports it.
+	j := NewFailureReportJob(postRepo, jobRunRepo, emailService)
+	if err := j.Run(context.Background()); err == nil {
+		t.Fatal("Run succeeded, want the report of the earlier failure to be attempted")
+	}
+	got, err := jobRunRepo.LastRun(failureReportJobName)
+	if err != nil {
+		t.Fatalf("LastRun: %v", err)
+	}
+	if !got.Equal(lastReport) {
+		t.Errorf("window start = %s after a failed send, want %s kept", got, lastReport)
+	}
+
+	// With nothing failed since, the window moves to the run time.
+	now := time.Now().Add(time.Minute).UTC().Truncate(time.Second)
+	j = NewFailureReportJob(postRepo, jobRunRepo, emailService)
+	j.now = func() time.Time { return now }
+	if _, err := db.Exec(`DELETE FROM posts`); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got, _ := jobRunRepo.LastRun(failureReportJobName); !got.Equal(now) {
+		t.Errorf("window start = %s, want %s", got, now)
+	}
+}
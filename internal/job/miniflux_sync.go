@@ -0,0 +1,45 @@
+package job
+
+import (
+	"context"
+	"log"
+
+	"lewdarchive/internal/repository"
+	"lewdarchive/internal/service"
+)
+
+// MinifluxSyncJob copies the Miniflux categories and feeds into the local
+// categories and feeds tables.
+type MinifluxSyncJob struct {
+	minifluxService *service.MinifluxService
+	feedRepo        *repository.FeedRepository
+}
+
+func NewMinifluxSyncJob(minifluxService *service.MinifluxService, feedRepo *repository.FeedRepository) *MinifluxSyncJob {
+	return &MinifluxSyncJob{
+		minifluxService: minifluxService,
+		feedRepo:        feedRepo,
+	}
+}
+
+// Run syncs categories before feeds so that every feed's category exists.
+func (j *MinifluxSyncJob) Run(ctx context.Context) error {
+	categories, err := j.minifluxService.ListCategories(ctx)
+	if err != nil {
+		return err
+	}
+	if err := j.feedRepo.UpsertCategories(categories); err != nil {
+		return err
+	}
+
+	feeds, err := j.minifluxService.ListFeeds(ctx)
+	if err != nil {
+		return err
+	}
+	if err := j.feedRepo.UpsertFeeds(feeds); err != nil {
+		return err
+	}
+
+	log.Printf("Miniflux sync job: %d categories and %d feeds synced", len(categories), len(feeds))
+	return nil
+}
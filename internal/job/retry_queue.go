@@ -0,0 +1,102 @@
+package job
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"time"
+
+	"lewdarchive/internal/repository"
+	"lewdarchive/internal/service"
+)
+
+// RetryQueueProcessor re-attempts Chibisafe uploads that failed during
+// archiving. Each failure pushes the next attempt back by another interval.
+// Once no attempts are left for a post, the download directory kept for them
+// is cleaned up.
+type RetryQueueProcessor struct {
+	retryQueue       *repository.RetryQueueRepository
+	chibisafeService *service.ChibisafeService
+	archiveService   *service.ArchiveService
+	interval         time.Duration
+	maxRetries       int
+	now              func() time.Time
+}
+
+func NewRetryQueueProcessor(retryQueue *repository.RetryQueueRepository, chibisafeService *service.ChibisafeService, archiveService *service.ArchiveService, interval time.Duration, maxRetries int) *RetryQueueProcessor {
+	return &RetryQueueProcessor{
+		retryQueue:       retryQueue,
+		chibisafeService: chibisafeService,
+		archiveService:   archiveService,
+		interval:         interval,
+		maxRetries:       maxRetries,
+		now:              time.Now,
+	}
+}
+
+// Run retries every due upload once. Uploads that reach maxRetries stay in the
+// queue for inspection but are no longer picked up.
+func (p *RetryQueueProcessor) Run(ctx context.Context) error {
+	if !p.chibisafeService.IsConfigured() {
+		return nil
+	}
+
+	items, err := p.retryQueue.ListDue(p.now(), p.maxRetries)
+	if err != nil {
+		return err
+	}
+
+	var succeeded, failed int
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		file, err := p.chibisafeService.RetryUpload(item)
+		if err != nil {
+			failed++
+			attempts := item.Attempts + 1
+			log.Printf("Upload retry %d/%d for %s failed: %v", attempts, p.maxRetries, item.Filename, err)
+			next := p.now().Add(p.interval * time.Duration(attempts+1))
+			if err := p.retryQueue.RecordFailure(item.ID, next, err.Error()); err != nil {
+				log.Printf("Error updating upload retry %d: %v", item.ID, err)
+				continue
+			}
+			if attempts >= p.maxRetries {
+				log.Printf("Giving up on uploading %s", item.Filename)
+				p.releaseDirectory(item.PostID, filepath.Dir(item.LocalFilePath))
+			}
+			continue
+		}
+
+		succeeded++
+		log.Printf("Upload retry succeeded for %s -> UUID: %s", item.Filename, file.UUID)
+		if err := p.retryQueue.Delete(item.ID); err != nil {
+			log.Printf("Error removing upload retry %d: %v", item.ID, err)
+			continue
+		}
+		p.chibisafeService.FinishUpload(item.PostID)
+		p.releaseDirectory(item.PostID, filepath.Dir(item.LocalFilePath))
+	}
+
+	if len(items) > 0 {
+		log.Printf("Upload retry job: %d succeeded, %d failed", succeeded, failed)
+	}
+	return nil
+}
+
+// releaseDirectory cleans up the download directory of a post once none of
+// its uploads have retries left.
+func (p *RetryQueueProcessor) releaseDirectory(postID int, dir string) {
+	if p.archiveService == nil {
+		return
+	}
+	pending, err := p.retryQueue.CountPendingByPostID(postID, p.maxRetries)
+	if err != nil {
+		log.Printf("Error checking upload retries for post %d: %v", postID, err)
+		return
+	}
+	if pending == 0 {
+		p.archiveService.CleanupRetriedDirectory(dir)
+	}
+}
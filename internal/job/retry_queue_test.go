@@ -0,0 +1,104 @@
+package job
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/repository"
+	"lewdarchive/internal/service"
+)
+
+// newChibisafeServer fakes direct uploads to Chibisafe, failing them while
+// fail is set.
+func newChibisafeServer(t *testing.T, fail *atomic.Bool) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/settings":
+			w.Write([]byte(`{"useNetworkStorage": false}`))
+		case "/api/upload":
+			if fail.Load() {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"uuid": "file-uuid", "publicUrl": "https://chibisafe.example/file.jpg"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRetryQueueCleansUpDirectory(t *testing.T) {
+	tests := []struct {
+		name      string
+		fail      bool
+		remaining int
+	}{
+		{"last retry succeeds", false, 0},
+		{"last retry exhausted", true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fail atomic.Bool
+			fail.Store(tt.fail)
+			srv := newChibisafeServer(t, &fail)
+
+			db := newTestDB(t)
+			postRepo := repository.NewPostRepository(db)
+			retryQueue := repository.NewRetryQueueRepository(db)
+			chibisafe := service.NewChibisafeService(service.ChibisafeConfig{APIURL: srv.URL, APIKey: "key", RetryQueue: retryQueue})
+			archiveRoot := t.TempDir()
+			archiveService := service.NewArchiveService(archiveRoot, nil, chibisafe, postRepo, nil, nil, nil, nil, true)
+
+			post := createPost(t, db, postRepo, "post", model.DownloadStatusCompleted, time.Now())
+			dir := filepath.Join(archiveRoot, "Alice", "post")
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			for i, name := range []string{"1.jpg", "2.jpg"} {
+				path := filepath.Join(dir, name)
+				if err := os.WriteFile(path, []byte("image"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				// Both files are down to their last attempt, the second one
+				// due only after the first run.
+				item := &model.ChibisafeRetry{PostID: post.ID, LocalFilePath: path, Filename: name, Attempts: 2, NextAttemptAt: time.Now().Add(time.Duration(i)*time.Hour - time.Minute)}
+				if err := retryQueue.Enqueue(item); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			p := NewRetryQueueProcessor(retryQueue, chibisafe, archiveService, time.Hour, 3)
+			if err := p.Run(context.Background()); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if _, err := os.Stat(dir); err != nil {
+				t.Fatalf("directory removed while a retry was pending: %v", err)
+			}
+
+			// Make the attempt of the second file.
+			p.now = func() time.Time { return time.Now().Add(24 * time.Hour) }
+			if err := p.Run(context.Background()); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if _, err := os.Stat(dir); !os.IsNotExist(err) {
+				t.Errorf("directory still there after the last retry: %v", err)
+			}
+			if _, err := os.Stat(archiveRoot); err != nil {
+				t.Errorf("archive root removed: %v", err)
+			}
+			if n, _ := retryQueue.Count(); n != tt.remaining*2 {
+				t.Errorf("%d retries left in the queue, want %d", n, tt.remaining*2)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DiskUsedBytes is the disk space taken by all downloads, as recorded in
+// posts.download_size_bytes.
+var DiskUsedBytes = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: "lewdarchive",
+	Name:      "disk_used_bytes",
+	Help:      "Total size in bytes of all archived downloads.",
+})
+
+// DownloadDuration measures how long DownloadContent takes per post, from the
+// start of the download to the end of the upload, by outcome.
+var DownloadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "lewdarchive",
+	Name:      "download_duration_seconds",
+	Help:      "Duration of post downloads including uploads, by status.",
+	Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+}, []string{"status"})
@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 type WebhookPayload struct {
 	EventType string  `json:"event_type"`
@@ -8,6 +12,86 @@ type WebhookPayload struct {
 	Entries   []Entry `json:"entries"`
 }
 
+// FreshRSSEntry is the body POSTed to /webhook/freshrss for one new entry, as
+// sent by the FreshRSS Webhook extension with a body template mapping its
+// placeholders to these fields, e.g. "title": "__TITLE__", "url": "__URL__",
+// "date_timestamp": __DATE_TIMESTAMP__. FreshRSS has no categories in its
+// placeholders, so Category, like every field but URL, is optional.
+type FreshRSSEntry struct {
+	Title         string `json:"title"`
+	URL           string `json:"url"`
+	Content       string `json:"content"`
+	Authors       string `json:"authors"`
+	Date          string `json:"date"`
+	DateTimestamp int64  `json:"date_timestamp"`
+	FeedName      string `json:"feed_name"`
+	FeedURL       string `json:"feed_url"`
+	SiteURL       string `json:"site_url"`
+	Category      string `json:"category"`
+	ThumbnailURL  string `json:"thumbnail_url"`
+}
+
+// TTRSSPayload is the body POSTed to /webhook/ttrss: the new articles of a
+// feed, with the article fields of the Tiny Tiny RSS getHeadlines API.
+type TTRSSPayload struct {
+	Feed     TTRSSFeed      `json:"feed"`
+	Articles []TTRSSArticle `json:"articles"`
+}
+
+type TTRSSFeed struct {
+	Title    string `json:"title"`
+	FeedURL  string `json:"feed_url"`
+	SiteURL  string `json:"site_url"`
+	CatTitle string `json:"cat_title"`
+}
+
+// TTRSSArticle is an article of a TTRSSPayload; Updated is a Unix timestamp.
+type TTRSSArticle struct {
+	Title       string            `json:"title"`
+	Link        string            `json:"link"`
+	Content     string            `json:"content"`
+	Author      string            `json:"author"`
+	Updated     int64             `json:"updated"`
+	Attachments []TTRSSAttachment `json:"attachments"`
+}
+
+type TTRSSAttachment struct {
+	ContentURL  string `json:"content_url"`
+	ContentType string `json:"content_type"`
+}
+
+// WebhookDelivery records a webhook request, identified by the SHA-256 of
+// its body. Duplicate deliveries of a payload processed shortly before are
+// recorded but not processed again.
+type WebhookDelivery struct {
+	ID          int       `json:"id"`
+	PayloadHash string    `json:"payload_hash"`
+	Source      string    `json:"source,omitempty"`
+	EventType   string    `json:"event_type"`
+	EntryCount  int       `json:"entry_count"`
+	Duplicate   bool      `json:"duplicate"`
+	ReceivedAt  time.Time `json:"received_at"`
+}
+
+// Feed filter types. Entries of a feed are skipped when their author matches
+// an author_block filter or their URL matches a url_pattern_block regular
+// expression. Once a feed has author_allow filters, only entries by those
+// authors are kept.
+const (
+	FeedFilterAuthorBlock     = "author_block"
+	FeedFilterURLPatternBlock = "url_pattern_block"
+	FeedFilterAuthorAllow     = "author_allow"
+)
+
+// FeedFilter is an author or URL filter of a single feed.
+type FeedFilter struct {
+	ID         int       `json:"id"`
+	FeedID     int       `json:"feed_id"`
+	FilterType string    `json:"filter_type"`
+	Pattern    string    `json:"pattern"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 type Feed struct {
 	ID       int      `json:"id"`
 	SiteURL  string   `json:"site_url"`
@@ -32,6 +116,19 @@ type Entry struct {
 	Enclosures  []Enclosure `json:"enclosures"`
 }
 
+// FeedEntry is an entry as returned by the Miniflux API, which embeds the feed
+// instead of sending it alongside as webhooks do.
+type FeedEntry struct {
+	Entry
+	Feed Feed `json:"feed"`
+}
+
+// EntriesPage is one page of a Miniflux entries listing.
+type EntriesPage struct {
+	Total   int         `json:"total"`
+	Entries []FeedEntry `json:"entries"`
+}
+
 type Enclosure struct {
 	ID       int    `json:"id"`
 	URL      string `json:"url"`
@@ -50,6 +147,320 @@ type Post struct {
 	Author        string    `json:"author"`
 	CategoryID    int       `json:"category_id"`
 	CategoryTitle string    `json:"category_title"`
+	FeedID        int       `json:"feed_id,omitempty"`
+	Source        string    `json:"source,omitempty"`
+	Tags          []string  `json:"tags,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	DiscordMessageID  string `json:"discord_message_id,omitempty"`
+	DiscordWebhookURL string `json:"-"`
+
+	DownloadStatus    DownloadStatus `json:"download_status"`
+	DownloadAttempts  int            `json:"download_attempts"`
+	DownloadSizeBytes int64          `json:"download_size_bytes"`
+	// DownloadCompletedAt and UploadCompletedAt tell when the post was last
+	// downloaded and uploaded to Chibisafe.
+	DownloadCompletedAt *time.Time `json:"download_completed_at,omitempty"`
+	UploadCompletedAt   *time.Time `json:"upload_completed_at,omitempty"`
+}
+
+// Entry rebuilds the Miniflux entry a post was created from. Enclosures are
+// not stored, so previews fall back to images found in the content.
+func (p *Post) Entry() Entry {
+	return Entry{
+		ID:          p.EntryID,
+		Hash:        p.Hash,
+		Title:       p.Title,
+		URL:         p.URL,
+		PublishedAt: p.PublishedAt.UTC().Format(time.RFC3339),
+		Content:     p.Content,
+		Author:      p.Author,
+	}
+}
+
+// Feed rebuilds the parts of the Miniflux feed that are stored with a post.
+func (p *Post) Feed() Feed {
+	return Feed{
+		ID:      p.FeedID,
+		SiteURL: p.SiteURL,
+		Category: Category{
+			ID:    p.CategoryID,
+			Title: p.CategoryTitle,
+		},
+	}
+}
+
+// ArchiveStats summarizes the archive for GET /api/stats.
+type ArchiveStats struct {
+	TotalPosts        int64 `json:"total_posts"`
+	TotalArchiveBytes int64 `json:"total_archive_bytes"`
+	TotalUploaded     int64 `json:"total_uploaded"`
+	// AvgDownloadSeconds is the mean time from archiving a post to its
+	// download completing, and AvgUploadSeconds from there to its upload
+	// completing.
+	AvgDownloadSeconds float64 `json:"avg_download_seconds"`
+	AvgUploadSeconds   float64 `json:"avg_upload_seconds"`
+}
+
+// DailyCount counts the posts archived on one day.
+type DailyCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// NamedCount counts the posts of one author or category.
+type NamedCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// DailyDownloadStats counts the downloads that finished on one day, and the
+// uploads.
+type DailyDownloadStats struct {
+	Date      string `json:"date"`
+	Total     int    `json:"total"`
+	Completed int    `json:"completed"`
+	Failed    int    `json:"failed"`
+	Uploaded  int    `json:"uploaded"`
+}
+
+// SearchResult is a post matching a full-text search. Snippet is HTML-escaped
+// text with the matched terms wrapped in <mark>.
+type SearchResult struct {
+	Hash          string    `json:"hash"`
+	Title         string    `json:"title"`
+	URL           string    `json:"url"`
+	Author        string    `json:"author"`
+	CategoryTitle string    `json:"category_title"`
+	PublishedAt   time.Time `json:"published_at"`
+	Snippet       string    `json:"snippet"`
+	Rank          float64   `json:"rank"`
+}
+
+// AuthorSummary describes an author's posts for GET /api/authors.
+type AuthorSummary struct {
+	Author     string    `json:"author"`
+	PostCount  int       `json:"post_count"`
+	LatestPost time.Time `json:"latest_post"`
+	Categories []string  `json:"categories"`
+}
+
+// FeedStats describes the posts of a feed for GET /api/feeds/{id}/stats.
+// PendingPosts counts the downloads not finished yet, running ones included,
+// and FailedPosts those that failed for now or for good. The post dates are
+// publication times and nil when the feed has no posts.
+type FeedStats struct {
+	FeedID          int        `json:"feed_id"`
+	Title           string     `json:"title,omitempty"`
+	TotalPosts      int        `json:"total_posts"`
+	DownloadedPosts int        `json:"downloaded_posts"`
+	FailedPosts     int        `json:"failed_posts"`
+	PendingPosts    int        `json:"pending_posts"`
+	TotalSizeBytes  int64      `json:"total_size_bytes"`
+	LatestPost      *time.Time `json:"latest_post"`
+	OldestPost      *time.Time `json:"oldest_post"`
+}
+
+// DownloadStatus is the archiving state of a post as stored in
+// posts.download_status.
+type DownloadStatus string
+
+const (
+	DownloadStatusPending     DownloadStatus = "pending"
+	DownloadStatusRunning     DownloadStatus = "running"
+	DownloadStatusCompleted   DownloadStatus = "completed"
+	DownloadStatusFailed      DownloadStatus = "failed"
+	DownloadStatusFinalFailed DownloadStatus = "final_failed"
+)
+
+func (s DownloadStatus) IsValid() bool {
+	switch s {
+	case DownloadStatusPending, DownloadStatusRunning, DownloadStatusCompleted, DownloadStatusFailed, DownloadStatusFinalFailed:
+		return true
+	}
+	return false
+}
+
+func (s DownloadStatus) String() string {
+	return string(s)
+}
+
+func (s DownloadStatus) MarshalJSON() ([]byte, error) {
+	if !s.IsValid() {
+		return nil, fmt.Errorf("invalid download status %q", string(s))
+	}
+	return json.Marshal(string(s))
+}
+
+func (s *DownloadStatus) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if !DownloadStatus(value).IsValid() {
+		return fmt.Errorf("invalid download status %q", value)
+	}
+	*s = DownloadStatus(value)
+	return nil
+}
+
+type DownloadLog struct {
+	ID              int       `json:"id"`
+	PostID          int       `json:"post_id"`
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	ExitCode        int       `json:"exit_code"`
+	StdoutLines     string    `json:"stdout_lines"`
+	StderrLines     string    `json:"stderr_lines"`
+	FilesDownloaded int       `json:"files_downloaded"`
+}
+
+// Upload is a file of a post that was uploaded to Chibisafe.
+type Upload struct {
+	ID        int       `json:"id"`
+	PostID    int       `json:"post_id"`
+	Name      string    `json:"name"`
+	LocalName string    `json:"local_name,omitempty"`
+	UUID      string    `json:"uuid"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FileHash is the Chibisafe upload of a file content, identified by its
+// SHA-256, reused when the same file turns up in another post.
+type FileHash struct {
+	Hash          string    `json:"file_hash"`
+	ChibisafeUUID string    `json:"chibisafe_uuid"`
+	ChibisafeURL  string    `json:"chibisafe_url"`
+	UploadedAt    time.Time `json:"uploaded_at"`
+}
+
+// PostFile is a file archived for a post. Path is relative to the archive
+// root; files only known from their upload, such as video thumbnails, have no
+// path, size or checksum.
+type PostFile struct {
+	Path          string `json:"path,omitempty"`
+	Name          string `json:"name"`
+	SizeBytes     int64  `json:"size_bytes,omitempty"`
+	SHA256        string `json:"sha256,omitempty"`
+	ChibisafeUUID string `json:"chibisafe_uuid,omitempty"`
+	ChibisafeURL  string `json:"chibisafe_url,omitempty"`
+}
+
+// LocalFile is a file in a post's archive directory, named by its path
+// relative to that directory.
+type LocalFile struct {
+	Name        string `json:"name"`
+	SizeBytes   int64  `json:"size_bytes"`
+	ContentType string `json:"content_type"`
+	SHA256      string `json:"sha256"`
+}
+
+// ImportRecord is a post archived by another tool, as accepted by
+// POST /api/import. Only URL is required; Hash defaults to the SHA-256 of the
+// URL and Path, when set, is a directory already holding the post's files.
+type ImportRecord struct {
+	URL         string `json:"url"`
+	Hash        string `json:"hash,omitempty"`
+	Title       string `json:"title"`
+	Author      string `json:"author"`
+	Category    string `json:"category"`
+	PublishedAt string `json:"published_at"`
+	Path        string `json:"path,omitempty"`
+}
+
+type ImportStatus string
+
+const (
+	ImportStatusCreated ImportStatus = "created"
+	ImportStatusSkipped ImportStatus = "skipped"
+	ImportStatusError   ImportStatus = "error"
+)
+
+// ImportResult is the outcome of importing one record, Index being its
+// position in the request.
+type ImportResult struct {
+	Index          int            `json:"index"`
+	URL            string         `json:"url,omitempty"`
+	Hash           string         `json:"hash,omitempty"`
+	Status         ImportStatus   `json:"status"`
+	DownloadStatus DownloadStatus `json:"download_status,omitempty"`
+	Error          string         `json:"error,omitempty"`
+}
+
+// ChibisafeRetry is an upload that failed all in-process attempts and waits in
+// the retry queue. TagUUIDs holds the tags to apply once the upload succeeds.
+type ChibisafeRetry struct {
+	ID            int
+	PostID        int
+	LocalFilePath string
+	Filename      string
+	AlbumUUID     string
+	TagUUIDs      []string
+	Attempts      int
+	NextAttemptAt time.Time
+	Error         string
+}
+
+// JobType tells downloads from Chibisafe upload retries in GET /api/jobs.
+type JobType string
+
+const (
+	JobTypeDownload JobType = "download"
+	JobTypeUpload   JobType = "upload"
+)
+
+// JobStatus is the state of a download or upload that has not succeeded yet.
+type JobStatus string
+
+const (
+	JobStatusQueued  JobStatus = "queued"
+	JobStatusRunning JobStatus = "running"
+	JobStatusFailed  JobStatus = "failed"
+)
+
+// ErrorClass tells failures that may go away on their own, such as timeouts
+// and rate limits, from those that need fixing before a retry can succeed.
+type ErrorClass string
+
+const (
+	ErrorClassTransient ErrorClass = "transient"
+	ErrorClassPermanent ErrorClass = "permanent"
+)
+
+// Job is a download or Chibisafe upload that has not succeeded yet. Download
+// jobs are identified by their post as "download-<post id>", uploads by their
+// retry queue entry as "upload-<id>".
+type Job struct {
+	ID            string     `json:"id"`
+	Type          JobType    `json:"type"`
+	Status        JobStatus  `json:"status"`
+	PostHash      string     `json:"post_hash"`
+	PostTitle     string     `json:"post_title"`
+	Filename      string     `json:"filename,omitempty"`
+	Attempts      int        `json:"attempts"`
+	ExitCode      int        `json:"exit_code,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	ErrorClass    ErrorClass `json:"error_class,omitempty"`
+	UpdatedAt     *time.Time `json:"updated_at,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+}
+
+const (
+	EventEntrySaved        = "entry.saved"
+	EventDownloadCompleted = "download.completed"
+	EventUploadCompleted   = "upload.completed"
+)
+
+type ArchiveEvent struct {
+	EventType     string    `json:"event_type"`
+	PostHash      string    `json:"post_hash"`
+	PostURL       string    `json:"post_url"`
+	Author        string    `json:"author"`
+	CategoryTitle string    `json:"category_title"`
+	ChibisafeURLs []string  `json:"chibisafe_urls,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
 }
 
 // Chibisafe types
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"lewdarchive/internal/model"
+)
+
+type DownloadLogRepository struct {
+	db *sql.DB
+}
+
+func NewDownloadLogRepository(db *sql.DB) *DownloadLogRepository {
+	return &DownloadLogRepository{db: db}
+}
+
+func (r *DownloadLogRepository) Create(entry *model.DownloadLog) error {
+	query := `
+		INSERT INTO download_log (post_id, started_at, finished_at, exit_code, stdout_lines, stderr_lines, files_downloaded)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := r.db.Exec(query,
+		entry.PostID,
+		entry.StartedAt,
+		entry.FinishedAt,
+		entry.ExitCode,
+		entry.StdoutLines,
+		entry.StderrLines,
+		entry.FilesDownloaded,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create download log: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to read download log id: %w", err)
+	}
+	entry.ID = int(id)
+
+	return nil
+}
+
+// ListByPostID returns the most recent download attempts for a post, newest first.
+func (r *DownloadLogRepository) ListByPostID(postID, limit int) ([]model.DownloadLog, error) {
+	query := `
+		SELECT id, post_id, started_at, finished_at, exit_code, stdout_lines, stderr_lines, files_downloaded
+		FROM download_log WHERE post_id = ?
+		ORDER BY started_at DESC, id DESC
+		LIMIT ?
+	`
+
+	rows, err := r.db.Query(query, postID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list download logs: %w", err)
+	}
+	defer rows.Close()
+
+	logs := []model.DownloadLog{}
+	for rows.Next() {
+		var entry model.DownloadLog
+		var stdout, stderr sql.NullString
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.PostID,
+			&entry.StartedAt,
+			&entry.FinishedAt,
+			&entry.ExitCode,
+			&stdout,
+			&stderr,
+			&entry.FilesDownloaded,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan download log: %w", err)
+		}
+		entry.StdoutLines = stdout.String
+		entry.StderrLines = stderr.String
+		logs = append(logs, entry)
+	}
+
+	return logs, rows.Err()
+}
+
+// LatestByPostIDs returns the most recent download attempt of each of the
+// given posts that has one, keyed by post ID.
+func (r *DownloadLogRepository) LatestByPostIDs(postIDs []int) (map[int]model.DownloadLog, error) {
+	logs := make(map[int]model.DownloadLog)
+	if len(postIDs) == 0 {
+		return logs, nil
+	}
+
+	placeholders := make([]string, len(postIDs))
+	args := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, post_id, started_at, finished_at, exit_code, stderr_lines, files_downloaded
+		FROM download_log
+		WHERE id IN (SELECT MAX(id) FROM download_log WHERE post_id IN (%s) GROUP BY post_id)
+	`, strings.Join(placeholders, ", "))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list latest download logs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry model.DownloadLog
+		var stderr sql.NullString
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.PostID,
+			&entry.StartedAt,
+			&entry.FinishedAt,
+			&entry.ExitCode,
+			&stderr,
+			&entry.FilesDownloaded,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan download log: %w", err)
+		}
+		entry.StderrLines = stderr.String
+		logs[entry.PostID] = entry
+	}
+	return logs, rows.Err()
+}
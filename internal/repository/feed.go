@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"lewdarchive/internal/model"
+)
+
+// FeedRepository stores the categories and feeds synced from Miniflux.
+type FeedRepository struct {
+	db *sql.DB
+}
+
+func NewFeedRepository(db *sql.DB) *FeedRepository {
+	return &FeedRepository{db: db}
+}
+
+// UpsertCategories inserts new categories and renames existing ones.
+func (r *FeedRepository) UpsertCategories(categories []model.Category) error {
+	return r.inTx(func(tx *sql.Tx, now time.Time) error {
+		for _, category := range categories {
+			if _, err := tx.Exec(`
+				INSERT INTO categories (id, title, synced_at) VALUES (?, ?, ?)
+				ON CONFLICT(id) DO UPDATE SET title = excluded.title, synced_at = excluded.synced_at
+			`, category.ID, category.Title, now); err != nil {
+				return fmt.Errorf("failed to upsert category %d: %w", category.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// UpsertFeeds inserts new feeds and updates existing ones.
+func (r *FeedRepository) UpsertFeeds(feeds []model.Feed) error {
+	return r.inTx(func(tx *sql.Tx, now time.Time) error {
+		for _, feed := range feeds {
+			var categoryID sql.NullInt64
+			if feed.Category.ID != 0 {
+				categoryID = sql.NullInt64{Int64: int64(feed.Category.ID), Valid: true}
+			}
+			if _, err := tx.Exec(`
+				INSERT INTO feeds (id, title, site_url, feed_url, category_id, synced_at) VALUES (?, ?, ?, ?, ?, ?)
+				ON CONFLICT(id) DO UPDATE SET
+					title = excluded.title,
+					site_url = excluded.site_url,
+					feed_url = excluded.feed_url,
+					category_id = excluded.category_id,
+					synced_at = excluded.synced_at
+			`, feed.ID, feed.Title, feed.SiteURL, feed.FeedURL, categoryID, now); err != nil {
+				return fmt.Errorf("failed to upsert feed %d: %w", feed.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Get returns a synced feed, or sql.ErrNoRows. Its category only has an ID.
+func (r *FeedRepository) Get(ctx context.Context, id int) (*model.Feed, error) {
+	feed := &model.Feed{}
+	var siteURL sql.NullString
+	var categoryID sql.NullInt64
+	err := r.db.QueryRowContext(ctx, `SELECT id, title, site_url, feed_url, category_id FROM feeds WHERE id = ?`, id).
+		Scan(&feed.ID, &feed.Title, &siteURL, &feed.FeedURL, &categoryID)
+	if err != nil {
+		return nil, err
+	}
+	feed.SiteURL = siteURL.String
+	feed.Category.ID = int(categoryID.Int64)
+	return feed, nil
+}
+
+func (r *FeedRepository) inTx(fn func(tx *sql.Tx, now time.Time) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx, time.Now().UTC()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
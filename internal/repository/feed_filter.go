@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"lewdarchive/internal/model"
+)
+
+// FeedFilterRepository stores the per-feed author and URL filters.
+type FeedFilterRepository struct {
+	db *sql.DB
+}
+
+func NewFeedFilterRepository(db *sql.DB) *FeedFilterRepository {
+	return &FeedFilterRepository{db: db}
+}
+
+// List returns the filters of a feed, oldest first.
+func (r *FeedFilterRepository) List(ctx context.Context, feedID int) ([]model.FeedFilter, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, feed_id, filter_type, pattern, created_at FROM feed_filters WHERE feed_id = ? ORDER BY id`,
+		feedID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list filters of feed %d: %w", feedID, err)
+	}
+	defer rows.Close()
+
+	filters := []model.FeedFilter{}
+	for rows.Next() {
+		var filter model.FeedFilter
+		if err := rows.Scan(&filter.ID, &filter.FeedID, &filter.FilterType, &filter.Pattern, &filter.CreatedAt); err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return filters, rows.Err()
+}
+
+// Add saves a new filter, setting its ID and creation time.
+func (r *FeedFilterRepository) Add(ctx context.Context, filter *model.FeedFilter) error {
+	filter.CreatedAt = time.Now().UTC()
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO feed_filters (feed_id, filter_type, pattern, created_at) VALUES (?, ?, ?, ?)`,
+		filter.FeedID, filter.FilterType, filter.Pattern, filter.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add filter to feed %d: %w", filter.FeedID, err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to read feed filter id: %w", err)
+	}
+	filter.ID = int(id)
+	return nil
+}
+
+// Remove deletes a filter of a feed, or returns sql.ErrNoRows when the feed
+// has no such filter.
+func (r *FeedFilterRepository) Remove(ctx context.Context, feedID, id int) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM feed_filters WHERE id = ? AND feed_id = ?`, id, feedID)
+	if err != nil {
+		return fmt.Errorf("failed to remove filter %d of feed %d: %w", id, feedID, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"lewdarchive/internal/model"
+)
+
+type FileHashRepository struct {
+	db *sql.DB
+}
+
+func NewFileHashRepository(db *sql.DB) *FileHashRepository {
+	return &FileHashRepository{db: db}
+}
+
+// FindByHash returns the upload recorded for a SHA-256, or nil when the
+// content was never uploaded.
+func (r *FileHashRepository) FindByHash(hash string) (*model.FileHash, error) {
+	var fileHash model.FileHash
+	var url sql.NullString
+	err := r.db.QueryRow(
+		`SELECT file_hash, chibisafe_uuid, chibisafe_url, uploaded_at FROM file_hashes WHERE file_hash = ?`,
+		hash,
+	).Scan(&fileHash.Hash, &fileHash.ChibisafeUUID, &url, &fileHash.UploadedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up file hash: %w", err)
+	}
+	fileHash.ChibisafeURL = url.String
+	return &fileHash, nil
+}
+
+// Create records the upload of a file content. The first upload recorded for
+// a hash is kept.
+func (r *FileHashRepository) Create(fileHash *model.FileHash) error {
+	_, err := r.db.Exec(
+		`INSERT INTO file_hashes (file_hash, chibisafe_uuid, chibisafe_url) VALUES (?, ?, ?)
+		ON CONFLICT (file_hash) DO NOTHING`,
+		fileHash.Hash, fileHash.ChibisafeUUID, sql.NullString{String: fileHash.ChibisafeURL, Valid: fileHash.ChibisafeURL != ""},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create file hash: %w", err)
+	}
+	return nil
+}
+
+// DeleteByUUID forgets the file contents uploaded as a Chibisafe file, once
+// that file was deleted.
+func (r *FileHashRepository) DeleteByUUID(uuid string) error {
+	if _, err := r.db.Exec(`DELETE FROM file_hashes WHERE chibisafe_uuid = ?`, uuid); err != nil {
+		return fmt.Errorf("failed to delete file hash: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type ForumThreadRepository struct {
+	db *sql.DB
+}
+
+func NewForumThreadRepository(db *sql.DB) *ForumThreadRepository {
+	return &ForumThreadRepository{db: db}
+}
+
+// Find returns the ID of the forum thread named threadName behind a Discord
+// webhook, or "" when none was recorded.
+func (r *ForumThreadRepository) Find(webhookID, threadName string) (string, error) {
+	var threadID string
+	err := r.db.QueryRow(
+		`SELECT thread_id FROM discord_forum_threads WHERE webhook_id = ? AND thread_name = ?`,
+		webhookID, threadName,
+	).Scan(&threadID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up forum thread: %w", err)
+	}
+	return threadID, nil
+}
+
+// Save records the forum thread opened for threadName, replacing a previous
+// one.
+func (r *ForumThreadRepository) Save(webhookID, threadName, threadID string) error {
+	_, err := r.db.Exec(
+		`INSERT INTO discord_forum_threads (webhook_id, thread_name, thread_id, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (webhook_id, thread_name) DO UPDATE SET thread_id = excluded.thread_id, created_at = excluded.created_at`,
+		webhookID, threadName, threadID, time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save forum thread: %w", err)
+	}
+	return nil
+}
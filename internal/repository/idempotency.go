@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// IdempotencyKeyTTL is how long a received Idempotency-Key is remembered.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+type IdempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+// Get returns the response status stored for key if it was received after since.
+func (r *IdempotencyRepository) Get(key string, since time.Time) (int, bool, error) {
+	var status int
+	err := r.db.QueryRow(
+		`SELECT response_status FROM idempotency_keys WHERE key = ? AND received_at > ?`,
+		key, since.UTC(),
+	).Scan(&status)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to look up idempotency key: %w", err)
+	}
+	return status, true, nil
+}
+
+func (r *IdempotencyRepository) Save(key string, status int) error {
+	_, err := r.db.Exec(
+		`INSERT OR REPLACE INTO idempotency_keys (key, received_at, response_status) VALUES (?, ?, ?)`,
+		key, time.Now().UTC(), status,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save idempotency key: %w", err)
+	}
+	return nil
+}
+
+// PruneBefore deletes keys received before the given time.
+func (r *IdempotencyRepository) PruneBefore(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM idempotency_keys WHERE received_at < ?`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune idempotency keys: %w", err)
+	}
+	return result.RowsAffected()
+}
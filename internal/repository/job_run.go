@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type JobRunRepository struct {
+	db *sql.DB
+}
+
+func NewJobRunRepository(db *sql.DB) *JobRunRepository {
+	return &JobRunRepository{db: db}
+}
+
+// LastRun returns when the named job last completed, or the zero time when it
+// never did.
+func (r *JobRunRepository) LastRun(name string) (time.Time, error) {
+	var lastRun time.Time
+	err := r.db.QueryRow(`SELECT last_run_at FROM job_runs WHERE name = ?`, name).Scan(&lastRun)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to look up last %s run: %w", name, err)
+	}
+	return lastRun, nil
+}
+
+// SaveRun records that the named job completed at the given time.
+func (r *JobRunRepository) SaveRun(name string, at time.Time) error {
+	_, err := r.db.Exec(
+		`INSERT INTO job_runs (name, last_run_at) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET last_run_at = excluded.last_run_at`,
+		name, at.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save %s run: %w", name, err)
+	}
+	return nil
+}
@@ -1,10 +1,17 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"lewdarchive/internal/model"
+
+	"github.com/mattn/go-sqlite3"
 )
 
 type PostRepository struct {
@@ -21,13 +28,19 @@ func (r *PostRepository) ExistsByHash(hash string) (bool, error) {
 	return exists, err
 }
 
+func (r *PostRepository) ExistsByURL(url string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow("SELECT EXISTS(SELECT 1 FROM posts WHERE url = ?)", url).Scan(&exists)
+	return exists, err
+}
+
 func (r *PostRepository) Create(post *model.Post) error {
 	query := `
-		INSERT INTO posts (site_url, entry_id, hash, title, url, published_at, content, author, category_id, category_title)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO posts (site_url, entry_id, hash, title, url, published_at, content, author, category_id, category_title, feed_id, source)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	
-	_, err := r.db.Exec(query,
+	result, err := r.db.Exec(query,
 		post.SiteURL,
 		post.EntryID,
 		post.Hash,
@@ -38,23 +51,40 @@ func (r *PostRepository) Create(post *model.Post) error {
 		post.Author,
 		post.CategoryID,
 		post.CategoryTitle,
+		sql.NullInt64{Int64: int64(post.FeedID), Valid: post.FeedID != 0},
+		sql.NullString{String: post.Source, Valid: post.Source != ""},
 	)
 	
 	if err != nil {
 		return fmt.Errorf("failed to create post: %w", err)
 	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to read post id: %w", err)
+	}
+	post.ID = int(id)
+	post.DownloadStatus = model.DownloadStatusPending
 	
 	return nil
 }
 
-func (r *PostRepository) GetByHash(hash string) (*model.Post, error) {
-	query := `
-		SELECT id, site_url, entry_id, hash, title, url, published_at, content, author, category_id, category_title
-		FROM posts WHERE hash = ?
-	`
-	
+// postColumns are the columns read by scanPost, in order.
+const postColumns = `id, site_url, entry_id, hash, title, url, published_at, content, author, category_id, category_title,
+	discord_message_id, discord_webhook_url, download_status, download_attempts, download_size_bytes, feed_id, source, created_at, updated_at,
+	download_completed_at, upload_completed_at`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPost(row rowScanner) (*model.Post, error) {
 	post := &model.Post{}
-	err := r.db.QueryRow(query, hash).Scan(
+	var discordMessageID, discordWebhookURL, source sql.NullString
+	var downloadSize, feedID sql.NullInt64
+	var downloadCompletedAt, uploadCompletedAt sql.NullTime
+	err := row.Scan(
 		&post.ID,
 		&post.SiteURL,
 		&post.EntryID,
@@ -66,11 +96,784 @@ func (r *PostRepository) GetByHash(hash string) (*model.Post, error) {
 		&post.Author,
 		&post.CategoryID,
 		&post.CategoryTitle,
+		&discordMessageID,
+		&discordWebhookURL,
+		&post.DownloadStatus,
+		&post.DownloadAttempts,
+		&downloadSize,
+		&feedID,
+		&source,
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		&downloadCompletedAt,
+		&uploadCompletedAt,
 	)
-	
 	if err != nil {
 		return nil, err
 	}
-	
+	post.DiscordMessageID = discordMessageID.String
+	post.DiscordWebhookURL = discordWebhookURL.String
+	post.Source = source.String
+	post.DownloadSizeBytes = downloadSize.Int64
+	post.FeedID = int(feedID.Int64)
+	if downloadCompletedAt.Valid {
+		post.DownloadCompletedAt = &downloadCompletedAt.Time
+	}
+	if uploadCompletedAt.Valid {
+		post.UploadCompletedAt = &uploadCompletedAt.Time
+	}
+
 	return post, nil
-}
\ No newline at end of file
+}
+
+func (r *PostRepository) GetByHash(hash string) (*model.Post, error) {
+	return scanPost(r.db.QueryRow("SELECT "+postColumns+" FROM posts WHERE hash = ?", hash))
+}
+
+func (r *PostRepository) GetByID(id int) (*model.Post, error) {
+	return scanPost(r.db.QueryRow("SELECT "+postColumns+" FROM posts WHERE id = ?", id))
+}
+
+// FindByURL returns the oldest post archived from url, or sql.ErrNoRows.
+func (r *PostRepository) FindByURL(ctx context.Context, url string) (*model.Post, error) {
+	return scanPost(r.db.QueryRowContext(ctx, "SELECT "+postColumns+" FROM posts WHERE url = ? ORDER BY id LIMIT 1", url))
+}
+
+// PostFilter narrows List and Count. Zero values match everything; Limit <= 0
+// means no limit. Since bounds the archive time, From and To the publication
+// time, and Query matches a substring of the title. AfterID skips posts up to
+// that ID, for walking the table with ListAfter.
+type PostFilter struct {
+	Author   string
+	Category string
+	Tag      string
+	Site     string
+	Status   model.DownloadStatus
+	Query    string
+	Since    time.Time
+	From     time.Time
+	To       time.Time
+	AfterID  int
+	Limit    int
+	Offset   int
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// from returns the FROM and WHERE clauses selecting the filtered posts, along
+// with their arguments.
+func (f PostFilter) from() (string, []interface{}) {
+	clause := " FROM posts"
+	var conditions []string
+	var args []interface{}
+	if f.Tag != "" {
+		clause += " JOIN post_tags ON post_tags.post_id = posts.id AND post_tags.tag = ?"
+		args = append(args, strings.ToLower(strings.TrimPrefix(f.Tag, "#")))
+	}
+	if f.Author != "" {
+		conditions = append(conditions, "author = ?")
+		args = append(args, f.Author)
+	}
+	if f.Category != "" {
+		conditions = append(conditions, "category_title = ?")
+		args = append(args, f.Category)
+	}
+	if f.Site != "" {
+		conditions = append(conditions, "site_url = ?")
+		args = append(args, f.Site)
+	}
+	if f.Status != "" {
+		conditions = append(conditions, "download_status = ?")
+		args = append(args, f.Status.String())
+	}
+	if f.Query != "" {
+		conditions = append(conditions, `title LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(f.Query)+"%")
+	}
+	if !f.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, f.Since.UTC().Format("2006-01-02 15:04:05"))
+	}
+	// published_at keeps the feed's UTC offset, so it is normalized before
+	// comparing.
+	if !f.From.IsZero() {
+		conditions = append(conditions, "datetime(published_at) >= ?")
+		args = append(args, f.From.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if !f.To.IsZero() {
+		conditions = append(conditions, "datetime(published_at) < ?")
+		args = append(args, f.To.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if f.AfterID > 0 {
+		conditions = append(conditions, "posts.id > ?")
+		args = append(args, f.AfterID)
+	}
+
+	if len(conditions) > 0 {
+		clause += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return clause, args
+}
+
+// Count returns the number of posts matching the filter, ignoring its Limit
+// and Offset.
+func (r *PostRepository) Count(filter PostFilter) (int, error) {
+	from, args := filter.from()
+	var count int
+	if err := r.db.QueryRow("SELECT COUNT(*)"+from, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count posts: %w", err)
+	}
+	return count, nil
+}
+
+// List returns posts matching the filter, most recently archived first.
+func (r *PostRepository) List(filter PostFilter) ([]model.Post, error) {
+	from, args := filter.from()
+	query := "SELECT " + postColumns + from + " ORDER BY created_at DESC, id DESC"
+	if filter.Limit > 0 || filter.Offset > 0 {
+		limit := filter.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, filter.Offset)
+	}
+
+	return r.list(query, args)
+}
+
+// ListAfter returns up to filter.Limit posts matching the filter in ID order,
+// ignoring Offset. Passing the last ID back as AfterID fetches the next batch,
+// so that large exports never hold a read open for long.
+func (r *PostRepository) ListAfter(filter PostFilter) ([]model.Post, error) {
+	from, args := filter.from()
+	query := "SELECT " + postColumns + from + " ORDER BY posts.id ASC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+	return r.list(query, args)
+}
+
+func (r *PostRepository) list(query string, args []interface{}) ([]model.Post, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list posts: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []model.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan post: %w", err)
+		}
+		posts = append(posts, *post)
+	}
+	return posts, rows.Err()
+}
+
+// SetTags replaces the tags of a post.
+func (r *PostRepository) SetTags(postID int, tags []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM post_tags WHERE post_id = ?", postID); err != nil {
+		return fmt.Errorf("failed to clear tags: %w", err)
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO post_tags (post_id, tag) VALUES (?, ?)", postID, tag); err != nil {
+			return fmt.Errorf("failed to add tag %q: %w", tag, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTags returns the tags of a post in alphabetical order.
+func (r *PostRepository) GetTags(postID int) ([]string, error) {
+	tags, err := r.ListTagsByPostIDs([]int{postID})
+	if err != nil {
+		return nil, err
+	}
+	return tags[postID], nil
+}
+
+// ListTagsByPostIDs returns the tags of the given posts keyed by post ID.
+func (r *PostRepository) ListTagsByPostIDs(postIDs []int) (map[int][]string, error) {
+	tags := make(map[int][]string)
+	if len(postIDs) == 0 {
+		return tags, nil
+	}
+
+	placeholders := make([]string, len(postIDs))
+	args := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	rows, err := r.db.Query(fmt.Sprintf(
+		"SELECT post_id, tag FROM post_tags WHERE post_id IN (%s) ORDER BY tag",
+		strings.Join(placeholders, ", "),
+	), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int
+		var tag string
+		if err := rows.Scan(&postID, &tag); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags[postID] = append(tags[postID], tag)
+	}
+	return tags, rows.Err()
+}
+
+var updatablePostColumns = map[string]bool{
+	"title":          true,
+	"content":        true,
+	"url":            true,
+	"author":         true,
+	"published_at":   true,
+	"category_id":    true,
+	"category_title": true,
+	"site_url":       true,
+}
+
+// Update applies a partial update to the post identified by hash. Only known
+// columns are accepted so callers can't inject arbitrary SQL through keys.
+func (r *PostRepository) Update(hash string, updates map[string]interface{}) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	columns := make([]string, 0, len(updates))
+	for column := range updates {
+		if !updatablePostColumns[column] {
+			return fmt.Errorf("cannot update unknown column %q", column)
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	setClauses := make([]string, 0, len(columns)+1)
+	args := make([]interface{}, 0, len(columns)+1)
+	for _, column := range columns {
+		setClauses = append(setClauses, column+" = ?")
+		args = append(args, updates[column])
+	}
+	setClauses = append(setClauses, "updated_at = CURRENT_TIMESTAMP")
+	args = append(args, hash)
+
+	query := fmt.Sprintf("UPDATE posts SET %s WHERE hash = ?", strings.Join(setClauses, ", "))
+
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update post: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update post: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// patchableMetadata are the columns PatchMetadata may change.
+var patchableMetadata = map[string]bool{
+	"title":          true,
+	"author":         true,
+	"category_title": true,
+}
+
+// PatchMetadata corrects the title, author or category title of a post, e.g.
+// after Miniflux delivered them garbled. It returns sql.ErrNoRows when no post
+// has the hash.
+func (r *PostRepository) PatchMetadata(hash string, fields map[string]string) error {
+	updates := make(map[string]interface{}, len(fields))
+	for column, value := range fields {
+		if !patchableMetadata[column] {
+			return fmt.Errorf("cannot patch column %q", column)
+		}
+		updates[column] = value
+	}
+	return r.Update(hash, updates)
+}
+
+// SetDiscordMessage remembers which Discord message announced the post so it
+// can be edited later.
+func (r *PostRepository) SetDiscordMessage(hash, webhookURL, messageID string) error {
+	_, err := r.db.Exec(
+		"UPDATE posts SET discord_message_id = ?, discord_webhook_url = ? WHERE hash = ?",
+		messageID, webhookURL, hash,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store discord message: %w", err)
+	}
+	return nil
+}
+
+// UpdateDownloadStatus records a download state transition. Moving to
+// DownloadStatusRunning counts as a new attempt.
+func (r *PostRepository) UpdateDownloadStatus(postID int, status model.DownloadStatus) error {
+	if !status.IsValid() {
+		return fmt.Errorf("invalid download status %q", status)
+	}
+
+	query := `
+		UPDATE posts
+		SET download_status = ?,
+			download_attempts = download_attempts + CASE WHEN ? THEN 1 ELSE 0 END,
+			download_status_updated_at = ?,
+			download_completed_at = CASE WHEN ? THEN ? ELSE download_completed_at END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+
+	now := time.Now().UTC()
+	running := status == model.DownloadStatusRunning
+	completed := status == model.DownloadStatusCompleted
+	if _, err := r.db.Exec(query, status.String(), running, now, completed, now, postID); err != nil {
+		return fmt.Errorf("failed to update download status: %w", err)
+	}
+	return nil
+}
+
+// UpdateDownloadSize records the disk space a finished download takes.
+func (r *PostRepository) UpdateDownloadSize(postID int, bytes int64) error {
+	if _, err := r.db.Exec("UPDATE posts SET download_size_bytes = ? WHERE id = ?", bytes, postID); err != nil {
+		return fmt.Errorf("failed to update download size: %w", err)
+	}
+	return nil
+}
+
+// Stats returns the post count, the total size of all downloads, how many
+// posts were uploaded and how long downloads and uploads take on average.
+func (r *PostRepository) Stats() (*model.ArchiveStats, error) {
+	stats := &model.ArchiveStats{}
+	err := r.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(download_size_bytes), 0), COUNT(upload_completed_at),
+			COALESCE(AVG((julianday(download_completed_at) - julianday(created_at)) * 86400), 0),
+			COALESCE(AVG((julianday(upload_completed_at) - julianday(download_completed_at)) * 86400), 0)
+		FROM posts
+	`).Scan(&stats.TotalPosts, &stats.TotalArchiveBytes, &stats.TotalUploaded, &stats.AvgDownloadSeconds, &stats.AvgUploadSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stats: %w", err)
+	}
+	return stats, nil
+}
+
+// CountByDay counts the posts archived on each day since the given time, or
+// ever when since is zero.
+func (r *PostRepository) CountByDay(since time.Time) ([]model.DailyCount, error) {
+	rows, err := r.db.Query(`
+		SELECT date(created_at) AS day, COUNT(*)
+		FROM posts
+		WHERE created_at >= ?
+		GROUP BY day
+		ORDER BY day`, sinceParam(since))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count posts by day: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []model.DailyCount{}
+	for rows.Next() {
+		var day model.DailyCount
+		if err := rows.Scan(&day.Date, &day.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan daily count: %w", err)
+		}
+		counts = append(counts, day)
+	}
+	return counts, rows.Err()
+}
+
+// countByColumns lists the columns CountBy may group on.
+var countByColumns = map[string]bool{"author": true, "category_title": true}
+
+// CountBy counts the posts archived since the given time, or ever when since
+// is zero, per value of column ("author" or "category_title"), largest first.
+// Limit <= 0 means no limit.
+func (r *PostRepository) CountBy(column string, since time.Time, limit int) ([]model.NamedCount, error) {
+	if !countByColumns[column] {
+		return nil, fmt.Errorf("cannot count posts by %q", column)
+	}
+	query := `
+		SELECT COALESCE(` + column + `, '') AS name, COUNT(*) AS count
+		FROM posts
+		WHERE created_at >= ?
+		GROUP BY name
+		ORDER BY count DESC, name`
+	args := []interface{}{sinceParam(since)}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count posts by %s: %w", column, err)
+	}
+	defer rows.Close()
+
+	counts := []model.NamedCount{}
+	for rows.Next() {
+		var count model.NamedCount
+		if err := rows.Scan(&count.Name, &count.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan count by %s: %w", column, err)
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// CountByStatus counts all posts per download status.
+func (r *PostRepository) CountByStatus() (map[model.DownloadStatus]int, error) {
+	rows, err := r.db.Query("SELECT download_status, COUNT(*) FROM posts GROUP BY download_status")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count posts by status: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[model.DownloadStatus]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan status count: %w", err)
+		}
+		counts[model.DownloadStatus(status)] = count
+	}
+	return counts, rows.Err()
+}
+
+// sinceParam formats a lower bound on created_at; the zero time matches
+// every post.
+func sinceParam(since time.Time) string {
+	if since.IsZero() {
+		return ""
+	}
+	return since.UTC().Format("2006-01-02 15:04:05")
+}
+
+// DownloadStatsByDay counts the downloads that finished on each day since the
+// given date, or ever when since is zero, and the uploads. Completed downloads
+// are dated by download_completed_at, failed ones by their last status change
+// and uploads by upload_completed_at.
+func (r *PostRepository) DownloadStatsByDay(since time.Time) ([]model.DailyDownloadStats, error) {
+	query := `
+		SELECT day, SUM(completed) + SUM(failed), SUM(completed), SUM(failed), SUM(uploaded)
+		FROM (
+			SELECT date(download_completed_at) AS day, 1 AS completed, 0 AS failed, 0 AS uploaded
+			FROM posts
+			WHERE download_status = 'completed' AND download_completed_at IS NOT NULL
+			UNION ALL
+			SELECT date(download_status_updated_at), 0, 1, 0
+			FROM posts
+			WHERE download_status = 'failed' AND download_status_updated_at IS NOT NULL
+			UNION ALL
+			SELECT date(upload_completed_at), 0, 0, 1
+			FROM posts
+			WHERE upload_completed_at IS NOT NULL
+		)
+		WHERE day >= ?
+		GROUP BY day
+		ORDER BY day
+	`
+
+	var sinceDay string
+	if !since.IsZero() {
+		sinceDay = since.UTC().Format(time.DateOnly)
+	}
+
+	rows, err := r.db.Query(query, sinceDay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load download stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []model.DailyDownloadStats
+	for rows.Next() {
+		var day model.DailyDownloadStats
+		if err := rows.Scan(&day.Date, &day.Total, &day.Completed, &day.Failed, &day.Uploaded); err != nil {
+			return nil, fmt.Errorf("failed to scan download stats: %w", err)
+		}
+		stats = append(stats, day)
+	}
+	return stats, rows.Err()
+}
+
+// ListAuthors sort orders.
+const (
+	AuthorSortPostCount  = "post_count"
+	AuthorSortName       = "name"
+	AuthorSortLatestPost = "latest_post"
+)
+
+var authorSortClauses = map[string]string{
+	AuthorSortPostCount:  "post_count DESC, author",
+	AuthorSortName:       "author COLLATE NOCASE, author",
+	AuthorSortLatestPost: "latest_post DESC, author",
+}
+
+// AuthorFilter pages ListAuthors. An empty Sort orders by post count.
+type AuthorFilter struct {
+	Sort   string
+	Limit  int
+	Offset int
+}
+
+// ListAuthors summarizes the posts of every author along with the distinct
+// categories they posted in.
+func (r *PostRepository) ListAuthors(filter AuthorFilter) ([]model.AuthorSummary, error) {
+	orderBy, ok := authorSortClauses[filter.Sort]
+	if !ok && filter.Sort != "" {
+		return nil, fmt.Errorf("unknown author sort %q", filter.Sort)
+	}
+	if !ok {
+		orderBy = authorSortClauses[AuthorSortPostCount]
+	}
+
+	query := `
+		SELECT author, COUNT(*) AS post_count, MAX(published_at) AS latest_post,
+			(SELECT json_group_array(DISTINCT c.category_title) FROM posts c
+			 WHERE COALESCE(c.author, '') = a.author AND COALESCE(c.category_title, '') != '')
+		FROM (SELECT COALESCE(author, '') AS author, published_at FROM posts) a
+		GROUP BY author
+		ORDER BY ` + orderBy
+	var args []interface{}
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list authors: %w", err)
+	}
+	defer rows.Close()
+
+	authors := []model.AuthorSummary{}
+	for rows.Next() {
+		var summary model.AuthorSummary
+		var latestPost, categories string
+		if err := rows.Scan(&summary.Author, &summary.PostCount, &latestPost, &categories); err != nil {
+			return nil, fmt.Errorf("failed to scan author: %w", err)
+		}
+		if summary.LatestPost, err = parseSQLiteTime(latestPost); err != nil {
+			return nil, fmt.Errorf("failed to parse latest post of %q: %w", summary.Author, err)
+		}
+		if err := json.Unmarshal([]byte(categories), &summary.Categories); err != nil {
+			return nil, fmt.Errorf("failed to decode categories of %q: %w", summary.Author, err)
+		}
+		authors = append(authors, summary)
+	}
+	return authors, rows.Err()
+}
+
+// GetFeedStats aggregates the posts of a feed. A feed without posts gets zero
+// counts.
+func (r *PostRepository) GetFeedStats(ctx context.Context, feedID int) (*model.FeedStats, error) {
+	stats := &model.FeedStats{FeedID: feedID}
+	var latestPost, oldestPost sql.NullString
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*),
+			COUNT(CASE WHEN download_status = 'completed' THEN 1 END),
+			COUNT(CASE WHEN download_status IN ('failed', 'final_failed') THEN 1 END),
+			COUNT(CASE WHEN download_status IN ('pending', 'running') THEN 1 END),
+			COALESCE(SUM(download_size_bytes), 0),
+			MAX(published_at),
+			MIN(published_at)
+		FROM posts
+		WHERE feed_id = ?
+	`, feedID).Scan(
+		&stats.TotalPosts, &stats.DownloadedPosts, &stats.FailedPosts, &stats.PendingPosts,
+		&stats.TotalSizeBytes, &latestPost, &oldestPost,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load feed stats: %w", err)
+	}
+
+	if latestPost.Valid {
+		t, err := parseSQLiteTime(latestPost.String)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse latest post of feed %d: %w", feedID, err)
+		}
+		stats.LatestPost = &t
+	}
+	if oldestPost.Valid {
+		t, err := parseSQLiteTime(oldestPost.String)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse oldest post of feed %d: %w", feedID, err)
+		}
+		stats.OldestPost = &t
+	}
+	return stats, nil
+}
+
+// parseSQLiteTime parses a timestamp that SQLite returned as text, e.g. from
+// an aggregate, where the driver can't convert it to a time.Time itself.
+func parseSQLiteTime(value string) (time.Time, error) {
+	value = strings.TrimSuffix(value, "Z")
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", value)
+}
+
+// ResetStuckDownloads moves posts that have been running since before the
+// given time back to pending and returns them, so that they can be queued
+// again.
+func (r *PostRepository) ResetStuckDownloads(before time.Time) ([]model.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		"SELECT "+postColumns+" FROM posts WHERE download_status = ? AND download_status_updated_at < ? ORDER BY id",
+		model.DownloadStatusRunning.String(), before.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stuck downloads: %w", err)
+	}
+	var posts []model.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan post: %w", err)
+		}
+		posts = append(posts, *post)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list stuck downloads: %w", err)
+	}
+
+	now := time.Now().UTC()
+	for i := range posts {
+		if _, err := tx.Exec(
+			`UPDATE posts SET download_status = ?, download_status_updated_at = ? WHERE id = ?`,
+			model.DownloadStatusPending.String(), now, posts[i].ID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to reset stuck download of post %d: %w", posts[i].ID, err)
+		}
+		posts[i].DownloadStatus = model.DownloadStatusPending
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit: %w", err)
+	}
+	return posts, nil
+}
+
+// FinalizeFailedDownloads marks failed posts that used up their retries as
+// DownloadStatusFinalFailed so they are no longer retried.
+func (r *PostRepository) FinalizeFailedDownloads(maxRetries int) (int64, error) {
+	result, err := r.db.Exec(`
+		UPDATE posts
+		SET download_status = ?, download_status_updated_at = ?
+		WHERE download_status = ? AND download_attempts > ?
+	`, model.DownloadStatusFinalFailed.String(), time.Now().UTC(), model.DownloadStatusFailed.String(), maxRetries)
+	if err != nil {
+		return 0, fmt.Errorf("failed to finalize failed downloads: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// ListFailedSince returns posts whose download or upload failed after the
+// given time, most recent first.
+func (r *PostRepository) ListFailedSince(since time.Time) ([]model.Post, error) {
+	rows, err := r.db.Query(`
+		SELECT id, hash, title, url, author, category_title, download_status, download_attempts
+		FROM posts
+		WHERE download_status IN (?, ?) AND download_status_updated_at > ?
+		ORDER BY download_status_updated_at DESC
+	`, model.DownloadStatusFailed.String(), model.DownloadStatusFinalFailed.String(), since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list failed posts: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []model.Post
+	for rows.Next() {
+		var post model.Post
+		if err := rows.Scan(
+			&post.ID,
+			&post.Hash,
+			&post.Title,
+			&post.URL,
+			&post.Author,
+			&post.CategoryTitle,
+			&post.DownloadStatus,
+			&post.DownloadAttempts,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan failed post: %w", err)
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// postTables lists the tables holding rows of a post, children first. Foreign
+// keys are not enforced, so Delete removes the children itself.
+var postTables = []struct{ name, column string }{
+	{"download_log", "post_id"},
+	{"chibisafe_retry_queue", "post_id"},
+	{"uploads", "post_id"},
+	{"post_files", "post_id"},
+	{"post_tags", "post_id"},
+	{"posts", "id"},
+}
+
+// CountRows returns how many rows of each table belong to a post, i.e. what
+// Delete would remove.
+func (r *PostRepository) CountRows(postID int) (map[string]int64, error) {
+	counts := make(map[string]int64, len(postTables))
+	for _, table := range postTables {
+		var n int64
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = ?", table.name, table.column)
+		if err := r.db.QueryRow(query, postID).Scan(&n); err != nil {
+			return nil, fmt.Errorf("failed to count %s rows: %w", table.name, err)
+		}
+		counts[table.name] = n
+	}
+	return counts, nil
+}
+
+// Delete removes a post along with its tags, files, uploads, retries and
+// download log, returning the number of rows removed from each table.
+func (r *PostRepository) Delete(postID int) (map[string]int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	counts := make(map[string]int64, len(postTables))
+	for _, table := range postTables {
+		query := fmt.Sprintf("DELETE FROM %s WHERE %s = ?", table.name, table.column)
+		result, err := tx.Exec(query, postID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete %s rows: %w", table.name, err)
+		}
+		counts[table.name], _ = result.RowsAffected()
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit post deletion: %w", err)
+	}
+	return counts, nil
+}
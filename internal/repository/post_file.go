@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"lewdarchive/internal/model"
+)
+
+type PostFileRepository struct {
+	db *sql.DB
+}
+
+func NewPostFileRepository(db *sql.DB) *PostFileRepository {
+	return &PostFileRepository{db: db}
+}
+
+// ReplaceForPost records the files found in a post's archive directory after a
+// download, replacing those of the previous download.
+func (r *PostFileRepository) ReplaceForPost(postID int, files []model.PostFile) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM post_files WHERE post_id = ?", postID); err != nil {
+		return fmt.Errorf("failed to clear post files: %w", err)
+	}
+	for _, file := range files {
+		_, err := tx.Exec(
+			`INSERT INTO post_files (post_id, path, name, size_bytes, sha256) VALUES (?, ?, ?, ?, ?)`,
+			postID, file.Path, file.Name, file.SizeBytes, file.SHA256,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record post file %s: %w", file.Path, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ListByPostID returns the archived files of a post with the Chibisafe upload
+// of each, followed by the uploads not matching an archived file, such as
+// thumbnails and uploads from before files were recorded.
+func (r *PostFileRepository) ListByPostID(postID int) ([]model.PostFile, error) {
+	files, err := r.ListByPostIDs([]int{postID})
+	if err != nil {
+		return nil, err
+	}
+	return files[postID], nil
+}
+
+// ListByPostIDs is ListByPostID for several posts, keyed by post ID.
+func (r *PostFileRepository) ListByPostIDs(postIDs []int) (map[int][]model.PostFile, error) {
+	files := make(map[int][]model.PostFile)
+	if len(postIDs) == 0 {
+		return files, nil
+	}
+
+	placeholders := make([]string, len(postIDs))
+	args := make([]interface{}, 0, 2*len(postIDs))
+	for i, id := range postIDs {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+	args = append(args, args...)
+	in := strings.Join(placeholders, ", ")
+
+	query := fmt.Sprintf(`
+		SELECT post_id, path, name, size_bytes, sha256, uuid, url FROM (
+			SELECT f.post_id, f.path, f.name, f.size_bytes, f.sha256, COALESCE(u.uuid, '') AS uuid, COALESCE(u.url, '') AS url, 0 AS upload_only
+			FROM post_files f
+			LEFT JOIN uploads u ON u.id = (
+				SELECT MAX(id) FROM uploads WHERE post_id = f.post_id AND local_name = f.name
+			)
+			WHERE f.post_id IN (%s)
+			UNION ALL
+			SELECT u.post_id, '', u.name, 0, '', u.uuid, COALESCE(u.url, ''), 1
+			FROM uploads u
+			WHERE u.post_id IN (%s) AND NOT EXISTS (
+				SELECT 1 FROM post_files f WHERE f.post_id = u.post_id AND f.name = u.local_name
+			)
+		)
+		ORDER BY post_id, upload_only, path, name
+	`, in, in)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list post files: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int
+		var file model.PostFile
+		if err := rows.Scan(&postID, &file.Path, &file.Name, &file.SizeBytes, &file.SHA256, &file.ChibisafeUUID, &file.ChibisafeURL); err != nil {
+			return nil, fmt.Errorf("failed to scan post file: %w", err)
+		}
+		files[postID] = append(files[postID], file)
+	}
+	return files, rows.Err()
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/pkg/database"
+)
+
+func newTestDB(t testing.TB) *sql.DB {
+	t.Helper()
+	db, err := database.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestPostRepositoryUpdate(t *testing.T) {
+	repo := NewPostRepository(newTestDB(t))
+	post := &model.Post{Hash: "hash", URL: "https://example.com/post", Title: "Old", Author: "Alice"}
+	if err := repo.Create(post); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := repo.Update("hash", map[string]interface{}{"title": "New", "url": "https://example.com/moved"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	got, err := repo.GetByHash("hash")
+	if err != nil {
+		t.Fatalf("GetByHash: %v", err)
+	}
+	if got.Title != "New" || got.URL != "https://example.com/moved" || got.Author != "Alice" {
+		t.Errorf("post = %q %q %q, want only title and url changed", got.Title, got.URL, got.Author)
+	}
+
+	if err := repo.Update("hash", nil); err != nil {
+		t.Errorf("Update with no changes: %v", err)
+	}
+	if err := repo.Update("missing", map[string]interface{}{"title": "x"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Update of a missing post = %v, want sql.ErrNoRows", err)
+	}
+	if err := repo.Update("hash", map[string]interface{}{"title = 'x', hash": "y"}); err == nil {
+		t.Error("Update of an unknown column: got nil error")
+	}
+}
+
+// seedPosts inserts n posts spread over 20 authors, 5 categories and the
+// last n minutes.
+func seedPosts(b *testing.B, db *sql.DB, n int) {
+	b.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	stmt, err := tx.Prepare(`INSERT INTO posts (site_url, entry_id, hash, title, url, published_at, content, author, category_id, category_title, created_at, download_status)
+		VALUES (?, ?, ?, ?, ?, ?, '', ?, 0, ?, ?, 'completed')`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	now := time.Now().UTC()
+	for i := 0; i < n; i++ {
+		created := now.Add(-time.Duration(n-i) * time.Minute).Format("2006-01-02 15:04:05")
+		_, err := stmt.Exec("https://example.com", i, fmt.Sprint("hash", i), fmt.Sprint("Post ", i), fmt.Sprint("https://example.com/", i),
+			created, fmt.Sprint("author", i%20), fmt.Sprint("category", i%5), created)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	stmt.Close()
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkPostListFiltered(b *testing.B) {
+	db := newTestDB(b)
+	seedPosts(b, db, 10000)
+	repo := NewPostRepository(db)
+
+	filters := []struct {
+		name   string
+		filter PostFilter
+	}{
+		{"category", PostFilter{Category: "category3"}},
+		{"author", PostFilter{Author: "author7"}},
+		{"author and category", PostFilter{Author: "author7", Category: "category2"}},
+		{"since", PostFilter{Since: time.Now().Add(-time.Hour)}},
+	}
+	for _, tt := range filters {
+		b.Run("count "+tt.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.Count(tt.filter); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run("list "+tt.name, func(b *testing.B) {
+			filter := tt.filter
+			filter.Limit = 50
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.List(filter); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
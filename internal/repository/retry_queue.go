@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"lewdarchive/internal/model"
+)
+
+type RetryQueueRepository struct {
+	db *sql.DB
+}
+
+func NewRetryQueueRepository(db *sql.DB) *RetryQueueRepository {
+	return &RetryQueueRepository{db: db}
+}
+
+func (r *RetryQueueRepository) Enqueue(item *model.ChibisafeRetry) error {
+	query := `
+		INSERT INTO chibisafe_retry_queue (post_id, local_file_path, filename, album_uuid, tag_uuid, attempts, next_attempt_at, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := r.db.Exec(query,
+		item.PostID,
+		item.LocalFilePath,
+		item.Filename,
+		item.AlbumUUID,
+		strings.Join(item.TagUUIDs, ","),
+		item.Attempts,
+		item.NextAttemptAt.UTC(),
+		item.Error,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue upload retry: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to read retry queue id: %w", err)
+	}
+	item.ID = int(id)
+
+	return nil
+}
+
+const retryColumns = "id, post_id, local_file_path, filename, album_uuid, tag_uuid, attempts, next_attempt_at, error"
+
+// ListDue returns queued uploads whose next attempt is due and which have not
+// used up maxAttempts, oldest first.
+func (r *RetryQueueRepository) ListDue(now time.Time, maxAttempts int) ([]model.ChibisafeRetry, error) {
+	query := `
+		SELECT ` + retryColumns + `
+		FROM chibisafe_retry_queue
+		WHERE next_attempt_at <= ? AND attempts < ?
+		ORDER BY next_attempt_at ASC, id ASC
+	`
+
+	rows, err := r.db.Query(query, now.UTC(), maxAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due upload retries: %w", err)
+	}
+	return scanRetries(rows)
+}
+
+// List returns every queued upload, including those that used up their
+// attempts, oldest first.
+func (r *RetryQueueRepository) List() ([]model.ChibisafeRetry, error) {
+	rows, err := r.db.Query(`SELECT ` + retryColumns + ` FROM chibisafe_retry_queue ORDER BY id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list upload retries: %w", err)
+	}
+	return scanRetries(rows)
+}
+
+// GetByID returns a queued upload, or sql.ErrNoRows.
+func (r *RetryQueueRepository) GetByID(id int) (*model.ChibisafeRetry, error) {
+	rows, err := r.db.Query(`SELECT `+retryColumns+` FROM chibisafe_retry_queue WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload retry: %w", err)
+	}
+	items, err := scanRetries(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &items[0], nil
+}
+
+// Requeue gives a queued upload a fresh set of attempts starting at
+// nextAttemptAt.
+func (r *RetryQueueRepository) Requeue(id int, nextAttemptAt time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE chibisafe_retry_queue SET attempts = 0, next_attempt_at = ? WHERE id = ?
+	`, nextAttemptAt.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to requeue upload retry: %w", err)
+	}
+	return nil
+}
+
+func scanRetries(rows *sql.Rows) ([]model.ChibisafeRetry, error) {
+	defer rows.Close()
+
+	var items []model.ChibisafeRetry
+	for rows.Next() {
+		var item model.ChibisafeRetry
+		var tags, errMsg sql.NullString
+		if err := rows.Scan(
+			&item.ID,
+			&item.PostID,
+			&item.LocalFilePath,
+			&item.Filename,
+			&item.AlbumUUID,
+			&tags,
+			&item.Attempts,
+			&item.NextAttemptAt,
+			&errMsg,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan upload retry: %w", err)
+		}
+		if tags.String != "" {
+			item.TagUUIDs = strings.Split(tags.String, ",")
+		}
+		item.Error = errMsg.String
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// Count returns how many uploads are queued for a retry.
+func (r *RetryQueueRepository) Count() (int, error) {
+	var count int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM chibisafe_retry_queue`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count upload retries: %w", err)
+	}
+	return count, nil
+}
+
+// CountPendingByPostID returns how many uploads of a post are queued and have
+// attempts left out of maxAttempts.
+func (r *RetryQueueRepository) CountPendingByPostID(postID, maxAttempts int) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM chibisafe_retry_queue WHERE post_id = ? AND attempts < ?`, postID, maxAttempts).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count pending upload retries: %w", err)
+	}
+	return count, nil
+}
+
+// CountByPostID returns how many uploads of a post are still queued.
+func (r *RetryQueueRepository) CountByPostID(postID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM chibisafe_retry_queue WHERE post_id = ?`, postID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count upload retries: %w", err)
+	}
+	return count, nil
+}
+
+func (r *RetryQueueRepository) Delete(id int) error {
+	if _, err := r.db.Exec(`DELETE FROM chibisafe_retry_queue WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete upload retry: %w", err)
+	}
+	return nil
+}
+
+// RecordFailure bumps the attempt counter of a queued upload and pushes its
+// next attempt back to nextAttemptAt.
+func (r *RetryQueueRepository) RecordFailure(id int, nextAttemptAt time.Time, errMsg string) error {
+	_, err := r.db.Exec(`
+		UPDATE chibisafe_retry_queue
+		SET attempts = attempts + 1, next_attempt_at = ?, error = ?
+		WHERE id = ?
+	`, nextAttemptAt.UTC(), errMsg, id)
+	if err != nil {
+		return fmt.Errorf("failed to record upload retry failure: %w", err)
+	}
+	return nil
+}
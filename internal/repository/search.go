@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/utils"
+)
+
+// ErrSearchUnavailable is returned by Search when SQLite was built without
+// FTS5, so posts_fts could not be created.
+var ErrSearchUnavailable = fmt.Errorf("full-text search is unavailable: SQLite was built without FTS5")
+
+// Snippet markers, replaced by <mark> once the snippet has been escaped.
+const (
+	snippetStart = "\x02"
+	snippetEnd   = "\x03"
+)
+
+// SearchFilter narrows Search. Query is required; Author and Category match
+// exactly, like in PostFilter.
+type SearchFilter struct {
+	Query    string
+	Author   string
+	Category string
+	Limit    int
+}
+
+// matchExpression quotes every word of a user query so that FTS5 operators
+// and punctuation are matched literally. All words must match.
+func matchExpression(query string) string {
+	words := strings.Fields(query)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	return strings.Join(words, " ")
+}
+
+// Search returns the posts whose title, content or author match the query,
+// best matches first.
+func (r *PostRepository) Search(filter SearchFilter) ([]model.SearchResult, error) {
+	match := matchExpression(filter.Query)
+	if match == "" {
+		return []model.SearchResult{}, nil
+	}
+
+	query := `
+		SELECT p.hash, p.title, p.url, COALESCE(p.author, ''), COALESCE(p.category_title, ''), p.published_at,
+			snippet(posts_fts, -1, char(2), char(3), '…', 16), bm25(posts_fts)
+		FROM posts_fts
+		JOIN posts p ON p.id = posts_fts.rowid
+		WHERE posts_fts MATCH ?`
+	args := []interface{}{match}
+	if filter.Author != "" {
+		query += " AND p.author = ?"
+		args = append(args, filter.Author)
+	}
+	if filter.Category != "" {
+		query += " AND p.category_title = ?"
+		args = append(args, filter.Category)
+	}
+	query += " ORDER BY bm25(posts_fts)"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table: posts_fts") || strings.Contains(err.Error(), "no such module: fts5") {
+			return nil, ErrSearchUnavailable
+		}
+		return nil, fmt.Errorf("failed to search posts: %w", err)
+	}
+	defer rows.Close()
+
+	results := []model.SearchResult{}
+	for rows.Next() {
+		var result model.SearchResult
+		var snippet string
+		if err := rows.Scan(&result.Hash, &result.Title, &result.URL, &result.Author, &result.CategoryTitle,
+			&result.PublishedAt, &snippet, &result.Rank); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		result.Snippet = highlightSnippet(snippet)
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// highlightSnippet strips the markup FTS5 indexed along with the content and
+// turns the match markers into <mark> elements.
+func highlightSnippet(snippet string) string {
+	text := html.EscapeString(utils.CleanText(snippet))
+	return strings.NewReplacer(snippetStart, "<mark>", snippetEnd, "</mark>").Replace(text)
+}
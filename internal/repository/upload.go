@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"lewdarchive/internal/model"
+)
+
+type UploadRepository struct {
+	db *sql.DB
+}
+
+func NewUploadRepository(db *sql.DB) *UploadRepository {
+	return &UploadRepository{db: db}
+}
+
+func (r *UploadRepository) Create(upload *model.Upload) error {
+	result, err := r.db.Exec(
+		`INSERT INTO uploads (post_id, name, local_name, uuid, url) VALUES (?, ?, ?, ?, ?)`,
+		upload.PostID, upload.Name, sql.NullString{String: upload.LocalName, Valid: upload.LocalName != ""}, upload.UUID, upload.URL,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create upload: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to read upload id: %w", err)
+	}
+	upload.ID = int(id)
+
+	return nil
+}
+
+// SetPostUploadCompleted records when every file of a post was uploaded.
+func (r *UploadRepository) SetPostUploadCompleted(postID int, at time.Time) error {
+	if _, err := r.db.Exec("UPDATE posts SET upload_completed_at = ? WHERE id = ?", at.UTC(), postID); err != nil {
+		return fmt.Errorf("failed to record upload completion: %w", err)
+	}
+	return nil
+}
+
+// ListByPostIDs returns the uploads of the given posts keyed by post ID.
+func (r *UploadRepository) ListByPostIDs(postIDs []int) (map[int][]model.Upload, error) {
+	uploads := make(map[int][]model.Upload)
+	if len(postIDs) == 0 {
+		return uploads, nil
+	}
+
+	placeholders := make([]string, len(postIDs))
+	args := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, post_id, name, uuid, url, created_at
+		FROM uploads WHERE post_id IN (%s)
+		ORDER BY id ASC
+	`, strings.Join(placeholders, ", "))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list uploads: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var upload model.Upload
+		var url sql.NullString
+		if err := rows.Scan(&upload.ID, &upload.PostID, &upload.Name, &upload.UUID, &url, &upload.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan upload: %w", err)
+		}
+		upload.URL = url.String
+		uploads[upload.PostID] = append(uploads[upload.PostID], upload)
+	}
+	return uploads, rows.Err()
+}
+
+// ListUUIDsForPost returns the Chibisafe files uploaded for a post, split into
+// those only the post refers to and those shared with other posts through
+// deduplication.
+func (r *UploadRepository) ListUUIDsForPost(postID int) (own, shared []string, err error) {
+	rows, err := r.db.Query(`
+		SELECT DISTINCT u.uuid, EXISTS (
+			SELECT 1 FROM uploads o WHERE o.uuid = u.uuid AND o.post_id != u.post_id
+		)
+		FROM uploads u
+		WHERE u.post_id = ? AND u.uuid != ''
+		ORDER BY u.uuid
+	`, postID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list upload uuids: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var uuid string
+		var isShared bool
+		if err := rows.Scan(&uuid, &isShared); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan upload uuid: %w", err)
+		}
+		if isShared {
+			shared = append(shared, uuid)
+		} else {
+			own = append(own, uuid)
+		}
+	}
+	return own, shared, rows.Err()
+}
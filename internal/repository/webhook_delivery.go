@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"lewdarchive/internal/model"
+)
+
+// WebhookDeliveryRetention is how long received webhook deliveries are kept.
+const WebhookDeliveryRetention = 30 * 24 * time.Hour
+
+type WebhookDeliveryRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookDeliveryRepository(db *sql.DB) *WebhookDeliveryRepository {
+	return &WebhookDeliveryRepository{db: db}
+}
+
+// Create records a received delivery.
+func (r *WebhookDeliveryRepository) Create(delivery *model.WebhookDelivery) error {
+	if delivery.ReceivedAt.IsZero() {
+		delivery.ReceivedAt = time.Now()
+	}
+	result, err := r.db.Exec(
+		`INSERT INTO webhook_deliveries (payload_hash, source, event_type, entry_count, duplicate, received_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		delivery.PayloadHash, delivery.Source, delivery.EventType, delivery.EntryCount, delivery.Duplicate, delivery.ReceivedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to read webhook delivery id: %w", err)
+	}
+	delivery.ID = int(id)
+	return nil
+}
+
+// FindProcessed returns the first delivery of a payload from source that was
+// processed, i.e. not itself a duplicate, after since, or sql.ErrNoRows.
+func (r *WebhookDeliveryRepository) FindProcessed(payloadHash, source string, since time.Time) (*model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	err := r.db.QueryRow(`
+		SELECT id, payload_hash, source, event_type, entry_count, duplicate, received_at
+		FROM webhook_deliveries
+		WHERE payload_hash = ? AND source = ? AND duplicate = 0 AND received_at > ?
+		ORDER BY id LIMIT 1
+	`, payloadHash, source, since.UTC()).Scan(
+		&delivery.ID, &delivery.PayloadHash, &delivery.Source, &delivery.EventType,
+		&delivery.EntryCount, &delivery.Duplicate, &delivery.ReceivedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// PruneBefore deletes deliveries received before the given time.
+func (r *WebhookDeliveryRepository) PruneBefore(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM webhook_deliveries WHERE received_at < ?`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune webhook deliveries: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,191 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Task is a maintenance operation. Its context is cancelled on shutdown.
+type Task func(ctx context.Context) error
+
+// TaskStatus describes a registered task for the health endpoint.
+type TaskStatus struct {
+	Name           string     `json:"name"`
+	Schedule       string     `json:"schedule"`
+	Running        bool       `json:"running"`
+	LastRun        *time.Time `json:"last_run,omitempty"`
+	LastDurationMS int64      `json:"last_duration_ms,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextRun        *time.Time `json:"next_run,omitempty"`
+}
+
+type task struct {
+	name         string
+	schedule     string
+	run          Task
+	entryID      cron.EntryID
+	running      bool
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastErr      error
+}
+
+// Scheduler runs named tasks on cron schedules. A run is skipped while the
+// previous run of the same task is still going.
+type Scheduler struct {
+	cron   *cron.Cron
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	tasks  map[string]*task
+}
+
+func New() *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		cron:   cron.New(),
+		ctx:    ctx,
+		cancel: cancel,
+		tasks:  make(map[string]*task),
+	}
+}
+
+// Every returns the schedule running a task at a fixed interval, or "" for
+// a non-positive interval.
+func Every(interval time.Duration) string {
+	if interval <= 0 {
+		return ""
+	}
+	return "@every " + interval.String()
+}
+
+// ValidateSchedule reports whether Add accepts the schedule. An empty
+// schedule is valid.
+func ValidateSchedule(schedule string) error {
+	if schedule == "" {
+		return nil
+	}
+	if _, err := cron.ParseStandard(schedule); err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", schedule, err)
+	}
+	return nil
+}
+
+// Add registers a task under a standard 5-field cron expression or a
+// descriptor such as "@every 6h". An empty schedule disables the task.
+func (s *Scheduler) Add(name, schedule string, run Task) error {
+	if schedule == "" {
+		log.Printf("Scheduled task %s disabled", name)
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tasks[name]; ok {
+		return fmt.Errorf("task %s already registered", name)
+	}
+
+	t := &task{name: name, schedule: schedule, run: run}
+	entryID, err := s.cron.AddFunc(schedule, func() { s.execute(t) })
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q for task %s: %w", schedule, name, err)
+	}
+	t.entryID = entryID
+	s.tasks[name] = t
+	return nil
+}
+
+// Trigger runs a registered task now, in the background, e.g. once at
+// startup ahead of its schedule.
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	t, ok := s.tasks[name]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown task %s", name)
+	}
+	go s.execute(t)
+	return nil
+}
+
+func (s *Scheduler) execute(t *task) {
+	s.mu.Lock()
+	if t.running {
+		s.mu.Unlock()
+		log.Printf("Task %s is still running, skipping this run", t.name)
+		return
+	}
+	if s.ctx.Err() != nil {
+		s.mu.Unlock()
+		return
+	}
+	t.running = true
+	s.wg.Add(1)
+	s.mu.Unlock()
+	defer s.wg.Done()
+
+	log.Printf("Task %s started", t.name)
+	started := time.Now()
+	err := t.run(s.ctx)
+	duration := time.Since(started)
+
+	s.mu.Lock()
+	t.running = false
+	t.lastRun = started
+	t.lastDuration = duration
+	t.lastErr = err
+	s.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Task %s failed after %s: %v", t.name, duration.Round(time.Millisecond), err)
+		return
+	}
+	log.Printf("Task %s finished in %s", t.name, duration.Round(time.Millisecond))
+}
+
+// Start begins running tasks on their schedules.
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+// Stop cancels the context of running tasks and waits for them to return.
+func (s *Scheduler) Stop() {
+	s.cron.Stop()
+	s.mu.Lock()
+	s.cancel()
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Status reports every registered task, sorted by name.
+func (s *Scheduler) Status() []TaskStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]TaskStatus, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		status := TaskStatus{Name: t.name, Schedule: t.schedule, Running: t.running}
+		if !t.lastRun.IsZero() {
+			lastRun := t.lastRun.UTC()
+			status.LastRun = &lastRun
+			status.LastDurationMS = t.lastDuration.Milliseconds()
+		}
+		if t.lastErr != nil {
+			status.LastError = t.lastErr.Error()
+		}
+		if next := s.cron.Entry(t.entryID).Next; !next.IsZero() {
+			next = next.UTC()
+			status.NextRun = &next
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
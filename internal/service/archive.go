@@ -1,69 +1,581 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"lewdarchive/internal/events"
+	"lewdarchive/internal/metrics"
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/repository"
+	"lewdarchive/internal/telemetry"
 	"lewdarchive/internal/utils"
 )
 
+// galleryDLDownloadPattern matches the lines gallery-dl logs for each file it fetches.
+var galleryDLDownloadPattern = regexp.MustCompile(`(?m)^.*\bDownloading\b.*$`)
+
 type ArchiveService struct {
 	baseDir            string
+	categoryDirs       map[string]string
 	chibisafeService   *ChibisafeService
+	postRepo           *repository.PostRepository
+	downloadLogRepo    *repository.DownloadLogRepository
+	postFileRepo       *repository.PostFileRepository
+	emitter            EventEmitter
+	bus                *events.Bus
 	cleanupAfterUpload bool
+	onComplete         []func(context.Context, ArchiveResult)
+	completeMu         sync.RWMutex
+	galleryDL          GalleryDLOptions
+	feedGalleryDL      map[int]GalleryDLOptions
+	authorRate         float64
+	feedAuthorRate     map[int]float64
+	authorLimiters     authorLimiters
+	highPriority       chan downloadJob
+	lowPriority        chan downloadJob
+	claimMu            sync.Mutex
+	// active counts the queued and running downloads of each post.
+	active   map[int]int
+	activeMu sync.Mutex
+	// workers is how many download workers StartWorkers started.
+	workers atomic.Int32
+}
+
+// archiveMetaFile records which post an archive directory belongs to.
+const archiveMetaFile = ".meta.json"
+
+// maxArchiveDirSuffix bounds the search for a free archive directory name.
+const maxArchiveDirSuffix = 100
+
+type archiveMeta struct {
+	PostID    int       `json:"post_id"`
+	URL       string    `json:"url"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DownloadPriority orders queued downloads: workers always take high priority
+// jobs first, so backfills never hold up freshly received entries.
+type DownloadPriority int
+
+const (
+	DownloadPriorityHigh DownloadPriority = iota
+	DownloadPriorityLow
+)
+
+// highPriorityQueueSize bounds the buffered high priority downloads. The low
+// priority queue is unbuffered so bulk producers wait for an idle worker.
+const highPriorityQueueSize = 1000
+
+type downloadJob struct {
+	ctx  context.Context
+	post *model.Post
+}
+
+// GalleryDLOptions selects the configuration gallery-dl runs with.
+type GalleryDLOptions struct {
+	// ConfigFile is passed as --config when set.
+	ConfigFile string
+	// NoConfig passes --ignore-config so the default config files are skipped.
+	NoConfig bool
 }
 
-func NewArchiveService(baseDir string, chibisafeService *ChibisafeService, cleanupAfterUpload bool) *ArchiveService {
+// args returns the gallery-dl command line flags for the options.
+func (o GalleryDLOptions) args() []string {
+	var args []string
+	if o.NoConfig {
+		args = append(args, "--ignore-config")
+	}
+	if o.ConfigFile != "" {
+		args = append(args, "--config", o.ConfigFile)
+	}
+	return args
+}
+
+// CheckGalleryDLConfigFile reports whether a gallery-dl config file exists and
+// is readable.
+func CheckGalleryDLConfigFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func NewArchiveService(baseDir string, categoryDirs map[string]string, chibisafeService *ChibisafeService, postRepo *repository.PostRepository, downloadLogRepo *repository.DownloadLogRepository, postFileRepo *repository.PostFileRepository, emitter EventEmitter, bus *events.Bus, cleanupAfterUpload bool) *ArchiveService {
 	return &ArchiveService{
 		baseDir:            baseDir,
+		categoryDirs:       categoryDirs,
 		chibisafeService:   chibisafeService,
+		postRepo:           postRepo,
+		downloadLogRepo:    downloadLogRepo,
+		postFileRepo:       postFileRepo,
+		emitter:            emitter,
+		bus:                bus,
 		cleanupAfterUpload: cleanupAfterUpload,
+		highPriority:       make(chan downloadJob, highPriorityQueueSize),
+		lowPriority:        make(chan downloadJob),
+		active:             make(map[int]int),
 	}
 }
 
-func (s *ArchiveService) DownloadContent(url, author, categoryTitle, title string, publishedAt time.Time, hash string) {
-	log.Printf("Starting download for: %s", url)
+// StartWorkers starts the goroutines running queued downloads.
+func (s *ArchiveService) StartWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		go s.worker()
+	}
+	s.workers.Add(int32(n))
+}
 
-	if _, err := exec.LookPath("gallery-dl"); err != nil {
-		log.Printf("gallery-dl not found in PATH: %v", err)
+// WorkersStarted reports whether StartWorkers was called.
+func (s *ArchiveService) WorkersStarted() bool {
+	return s.workers.Load() > 0
+}
+
+// Enqueue schedules a download. It blocks while the queue for the priority is
+// full.
+func (s *ArchiveService) Enqueue(ctx context.Context, post *model.Post, priority DownloadPriority) {
+	s.activeMu.Lock()
+	s.active[post.ID]++
+	s.activeMu.Unlock()
+	s.send(downloadJob{ctx: ctx, post: post}, priority)
+}
+
+// TryEnqueue schedules a download unless one is already queued or running for
+// the post, reporting whether it did. It blocks like Enqueue.
+func (s *ArchiveService) TryEnqueue(ctx context.Context, post *model.Post, priority DownloadPriority) bool {
+	if !s.claim(post.ID) {
+		return false
+	}
+	s.send(downloadJob{ctx: ctx, post: post}, priority)
+	return true
+}
+
+// Requeue schedules low priority downloads of posts whose queued download was
+// lost, such as those reset after a restart, skipping posts already queued or
+// running. It doesn't block: the downloads are handed to the workers in the
+// background as they become idle.
+func (s *ArchiveService) Requeue(ctx context.Context, posts []model.Post) {
+	var claimed []downloadJob
+	for i := range posts {
+		if s.claim(posts[i].ID) {
+			claimed = append(claimed, downloadJob{ctx: ctx, post: &posts[i]})
+		}
+	}
+	if len(claimed) == 0 {
 		return
 	}
+	go func() {
+		for _, job := range claimed {
+			s.send(job, DownloadPriorityLow)
+		}
+	}()
+}
 
-	archiveDir := s.buildArchivePath(author, categoryTitle, publishedAt, hash)
-	if err := os.MkdirAll(archiveDir, 0755); err != nil {
-		log.Printf("Error creating directory %s: %v", archiveDir, err)
+// claim marks a download of the post as queued unless one already is.
+func (s *ArchiveService) claim(postID int) bool {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+	if s.active[postID] > 0 {
+		return false
+	}
+	s.active[postID]++
+	return true
+}
+
+// QueueDepth returns how many downloads wait in the high priority queue and
+// how many posts have a download queued or running. Low priority downloads
+// wait for an idle worker instead of queueing.
+func (s *ArchiveService) QueueDepth() (queued, active int) {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+	return len(s.highPriority), len(s.active)
+}
+
+// IsActive reports whether a download of the post is queued or running.
+func (s *ArchiveService) IsActive(postID int) bool {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+	return s.active[postID] > 0
+}
+
+func (s *ArchiveService) send(job downloadJob, priority DownloadPriority) {
+	if priority == DownloadPriorityLow {
+		s.lowPriority <- job
 		return
 	}
+	s.highPriority <- job
+}
+
+func (s *ArchiveService) worker() {
+	for {
+		var job downloadJob
+		select {
+		case job = <-s.highPriority:
+		default:
+			select {
+			case job = <-s.highPriority:
+			case job = <-s.lowPriority:
+			}
+		}
+		s.DownloadContent(job.ctx, job.post)
+		s.release(job.post.ID)
+	}
+}
+
+// release records that a queued download of the post finished.
+func (s *ArchiveService) release(postID int) {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+	s.active[postID]--
+	if s.active[postID] <= 0 {
+		delete(s.active, postID)
+	}
+}
+
+// ArchiveResult describes the outcome of the download/upload pipeline for a post.
+type ArchiveResult struct {
+	Post          *model.Post
+	ArchiveDir    string
+	Success       bool
+	Err           error
+	UploadedFiles []UploadedFile
+}
+
+// SetGalleryDLOptions sets the gallery-dl options used for every download and
+// their per-feed replacements.
+func (s *ArchiveService) SetGalleryDLOptions(defaults GalleryDLOptions, perFeed map[int]GalleryDLOptions) {
+	s.galleryDL = defaults
+	s.feedGalleryDL = perFeed
+}
+
+// SetAuthorRateLimit sets how many downloads per minute each author may start,
+// and its per-feed replacements. A rate <= 0 disables the limit.
+func (s *ArchiveService) SetAuthorRateLimit(perMinute float64, perFeed map[int]float64) {
+	s.authorRate = perMinute
+	s.feedAuthorRate = perFeed
+}
+
+func (s *ArchiveService) authorRateFor(feedID int) float64 {
+	if perMinute, ok := s.feedAuthorRate[feedID]; ok {
+		return perMinute
+	}
+	return s.authorRate
+}
+
+func (s *ArchiveService) galleryDLOptionsFor(feedID int) GalleryDLOptions {
+	if opts, ok := s.feedGalleryDL[feedID]; ok {
+		return opts
+	}
+	return s.galleryDL
+}
+
+// OnComplete registers a callback invoked after every DownloadContent run,
+// successful or not, with the context of the download job.
+func (s *ArchiveService) OnComplete(fn func(context.Context, ArchiveResult)) {
+	s.completeMu.Lock()
+	defer s.completeMu.Unlock()
+	s.onComplete = append(s.onComplete, fn)
+}
+
+func (s *ArchiveService) DownloadContent(ctx context.Context, post *model.Post) {
+	ctx = telemetry.WithAttributes(ctx, telemetry.PostAttributes(post)...)
+	ctx, span := telemetry.StartSpan(ctx, "DownloadContent")
+
+	s.setDownloadStatus(post, model.DownloadStatusRunning)
+	s.bus.Publish(events.Event{Type: events.TypeDownloadStarted, Hash: post.Hash})
 
-	if err := s.executeGalleryDL(archiveDir, url); err != nil {
-		log.Printf("Error in gallery-dl for %s: %v", url, err)
+	started := time.Now()
+	result := s.archive(ctx, post)
+	telemetry.EndSpan(span, result.Err)
+	status := model.DownloadStatusCompleted
+	if result.Err != nil {
+		log.Printf("Archiving failed for %s: %v", post.URL, result.Err)
+		status = model.DownloadStatusFailed
+	}
+	metrics.DownloadDuration.WithLabelValues(status.String()).Observe(time.Since(started).Seconds())
+	s.setDownloadStatus(post, status)
+
+	s.completeMu.RLock()
+	callbacks := append([]func(context.Context, ArchiveResult){}, s.onComplete...)
+	s.completeMu.RUnlock()
+
+	for _, fn := range callbacks {
+		fn(ctx, result)
+	}
+}
+
+func (s *ArchiveService) setDownloadStatus(post *model.Post, status model.DownloadStatus) {
+	if s.postRepo == nil || post.ID == 0 {
+		return
+	}
+	if err := s.postRepo.UpdateDownloadStatus(post.ID, status); err != nil {
+		log.Printf("Error updating download status for %s: %v", post.Hash, err)
 		return
 	}
+	post.DownloadStatus = status
+}
+
+func (s *ArchiveService) archive(ctx context.Context, post *model.Post) ArchiveResult {
+	url := post.URL
+	author := post.Author
+	categoryTitle := post.CategoryTitle
+	result := ArchiveResult{Post: post}
+
+	log.Printf("Starting download for: %s", url)
+
+	if _, err := exec.LookPath("gallery-dl"); err != nil {
+		result.Err = fmt.Errorf("gallery-dl not found in PATH: %w", err)
+		return result
+	}
+
+	archiveDir, err := s.claimArchiveDir(s.buildArchivePath(author, categoryTitle, post.PublishedAt, post.Hash), post)
+	result.ArchiveDir = archiveDir
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	// A re-download, e.g. after the entry was updated, lands in the same
+	// directory: gallery-dl skips the files it already has and only the new
+	// ones are uploaded.
+	existingFiles := listArchivedFiles(archiveDir)
+
+	started := time.Now()
+	if err := s.authorLimiters.wait(ctx, author, s.authorRateFor(post.FeedID)); err != nil {
+		result.Err = fmt.Errorf("waiting for the download rate limit of %s: %w", author, err)
+		return result
+	}
+	if waited := time.Since(started); waited > time.Second {
+		log.Printf("Download of %s delayed %s by the rate limit for %s", url, waited.Round(time.Second), author)
+	}
+
+	if err := s.executeGalleryDL(post.ID, s.galleryDLOptionsFor(post.FeedID), archiveDir, url); err != nil {
+		result.Err = fmt.Errorf("error in gallery-dl for %s: %w", url, err)
+		return result
+	}
 
 	log.Printf("Download completed for: %s", url)
+	s.recordDownloadSize(post, archiveDir)
+	if files, err := s.hashArchivedFiles(post, archiveDir); err != nil {
+		log.Printf("Error listing files of %s: %v", archiveDir, err)
+	} else {
+		s.recordFiles(post, files)
+		if err := GenerateManifest(archiveDir, post, manifestFiles(files)); err != nil {
+			log.Printf("Error generating manifest for %s: %v", post.Hash, err)
+		}
+	}
+	EmitEvent(s.emitter, archiveEvent(model.EventDownloadCompleted, post, nil))
+	s.bus.Publish(events.Event{Type: events.TypeDownloadCompleted, Hash: post.Hash, Files: len(listArchivedFiles(archiveDir))})
 
 	if s.chibisafeService != nil && s.chibisafeService.IsConfigured() {
 		log.Printf("Starting Chibisafe upload for: %s", archiveDir)
-		if err := s.chibisafeService.UploadFiles(archiveDir, categoryTitle, author, title); err != nil {
-			log.Printf("Error uploading to Chibisafe: %v", err)
-		} else {
-			log.Printf("Chibisafe upload completed for: %s", archiveDir)
-			
-			if s.cleanupAfterUpload {
-				if err := s.cleanupDirectory(archiveDir); err != nil {
-					log.Printf("Error cleaning up directory %s: %v", archiveDir, err)
-				} else {
-					log.Printf("Successfully cleaned up directory: %s", archiveDir)
-				}
+		uploaded, err := s.chibisafeService.UploadFiles(ctx, post, archiveDir, existingFiles)
+		if err != nil {
+			result.Err = fmt.Errorf("error uploading to Chibisafe: %w", err)
+			return result
+		}
+		result.UploadedFiles = uploaded
+		log.Printf("Chibisafe upload completed for: %s", archiveDir)
+		EmitEvent(s.emitter, archiveEvent(model.EventUploadCompleted, post, uploaded))
+		s.bus.Publish(uploadCompletedEvent(post, uploaded))
+
+		if s.cleanupAfterUpload && s.chibisafeService.PendingRetries(post.ID) {
+			log.Printf("Keeping %s until queued uploads have been retried", archiveDir)
+		} else if s.cleanupAfterUpload {
+			if err := s.cleanupDirectory(archiveDir); err != nil {
+				log.Printf("Error cleaning up directory %s: %v", archiveDir, err)
+			} else {
+				log.Printf("Successfully cleaned up directory: %s", archiveDir)
 			}
 		}
 	}
+
+	result.Success = true
+	return result
+}
+
+// recordDownloadSize stores the size of a finished download and refreshes the
+// disk usage gauge. It is measured before uploading so that cleanup does not
+// hide the space the download took.
+func (s *ArchiveService) recordDownloadSize(post *model.Post, archiveDir string) {
+	size, err := directorySize(archiveDir)
+	if err != nil {
+		log.Printf("Error measuring %s: %v", archiveDir, err)
+		return
+	}
+	post.DownloadSizeBytes = size
+
+	if s.postRepo == nil || post.ID == 0 {
+		return
+	}
+	if err := s.postRepo.UpdateDownloadSize(post.ID, size); err != nil {
+		log.Printf("Error updating download size for %s: %v", post.Hash, err)
+		return
+	}
+	s.UpdateDiskUsage()
 }
 
+// UpdateDiskUsage sets the disk_used_bytes gauge from the recorded download sizes.
+func (s *ArchiveService) UpdateDiskUsage() {
+	if s.postRepo == nil {
+		return
+	}
+	stats, err := s.postRepo.Stats()
+	if err != nil {
+		log.Printf("Error loading disk usage: %v", err)
+		return
+	}
+	metrics.DiskUsedBytes.Set(float64(stats.TotalArchiveBytes))
+}
+
+// archivedFile is a downloaded file; PostFile.Path is relative to the
+// category's base directory and relPath to the archive directory.
+type archivedFile struct {
+	model.PostFile
+	relPath string
+}
+
+// hashArchivedFiles lists the downloaded files of an archive directory along
+// with their size and checksum.
+func (s *ArchiveService) hashArchivedFiles(post *model.Post, archiveDir string) ([]archivedFile, error) {
+	root := s.baseDirFor(post.CategoryTitle)
+
+	var files []archivedFile
+	err := filepath.WalkDir(archiveDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || isArchiveMetadata(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		checksum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		rootPath, err := filepath.Rel(root, path)
+		if err != nil {
+			rootPath = path
+		}
+		dirPath, err := filepath.Rel(archiveDir, path)
+		if err != nil {
+			dirPath = d.Name()
+		}
+		files = append(files, archivedFile{
+			PostFile: model.PostFile{
+				Path:      filepath.ToSlash(rootPath),
+				Name:      d.Name(),
+				SizeBytes: info.Size(),
+				SHA256:    checksum,
+			},
+			relPath: filepath.ToSlash(dirPath),
+		})
+		return nil
+	})
+	return files, err
+}
+
+// recordFiles stores the path, size and checksum of every file of a finished
+// download, before cleanup can remove them.
+func (s *ArchiveService) recordFiles(post *model.Post, files []archivedFile) {
+	if s.postFileRepo == nil || post.ID == 0 {
+		return
+	}
+
+	postFiles := make([]model.PostFile, len(files))
+	for i, file := range files {
+		postFiles[i] = file.PostFile
+	}
+	if err := s.postFileRepo.ReplaceForPost(post.ID, postFiles); err != nil {
+		log.Printf("Error recording files for %s: %v", post.Hash, err)
+	}
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 of a file's content.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// directorySize sums the sizes of the regular files below dir.
+func directorySize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+func archiveEvent(eventType string, post *model.Post, uploaded []UploadedFile) model.ArchiveEvent {
+	event := model.ArchiveEvent{
+		EventType:     eventType,
+		PostHash:      post.Hash,
+		PostURL:       post.URL,
+		Author:        post.Author,
+		CategoryTitle: post.CategoryTitle,
+	}
+	for _, file := range uploaded {
+		if file.URL != "" {
+			event.ChibisafeURLs = append(event.ChibisafeURLs, file.URL)
+		}
+	}
+	return event
+}
+
+// uploadCompletedEvent lists the Chibisafe URLs of the uploaded files.
+func uploadCompletedEvent(post *model.Post, uploaded []UploadedFile) events.Event {
+	return events.Event{
+		Type: events.TypeUploadCompleted,
+		Hash: post.Hash,
+		URLs: archiveEvent(model.EventUploadCompleted, post, uploaded).ChibisafeURLs,
+	}
+}
+
+// buildArchivePath takes the author as stored, without utils.CleanText, so the
+// directories of authors archived before titles were cleaned don't move.
 func (s *ArchiveService) buildArchivePath(author, categoryTitle string, publishedAt time.Time, hash string) string {
 	sanitizedAuthor := utils.SanitizeForPath(author)
 	sanitizedCategory := utils.SanitizeForPath(categoryTitle)
@@ -71,7 +583,7 @@ func (s *ArchiveService) buildArchivePath(author, categoryTitle string, publishe
 	month := fmt.Sprintf("%02d - %s", int(publishedAt.Month()), publishedAt.Month().String())
 	
 	return filepath.Join(
-		s.baseDir,
+		s.baseDirFor(categoryTitle),
 		fmt.Sprintf("%s - %s", sanitizedAuthor, sanitizedCategory),
 		year,
 		month,
@@ -79,21 +591,262 @@ func (s *ArchiveService) buildArchivePath(author, categoryTitle string, publishe
 	)
 }
 
-func (s *ArchiveService) executeGalleryDL(destDir, url string) error {
-	cmd := exec.Command("gallery-dl",
+// claimArchiveDir creates the post's archive directory along with its
+// .meta.json and returns it. Miniflux hashes are only unique within a feed, so
+// when dir already belongs to another post a -1, -2, ... suffix is appended.
+// Directories without .meta.json predate it and are adopted.
+func (s *ArchiveService) claimArchiveDir(dir string, post *model.Post) (string, error) {
+	s.claimMu.Lock()
+	defer s.claimMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", fmt.Errorf("error creating directory %s: %w", filepath.Dir(dir), err)
+	}
+
+	for suffix := 0; suffix <= maxArchiveDirSuffix; suffix++ {
+		candidate := dir
+		if suffix > 0 {
+			candidate = fmt.Sprintf("%s-%d", dir, suffix)
+		}
+
+		err := os.Mkdir(candidate, 0755)
+		if err != nil && !errors.Is(err, fs.ErrExist) {
+			return "", fmt.Errorf("error creating directory %s: %w", candidate, err)
+		}
+		if err == nil {
+			return candidate, writeArchiveMeta(candidate, post)
+		}
+
+		meta, err := readArchiveMeta(candidate)
+		if errors.Is(err, fs.ErrNotExist) {
+			return candidate, writeArchiveMeta(candidate, post)
+		}
+		if err != nil {
+			log.Printf("Skipping archive directory %s: %v", candidate, err)
+			continue
+		}
+		if meta.PostID == post.ID {
+			return candidate, nil
+		}
+		log.Printf("Archive directory %s belongs to post %d, trying the next suffix for %s", candidate, meta.PostID, post.Hash)
+	}
+	return "", fmt.Errorf("no free archive directory for %s after %d suffixes", dir, maxArchiveDirSuffix)
+}
+
+// ArchiveDirFor returns the existing archive directory of a post, looking
+// through the same suffixes as claimArchiveDir without creating anything. It
+// returns fs.ErrNotExist when the post has no directory, e.g. after cleanup.
+func (s *ArchiveService) ArchiveDirFor(post *model.Post) (string, error) {
+	dir := s.buildArchivePath(post.Author, post.CategoryTitle, post.PublishedAt, post.Hash)
+	for suffix := 0; suffix <= maxArchiveDirSuffix; suffix++ {
+		candidate := dir
+		if suffix > 0 {
+			candidate = fmt.Sprintf("%s-%d", dir, suffix)
+		}
+
+		meta, err := readArchiveMeta(candidate)
+		if errors.Is(err, fs.ErrNotExist) {
+			if _, err := os.Stat(candidate); err != nil {
+				return "", fs.ErrNotExist
+			}
+			return candidate, nil
+		}
+		if err == nil && meta.PostID == post.ID {
+			return candidate, nil
+		}
+	}
+	return "", fs.ErrNotExist
+}
+
+// LocalFiles lists the downloaded files of a post with their checksums. It
+// returns fs.ErrNotExist when the post has no archive directory, e.g. before
+// its download or after cleanup.
+func (s *ArchiveService) LocalFiles(post *model.Post) ([]model.LocalFile, error) {
+	archiveDir, err := s.ArchiveDirFor(post)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := s.hashArchivedFiles(post, archiveDir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]model.LocalFile, 0, len(archived))
+	for _, file := range archived {
+		files = append(files, model.LocalFile{
+			Name:        file.relPath,
+			SizeBytes:   file.SizeBytes,
+			ContentType: fileContentType(file.Name),
+			SHA256:      file.SHA256,
+		})
+	}
+	return files, nil
+}
+
+// UploadsEnabled reports whether archived files are uploaded to Chibisafe.
+func (s *ArchiveService) UploadsEnabled() bool {
+	return s.chibisafeService != nil && s.chibisafeService.IsConfigured()
+}
+
+// Reupload uploads the files of an already downloaded post to Chibisafe
+// again, e.g. after they were deleted there, without running gallery-dl.
+func (s *ArchiveService) Reupload(ctx context.Context, post *model.Post) ([]UploadedFile, error) {
+	if !s.UploadsEnabled() {
+		return nil, fmt.Errorf("chibisafe is not configured")
+	}
+	archiveDir, err := s.ArchiveDirFor(post)
+	if err != nil {
+		return nil, fmt.Errorf("no archive directory for %s: %w", post.Hash, err)
+	}
+
+	log.Printf("Starting Chibisafe re-upload for: %s", archiveDir)
+	uploaded, err := s.chibisafeService.UploadFiles(ctx, post, archiveDir, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error uploading to Chibisafe: %w", err)
+	}
+	log.Printf("Chibisafe re-upload completed for: %s", archiveDir)
+	EmitEvent(s.emitter, archiveEvent(model.EventUploadCompleted, post, uploaded))
+	s.bus.Publish(uploadCompletedEvent(post, uploaded))
+	return uploaded, nil
+}
+
+// listArchivedFiles returns the names of the files already in an archive
+// directory, leaving out .meta.json and manifest.json.
+func listArchivedFiles(dir string) map[string]bool {
+	files := make(map[string]bool)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return files
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && !isArchiveMetadata(entry.Name()) {
+			files[entry.Name()] = true
+		}
+	}
+	return files
+}
+
+func readArchiveMeta(dir string) (*archiveMeta, error) {
+	data, err := os.ReadFile(filepath.Join(dir, archiveMetaFile))
+	if err != nil {
+		return nil, err
+	}
+	var meta archiveMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", archiveMetaFile, err)
+	}
+	return &meta, nil
+}
+
+func writeArchiveMeta(dir string, post *model.Post) error {
+	data, err := json.MarshalIndent(archiveMeta{
+		PostID:    post.ID,
+		URL:       post.URL,
+		Author:    post.Author,
+		CreatedAt: time.Now().UTC(),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", archiveMetaFile, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, archiveMetaFile), data, 0644); err != nil {
+		return fmt.Errorf("error writing %s in %s: %w", archiveMetaFile, dir, err)
+	}
+	return nil
+}
+
+// baseDirFor returns the archive root for a category, falling back to the
+// global archive directory when no category-specific one is configured.
+func (s *ArchiveService) baseDirFor(categoryTitle string) string {
+	if dir, ok := s.categoryDirs[categoryTitle]; ok && dir != "" {
+		return dir
+	}
+	return s.baseDir
+}
+
+// ArchiveRoots returns every configured archive root directory.
+func (s *ArchiveService) ArchiveRoots() []string {
+	roots := []string{s.baseDir}
+	for _, dir := range s.categoryDirs {
+		roots = append(roots, dir)
+	}
+	return roots
+}
+
+// CleanupRetriedDirectory removes a download directory that was kept for
+// upload retries, once none of them are left, when cleanup after upload is
+// enabled. Archive roots are never removed.
+func (s *ArchiveService) CleanupRetriedDirectory(dirPath string) {
+	if !s.cleanupAfterUpload || s.isBaseDir(dirPath) {
+		return
+	}
+	if err := s.cleanupDirectory(dirPath); err != nil {
+		log.Printf("Error cleaning up directory %s: %v", dirPath, err)
+	}
+}
+
+func (s *ArchiveService) isBaseDir(dirPath string) bool {
+	if dirPath == s.baseDir || dirPath == filepath.Dir(s.baseDir) {
+		return true
+	}
+	for _, dir := range s.categoryDirs {
+		if dirPath == dir || dirPath == filepath.Dir(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ArchiveService) executeGalleryDL(postID int, opts GalleryDLOptions, destDir, url string) error {
+	args := append(opts.args(),
 		"--dest", destDir,
 		"--no-mtime",
 		"--option", "directory=[]",
 		url)
+	cmd := exec.Command("gallery-dl", args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	startedAt := time.Now()
+	err := cmd.Run()
+	finishedAt := time.Now()
+
+	exitCode := -1
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
+
+	s.recordDownloadLog(&model.DownloadLog{
+		PostID:          postID,
+		StartedAt:       startedAt,
+		FinishedAt:      finishedAt,
+		ExitCode:        exitCode,
+		StdoutLines:     stdout.String(),
+		StderrLines:     stderr.String(),
+		FilesDownloaded: countDownloadedFiles(stdout.String() + "\n" + stderr.String()),
+	})
 
-	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("gallery-dl execution failed: %w\nOutput: %s", err, string(output))
+		return fmt.Errorf("gallery-dl execution failed: %w\nOutput: %s%s", err, stdout.String(), stderr.String())
 	}
 
 	return nil
 }
 
+func (s *ArchiveService) recordDownloadLog(entry *model.DownloadLog) {
+	if s.downloadLogRepo == nil || entry.PostID == 0 {
+		return
+	}
+	if err := s.downloadLogRepo.Create(entry); err != nil {
+		log.Printf("Error recording download log for post %d: %v", entry.PostID, err)
+	}
+}
+
+func countDownloadedFiles(output string) int {
+	return len(galleryDLDownloadPattern.FindAllString(output, -1))
+}
+
 func (s *ArchiveService) cleanupDirectory(dirPath string) error {
 	// Check if directory exists
 	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
@@ -129,7 +882,7 @@ func (s *ArchiveService) cleanupDirectory(dirPath string) error {
 }
 
 func (s *ArchiveService) cleanupEmptyParentDirs(dirPath string) {
-	if dirPath == s.baseDir || dirPath == filepath.Dir(s.baseDir) {
+	if s.isBaseDir(dirPath) {
 		return
 	}
 
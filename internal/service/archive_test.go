@@ -0,0 +1,20 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildArchivePathKeepsRawAuthor(t *testing.T) {
+	s := NewArchiveService("/archive", nil, nil, nil, nil, nil, nil, nil, false)
+	publishedAt := time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC)
+
+	// Cleaning would turn the author into "Tom___Jerry" and move the
+	// directories already archived under the raw name.
+	got := s.buildArchivePath("Tom &amp; <b>Jerry</b>", "Art", publishedAt, "abc")
+	want := filepath.Join("/archive", "Tom__amp___b_Jerry__b_ - Art", "2024", "05 - May", "abc")
+	if got != want {
+		t.Errorf("buildArchivePath = %q, want %q", got, want)
+	}
+}
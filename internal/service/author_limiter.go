@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// authorLimiterIdle is how long an author's bucket is kept without use.
+	// An hour is long past the point where an idle bucket has refilled.
+	authorLimiterIdle = time.Hour
+	// authorLimiterPruneInterval is how often idle buckets are looked for.
+	authorLimiterPruneInterval = 10 * time.Minute
+)
+
+type authorLimiter struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// authorLimiters spaces out the downloads of each author so that sites
+// rate-limiting scrapers don't see a burst when several posts of one author
+// arrive together.
+type authorLimiters struct {
+	mu        sync.Mutex
+	limiters  map[string]*authorLimiter
+	lastPrune time.Time
+}
+
+// wait blocks until the author may start another download at perMinute
+// downloads per minute. A rate <= 0 or an unknown author is not limited.
+func (l *authorLimiters) wait(ctx context.Context, author string, perMinute float64) error {
+	if perMinute <= 0 || author == "" {
+		return nil
+	}
+	return l.limiter(author, perMinute).Wait(ctx)
+}
+
+// limiter returns the author's bucket, created with a burst of one minute's
+// allowance. The rate is updated in place when a feed override changes it.
+func (l *authorLimiters) limiter(author string, perMinute float64) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.limiters == nil {
+		l.limiters = make(map[string]*authorLimiter)
+	}
+	if now.Sub(l.lastPrune) > authorLimiterPruneInterval {
+		for key, entry := range l.limiters {
+			if now.Sub(entry.lastUsed) > authorLimiterIdle {
+				delete(l.limiters, key)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	limit := rate.Limit(perMinute / 60)
+	entry, ok := l.limiters[author]
+	if !ok {
+		entry = &authorLimiter{limiter: rate.NewLimiter(limit, max(1, int(perMinute)))}
+		l.limiters[author] = entry
+	} else if entry.limiter.Limit() != limit {
+		entry.limiter.SetLimit(limit)
+	}
+	entry.lastUsed = now
+	return entry.limiter
+}
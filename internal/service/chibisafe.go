@@ -2,7 +2,14 @@ package service
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,46 +17,355 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"text/template"
+	"time"
 
 	"lewdarchive/internal/model"
+	"lewdarchive/internal/repository"
+	"lewdarchive/internal/telemetry"
 	"lewdarchive/internal/utils"
 )
 
+const (
+	// uploadAttempts is how often an upload is tried in-process before it is
+	// handed to the retry queue.
+	uploadAttempts     = 3
+	uploadRetryBackoff = 2 * time.Second
+	// uploadNameMaxLength caps the slugified title and author used in file
+	// names, in runes.
+	uploadNameMaxLength = 100
+)
+
 type ChibisafeService struct {
 	apiURL           string
 	apiKey           string
+	apiKeyFile       string
+	apiKeyRefreshURL string
 	client           *http.Client
 	useNetworkStorage *bool 
 	settingsMutex     sync.RWMutex
+	maxFileSize       int64
+	maxSizeByMime     map[string]int64
+	retryQueue        *repository.RetryQueueRepository
+	uploadRepo        *repository.UploadRepository
+	fileHashRepo      *repository.FileHashRepository
+	retryInterval     time.Duration
+	videoThumbnails   bool
+	filenameTemplate  *template.Template
+	cfg               ChibisafeConfig
+	lastUpload        successClock
+}
+
+// ExtraAlbum is an additional album that receives its own copy of the files
+// of every post, or only of posts in Categories.
+type ExtraAlbum struct {
+	Name        string
+	AddAllPosts bool
+	Categories  []string
+}
+
+// matches reports whether posts of the category belong in the album.
+func (a ExtraAlbum) matches(categoryTitle string) bool {
+	if a.AddAllPosts {
+		return true
+	}
+	for _, category := range a.Categories {
+		if strings.EqualFold(category, categoryTitle) {
+			return true
+		}
+	}
+	return false
+}
+
+type ChibisafeConfig struct {
+	APIURL string
+	APIKey string
+	// APIKeyFile and APIKeyRefreshURL are where WatchAPIKey picks up a
+	// rotated key, the file taking precedence.
+	APIKeyFile       string
+	APIKeyRefreshURL string
+	// ProxyURL routes every request, including the S3 uploads, through an
+	// HTTP(S) or SOCKS5 proxy, see ParseProxyURL. InsecureTLS skips
+	// certificate verification for self-signed instances.
+	ProxyURL    *url.URL
+	InsecureTLS bool
+	// CertPinSHA256 is the SHA-256 of the Chibisafe server's leaf
+	// certificate, see ParseCertPin. Connections to the API host presenting
+	// another certificate are refused; with InsecureTLS the pin is the only
+	// check. Nil disables pinning.
+	CertPinSHA256 []byte
+	// MaxFileSizeMB caps every upload; MaxSizeByMime overrides it per MIME
+	// type or wildcard such as "video/*". Zero disables the cap.
+	MaxFileSizeMB int64
+	MaxSizeByMime map[string]int64
+	// RetryQueue receives uploads that failed every in-process attempt; they
+	// are first retried RetryInterval later. A nil queue drops them.
+	RetryQueue    *repository.RetryQueueRepository
+	RetryInterval time.Duration
+	// Uploads records every successful upload of a post.
+	Uploads *repository.UploadRepository
+	// FileHashes remembers the upload of every file content so that files
+	// shared between posts are only uploaded once. Nil disables it.
+	FileHashes *repository.FileHashRepository
+	// GenerateVideoThumbnails uploads an ffmpeg-extracted frame ahead of
+	// every .mp4 file.
+	GenerateVideoThumbnails bool
+	// FilenameTemplate names uploaded files, see ParseFilenameTemplate. Nil
+	// uses DefaultFilenameTemplate.
+	FilenameTemplate *template.Template
+	// ExtraAlbums are uploaded to besides the category album.
+	ExtraAlbums []ExtraAlbum
+}
+
+type UploadedFile struct {
+	Name string `json:"name"`
+	UUID string `json:"uuid"`
+	URL  string `json:"url"`
 }
 
 type ChibisafeSettings struct {
 	UseNetworkStorage bool `json:"useNetworkStorage"`
 }
 
-func NewChibisafeService(apiURL, apiKey string) *ChibisafeService {
+func NewChibisafeService(cfg ChibisafeConfig) *ChibisafeService {
+	apiURL, apiKey := cfg.APIURL, cfg.APIKey
 	if apiURL == "" || apiKey == "" {
 		log.Println("WARNING: Chibisafe API URL or key not configured. Chibisafe uploads will be skipped.")
 		return &ChibisafeService{
 			apiURL: apiURL,
 			apiKey: apiKey,
-			client: &http.Client{},
+			client: newChibisafeClient(cfg),
 		}
 	}
 
+	filenameTemplate := cfg.FilenameTemplate
+	if filenameTemplate == nil {
+		filenameTemplate = defaultFilenameTemplate
+	}
+
 	return &ChibisafeService{
-		apiURL: strings.TrimSuffix(apiURL, "/"),
-		apiKey: apiKey,
-		client: &http.Client{},
+		apiURL:           strings.TrimSuffix(apiURL, "/"),
+		apiKey:           apiKey,
+		apiKeyFile:       cfg.APIKeyFile,
+		apiKeyRefreshURL: cfg.APIKeyRefreshURL,
+		client:           newChibisafeClient(cfg),
+		maxFileSize:      cfg.MaxFileSizeMB * 1024 * 1024,
+		maxSizeByMime:    cfg.MaxSizeByMime,
+		retryQueue:       cfg.RetryQueue,
+		retryInterval:    cfg.RetryInterval,
+		uploadRepo:       cfg.Uploads,
+		fileHashRepo:     cfg.FileHashes,
+		videoThumbnails:  cfg.GenerateVideoThumbnails,
+		filenameTemplate: filenameTemplate,
+		cfg:              cfg,
 	}
 }
 
+// newChibisafeClient returns the client for Chibisafe and its S3 storage,
+// honouring the proxy and TLS settings.
+func newChibisafeClient(cfg ChibisafeConfig) *http.Client {
+	if cfg.ProxyURL == nil && !cfg.InsecureTLS && cfg.CertPinSHA256 == nil {
+		return &http.Client{}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.ProxyURL != nil {
+		transport.Proxy = http.ProxyURL(cfg.ProxyURL)
+	}
+	if cfg.InsecureTLS {
+		if cfg.CertPinSHA256 == nil {
+			log.Println("WARNING: CHIBISAFE_INSECURE_TLS is set, Chibisafe certificates are not verified")
+		}
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	if cfg.CertPinSHA256 == nil {
+		return &http.Client{Transport: transport}
+	}
+
+	// The S3 storage and key refresh URL are on other hosts, so only
+	// connections to the API host are pinned.
+	apiURL, err := url.Parse(cfg.APIURL)
+	if err != nil || apiURL.Host == "" {
+		log.Printf("WARNING: CHIBISAFE_CERT_PIN_SHA256 is set but CHIBISAFE_API_URL %q has no host, nothing is pinned", cfg.APIURL)
+		return &http.Client{Transport: transport}
+	}
+	pinned := transport.Clone()
+	if pinned.TLSClientConfig == nil {
+		pinned.TLSClientConfig = &tls.Config{}
+	}
+	pinned.TLSClientConfig.VerifyPeerCertificate = verifyCertPin(apiURL.Hostname(), cfg.CertPinSHA256)
+	return &http.Client{Transport: &pinnedHostTransport{
+		host:     apiURL.Host,
+		pinned:   pinned,
+		fallback: transport,
+	}}
+}
+
+// verifyCertPin returns a tls.Config.VerifyPeerCertificate callback refusing
+// connections whose leaf certificate's SHA-256 is not pin.
+func verifyCertPin(host string, pin []byte) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			log.Printf("Chibisafe certificate pin check failed for %s: no certificate presented", host)
+			return errors.New("chibisafe: no certificate presented")
+		}
+		sum := sha256.Sum256(rawCerts[0])
+		if subtle.ConstantTimeCompare(sum[:], pin) != 1 {
+			log.Printf("Chibisafe certificate pin check failed for %s: got SHA-256 %s, expected %s",
+				host, hex.EncodeToString(sum[:]), hex.EncodeToString(pin))
+			return errors.New("chibisafe: certificate does not match CHIBISAFE_CERT_PIN_SHA256")
+		}
+		return nil
+	}
+}
+
+// pinnedHostTransport sends requests for host through the pinned transport
+// and all others through fallback.
+type pinnedHostTransport struct {
+	host     string
+	pinned   http.RoundTripper
+	fallback http.RoundTripper
+}
+
+func (t *pinnedHostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == t.host {
+		return t.pinned.RoundTrip(req)
+	}
+	return t.fallback.RoundTrip(req)
+}
+
+// ParseCertPin validates CHIBISAFE_CERT_PIN_SHA256, the hex-encoded SHA-256
+// of a DER certificate, optionally colon-separated as printed by
+// `openssl x509 -fingerprint -sha256`. An empty value means no pin.
+func ParseCertPin(raw string) ([]byte, error) {
+	raw = strings.ReplaceAll(strings.TrimSpace(raw), ":", "")
+	if raw == "" {
+		return nil, nil
+	}
+	pin, err := hex.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("not hex: %w", err)
+	}
+	if len(pin) != sha256.Size {
+		return nil, fmt.Errorf("expected %d bytes, got %d", sha256.Size, len(pin))
+	}
+	return pin, nil
+}
+
+// ParseProxyURL validates CHIBISAFE_PROXY_URL, which must be an http, https,
+// socks5 or socks5h URL with a host. An empty value means no proxy.
+func ParseProxyURL(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https, socks5 or socks5h", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", raw)
+	}
+	return proxyURL, nil
+}
+
+// maxSizeFor returns the byte limit for a content type: an exact MIME match
+// wins over a "type/*" wildcard, which wins over the global limit.
+func (s *ChibisafeService) maxSizeFor(contentType string) int64 {
+	if mb, ok := s.maxSizeByMime[contentType]; ok {
+		return mb * 1024 * 1024
+	}
+	if slash := strings.Index(contentType, "/"); slash != -1 {
+		if mb, ok := s.maxSizeByMime[contentType[:slash]+"/*"]; ok {
+			return mb * 1024 * 1024
+		}
+	}
+	return s.maxFileSize
+}
+
 func (s *ChibisafeService) IsConfigured() bool {
-	return s.apiURL != "" && s.apiKey != ""
+	return s.apiURL != "" && s.currentAPIKey() != ""
+}
+
+// LastSuccess returns when a file was last uploaded, nil if none was since
+// startup.
+func (s *ChibisafeService) LastSuccess() *time.Time {
+	return s.lastUpload.get()
+}
+
+// currentAPIKey returns the API key to send with a new request. Requests
+// already sent keep the key they were made with when it is rotated.
+func (s *ChibisafeService) currentAPIKey() string {
+	s.settingsMutex.RLock()
+	defer s.settingsMutex.RUnlock()
+	return s.apiKey
+}
+
+// Ping requests GET /api/settings, bypassing the cached settings.
+func (s *ChibisafeService) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.apiURL+"/api/settings", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create settings request: %w", err)
+	}
+	req.Header.Set("x-api-key", s.currentAPIKey())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get settings: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("get settings failed: %d - %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// PostFiles returns the Chibisafe files uploaded for a post, split into those
+// only this post uses and those reused by other posts through deduplication.
+func (s *ChibisafeService) PostFiles(postID int) (own, shared []string, err error) {
+	if s.uploadRepo == nil {
+		return nil, nil, nil
+	}
+	return s.uploadRepo.ListUUIDsForPost(postID)
+}
+
+// DeleteFile deletes an uploaded file. A file that is already gone counts as
+// deleted, so that an interrupted purge can be run again.
+func (s *ChibisafeService) DeleteFile(ctx context.Context, uuid string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.apiURL+"/api/file/"+url.PathEscape(uuid), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create delete request: %w", err)
+	}
+	req.Header.Set("x-api-key", s.currentAPIKey())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("delete file failed: %d - %s", resp.StatusCode, string(body))
+	}
+
+	if s.fileHashRepo != nil {
+		if err := s.fileHashRepo.DeleteByUUID(uuid); err != nil {
+			log.Printf("Error forgetting hash of deleted file %s: %v", uuid, err)
+		}
+	}
+	return nil
 }
 
 func (s *ChibisafeService) getSettings() (*ChibisafeSettings, error) {
@@ -66,7 +382,7 @@ func (s *ChibisafeService) getSettings() (*ChibisafeSettings, error) {
 		return nil, fmt.Errorf("failed to create settings request: %w", err)
 	}
 
-	req.Header.Set("x-api-key", s.apiKey)
+	req.Header.Set("x-api-key", s.currentAPIKey())
 
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -96,15 +412,22 @@ func (s *ChibisafeService) containsWIP(title string) bool {
 	return strings.Contains(strings.ToUpper(title), "WIP")
 }
 
-func (s *ChibisafeService) UploadFiles(archiveDir, categoryTitle, author, title string) error {
+// UploadFiles uploads the supported files in archiveDir, except those named in
+// skip, and returns the files that made it to Chibisafe. Files that keep
+// failing are put on the retry queue.
+func (s *ChibisafeService) UploadFiles(ctx context.Context, post *model.Post, archiveDir string, skip map[string]bool) (uploaded []UploadedFile, err error) {
+	_, span := telemetry.StartSpan(ctx, "UploadFiles")
+	defer func() { telemetry.EndSpan(span, err) }()
+
 	if !s.IsConfigured() {
 		log.Printf("Chibisafe not configured, skipping upload for %s", archiveDir)
-		return nil
+		return nil, nil
 	}
 
-	albumUUID, err := s.getOrCreateAlbum(categoryTitle)
-	if err != nil {
-		return fmt.Errorf("failed to get/create album: %w", err)
+	categoryTitle, author, title := post.CategoryTitle, post.Author, post.Title
+	albumUUIDs := s.resolveTargetAlbums(categoryTitle, s.cfg)
+	if len(albumUUIDs) == 0 {
+		return nil, fmt.Errorf("failed to get/create album %s", categoryTitle)
 	}
 
 	authorTagUUID, err := s.getOrCreateTag(author)
@@ -122,7 +445,50 @@ func (s *ChibisafeService) UploadFiles(archiveDir, categoryTitle, author, title
 		}
 	}
 
-	return s.uploadDirectoryFiles(archiveDir, albumUUID, authorTagUUID, wipTagUUID, title)
+	uploaded, err = s.uploadDirectoryFiles(post, archiveDir, skip, albumUUIDs, authorTagUUID, wipTagUUID)
+	if err == nil {
+		s.FinishUpload(post.ID)
+	}
+	return uploaded, err
+}
+
+// FinishUpload records when the upload of a post completed, unless some of
+// its files are still queued for retry.
+func (s *ChibisafeService) FinishUpload(postID int) {
+	if s.uploadRepo == nil || postID == 0 || s.PendingRetries(postID) {
+		return
+	}
+	if err := s.uploadRepo.SetPostUploadCompleted(postID, time.Now()); err != nil {
+		log.Printf("Error recording upload completion of post %d: %v", postID, err)
+	}
+}
+
+// resolveTargetAlbums returns the UUID of the category album followed by those
+// of the extra albums of cfg matching the category, or nil when the category
+// album can't be resolved. Extra albums that can't be resolved are skipped so
+// they never block the primary upload.
+func (s *ChibisafeService) resolveTargetAlbums(categoryTitle string, cfg ChibisafeConfig) []string {
+	primary, err := s.getOrCreateAlbum(categoryTitle)
+	if err != nil {
+		log.Printf("Error getting/creating album %s: %v", categoryTitle, err)
+		return nil
+	}
+
+	albumUUIDs := []string{primary}
+	for _, album := range cfg.ExtraAlbums {
+		if !album.matches(categoryTitle) {
+			continue
+		}
+		uuid, err := s.getOrCreateAlbum(album.Name)
+		if err != nil {
+			log.Printf("Warning: failed to get/create extra album %s: %v", album.Name, err)
+			continue
+		}
+		if uuid != primary {
+			albumUUIDs = append(albumUUIDs, uuid)
+		}
+	}
+	return albumUUIDs
 }
 
 func (s *ChibisafeService) getOrCreateAlbum(categoryTitle string) (string, error) {
@@ -152,7 +518,7 @@ func (s *ChibisafeService) searchAlbums(search string) ([]model.ChibisafeAlbum,
 	q.Add("search", search)
 	req.URL.RawQuery = q.Encode()
 
-	req.Header.Set("x-api-key", s.apiKey)
+	req.Header.Set("x-api-key", s.currentAPIKey())
 
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -189,7 +555,7 @@ func (s *ChibisafeService) createAlbum(name string) (string, error) {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", s.apiKey)
+	req.Header.Set("x-api-key", s.currentAPIKey())
 
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -238,7 +604,7 @@ func (s *ChibisafeService) searchTags(search string) ([]model.ChibisafeTag, erro
 	q.Add("search", search)
 	req.URL.RawQuery = q.Encode()
 
-	req.Header.Set("x-api-key", s.apiKey)
+	req.Header.Set("x-api-key", s.currentAPIKey())
 
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -275,7 +641,7 @@ func (s *ChibisafeService) createTag(name string) (string, error) {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", s.apiKey)
+	req.Header.Set("x-api-key", s.currentAPIKey())
 
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -297,66 +663,207 @@ func (s *ChibisafeService) createTag(name string) (string, error) {
 	return response.Tag.UUID, nil
 }
 
-func (s *ChibisafeService) uploadDirectoryFiles(dirPath, albumUUID, authorTagUUID, wipTagUUID, title string) error {
+// uploadDirectoryFiles uploads every supported file once per album. Only the
+// copies in the first, primary album are recorded and returned.
+func (s *ChibisafeService) uploadDirectoryFiles(post *model.Post, dirPath string, skip map[string]bool, albumUUIDs []string, authorTagUUID, wipTagUUID string) ([]UploadedFile, error) {
+	postID := post.ID
 	entries, err := os.ReadDir(dirPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var supportedFiles []os.DirEntry
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if entry.IsDir() || isArchiveMetadata(entry.Name()) {
+			continue
+		}
+		if skip[entry.Name()] {
+			log.Printf("Skipping previously uploaded file: %s", entry.Name())
 			continue
 		}
 		if !s.isSupportedFile(entry.Name()) {
 			log.Printf("Skipping non-supported file: %s", entry.Name())
 			continue
 		}
+		info, err := entry.Info()
+		if err != nil {
+			log.Printf("Skipping file %s: %v", entry.Name(), err)
+			continue
+		}
+		contentType := s.getContentType(filepath.Join(dirPath, entry.Name()), entry.Name())
+		if limit := s.maxSizeFor(contentType); limit > 0 && info.Size() > limit {
+			log.Printf("WARNING: Skipping %s: %d bytes exceeds the %d MB limit for %s", entry.Name(), info.Size(), limit/1024/1024, contentType)
+			continue
+		}
 		supportedFiles = append(supportedFiles, entry)
 	}
 
 	if len(supportedFiles) == 0 {
-		return nil
+		return nil, nil
 	}
 
-	sanitizedTitle := utils.SanitizeForPath(title)
+	sanitizedTitle := utils.SlugifyTitle(utils.CleanText(post.Title), uploadNameMaxLength)
 	if sanitizedTitle == "" {
 		sanitizedTitle = "unknown"
 	}
 
+	var uploaded []UploadedFile
 	for i, entry := range supportedFiles {
 		filePath := filepath.Join(dirPath, entry.Name())
 		ext := filepath.Ext(entry.Name())
-		var filename string
-		if len(supportedFiles) == 1 {
-			filename = sanitizedTitle + ext
-		} else {
-			filename = fmt.Sprintf("%s-%d%s", sanitizedTitle, i+1, ext)
+
+		checksum, existing := s.findUploadedCopy(filePath)
+		if existing != nil {
+			log.Printf("Reusing existing Chibisafe file %s for %s", existing.UUID, entry.Name())
+			uploaded = append(uploaded, *existing)
+			s.recordUpload(postID, entry.Name(), existing)
+			s.tagFile(existing.UUID, entry.Name(), authorTagUUID, wipTagUUID)
+			continue
 		}
 
-		log.Printf("Uploading file: %s as %s", entry.Name(), filename)
-		fileUUID, err := s.uploadFile(filePath, filename, albumUUID)
+		data := FilenameData{
+			Title:  sanitizedTitle,
+			Index:  i + 1,
+			Total:  len(supportedFiles),
+			Ext:    ext,
+			Author: utils.SlugifyTitle(utils.CleanText(post.Author), uploadNameMaxLength),
+			Hash:   post.Hash,
+			Date:   post.PublishedAt.Format("2006-01-02"),
+		}
+		filename, err := renderFilename(s.filenameTemplate, data)
 		if err != nil {
-			log.Printf("Error uploading file %s: %v", filename, err)
-			continue
+			log.Printf("Error naming %s, using the default name: %v", entry.Name(), err)
+			filename, _ = renderFilename(defaultFilenameTemplate, data)
 		}
 
-		if authorTagUUID != "" && fileUUID != "" {
-			if err := s.addTagToFile(fileUUID, authorTagUUID); err != nil {
-				log.Printf("Error adding author tag to file %s: %v", filename, err)
-			}
+		// The thumbnail is extracted once and uploaded to every album.
+		var thumbPath string
+		if s.videoThumbnails && strings.ToLower(ext) == ".mp4" {
+			thumbPath = s.generateThumbnail(filePath, filename)
 		}
 
-		if wipTagUUID != "" && fileUUID != "" {
-			if err := s.addTagToFile(fileUUID, wipTagUUID); err != nil {
-				log.Printf("Error adding WIP tag to file %s: %v", filename, err)
-			} else {
-				log.Printf("Successfully applied WIP tag to file %s", filename)
+		for i, albumUUID := range albumUUIDs {
+			primary := i == 0
+
+			if thumbPath != "" {
+				if thumb := s.uploadThumbnail(thumbPath, filename, albumUUID, authorTagUUID); thumb != nil && primary {
+					uploaded = append(uploaded, *thumb)
+					s.recordUpload(postID, "", thumb)
+				}
+			}
+
+			log.Printf("Uploading file: %s as %s to album %s", entry.Name(), filename, albumUUID)
+			file, err := s.uploadFileWithRetry(filePath, filename, albumUUID)
+			if err != nil {
+				log.Printf("Error uploading file %s: %v", filename, err)
+				s.queueRetry(postID, filePath, filename, albumUUID, []string{authorTagUUID, wipTagUUID}, err)
+				continue
 			}
+			if primary {
+				uploaded = append(uploaded, *file)
+				s.recordUpload(postID, entry.Name(), file)
+				s.recordFileHash(checksum, file)
+			}
+			s.tagFile(file.UUID, filename, authorTagUUID, wipTagUUID)
+		}
+
+		if thumbPath != "" {
+			os.RemoveAll(filepath.Dir(thumbPath))
 		}
 	}
 
-	return nil
+	return uploaded, nil
+}
+
+// tagFile applies the author and WIP tags, when set, to an uploaded file.
+func (s *ChibisafeService) tagFile(fileUUID, filename, authorTagUUID, wipTagUUID string) {
+	if fileUUID == "" {
+		return
+	}
+
+	if authorTagUUID != "" {
+		if err := s.addTagToFile(fileUUID, authorTagUUID); err != nil {
+			log.Printf("Error adding author tag to file %s: %v", filename, err)
+		}
+	}
+
+	if wipTagUUID != "" {
+		if err := s.addTagToFile(fileUUID, wipTagUUID); err != nil {
+			log.Printf("Error adding WIP tag to file %s: %v", filename, err)
+		} else {
+			log.Printf("Successfully applied WIP tag to file %s", filename)
+		}
+	}
+}
+
+// findUploadedCopy returns the checksum of a local file along with the
+// Chibisafe upload of the same content, if any. The checksum is empty when
+// deduplication is disabled or the file could not be read.
+func (s *ChibisafeService) findUploadedCopy(filePath string) (string, *UploadedFile) {
+	if s.fileHashRepo == nil {
+		return "", nil
+	}
+	checksum, err := fileSHA256(filePath)
+	if err != nil {
+		log.Printf("Error hashing %s, uploading it anyway: %v", filePath, err)
+		return "", nil
+	}
+	existing, err := s.fileHashRepo.FindByHash(checksum)
+	if err != nil {
+		log.Printf("Error looking up %s by hash: %v", filePath, err)
+		return checksum, nil
+	}
+	if existing == nil {
+		return checksum, nil
+	}
+	return checksum, &UploadedFile{Name: filepath.Base(filePath), UUID: existing.ChibisafeUUID, URL: existing.ChibisafeURL}
+}
+
+// recordFileHash remembers the upload of a file content for findUploadedCopy.
+func (s *ChibisafeService) recordFileHash(checksum string, file *UploadedFile) {
+	if s.fileHashRepo == nil || checksum == "" || file.UUID == "" {
+		return
+	}
+	fileHash := &model.FileHash{Hash: checksum, ChibisafeUUID: file.UUID, ChibisafeURL: file.URL}
+	if err := s.fileHashRepo.Create(fileHash); err != nil {
+		log.Printf("Error recording hash of %s: %v", file.Name, err)
+	}
+}
+
+// generateThumbnail extracts a frame from the video and returns its path, in a
+// temporary directory the caller removes, or "" when it failed. Failures are
+// logged and never stop the video upload itself.
+func (s *ChibisafeService) generateThumbnail(videoPath, videoFilename string) string {
+	thumbPath, err := utils.GenerateThumbnail(videoPath)
+	if errors.Is(err, utils.ErrFFmpegNotFound) {
+		log.Printf("WARNING: ffmpeg not found, skipping thumbnail for %s", videoFilename)
+		return ""
+	}
+	if err != nil {
+		log.Printf("Error generating thumbnail for %s: %v", videoFilename, err)
+		return ""
+	}
+	return thumbPath
+}
+
+// uploadThumbnail uploads the thumbnail of a video as
+// <video_basename>_thumb.jpg. Failures are logged and never stop the video
+// upload itself.
+func (s *ChibisafeService) uploadThumbnail(thumbPath, videoFilename, albumUUID, authorTagUUID string) *UploadedFile {
+	thumbFilename := strings.TrimSuffix(videoFilename, filepath.Ext(videoFilename)) + "_thumb.jpg"
+	log.Printf("Uploading thumbnail for %s as %s", videoFilename, thumbFilename)
+	file, err := s.uploadFileWithRetry(thumbPath, thumbFilename, albumUUID)
+	if err != nil {
+		log.Printf("Error uploading thumbnail %s: %v", thumbFilename, err)
+		return nil
+	}
+
+	if authorTagUUID != "" && file.UUID != "" {
+		if err := s.addTagToFile(file.UUID, authorTagUUID); err != nil {
+			log.Printf("Error adding author tag to file %s: %v", thumbFilename, err)
+		}
+	}
+	return file
 }
 
 func (s *ChibisafeService) isSupportedFile(filename string) bool {
@@ -372,6 +879,12 @@ func (s *ChibisafeService) isSupportedFile(filename string) bool {
 }
 
 func (s *ChibisafeService) getContentType(filePath, filename string) string {
+	return fileContentType(filename)
+}
+
+// fileContentType guesses the MIME type of an archived file from its
+// extension, preferring the types Chibisafe expects for common media.
+func fileContentType(filename string) string {
 	ext := strings.ToLower(filepath.Ext(filename))
 
 	specificTypes := map[string]string{
@@ -402,7 +915,106 @@ func (s *ChibisafeService) getContentType(filePath, filename string) string {
 	return "application/octet-stream"
 }
 
-func (s *ChibisafeService) uploadFile(filePath, filename, albumUUID string) (string, error) {
+func (s *ChibisafeService) uploadFileWithRetry(filePath, filename, albumUUID string) (*UploadedFile, error) {
+	var lastErr error
+	for attempt := 1; attempt <= uploadAttempts; attempt++ {
+		file, err := s.uploadFile(filePath, filename, albumUUID)
+		if err == nil {
+			return file, nil
+		}
+		lastErr = err
+		if attempt < uploadAttempts {
+			log.Printf("Upload attempt %d/%d for %s failed: %v", attempt, uploadAttempts, filename, err)
+			time.Sleep(uploadRetryBackoff * time.Duration(attempt))
+		}
+	}
+	return nil, lastErr
+}
+
+// queueRetry stores a failed upload so the retry job can pick it up later.
+func (s *ChibisafeService) queueRetry(postID int, filePath, filename, albumUUID string, tagUUIDs []string, uploadErr error) {
+	if s.retryQueue == nil {
+		return
+	}
+
+	var tags []string
+	for _, tag := range tagUUIDs {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	item := &model.ChibisafeRetry{
+		PostID:        postID,
+		LocalFilePath: filePath,
+		Filename:      filename,
+		AlbumUUID:     albumUUID,
+		TagUUIDs:      tags,
+		NextAttemptAt: time.Now().Add(s.retryInterval),
+		Error:         uploadErr.Error(),
+	}
+	if err := s.retryQueue.Enqueue(item); err != nil {
+		log.Printf("Error queueing retry for %s: %v", filename, err)
+		return
+	}
+	log.Printf("Queued %s for a later upload retry", filename)
+}
+
+// PendingRetries reports whether any upload of the post is still waiting in
+// the retry queue, in which case its local files must be kept.
+func (s *ChibisafeService) PendingRetries(postID int) bool {
+	if s.retryQueue == nil {
+		return false
+	}
+	count, err := s.retryQueue.CountByPostID(postID)
+	if err != nil {
+		log.Printf("Error checking upload retries for post %d: %v", postID, err)
+		return true
+	}
+	return count > 0
+}
+
+// RetryUpload makes one more attempt at a queued upload and applies its tags
+// on success.
+func (s *ChibisafeService) RetryUpload(item model.ChibisafeRetry) (*UploadedFile, error) {
+	if _, err := os.Stat(item.LocalFilePath); err != nil {
+		return nil, fmt.Errorf("local file unavailable: %w", err)
+	}
+
+	file, err := s.uploadFile(item.LocalFilePath, item.Filename, item.AlbumUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordUpload(item.PostID, filepath.Base(item.LocalFilePath), file)
+	if s.fileHashRepo != nil {
+		if checksum, err := fileSHA256(item.LocalFilePath); err == nil {
+			s.recordFileHash(checksum, file)
+		}
+	}
+
+	for _, tagUUID := range item.TagUUIDs {
+		if err := s.addTagToFile(file.UUID, tagUUID); err != nil {
+			log.Printf("Error adding tag %s to file %s: %v", tagUUID, item.Filename, err)
+		}
+	}
+	return file, nil
+}
+
+// recordUpload stores an upload of the post. localName is the name of the
+// archived file it was made from, empty for generated files like thumbnails.
+func (s *ChibisafeService) recordUpload(postID int, localName string, file *UploadedFile) {
+	s.lastUpload.record()
+	if s.uploadRepo == nil || postID == 0 {
+		return
+	}
+	upload := &model.Upload{PostID: postID, Name: file.Name, LocalName: localName, UUID: file.UUID, URL: file.URL}
+	if err := s.uploadRepo.Create(upload); err != nil {
+		log.Printf("Error recording upload %s: %v", file.Name, err)
+	}
+}
+
+func (s *ChibisafeService) uploadFile(filePath, filename, albumUUID string) (*UploadedFile, error) {
 	settings, err := s.getSettings()
 	if err != nil {
 		log.Printf("Warning: Could not get Chibisafe settings, falling back to direct upload: %v", err)
@@ -436,7 +1048,7 @@ func (s *ChibisafeService) getSignedURL(filename string, fileSize int64, content
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", s.apiKey)
+	req.Header.Set("x-api-key", s.currentAPIKey())
 
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -493,7 +1105,7 @@ func (s *ChibisafeService) uploadToS3(signedURL string, filePath string, content
 	return nil
 }
 
-func (s *ChibisafeService) processUpload(identifier, filename, contentType, albumUUID string) (string, error) {
+func (s *ChibisafeService) processUpload(identifier, filename, contentType, albumUUID string) (*UploadedFile, error) {
 	reqBody := map[string]string{
 		"identifier": identifier,
 		"name":       filename,
@@ -502,17 +1114,17 @@ func (s *ChibisafeService) processUpload(identifier, filename, contentType, albu
 
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	processURL := fmt.Sprintf("%s/api/upload/process", s.apiURL)
 	req, err := http.NewRequest("POST", processURL, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return "", fmt.Errorf("failed to create process request: %w", err)
+		return nil, fmt.Errorf("failed to create process request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", s.apiKey)
+	req.Header.Set("x-api-key", s.currentAPIKey())
 
 	if albumUUID != "" {
 		req.Header.Set("albumuuid", albumUUID)
@@ -525,32 +1137,33 @@ func (s *ChibisafeService) processUpload(identifier, filename, contentType, albu
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to process upload: %w", err)
+		return nil, fmt.Errorf("failed to process upload: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	log.Printf("Process upload response - Status: %d, Body: %s", resp.StatusCode, string(body))
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return "", fmt.Errorf("process upload failed: %d - %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("process upload failed: %d - %s", resp.StatusCode, string(body))
 	}
 
 	var processResponse map[string]interface{}
 	if err := json.Unmarshal(body, &processResponse); err != nil {
-		return "", fmt.Errorf("failed to decode process response: %w", err)
+		return nil, fmt.Errorf("failed to decode process response: %w", err)
 	}
 
-	var fileUUID string
+	var fileUUID, fileURL string
 
 	if file, ok := processResponse["file"].(map[string]interface{}); ok {
 		if uuid, ok := file["uuid"].(string); ok {
 			fileUUID = uuid
 		}
+		fileURL = uploadedFileURL(file)
 	}
 
 	if fileUUID == "" {
@@ -565,23 +1178,38 @@ func (s *ChibisafeService) processUpload(identifier, filename, contentType, albu
 				if uuid, ok := file["uuid"].(string); ok {
 					fileUUID = uuid
 				}
+				fileURL = uploadedFileURL(file)
 			}
 		}
 	}
 
 	if fileUUID == "" {
 		log.Printf("WARNING: Could not extract file UUID from response: %s", string(body))
-		return "", fmt.Errorf("file UUID not found in response")
+		return nil, fmt.Errorf("file UUID not found in response")
+	}
+
+	if fileURL == "" {
+		fileURL = uploadedFileURL(processResponse)
 	}
 
 	log.Printf("Successfully processed upload: %s", fileUUID)
-	return fileUUID, nil
+	return &UploadedFile{Name: filename, UUID: fileUUID, URL: fileURL}, nil
 }
 
-func (s *ChibisafeService) uploadFileS3(filePath, filename, albumUUID string) (string, error) {
+// uploadedFileURL picks the public link out of a Chibisafe file object.
+func uploadedFileURL(file map[string]interface{}) string {
+	for _, key := range []string{"publicUrl", "url"} {
+		if url, ok := file[key].(string); ok && url != "" {
+			return url
+		}
+	}
+	return ""
+}
+
+func (s *ChibisafeService) uploadFileS3(filePath, filename, albumUUID string) (*UploadedFile, error) {
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to stat file: %w", err)
+		return nil, fmt.Errorf("failed to stat file: %w", err)
 	}
 
 	contentType := s.getContentType(filePath, filename)
@@ -591,34 +1219,34 @@ func (s *ChibisafeService) uploadFileS3(filePath, filename, albumUUID string) (s
 
 	signedURL, identifier, err := s.getSignedURL(filename, fileInfo.Size(), contentType)
 	if err != nil {
-		return "", fmt.Errorf("failed to get signed URL: %w", err)
+		return nil, fmt.Errorf("failed to get signed URL: %w", err)
 	}
 
 	if err := s.uploadToS3(signedURL, filePath, contentType); err != nil {
-		return "", fmt.Errorf("failed to upload to S3: %w", err)
+		return nil, fmt.Errorf("failed to upload to S3: %w", err)
 	}
 
-	fileUUID, err := s.processUpload(identifier, filename, contentType, albumUUID)
+	uploaded, err := s.processUpload(identifier, filename, contentType, albumUUID)
 	if err != nil {
-		return "", fmt.Errorf("failed to process upload: %w", err)
+		return nil, fmt.Errorf("failed to process upload: %w", err)
 	}
 
 	log.Printf("Successfully uploaded file via S3: %s -> UUID: %s",
-		filename, fileUUID)
+		filename, uploaded.UUID)
 
-	return fileUUID, nil
+	return uploaded, nil
 }
 
-func (s *ChibisafeService) uploadFileDirect(filePath, filename, albumUUID string) (string, error) {
+func (s *ChibisafeService) uploadFileDirect(filePath, filename, albumUUID string) (*UploadedFile, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer file.Close()
 
 	fileInfo, err := file.Stat()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	var buf bytes.Buffer
@@ -638,24 +1266,24 @@ func (s *ChibisafeService) uploadFileDirect(filePath, filename, albumUUID string
 
 	part, err := writer.CreatePart(headers)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if _, err := io.Copy(part, file); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if err := writer.Close(); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	req, err := http.NewRequest("POST", s.apiURL+"/api/upload", &buf)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("x-api-key", s.apiKey)
+	req.Header.Set("x-api-key", s.currentAPIKey())
 	req.Header.Set("albumuuid", albumUUID)
 
 	log.Printf("Direct upload request headers: Content-Type=%s, albumuuid=%s",
@@ -663,24 +1291,24 @@ func (s *ChibisafeService) uploadFileDirect(filePath, filename, albumUUID string
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
 		log.Printf("Direct upload failed for %s: status=%d, body=%s", filename, resp.StatusCode, string(body))
-		return "", fmt.Errorf("upload failed: %d - %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("upload failed: %d - %s", resp.StatusCode, string(body))
 	}
 
 	var response model.ChibisafeUploadResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	log.Printf("Successfully uploaded file via direct upload: %s (%s) -> UUID: %s, Public URL: %s",
 		response.Name, filename, response.UUID, response.PublicURL)
-	return response.UUID, nil
+	return &UploadedFile{Name: filename, UUID: response.UUID, URL: response.PublicURL}, nil
 }
 
 func (s *ChibisafeService) addTagToFile(fileUUID, tagUUID string) error {
@@ -691,7 +1319,7 @@ func (s *ChibisafeService) addTagToFile(fileUUID, tagUUID string) error {
 		return err
 	}
 
-	req.Header.Set("x-api-key", s.apiKey)
+	req.Header.Set("x-api-key", s.currentAPIKey())
 
 	resp, err := s.client.Do(req)
 	if err != nil {
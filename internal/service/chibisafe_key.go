@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+const (
+	// chibisafeKeyReloadInterval is how often WatchAPIKey looks for a new key.
+	chibisafeKeyReloadInterval = 5 * time.Minute
+	// chibisafeKeyRefreshTimeout bounds a request to CHIBISAFE_API_KEY_REFRESH_URL.
+	chibisafeKeyRefreshTimeout = 30 * time.Second
+)
+
+// ReadAPIKeyFile returns the key stored in a file, ignoring surrounding
+// whitespace such as a trailing newline.
+func ReadAPIKeyFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read API key file: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("API key file %s is empty", path)
+	}
+	return key, nil
+}
+
+// WatchAPIKey reloads the API key every 5 minutes and whenever the process
+// receives SIGUSR2, from CHIBISAFE_API_KEY_FILE or else from
+// CHIBISAFE_API_KEY_REFRESH_URL, until ctx is done. It returns immediately
+// when neither is configured.
+func (s *ChibisafeService) WatchAPIKey(ctx context.Context) {
+	if s.apiKeyFile == "" && s.apiKeyRefreshURL == "" {
+		return
+	}
+
+	reload := make(chan os.Signal, 1)
+	if len(apiKeyReloadSignals) > 0 {
+		signal.Notify(reload, apiKeyReloadSignals...)
+		defer signal.Stop(reload)
+	}
+
+	ticker := time.NewTicker(chibisafeKeyReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case sig := <-reload:
+			log.Printf("Received %s, reloading the Chibisafe API key", sig)
+		}
+
+		if err := s.reloadAPIKey(ctx); err != nil {
+			log.Printf("Error reloading the Chibisafe API key, keeping the current one: %v", err)
+		}
+	}
+}
+
+func (s *ChibisafeService) reloadAPIKey(ctx context.Context) error {
+	var key string
+	var err error
+	if s.apiKeyFile != "" {
+		key, err = ReadAPIKeyFile(s.apiKeyFile)
+	} else {
+		key, err = s.fetchAPIKey(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.settingsMutex.Lock()
+	changed := key != s.apiKey
+	s.apiKey = key
+	s.settingsMutex.Unlock()
+
+	if changed {
+		log.Printf("Chibisafe API key rotated")
+	}
+	return nil
+}
+
+// fetchAPIKey asks CHIBISAFE_API_KEY_REFRESH_URL for the current key,
+// authenticating with the key in use as a Bearer token. The endpoint may answer
+// with {"api_key": "..."} or with the bare key as plain text.
+func (s *ChibisafeService) fetchAPIKey(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, chibisafeKeyRefreshTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.apiKeyRefreshURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create key refresh request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.currentAPIKey())
+	req.Header.Set("Accept", "application/json, text/plain")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("key refresh request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("failed to read key refresh response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("key refresh failed: %d - %s", resp.StatusCode, string(body))
+	}
+
+	key := strings.TrimSpace(string(body))
+	if strings.HasPrefix(key, "{") {
+		var payload struct {
+			APIKey string `json:"api_key"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return "", fmt.Errorf("failed to decode key refresh response: %w", err)
+		}
+		key = strings.TrimSpace(payload.APIKey)
+	}
+	if key == "" {
+		return "", fmt.Errorf("key refresh response contains no key")
+	}
+	return key, nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package service
+
+import "os"
+
+// apiKeyReloadSignals is empty where SIGUSR2 doesn't exist; the key is only
+// reloaded on the polling interval.
+var apiKeyReloadSignals []os.Signal
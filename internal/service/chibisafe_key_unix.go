@@ -0,0 +1,11 @@
+//go:build unix
+
+package service
+
+import (
+	"os"
+	"syscall"
+)
+
+// apiKeyReloadSignals make WatchAPIKey reload the key immediately.
+var apiKeyReloadSignals = []os.Signal{syscall.SIGUSR2}
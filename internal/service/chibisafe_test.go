@@ -0,0 +1,168 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"lewdarchive/internal/model"
+)
+
+func newPinTestServer(t *testing.T) (*httptest.Server, []byte) {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+	sum := sha256.Sum256(srv.Certificate().Raw)
+	return srv, sum[:]
+}
+
+func TestChibisafeCertPin(t *testing.T) {
+	srv, pin := newPinTestServer(t)
+	wrongPin := sha256.Sum256([]byte("another certificate"))
+
+	tests := []struct {
+		name    string
+		cfg     ChibisafeConfig
+		wantErr string
+	}{
+		{"pin match", ChibisafeConfig{APIURL: srv.URL, InsecureTLS: true, CertPinSHA256: pin}, ""},
+		{"pin mismatch", ChibisafeConfig{APIURL: srv.URL, InsecureTLS: true, CertPinSHA256: wrongPin[:]}, "does not match CHIBISAFE_CERT_PIN_SHA256"},
+		// The pin adds to certificate verification unless InsecureTLS is set.
+		{"pin match, untrusted CA", ChibisafeConfig{APIURL: srv.URL, CertPinSHA256: pin}, "certificate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := newChibisafeClient(tt.cfg).Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Get: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("Get: got nil error, want %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("Get: %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChibisafeCertPinOnlyAppliesToAPIHost(t *testing.T) {
+	api, _ := newPinTestServer(t)
+	storage, _ := newPinTestServer(t)
+	wrongPin := sha256.Sum256([]byte("another certificate"))
+
+	client := newChibisafeClient(ChibisafeConfig{APIURL: api.URL, InsecureTLS: true, CertPinSHA256: wrongPin[:]})
+	if _, err := client.Get(api.URL); err == nil {
+		t.Error("API host: got nil error despite a mismatching pin")
+	}
+	resp, err := client.Get(storage.URL)
+	if err != nil {
+		t.Fatalf("other host: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestParseCertPin(t *testing.T) {
+	sum := sha256.Sum256([]byte("cert"))
+	hexPin := hex.EncodeToString(sum[:])
+	var colons []string
+	for i := 0; i < len(hexPin); i += 2 {
+		colons = append(colons, strings.ToUpper(hexPin[i:i+2]))
+	}
+
+	for _, raw := range []string{hexPin, strings.Join(colons, ":"), " " + hexPin + "\n"} {
+		pin, err := ParseCertPin(raw)
+		if err != nil || hex.EncodeToString(pin) != hexPin {
+			t.Errorf("ParseCertPin(%q) = %x, %v, want %s", raw, pin, err, hexPin)
+		}
+	}
+	if pin, err := ParseCertPin(""); pin != nil || err != nil {
+		t.Errorf("ParseCertPin(\"\") = %x, %v, want no pin", pin, err)
+	}
+	for _, raw := range []string{"zz", hexPin[:32]} {
+		if _, err := ParseCertPin(raw); err == nil {
+			t.Errorf("ParseCertPin(%q): got nil error", raw)
+		}
+	}
+}
+
+// newAlbumServer fakes the Chibisafe album API, creating albums on demand.
+// Albums named in failing can neither be found nor created.
+func newAlbumServer(t *testing.T, failing ...string) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	albums := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/albums":
+			name := r.URL.Query().Get("search")
+			for _, f := range failing {
+				if strings.EqualFold(f, name) {
+					http.Error(w, "unavailable", http.StatusServiceUnavailable)
+					return
+				}
+			}
+			var found []model.ChibisafeAlbum
+			if uuid, ok := albums[strings.ToLower(name)]; ok {
+				found = append(found, model.ChibisafeAlbum{UUID: uuid, Name: name})
+			}
+			json.NewEncoder(w).Encode(model.ChibisafeAlbumsResponse{Albums: found})
+		case "/api/album/create":
+			var req model.ChibisafeCreateAlbumRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			uuid := "uuid-" + strings.ToLower(req.Name)
+			albums[strings.ToLower(req.Name)] = uuid
+			json.NewEncoder(w).Encode(model.ChibisafeCreateAlbumResponse{Album: model.ChibisafeAlbum{UUID: uuid, Name: req.Name}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResolveTargetAlbums(t *testing.T) {
+	srv := newAlbumServer(t, "Broken", "Patreon")
+	cfg := ChibisafeConfig{
+		APIURL: srv.URL,
+		APIKey: "key",
+		ExtraAlbums: []ExtraAlbum{
+			{Name: "All 2024", AddAllPosts: true},
+			{Name: "Pixiv Only", Categories: []string{"pixiv"}},
+			{Name: "Broken", AddAllPosts: true},
+			{Name: "fanbox", Categories: []string{"Fanbox"}},
+		},
+	}
+	s := NewChibisafeService(cfg)
+
+	tests := []struct {
+		category string
+		want     []string
+	}{
+		{"Pixiv", []string{"uuid-pixiv", "uuid-all 2024", "uuid-pixiv only"}},
+		// An extra album that is the category album is not uploaded twice.
+		{"Fanbox", []string{"uuid-fanbox", "uuid-all 2024"}},
+		{"Patreon", nil},
+	}
+	for _, tt := range tests {
+		if got := s.resolveTargetAlbums(tt.category, cfg); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("resolveTargetAlbums(%q) = %q, want %q", tt.category, got, tt.want)
+		}
+	}
+
+	if got := s.resolveTargetAlbums("Pixiv", ChibisafeConfig{}); !reflect.DeepEqual(got, []string{"uuid-pixiv"}) {
+		t.Errorf("resolveTargetAlbums without extra albums = %q, want only the category album", got)
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+
+	"lewdarchive/internal/model"
+)
+
+// DeleteOptions selects what DeletePost removes besides the post's rows and
+// archive directory.
+type DeleteOptions struct {
+	// PurgeRemote also deletes the post's uploads from Chibisafe.
+	PurgeRemote bool
+	// DryRun only reports what would be deleted.
+	DryRun bool
+}
+
+// DeleteSummary reports what DeletePost removed, or would remove on a dry run.
+// Chibisafe files are identified by UUID; SharedRemoteFiles are kept because
+// other posts reuse them.
+type DeleteSummary struct {
+	Hash              string            `json:"hash"`
+	DryRun            bool              `json:"dry_run"`
+	ArchiveDir        string            `json:"archive_dir,omitempty"`
+	LocalFiles        []string          `json:"local_files"`
+	RemoteFiles       []string          `json:"remote_files"`
+	SharedRemoteFiles []string          `json:"shared_remote_files,omitempty"`
+	RemoteErrors      map[string]string `json:"remote_errors,omitempty"`
+	DatabaseRows      map[string]int64  `json:"database_rows"`
+}
+
+// ErrRemotePurgeIncomplete is returned by DeletePost when some Chibisafe files
+// could not be deleted. The post is kept so that the deletion can be retried.
+var ErrRemotePurgeIncomplete = errors.New("some Chibisafe files could not be deleted")
+
+// DeletePost removes a post: its Chibisafe uploads when purging, then its
+// archive directory, then its database rows. The rows go last so that a
+// deletion that fails halfway can be run again.
+func (s *ArchiveService) DeletePost(ctx context.Context, post *model.Post, opts DeleteOptions) (*DeleteSummary, error) {
+	summary := &DeleteSummary{
+		Hash:        post.Hash,
+		DryRun:      opts.DryRun,
+		LocalFiles:  []string{},
+		RemoteFiles: []string{},
+	}
+
+	archiveDir, err := s.ArchiveDirFor(post)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if s.isBaseDir(archiveDir) {
+			return nil, fmt.Errorf("refusing to delete archive root %s", archiveDir)
+		}
+		summary.ArchiveDir = archiveDir
+		for name := range listArchivedFiles(archiveDir) {
+			summary.LocalFiles = append(summary.LocalFiles, name)
+		}
+		sort.Strings(summary.LocalFiles)
+	}
+
+	if opts.PurgeRemote {
+		if !s.UploadsEnabled() {
+			return nil, fmt.Errorf("chibisafe is not configured")
+		}
+		own, shared, err := s.chibisafeService.PostFiles(post.ID)
+		if err != nil {
+			return nil, err
+		}
+		summary.SharedRemoteFiles = shared
+		if opts.DryRun {
+			summary.RemoteFiles = append(summary.RemoteFiles, own...)
+			own = nil
+		}
+		for _, uuid := range own {
+			if err := s.chibisafeService.DeleteFile(ctx, uuid); err != nil {
+				if summary.RemoteErrors == nil {
+					summary.RemoteErrors = make(map[string]string)
+				}
+				summary.RemoteErrors[uuid] = err.Error()
+				continue
+			}
+			summary.RemoteFiles = append(summary.RemoteFiles, uuid)
+		}
+		if len(summary.RemoteErrors) > 0 {
+			return summary, ErrRemotePurgeIncomplete
+		}
+	}
+
+	if opts.DryRun {
+		if summary.DatabaseRows, err = s.postRepo.CountRows(post.ID); err != nil {
+			return nil, err
+		}
+		return summary, nil
+	}
+
+	if summary.ArchiveDir != "" {
+		if err := s.cleanupDirectory(summary.ArchiveDir); err != nil {
+			return summary, err
+		}
+		if _, err := os.Stat(summary.ArchiveDir); err == nil {
+			return summary, fmt.Errorf("archive directory %s could not be removed", summary.ArchiveDir)
+		}
+		s.UpdateDiskUsage()
+	}
+
+	if summary.DatabaseRows, err = s.postRepo.Delete(post.ID); err != nil {
+		return summary, err
+	}
+	log.Printf("Deleted post %s: %d local files, %d Chibisafe files", post.Hash, len(summary.LocalFiles), len(summary.RemoteFiles))
+	return summary, nil
+}
@@ -2,28 +2,163 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
-	"regexp"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"golang.org/x/sync/singleflight"
+
 	"lewdarchive/internal/model"
+	"lewdarchive/internal/repository"
+	"lewdarchive/internal/utils"
 )
 
+const (
+	discordFlushInterval = 5 * time.Second
+	discordMaxEmbeds     = 10
+	discordMaxEmbedChars = 6000
+	// discordRequestTimeout bounds every request to Discord.
+	discordRequestTimeout = 30 * time.Second
+	// discordMaxRateLimitRetries is how often a batch is sent again after
+	// Discord answered 429 before it is dropped.
+	discordMaxRateLimitRetries = 3
+
+	discordMaxTitleLength       = 256
+	discordMaxAuthorLength      = 256
+	discordMaxDescriptionLength = 4096
+)
+
+// discordPreviewTimeout bounds fetching the linked pages of a whole flush for
+// preview images, so one slow site can't hold back the batch.
+var discordPreviewTimeout = 3 * time.Second
+
 type DiscordService struct {
-	webhookURL string
+	webhookURL        string
+	categoryWebhooks  map[string]string
+	spoilerCategories map[string]bool
+	categoryColors    map[string]int
+	categoryIcons     map[string]string
+	postRepo          *repository.PostRepository
+	miniflux          *MinifluxService
+	pending           []*queuedEmbed
+	sending           []*queuedEmbed
+	pendingMu         sync.Mutex
+	icons             map[int]cachedFeedIcon
+	iconFiles         map[string]*FeedIcon
+	iconsMu           sync.Mutex
+	forumMode         bool
+	forumThreads      map[string]string
+	forumMu           sync.Mutex
+	forumCreate       singleflight.Group
+	forumThreadRepo   *repository.ForumThreadRepository
+	client            *http.Client
+	imageProxy        ImageProxy
+	lastSent          successClock
 }
 
-func NewDiscordService(webhookURL string) *DiscordService {
-	if webhookURL == "" {
+type DiscordConfig struct {
+	WebhookURL        string
+	CategoryWebhooks  map[string]string
+	SpoilerCategories []string
+	// CategoryColors and CategoryIcons override the built-in per-category
+	// embed colors and footer icons; "default" applies to unknown categories.
+	CategoryColors map[string]int
+	CategoryIcons  map[string]string
+	// Miniflux, when its API is configured, supplies feed icons; otherwise
+	// they are looked up in the feed XML.
+	Miniflux *MinifluxService
+	// ForumMode posts into one thread per author, for webhooks of forum
+	// channels.
+	ForumMode bool
+	// ForumThreads remembers the threads across restarts; nil keeps them in
+	// memory only.
+	ForumThreads *repository.ForumThreadRepository
+	// ImageProxy rewrites preview image URLs; nil leaves them untouched.
+	ImageProxy ImageProxy
+}
+
+// DiscordResponse describes how Discord answered a webhook request.
+type DiscordResponse struct {
+	StatusCode int
+	MessageID  string
+	// RetryAfter is how long Discord asked to wait when it answered 429.
+	RetryAfter time.Duration
+}
+
+// ErrDiscordMessageNotFound is returned when editing a message that no longer exists.
+var ErrDiscordMessageNotFound = fmt.Errorf("discord message not found")
+
+type queuedEmbed struct {
+	feed        model.Feed
+	entry       model.Entry
+	publishedAt time.Time
+	imageURL    string
+	// result and applied, the result already in the sent embed, are guarded
+	// by pendingMu.
+	result  *ArchiveResult
+	applied *ArchiveResult
+}
+
+// feedIconCacheTTL is how long an icon fetched from Miniflux, or its absence,
+// is reused before asking again.
+const feedIconCacheTTL = 24 * time.Hour
+
+type cachedFeedIcon struct {
+	name      string
+	fetchedAt time.Time
+}
+
+type discordAttachment struct {
+	ID       int    `json:"id"`
+	Filename string `json:"filename"`
+}
+
+type discordMessage struct {
+	ID     string  `json:"id"`
+	Embeds []Embed `json:"embeds"`
+}
+
+func NewDiscordService(cfg DiscordConfig, postRepo *repository.PostRepository) *DiscordService {
+	if cfg.WebhookURL == "" && len(cfg.CategoryWebhooks) == 0 {
 		return nil
 	}
-	return &DiscordService{webhookURL: webhookURL}
+	s := &DiscordService{
+		webhookURL:        cfg.WebhookURL,
+		categoryWebhooks:  cfg.CategoryWebhooks,
+		spoilerCategories: make(map[string]bool),
+		categoryColors:    overlayColors(cfg.CategoryColors),
+		categoryIcons:     overlayIcons(cfg.CategoryIcons),
+		postRepo:          postRepo,
+		miniflux:          cfg.Miniflux,
+		icons:             make(map[int]cachedFeedIcon),
+		iconFiles:         make(map[string]*FeedIcon),
+		forumMode:         cfg.ForumMode,
+		forumThreads:      make(map[string]string),
+		forumThreadRepo:   cfg.ForumThreads,
+		client:            &http.Client{Timeout: discordRequestTimeout},
+		imageProxy:        cfg.ImageProxy,
+	}
+	if s.imageProxy == nil {
+		s.imageProxy = NoopProxy{}
+	}
+	for _, category := range cfg.SpoilerCategories {
+		s.spoilerCategories[category] = true
+	}
+	go s.flushLoop()
+	return s
 }
 
 type RSSFeed struct {
@@ -42,18 +177,19 @@ type AtomFeed struct {
 }
 
 type DiscordEmbed struct {
-	Embeds      []Embed     `json:"embeds"`
-	Attachments []struct{}  `json:"attachments"`
+	Embeds      []Embed             `json:"embeds"`
+	Attachments []discordAttachment `json:"attachments"`
 }
 
 type Embed struct {
-	Title     string      `json:"title"`
-	URL       string      `json:"url"`
-	Color     int         `json:"color"`
-	Author    EmbedAuthor `json:"author"`
-	Footer    EmbedFooter `json:"footer"`
-	Timestamp string      `json:"timestamp"`
-	Image     EmbedImage  `json:"image"`
+	Title       string      `json:"title"`
+	Description string      `json:"description,omitempty"`
+	URL         string      `json:"url"`
+	Color       int         `json:"color"`
+	Author      EmbedAuthor `json:"author"`
+	Footer      EmbedFooter `json:"footer"`
+	Timestamp   string      `json:"timestamp,omitempty"`
+	Image       *EmbedImage `json:"image,omitempty"`
 }
 
 type EmbedAuthor struct {
@@ -72,6 +208,10 @@ type EmbedImage struct {
 }
 
 func getIconURL(feedURL string) string {
+	if feedURL == "" {
+		return ""
+	}
+
 	resp, err := http.Get(feedURL)
 	if err != nil {
 		log.Printf("Error fetching feed: %v", err)
@@ -107,57 +247,11 @@ func getIconURL(feedURL string) string {
 	return ""
 }
 
-func extractImageFromContent(content string) string {
-	imgRegex := regexp.MustCompile(`<img[^>]+src="([^"]+)"`)
-	matches := imgRegex.FindAllStringSubmatch(content, -1)
-	
-	for _, match := range matches {
-		if len(match) > 1 {
-			url := match[1]
-			if isImageURL(url) {
-				log.Printf("Found image from <img> tag: %s", url)
-				return url
-			}
-		}
-	}
-	
-	linkRegex := regexp.MustCompile(`<a[^>]+href="([^"]+\.(?:jpg|jpeg|png|gif|webp|bmp|svg))"`)
-	matches = linkRegex.FindAllStringSubmatch(content, -1)
-	
-	for _, match := range matches {
-		if len(match) > 1 {
-			url := match[1]
-			log.Printf("Found image from <a> tag: %s", url)
-			return url
-		}
-	}
-	
-	generalImageRegex := regexp.MustCompile(`https?://[^\s"<>]+\.(?:jpg|jpeg|png|gif|webp|bmp|svg|tiff)`)
-	matches = generalImageRegex.FindAllStringSubmatch(content, -1)
-	
-	if len(matches) > 0 {
-		url := matches[0][0]
-		log.Printf("Found image from general URL pattern: %s", url)
-		return url
-	}
-	
-	log.Printf("No image found in content: %s", content)
-	return ""
-}
+const defaultEmbedImage = "https://i.imgur.com/5zcBLRc.png"
 
-func isImageURL(url string) bool {
-	imageExtensions := []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp", ".svg", ".tiff"}
-	urlLower := strings.ToLower(url)
-	
-	for _, ext := range imageExtensions {
-		if strings.Contains(urlLower, ext) {
-			return true
-		}
-	}
-	return false
-}
-
-var categoryColors = map[string]int{
+// defaultCategoryColors and defaultCategoryIcons are overlaid by
+// DISCORD_CATEGORY_COLORS and DISCORD_CATEGORY_ICONS.
+var defaultCategoryColors = map[string]int{
 	"default": 0xFF69B4,
 	"Patreon": 0xFF5900,
 	"Fanbox": 0xFAF18A,
@@ -167,7 +261,7 @@ var categoryColors = map[string]int{
 	"X": 0x000000,
 }
 
-var categoryIcons = map[string]string{
+var defaultCategoryIcons = map[string]string{
 	"default": "https://i.imgur.com/Nyh7tRG.png",
 	"Patreon": "https://i.imgur.com/07HA8CQ.png",
 	"Fanbox": "https://i.imgur.com/uXT06Tq.png",
@@ -177,86 +271,720 @@ var categoryIcons = map[string]string{
 	"X": "https://i.imgur.com/wXxVrmo.png",
 }
 
-func (s *DiscordService) SendEmbed(feed model.Feed, entry model.Entry) error {
-	iconURL := getIconURL(feed.FeedURL)
+// buildEmbed renders an entry, with imageURL as found by entryImageURL.
+func (s *DiscordService) buildEmbed(feed model.Feed, entry model.Entry, imageURL string) Embed {
+	iconURL := s.feedIconURL(feed)
 	categoryTitle := feed.Category.Title
 	if categoryTitle == "" {
 		categoryTitle = "Uncategorized"
 	}
 
-	categoryColor, ok := categoryColors[categoryTitle]
-	if !ok {
-		categoryColor = categoryColors["default"]
+	categoryColor := s.colorFor(categoryTitle)
+	categoryIcon := s.iconFor(categoryTitle)
+
+	if iconURL == "" {
+		iconURL = categoryIcon
 	}
 
-	categoryIcon, ok := categoryIcons[categoryTitle]
-	if !ok {
-		categoryIcon = categoryIcons["default"]
+	spoiler := imageURL != "" && s.spoilerCategories[categoryTitle]
+	if imageURL == "" {
+		imageURL = defaultEmbedImage
+	} else {
+		imageURL = s.imageProxy.ProxyURL(imageURL)
 	}
 
-	if iconURL == "" {
-		iconURL = categoryIcon
+	embed := Embed{
+		Title: utils.Truncate(utils.CleanText(entry.Title), discordMaxTitleLength),
+		URL:   entry.URL,
+		Color: categoryColor,
+		Author: EmbedAuthor{
+			Name:    utils.Truncate(utils.CleanText(entry.Author), discordMaxAuthorLength),
+			URL:     feed.SiteURL,
+			IconURL: iconURL,
+		},
+		Footer: EmbedFooter{
+			Text:    categoryTitle,
+			IconURL: categoryIcon,
+		},
+	}
+
+	// Discord rejects the whole message for a timestamp that isn't ISO8601,
+	// so anything unparseable is left out rather than passed through.
+	if publishedAt, ok := utils.ParsePublishedAt(entry.PublishedAt); ok {
+		embed.Timestamp = publishedAt.UTC().Format(time.RFC3339)
+	} else if entry.PublishedAt != "" {
+		log.Printf("Omitting unparseable timestamp %q for entry %s", entry.PublishedAt, entry.Hash)
+	}
+
+	// Spoilered previews are moved out of the image slot so Discord doesn't
+	// render them inline; the generic fallback image is never hidden.
+	if spoiler {
+		embed.Description = "||" + imageURL + "||"
+	} else {
+		embed.Image = &EmbedImage{URL: imageURL}
+	}
+
+	return embed
+}
+
+// feedIconURL prefers the icon Miniflux stores for the feed, uploaded along
+// with the message as an attachment, over parsing the feed XML.
+func (s *DiscordService) feedIconURL(feed model.Feed) string {
+	if name := s.minifluxIcon(feed.ID); name != "" {
+		return "attachment://" + name
+	}
+	return getIconURL(feed.FeedURL)
+}
+
+// minifluxIcon returns the attachment name of the feed's cached Miniflux icon,
+// fetching it when the cache is cold or stale, or "" when there is none.
+func (s *DiscordService) minifluxIcon(feedID int) string {
+	if s.miniflux == nil || !s.miniflux.IsConfigured() || feedID == 0 {
+		return ""
+	}
+
+	s.iconsMu.Lock()
+	cached, ok := s.icons[feedID]
+	s.iconsMu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < feedIconCacheTTL {
+		return cached.name
+	}
+
+	icon, err := s.miniflux.GetFeedIcon(context.Background(), feedID)
+	if err != nil {
+		log.Printf("Error fetching Miniflux icon for feed %d: %v", feedID, err)
+		return ""
+	}
+
+	cached = cachedFeedIcon{fetchedAt: time.Now()}
+	if icon != nil {
+		ext := ".png"
+		if exts, _ := mime.ExtensionsByType(icon.MimeType); len(exts) > 0 {
+			ext = exts[0]
+		}
+		cached.name = fmt.Sprintf("feed-icon-%d%s", feedID, ext)
+	}
+
+	s.iconsMu.Lock()
+	s.icons[feedID] = cached
+	if icon != nil {
+		s.iconFiles[cached.name] = icon
+	}
+	s.iconsMu.Unlock()
+	return cached.name
+}
+
+// iconAttachments collects the cached icons the embeds reference through
+// attachment:// URLs, once per file.
+func (s *DiscordService) iconAttachments(embeds []Embed) ([]string, []*FeedIcon) {
+	s.iconsMu.Lock()
+	defer s.iconsMu.Unlock()
+
+	var names []string
+	var icons []*FeedIcon
+	seen := make(map[string]bool)
+	for _, embed := range embeds {
+		name, ok := strings.CutPrefix(embed.Author.IconURL, "attachment://")
+		if !ok || seen[name] {
+			continue
+		}
+		if icon, ok := s.iconFiles[name]; ok {
+			seen[name] = true
+			names = append(names, name)
+			icons = append(icons, icon)
+		}
+	}
+	return names, icons
+}
+
+func (s *DiscordService) colorFor(categoryTitle string) int {
+	if color, ok := s.categoryColors[categoryTitle]; ok {
+		return color
+	}
+	return s.categoryColors["default"]
+}
+
+func (s *DiscordService) iconFor(categoryTitle string) string {
+	if icon, ok := s.categoryIcons[categoryTitle]; ok {
+		return icon
+	}
+	return s.categoryIcons["default"]
+}
+
+// overlayColors returns the built-in colors with overrides applied on top.
+func overlayColors(overrides map[string]int) map[string]int {
+	colors := make(map[string]int, len(defaultCategoryColors)+len(overrides))
+	for category, color := range defaultCategoryColors {
+		colors[category] = color
+	}
+	for category, color := range overrides {
+		colors[category] = color
+	}
+	return colors
+}
+
+// overlayIcons returns the built-in icons with overrides applied on top.
+func overlayIcons(overrides map[string]string) map[string]string {
+	icons := make(map[string]string, len(defaultCategoryIcons)+len(overrides))
+	for category, icon := range defaultCategoryIcons {
+		icons[category] = icon
+	}
+	for category, icon := range overrides {
+		icons[category] = icon
+	}
+	return icons
+}
+
+// webhookURLFor returns the destination webhook for a category, falling back
+// to DISCORD_WEBHOOK_URL. Entries are only batched together when they share a
+// destination.
+func (s *DiscordService) webhookURLFor(categoryTitle string) string {
+	if url, ok := s.categoryWebhooks[categoryTitle]; ok {
+		return url
+	}
+	return s.webhookURL
+}
+
+// Ping sends a HEAD request to the host of a configured webhook. Any HTTP
+// response counts as reachable; the webhook itself is not called.
+func (s *DiscordService) Ping(ctx context.Context) error {
+	webhookURL := s.webhookURL
+	for _, categoryWebhook := range s.categoryWebhooks {
+		if webhookURL == "" {
+			webhookURL = categoryWebhook
+		}
+	}
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.Scheme+"://"+u.Host, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("discord unreachable: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// SendEmbed sends a single embed immediately, bypassing the batching queue.
+func (s *DiscordService) SendEmbed(feed model.Feed, entry model.Entry) (*DiscordResponse, error) {
+	return s.SendEmbedTo(s.webhookURLFor(feed.Category.Title), feed, entry)
+}
+
+// SendEmbedTo sends a single embed immediately to the given webhook and
+// remembers the message so archive results can edit it later.
+func (s *DiscordService) SendEmbedTo(webhookURL string, feed model.Feed, entry model.Entry) (*DiscordResponse, error) {
+	webhookURL, err := s.destinationFor(webhookURL, entry.Author)
+	if err != nil {
+		return nil, err
+	}
+	embed := s.buildEmbed(feed, entry, entryImageURL(entry))
+	resp, err := s.postEmbeds(webhookURL, []Embed{embed})
+	if err != nil {
+		return resp, err
+	}
+	s.recordMessage(entry.Hash, webhookURL, resp.MessageID)
+
+	log.Printf("Discord notification sent for '%s'", entry.Title)
+	return resp, nil
+}
+
+// alertColor is the embed color of operational alerts.
+const alertColor = 0xE74C3C
+
+// SendAlert posts an operational error, e.g. a failed backup, to
+// DISCORD_WEBHOOK_URL.
+func (s *DiscordService) SendAlert(title, description string) error {
+	if s.webhookURL == "" {
+		return nil
+	}
+	embed := Embed{
+		Title:       utils.Truncate(title, discordMaxTitleLength),
+		Description: utils.Truncate(description, discordMaxDescriptionLength),
+		Color:       alertColor,
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Footer:      EmbedFooter{Text: "LewdArchive"},
+	}
+	webhookURL, err := s.destinationFor(s.webhookURL, discordAlertThread)
+	if err != nil {
+		return err
+	}
+	_, err = s.postEmbeds(webhookURL, []Embed{embed})
+	return err
+}
+
+// Enqueue schedules an entry for the next flush tick. Entries queued during the
+// same tick for the same webhook are coalesced into as few requests as possible.
+func (s *DiscordService) Enqueue(feed model.Feed, entry model.Entry) {
+	publishedAt, _ := utils.ParsePublishedAt(entry.PublishedAt)
+
+	s.pendingMu.Lock()
+	s.pending = append(s.pending, &queuedEmbed{feed: feed, entry: entry, publishedAt: publishedAt})
+	s.pendingMu.Unlock()
+}
+
+// Pending returns how many embeds wait for the next batch.
+func (s *DiscordService) Pending() int {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	return len(s.pending)
+}
+
+// LastSuccess returns when a message was last sent, nil if none was since
+// startup.
+func (s *DiscordService) LastSuccess() *time.Time {
+	return s.lastSent.get()
+}
+
+func (s *DiscordService) flushLoop() {
+	ticker := time.NewTicker(discordFlushInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.flush()
+	}
+}
+
+// flush sends the queued embeds. While it runs NotifyArchiveResult still finds
+// them in s.sending; results that arrive too late to be part of a sent embed
+// are applied by editing the message afterwards.
+func (s *DiscordService) flush() {
+	s.pendingMu.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.sending = pending
+	s.pendingMu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+	defer s.finishSending(pending)
+
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].publishedAt.Before(pending[j].publishedAt)
+	})
+	resolvePreviewImages(pending)
+
+	var destinations []string
+	byDestination := make(map[string][]*queuedEmbed)
+	for _, item := range pending {
+		dest, err := s.destinationFor(s.webhookURLFor(item.feed.Category.Title), item.entry.Author)
+		if err != nil {
+			log.Printf("Error finding the Discord forum thread for entry %s: %v", item.entry.Hash, err)
+			continue
+		}
+		if _, ok := byDestination[dest]; !ok {
+			destinations = append(destinations, dest)
+		}
+		byDestination[dest] = append(byDestination[dest], item)
 	}
 
-	var imageURL string
-	for _, enc := range entry.Enclosures {
-		if strings.HasPrefix(enc.MimeType, "image/") {
-			imageURL = enc.URL
+	var delay time.Duration
+	for _, dest := range destinations {
+		items := byDestination[dest]
+		if dest == "" {
+			log.Printf("No Discord webhook configured for category '%s', dropping %d notification(s)", items[0].feed.Category.Title, len(items))
+			continue
+		}
+		embeds := make([]Embed, len(items))
+		for i, item := range items {
+			embeds[i] = s.buildEmbed(item.feed, item.entry, item.imageURL)
+		}
+		s.pendingMu.Lock()
+		for i, item := range items {
+			if item.result != nil {
+				applyArchiveResult(&embeds[i], *item.result)
+			}
+			item.applied = item.result
+		}
+		s.pendingMu.Unlock()
+
+		retries := 0
+		for start := 0; start < len(embeds); {
+			end := nextBatchEnd(embeds, start)
+
+			time.Sleep(delay)
+			delay = discordFlushInterval
+
+			resp, err := s.postEmbeds(dest, embeds[start:end])
+			if resp != nil && resp.StatusCode == http.StatusTooManyRequests && retries < discordMaxRateLimitRetries {
+				retries++
+				delay = resp.RetryAfter
+				log.Printf("Discord rate limited %d notification(s), retrying in %s", end-start, delay)
+				continue
+			}
+			retries = 0
+			if err != nil {
+				for _, item := range items[start:end] {
+					log.Printf("Error sending Discord notification for entry %s: %v", item.entry.Hash, err)
+				}
+			} else {
+				for _, item := range items[start:end] {
+					log.Printf("Discord notification sent for '%s'", item.entry.Title)
+					s.recordMessage(item.entry.Hash, dest, resp.MessageID)
+				}
+			}
+			start = end
+		}
+	}
+}
+
+// finishSending stops tracking the items of a flush and applies the archive
+// results that arrived after their embeds were built.
+func (s *DiscordService) finishSending(items []*queuedEmbed) {
+	var late []ArchiveResult
+	s.pendingMu.Lock()
+	s.sending = nil
+	for _, item := range items {
+		if item.result != nil && item.result != item.applied {
+			late = append(late, *item.result)
+		}
+	}
+	s.pendingMu.Unlock()
+
+	for _, result := range late {
+		s.NotifyArchiveResult(context.Background(), result)
+	}
+}
+
+// resolvePreviewImages looks up the preview images of a flush in parallel,
+// giving up on the linked pages not fetched within discordPreviewTimeout.
+func resolvePreviewImages(items []*queuedEmbed) {
+	ctx, cancel := context.WithTimeout(context.Background(), discordPreviewTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, item := range items {
+		wg.Add(1)
+		go func(item *queuedEmbed) {
+			defer wg.Done()
+			item.imageURL = entryImageURLContext(ctx, item.entry)
+		}(item)
+	}
+	wg.Wait()
+}
+
+// nextBatchEnd returns the exclusive end index of the batch starting at start,
+// honoring Discord's per-message embed count and total character limits.
+func nextBatchEnd(embeds []Embed, start int) int {
+	end := start
+	total := 0
+	for end < len(embeds) && end-start < discordMaxEmbeds {
+		size := embedLength(embeds[end])
+		if end > start && total+size > discordMaxEmbedChars {
 			break
 		}
+		total += size
+		end++
 	}
-	if imageURL == "" {
-		imageURL = extractImageFromContent(entry.Content)
+	return end
+}
+
+func embedLength(e Embed) int {
+	return len([]rune(e.Title)) + len([]rune(e.Description)) + len([]rune(e.Author.Name)) + len([]rune(e.Footer.Text))
+}
+
+func (s *DiscordService) recordMessage(hash, webhookURL, messageID string) {
+	if s.postRepo == nil || messageID == "" {
+		return
 	}
-	if imageURL == "" {
-		imageURL = "https://i.imgur.com/5zcBLRc.png"
-	}
-
-	embed := DiscordEmbed{
-		Embeds: []Embed{{
-			Title: entry.Title,
-			URL:   entry.URL,
-			Color: categoryColor,
-			Author: EmbedAuthor{
-				Name:    entry.Author,
-				URL:     feed.SiteURL,
-				IconURL: iconURL,
-			},
-			Footer: EmbedFooter{
-				Text:    categoryTitle,
-				IconURL: categoryIcon,
-			},
-			Timestamp: entry.PublishedAt,
-			Image: EmbedImage{
-				URL: imageURL,
-			},
-		}},
-		Attachments: []struct{}{},
-	}
-
-	jsonData, err := json.Marshal(embed)
+	if err := s.postRepo.SetDiscordMessage(hash, webhookURL, messageID); err != nil {
+		log.Printf("Error storing Discord message ID for entry %s: %v", hash, err)
+	}
+}
+
+func (s *DiscordService) postEmbeds(webhookURL string, embeds []Embed) (*DiscordResponse, error) {
+	if webhookURL == "" {
+		return nil, fmt.Errorf("no Discord webhook configured")
+	}
+
+	names, icons := s.iconAttachments(embeds)
+	payload := DiscordEmbed{
+		Embeds:      embeds,
+		Attachments: []discordAttachment{},
+	}
+	for i, name := range names {
+		payload.Attachments = append(payload.Attachments, discordAttachment{ID: i, Filename: name})
+	}
+
+	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("error marshaling JSON: %v", err)
+		return nil, fmt.Errorf("error marshaling JSON: %v", err)
 	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("POST", s.webhookURL, bytes.NewBuffer(jsonData))
+	body, contentType := bytes.NewBuffer(jsonData), "application/json"
+	if len(icons) > 0 {
+		body, contentType, err = multipartPayload(jsonData, names, icons)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// wait=true makes Discord answer with the created message so its ID can
+	// be stored and the message edited later.
+	requestURL, err := webhookEndpoint(webhookURL, "", true)
 	if err != nil {
-		return fmt.Errorf("error creating request: %v", err)
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(req)
+	req, err := http.NewRequest("POST", requestURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	resp, err := s.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("error sending webhook: %v", err)
+		return nil, fmt.Errorf("error sending webhook: %v", err)
 	}
 	defer resp.Body.Close()
 
+	result := &DiscordResponse{StatusCode: resp.StatusCode}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		result.RetryAfter = discordRetryAfter(resp.Header, body)
+		return result, fmt.Errorf("rate limited by Discord, retry after %s", result.RetryAfter)
+	}
+	if resp.StatusCode == http.StatusBadRequest {
+		body, _ := io.ReadAll(resp.Body)
+		log.Printf("Discord rejected payload: %s - response: %s", string(jsonData), string(body))
+	}
 	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return result, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		var message discordMessage
+		if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+			log.Printf("Warning: could not decode Discord message response: %v", err)
+		}
+		result.MessageID = message.ID
+	}
+
+	s.lastSent.record()
+	return result, nil
+}
+
+// discordRetryAfter returns how long Discord asks to wait after a 429: the
+// retry_after field of the body in seconds, or else the Retry-After header.
+// It falls back to discordFlushInterval and never exceeds a minute.
+func discordRetryAfter(header http.Header, body []byte) time.Duration {
+	var rateLimit struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	seconds := 0.0
+	if err := json.Unmarshal(body, &rateLimit); err == nil && rateLimit.RetryAfter > 0 {
+		seconds = rateLimit.RetryAfter
+	} else if parsed, err := strconv.ParseFloat(header.Get("Retry-After"), 64); err == nil && parsed > 0 {
+		seconds = parsed
+	}
+	if seconds <= 0 {
+		return discordFlushInterval
+	}
+	return min(time.Duration(seconds*float64(time.Second)), time.Minute)
+}
+
+// multipartPayload wraps the JSON payload and the icon files in the multipart
+// form Discord expects when a message carries attachments.
+func multipartPayload(jsonData []byte, names []string, icons []*FeedIcon) (*bytes.Buffer, string, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	if err := writer.WriteField("payload_json", string(jsonData)); err != nil {
+		return nil, "", fmt.Errorf("error writing payload: %v", err)
+	}
+	for i, icon := range icons {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="files[%d]"; filename="%s"`, i, names[i]))
+		header.Set("Content-Type", icon.MimeType)
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, "", fmt.Errorf("error creating attachment: %v", err)
+		}
+		if _, err := part.Write(icon.Data); err != nil {
+			return nil, "", fmt.Errorf("error writing attachment: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", fmt.Errorf("error closing multipart body: %v", err)
+	}
+	return body, writer.FormDataContentType(), nil
+}
+
+// webhookEndpoint builds a webhook URL, optionally targeting an existing
+// message, while keeping query parameters such as thread_id intact.
+func webhookEndpoint(webhookURL, messageID string, wait bool) (string, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook URL: %v", err)
+	}
+
+	if messageID != "" {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/messages/" + messageID
+	}
+	if wait {
+		q := u.Query()
+		q.Set("wait", "true")
+		u.RawQuery = q.Encode()
+	}
+	return u.String(), nil
+}
+
+// EditEmbed rewrites the embed for entryURL inside a previously sent message.
+// Batched messages carry several embeds, so the message is fetched first and
+// only the matching embed is changed.
+func (s *DiscordService) EditEmbed(webhookURL, messageID, entryURL string, edit func(*Embed)) error {
+	messageURL, err := webhookEndpoint(webhookURL, messageID, false)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Get(messageURL)
+	if err != nil {
+		return fmt.Errorf("error fetching message: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrDiscordMessageNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code fetching message: %d", resp.StatusCode)
+	}
+
+	var message discordMessage
+	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+		return fmt.Errorf("error decoding message: %v", err)
+	}
+
+	found := false
+	for i := range message.Embeds {
+		if message.Embeds[i].URL == entryURL {
+			edit(&message.Embeds[i])
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("embed for %s not found in message %s", entryURL, messageID)
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{"embeds": message.Embeds})
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %v", err)
+	}
+
+	req, err := http.NewRequest("PATCH", messageURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	patchResp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error editing message: %v", err)
+	}
+	defer patchResp.Body.Close()
+
+	if patchResp.StatusCode == http.StatusNotFound {
+		return ErrDiscordMessageNotFound
+	}
+	if patchResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code editing message: %d", patchResp.StatusCode)
 	}
 
-	log.Printf("Discord notification sent for '%s'", entry.Title)
-	time.Sleep(5 * time.Second)
 	return nil
-}
\ No newline at end of file
+}
+
+// NotifyArchiveResult marks the original notification with the archive
+// outcome. Entries still waiting in the queue or being sent are updated in
+// place; otherwise the sent message is edited, falling back to a follow-up
+// message when the original can't be edited.
+func (s *DiscordService) NotifyArchiveResult(_ context.Context, result ArchiveResult) {
+	post := result.Post
+
+	s.pendingMu.Lock()
+	for _, items := range [][]*queuedEmbed{s.pending, s.sending} {
+		for _, item := range items {
+			if item.entry.Hash == post.Hash {
+				item.result = &result
+				s.pendingMu.Unlock()
+				return
+			}
+		}
+	}
+	s.pendingMu.Unlock()
+
+	if s.postRepo != nil {
+		if fresh, err := s.postRepo.GetByHash(post.Hash); err == nil {
+			post = fresh
+		}
+	}
+
+	edit := func(e *Embed) { applyArchiveResult(e, result) }
+
+	if post.DiscordMessageID != "" && post.DiscordWebhookURL != "" {
+		err := s.EditEmbed(post.DiscordWebhookURL, post.DiscordMessageID, post.URL, edit)
+		if err == nil {
+			log.Printf("Discord notification updated for '%s'", post.Title)
+			return
+		}
+		log.Printf("Error editing Discord message %s for entry %s, sending follow-up: %v", post.DiscordMessageID, post.Hash, err)
+	}
+
+	categoryTitle := post.CategoryTitle
+	if categoryTitle == "" {
+		categoryTitle = "Uncategorized"
+	}
+	followUp := Embed{
+		Title:  utils.Truncate(utils.CleanText(post.Title), discordMaxTitleLength),
+		URL:    post.URL,
+		Color:  s.colorFor(categoryTitle),
+		Author: EmbedAuthor{Name: utils.Truncate(utils.CleanText(post.Author), discordMaxAuthorLength), URL: post.SiteURL},
+		Footer: EmbedFooter{Text: categoryTitle},
+	}
+	edit(&followUp)
+
+	dest, err := s.destinationFor(s.webhookURLFor(post.CategoryTitle), post.Author)
+	if err != nil {
+		log.Printf("Error finding the Discord forum thread for entry %s: %v", post.Hash, err)
+		return
+	}
+	if _, err := s.postEmbeds(dest, []Embed{followUp}); err != nil {
+		log.Printf("Error sending Discord follow-up for entry %s: %v", post.Hash, err)
+	}
+}
+
+const maxChibisafeLinks = 3
+
+func applyArchiveResult(e *Embed, result ArchiveResult) {
+	if result.Success {
+		e.Footer.Text += " • ✅"
+	} else {
+		e.Footer.Text += " • ❌"
+	}
+
+	var links []string
+	for _, file := range result.UploadedFiles {
+		if file.URL == "" {
+			continue
+		}
+		if len(links) == maxChibisafeLinks {
+			links = append(links, fmt.Sprintf("+%d more", len(result.UploadedFiles)-maxChibisafeLinks))
+			break
+		}
+		links = append(links, fmt.Sprintf("[Chibisafe](%s)", file.URL))
+	}
+	if len(links) == 0 {
+		return
+	}
+
+	if e.Description != "" {
+		e.Description += "\n"
+	}
+	e.Description += strings.Join(links, " · ")
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"lewdarchive/internal/utils"
+)
+
+// discordMaxThreadNameLength is Discord's limit on forum post titles.
+const discordMaxThreadNameLength = 100
+
+// discordAlertThread is the forum thread receiving SendAlert messages.
+const discordAlertThread = "LewdArchive alerts"
+
+type forumThreadResponse struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+}
+
+// FindOrCreateForumThread returns the ID of the forum thread of an author on
+// DISCORD_WEBHOOK_URL, creating it on first use.
+func (s *DiscordService) FindOrCreateForumThread(authorName string) (string, error) {
+	return s.forumThread(s.webhookURL, authorName)
+}
+
+// forumThread returns the thread of an author in the forum channel of a
+// webhook. Webhooks can't list threads, so they are only known from creating
+// them: they are cached in memory and, with a repository, in the database so
+// that a restart keeps posting into the same threads.
+func (s *DiscordService) forumThread(webhookURL, authorName string) (string, error) {
+	if webhookURL == "" {
+		return "", fmt.Errorf("no Discord webhook configured")
+	}
+	threadName := utils.Truncate(utils.CleanText(authorName), discordMaxThreadNameLength)
+	if threadName == "" {
+		threadName = "Unknown"
+	}
+	key := webhookURL + "\x00" + threadName
+
+	if threadID, ok := s.cachedForumThread(key); ok {
+		return threadID, nil
+	}
+
+	// Concurrent messages for a new author share one lookup, so only one
+	// thread is created. forumMu is not held during the requests.
+	threadID, err, _ := s.forumCreate.Do(key, func() (interface{}, error) {
+		if threadID, ok := s.cachedForumThread(key); ok {
+			return threadID, nil
+		}
+		threadID, err := s.loadOrCreateForumThread(webhookURL, threadName)
+		if err != nil {
+			return "", err
+		}
+		s.forumMu.Lock()
+		s.forumThreads[key] = threadID
+		s.forumMu.Unlock()
+		return threadID, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return threadID.(string), nil
+}
+
+func (s *DiscordService) cachedForumThread(key string) (string, bool) {
+	s.forumMu.Lock()
+	defer s.forumMu.Unlock()
+	threadID, ok := s.forumThreads[key]
+	return threadID, ok
+}
+
+// loadOrCreateForumThread returns the thread recorded in the database, or
+// creates and records it.
+func (s *DiscordService) loadOrCreateForumThread(webhookURL, threadName string) (string, error) {
+	webhookID := discordWebhookID(webhookURL)
+	if s.forumThreadRepo != nil {
+		threadID, err := s.forumThreadRepo.Find(webhookID, threadName)
+		if err != nil {
+			return "", err
+		}
+		if threadID != "" {
+			return threadID, nil
+		}
+	}
+
+	threadID, err := s.createForumThread(webhookURL, threadName)
+	if err != nil {
+		return "", err
+	}
+	if s.forumThreadRepo != nil {
+		if err := s.forumThreadRepo.Save(webhookID, threadName, threadID); err != nil {
+			log.Printf("Error saving Discord forum thread %s for '%s': %v", threadID, threadName, err)
+		}
+	}
+	return threadID, nil
+}
+
+func (s *DiscordService) createForumThread(webhookURL, threadName string) (string, error) {
+	requestURL, err := webhookEndpoint(webhookURL, "", true)
+	if err != nil {
+		return "", err
+	}
+	jsonData, err := json.Marshal(map[string]string{
+		"content":     fmt.Sprintf("Posts by **%s**", threadName),
+		"thread_name": threadName,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshaling JSON: %v", err)
+	}
+
+	resp, err := s.client.Post(requestURL, "application/json", bytes.NewReader(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("error creating forum thread: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("unexpected status code creating forum thread: %d - %s", resp.StatusCode, string(body))
+	}
+	var message forumThreadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+		return "", fmt.Errorf("error decoding forum thread: %v", err)
+	}
+	if message.ChannelID == "" {
+		return "", fmt.Errorf("discord did not create a forum thread, is the webhook in a forum channel?")
+	}
+
+	log.Printf("Created Discord forum thread %s for '%s'", message.ChannelID, threadName)
+	return message.ChannelID, nil
+}
+
+// discordWebhookID returns the ID in a webhook URL,
+// https://discord.com/api/webhooks/<id>/<token>, which identifies the webhook
+// without its token. Other URLs are returned without their query.
+func discordWebhookID(webhookURL string) string {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return webhookURL
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, part := range parts {
+		if part == "webhooks" && i+1 < len(parts) {
+			return parts[i+1]
+		}
+	}
+	return u.Host + u.Path
+}
+
+// destinationFor returns where a message about the author goes: the webhook
+// itself, or in forum mode the webhook targeting the author's thread.
+func (s *DiscordService) destinationFor(webhookURL, authorName string) (string, error) {
+	if !s.forumMode || webhookURL == "" {
+		return webhookURL, nil
+	}
+	threadID, err := s.forumThread(webhookURL, authorName)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook URL: %v", err)
+	}
+	q := u.Query()
+	q.Set("thread_id", threadID)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"lewdarchive/internal/repository"
+	"lewdarchive/pkg/database"
+)
+
+// newForumServer fakes a forum channel webhook, opening a new thread for
+// every message posted with a thread_name.
+func newForumServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var created atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ThreadName string `json:"thread_name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ThreadName == "" {
+			http.Error(w, "expected a thread_name", http.StatusBadRequest)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		n := created.Add(1)
+		json.NewEncoder(w).Encode(forumThreadResponse{ID: fmt.Sprint("message", n), ChannelID: fmt.Sprint("thread", n)})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &created
+}
+
+func newForumThreadRepo(t *testing.T) *repository.ForumThreadRepository {
+	t.Helper()
+	db, err := database.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return repository.NewForumThreadRepository(db)
+}
+
+func TestForumThreadSurvivesRestart(t *testing.T) {
+	srv, created := newForumServer(t)
+	repo := newForumThreadRepo(t)
+	webhookURL := srv.URL + "/api/webhooks/123/secret-token"
+
+	first := NewDiscordService(DiscordConfig{WebhookURL: webhookURL, ForumMode: true, ForumThreads: repo}, nil)
+	threadID, err := first.FindOrCreateForumThread("Alice")
+	if err != nil {
+		t.Fatalf("FindOrCreateForumThread: %v", err)
+	}
+
+	restarted := NewDiscordService(DiscordConfig{WebhookURL: webhookURL, ForumMode: true, ForumThreads: repo}, nil)
+	again, err := restarted.FindOrCreateForumThread("Alice")
+	if err != nil {
+		t.Fatalf("FindOrCreateForumThread after restart: %v", err)
+	}
+	if again != threadID {
+		t.Errorf("thread after restart = %q, want %q", again, threadID)
+	}
+	if n := created.Load(); n != 1 {
+		t.Errorf("created %d threads, want 1", n)
+	}
+
+	stored, err := repo.Find("123", "Alice")
+	if err != nil || stored != threadID {
+		t.Errorf("repo.Find = %q, %v, want %q stored by webhook ID", stored, err, threadID)
+	}
+}
+
+func TestForumThreadCreatedOnceConcurrently(t *testing.T) {
+	srv, created := newForumServer(t)
+	s := NewDiscordService(DiscordConfig{WebhookURL: srv.URL + "/api/webhooks/123/token", ForumMode: true}, nil)
+
+	var wg sync.WaitGroup
+	ids := make([]string, 8)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id, err := s.FindOrCreateForumThread("Bob")
+			if err != nil {
+				t.Errorf("FindOrCreateForumThread: %v", err)
+			}
+			ids[i] = id
+		}(i)
+	}
+	wg.Wait()
+
+	if n := created.Load(); n != 1 {
+		t.Errorf("created %d threads, want 1", n)
+	}
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Errorf("got threads %q and %q for the same author", ids[0], id)
+		}
+	}
+}
+
+func TestForumThreadErrorIsNotCached(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(forumThreadResponse{ID: "message", ChannelID: "thread"})
+	}))
+	defer srv.Close()
+	s := NewDiscordService(DiscordConfig{WebhookURL: srv.URL + "/api/webhooks/123/token", ForumMode: true}, nil)
+
+	if _, err := s.FindOrCreateForumThread("Carol"); err == nil {
+		t.Fatal("FindOrCreateForumThread: got nil error from a failing webhook")
+	}
+	fail.Store(false)
+	if id, err := s.FindOrCreateForumThread("Carol"); err != nil || id != "thread" {
+		t.Errorf("FindOrCreateForumThread after recovery = %q, %v", id, err)
+	}
+}
+
+func TestDiscordWebhookID(t *testing.T) {
+	tests := map[string]string{
+		"https://discord.com/api/webhooks/123/token":         "123",
+		"https://discord.com/api/v10/webhooks/456/token?x=1": "456",
+		"https://example.com/hook?token=secret":              "example.com/hook",
+	}
+	for webhookURL, want := range tests {
+		if got := discordWebhookID(webhookURL); got != want {
+			t.Errorf("discordWebhookID(%q) = %q, want %q", webhookURL, got, want)
+		}
+	}
+}
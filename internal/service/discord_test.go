@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/repository"
+	"lewdarchive/pkg/database"
+)
+
+// embedOfLength returns an embed whose embedLength is n.
+func embedOfLength(n int) Embed {
+	return Embed{Description: strings.Repeat("a", n)}
+}
+
+func embedsOfLength(lengths ...int) []Embed {
+	embeds := make([]Embed, len(lengths))
+	for i, n := range lengths {
+		embeds[i] = embedOfLength(n)
+	}
+	return embeds
+}
+
+func TestNextBatchEnd(t *testing.T) {
+	tests := []struct {
+		name   string
+		embeds []Embed
+		start  int
+		want   int
+	}{
+		{"empty", nil, 0, 0},
+		{"single", embedsOfLength(10), 0, 1},
+		{"exactly max embeds", make([]Embed, discordMaxEmbeds), 0, discordMaxEmbeds},
+		{"one over max embeds", make([]Embed, discordMaxEmbeds+1), 0, discordMaxEmbeds},
+		{"second batch", make([]Embed, discordMaxEmbeds+1), discordMaxEmbeds, discordMaxEmbeds + 1},
+		{"exactly max chars", embedsOfLength(discordMaxEmbedChars/2, discordMaxEmbedChars/2), 0, 2},
+		{"one over max chars", embedsOfLength(discordMaxEmbedChars/2, discordMaxEmbedChars/2+1), 0, 1},
+		{"oversized embed goes alone", embedsOfLength(discordMaxEmbedChars+1, 1), 0, 1},
+		{"oversized embed after others", embedsOfLength(1, discordMaxEmbedChars), 0, 1},
+		{"start at end", embedsOfLength(1, 1), 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextBatchEnd(tt.embeds, tt.start); got != tt.want {
+				t.Errorf("nextBatchEnd(%d embeds, %d) = %d, want %d", len(tt.embeds), tt.start, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscordRetryAfter(t *testing.T) {
+	header := func(v string) http.Header {
+		h := http.Header{}
+		h.Set("Retry-After", v)
+		return h
+	}
+	tests := []struct {
+		name   string
+		header http.Header
+		body   string
+		want   time.Duration
+	}{
+		{"body", http.Header{}, `{"retry_after": 1.5}`, 1500 * time.Millisecond},
+		{"body wins over header", header("3"), `{"retry_after": 0.25}`, 250 * time.Millisecond},
+		{"header", header("2"), ``, 2 * time.Second},
+		{"capped", header("3600"), ``, time.Minute},
+		{"missing", http.Header{}, `{"message": "You are being rate limited."}`, discordFlushInterval},
+		{"garbage", header("soon"), `not json`, discordFlushInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := discordRetryAfter(tt.header, []byte(tt.body)); got != tt.want {
+				t.Errorf("discordRetryAfter = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlushHonorsRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	var rateLimitedAt time.Time
+	var retryGap time.Duration
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			rateLimitedAt = time.Now()
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"message": "You are being rate limited.", "retry_after": 0.2, "global": false}`))
+			return
+		}
+		retryGap = time.Since(rateLimitedAt)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "message"}`))
+	}))
+	defer srv.Close()
+
+	s := NewDiscordService(DiscordConfig{WebhookURL: srv.URL + "/api/webhooks/123/token"}, nil)
+	s.Enqueue(model.Feed{}, model.Entry{Title: "Post", URL: "https://example.com/post", Hash: "hash"})
+	s.flush()
+
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("got %d requests, want the batch sent again after the 429", n)
+	}
+	if retryGap < 200*time.Millisecond {
+		t.Errorf("retried after %s, want at least the 200ms Discord asked for", retryGap)
+	}
+	if s.LastSuccess() == nil {
+		t.Error("LastSuccess is nil after the retry succeeded")
+	}
+}
+
+func TestFlushGivesUpWhenRateLimited(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"retry_after": 0.01}`))
+	}))
+	defer srv.Close()
+
+	s := NewDiscordService(DiscordConfig{WebhookURL: srv.URL + "/api/webhooks/123/token"}, nil)
+	s.Enqueue(model.Feed{}, model.Entry{Title: "Post", URL: "https://example.com/post", Hash: "hash"})
+	s.flush()
+
+	if n := requests.Load(); n != discordMaxRateLimitRetries+1 {
+		t.Errorf("got %d requests, want %d", n, discordMaxRateLimitRetries+1)
+	}
+}
+
+func TestFlushBoundsPreviewFetches(t *testing.T) {
+	defer func(timeout time.Duration) { discordPreviewTimeout = timeout }(discordPreviewTimeout)
+	discordPreviewTimeout = 100 * time.Millisecond
+
+	release := make(chan struct{})
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer page.Close()
+	defer close(release)
+
+	var posted atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "message"}`))
+	}))
+	defer srv.Close()
+
+	s := NewDiscordService(DiscordConfig{WebhookURL: srv.URL + "/api/webhooks/123/token"}, nil)
+	for _, hash := range []string{"a", "b", "c"} {
+		s.Enqueue(model.Feed{}, model.Entry{Title: "Post", URL: page.URL + "/" + hash, Hash: hash})
+	}
+	started := time.Now()
+	s.flush()
+
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("flush took %s, want the stalled pages given up on together", elapsed)
+	}
+	if n := posted.Load(); n != 1 {
+		t.Errorf("got %d Discord requests, want the batch sent once", n)
+	}
+}
+
+func TestDiscordClientHasTimeout(t *testing.T) {
+	s := NewDiscordService(DiscordConfig{WebhookURL: "https://discord.com/api/webhooks/123/token"}, nil)
+	if s.client.Timeout != discordRequestTimeout {
+		t.Errorf("client timeout = %s, want %s", s.client.Timeout, discordRequestTimeout)
+	}
+}
+
+func TestBuildEmbedCleansTitleAndAuthor(t *testing.T) {
+	s := NewDiscordService(DiscordConfig{WebhookURL: "https://discord.com/api/webhooks/123/token"}, nil)
+	embed := s.buildEmbed(model.Feed{}, model.Entry{
+		Title:  "R-18 &amp; WIP &lt;preview&gt; <img src=\"x.png\">" + strings.Repeat(" long", 100),
+		Author: "<b>Alice</b> &amp; Bob",
+	}, "")
+
+	if !strings.HasPrefix(embed.Title, "R-18 & WIP <preview> long") {
+		t.Errorf("Title = %q, want entities decoded and tags stripped", embed.Title)
+	}
+	if n := len([]rune(embed.Title)); n > discordMaxTitleLength || !strings.HasSuffix(embed.Title, "…") {
+		t.Errorf("Title is %d runes, want at most %d ending in an ellipsis: %q", n, discordMaxTitleLength, embed.Title)
+	}
+	if embed.Author.Name != "Alice & Bob" {
+		t.Errorf("Author.Name = %q, want %q", embed.Author.Name, "Alice & Bob")
+	}
+}
+
+func TestCategoryColorAndIconOverlay(t *testing.T) {
+	s := NewDiscordService(DiscordConfig{
+		WebhookURL:     "https://discord.com/api/webhooks/123/token",
+		CategoryColors: map[string]int{"Patreon": 0x123456, "MyFeed": 0x0000FF},
+		CategoryIcons:  map[string]string{"default": "https://example.com/default.png", "MyFeed": "https://example.com/myfeed.png"},
+	}, nil)
+
+	colors := []struct {
+		category string
+		want     int
+	}{
+		{"Patreon", 0x123456},
+		{"MyFeed", 0x0000FF},
+		{"Fanbox", defaultCategoryColors["Fanbox"]},
+		{"Unknown", defaultCategoryColors["default"]},
+	}
+	for _, tt := range colors {
+		if got := s.colorFor(tt.category); got != tt.want {
+			t.Errorf("colorFor(%q) = %#06x, want %#06x", tt.category, got, tt.want)
+		}
+	}
+
+	icons := []struct {
+		category string
+		want     string
+	}{
+		{"MyFeed", "https://example.com/myfeed.png"},
+		{"Patreon", defaultCategoryIcons["Patreon"]},
+		{"Unknown", "https://example.com/default.png"},
+	}
+	for _, tt := range icons {
+		if got := s.iconFor(tt.category); got != tt.want {
+			t.Errorf("iconFor(%q) = %q, want %q", tt.category, got, tt.want)
+		}
+	}
+
+	if defaultCategoryColors["Patreon"] == 0x123456 || defaultCategoryIcons["default"] == "https://example.com/default.png" {
+		t.Error("overrides leaked into the built-in defaults")
+	}
+}
+
+// newMessageServer fakes a webhook that keeps its messages so they can be
+// fetched and edited. It returns how many messages were posted.
+func newMessageServer(t *testing.T) (*httptest.Server, func(id string) []Embed, *atomic.Int32) {
+	t.Helper()
+	var mu sync.Mutex
+	messages := make(map[string][]Embed)
+	var posted atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		id := path.Base(r.URL.Path)
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(discordMessage{ID: id, Embeds: messages[id]})
+			return
+		case http.MethodPost:
+			time.Sleep(20 * time.Millisecond)
+			id = fmt.Sprint("message", posted.Add(1))
+		}
+		var body discordMessage
+		json.NewDecoder(r.Body).Decode(&body)
+		messages[id] = body.Embeds
+		json.NewEncoder(w).Encode(discordMessage{ID: id, Embeds: body.Embeds})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func(id string) []Embed {
+		mu.Lock()
+		defer mu.Unlock()
+		return messages[id]
+	}, &posted
+}
+
+func TestArchiveResultDuringFlush(t *testing.T) {
+	srv, message, posted := newMessageServer(t)
+	db, err := database.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	postRepo := repository.NewPostRepository(db)
+	s := NewDiscordService(DiscordConfig{WebhookURL: srv.URL + "/api/webhooks/123/token"}, postRepo)
+
+	// Whether the result lands before, while or after the message is posted,
+	// it ends up in the original message rather than a follow-up.
+	for i := 1; i <= 10; i++ {
+		post := &model.Post{Hash: fmt.Sprint("hash", i), URL: fmt.Sprint("http://127.0.0.1:1/post", i), Title: "Post"}
+		if err := postRepo.Create(post); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		s.Enqueue(model.Feed{}, model.Entry{Title: post.Title, URL: post.URL, Hash: post.Hash})
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.flush()
+		}()
+		go func(delay time.Duration) {
+			defer wg.Done()
+			time.Sleep(delay)
+			s.NotifyArchiveResult(context.Background(), ArchiveResult{Post: post, Success: true})
+		}(time.Duration(i-1) * 4 * time.Millisecond)
+		wg.Wait()
+
+		if n := posted.Load(); n != int32(i) {
+			t.Fatalf("round %d: %d messages posted, want no follow-up", i, n)
+		}
+		embeds := message(fmt.Sprint("message", i))
+		if len(embeds) != 1 || !strings.HasSuffix(embeds[0].Footer.Text, "✅") {
+			t.Errorf("round %d: message embeds = %+v, want the archive result", i, embeds)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/utils"
+)
+
+const (
+	EmailTLSStartTLS = "starttls"
+	EmailTLSImplicit = "tls"
+	EmailTLSNone     = "none"
+)
+
+// smtpTimeout bounds connecting to the SMTP server and, separately, the
+// conversation that sends one email.
+var smtpTimeout = 30 * time.Second
+
+var postEmailTemplate = template.Must(template.New("post").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h2><a href="{{.URL}}">{{.Title}}</a></h2>
+<p>by <strong>{{.Author}}</strong> in {{.Category}}</p>
+{{if .ImageURL}}<p><a href="{{.URL}}"><img src="{{.ImageURL}}" alt="Preview" style="max-width: 600px"></a></p>{{end}}
+<p><a href="{{.URL}}">Open post</a></p>
+</body>
+</html>
+`))
+
+var failureReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h2>{{len .Posts}} failed post{{if ne (len .Posts) 1}}s{{end}} since {{.Since.Format "2006-01-02 15:04 MST"}}</h2>
+<table cellpadding="4" style="border-collapse: collapse">
+<tr><th align="left">Title</th><th align="left">Author</th><th align="left">Category</th><th align="left">Status</th><th align="right">Attempts</th></tr>
+{{range .Posts}}<tr>
+<td><a href="{{.URL}}">{{.Title}}</a></td>
+<td>{{.Author}}</td>
+<td>{{.CategoryTitle}}</td>
+<td>{{.DownloadStatus}}</td>
+<td align="right">{{.DownloadAttempts}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// EmailService sends HTML emails over SMTP, either per archived post or as a
+// periodic report of failed posts.
+type EmailService struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	to       []string
+	tlsMode  string
+}
+
+type EmailConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+	// TLSMode is EmailTLSStartTLS, EmailTLSImplicit or EmailTLSNone.
+	TLSMode string
+}
+
+// NewEmailService returns nil when the host, sender or recipients are missing.
+func NewEmailService(cfg EmailConfig) *EmailService {
+	if cfg.Host == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil
+	}
+	tlsMode := cfg.TLSMode
+	if tlsMode == "" {
+		tlsMode = EmailTLSStartTLS
+	}
+	return &EmailService{
+		host:     cfg.Host,
+		port:     cfg.Port,
+		username: cfg.Username,
+		password: cfg.Password,
+		from:     cfg.From,
+		to:       cfg.To,
+		tlsMode:  tlsMode,
+	}
+}
+
+func (s *EmailService) Name() string {
+	return "Email"
+}
+
+// Notify emails a single archived entry.
+func (s *EmailService) Notify(feed model.Feed, entry model.Entry) error {
+	category := feed.Category.Title
+	if category == "" {
+		category = "Uncategorized"
+	}
+	data := struct {
+		Title, Author, Category, URL, ImageURL string
+	}{
+		Title:    utils.CleanText(entry.Title),
+		Author:   utils.CleanText(entry.Author),
+		Category: category,
+		URL:      entry.URL,
+		ImageURL: entryImageURL(entry),
+	}
+
+	var body bytes.Buffer
+	if err := postEmailTemplate.Execute(&body, data); err != nil {
+		return &permanentError{err: fmt.Errorf("failed to render post email: %w", err)}
+	}
+	return s.send(fmt.Sprintf("[%s] %s", category, data.Title), body.Bytes())
+}
+
+// SendFailureReport emails the list of posts that failed since the given time.
+func (s *EmailService) SendFailureReport(posts []model.Post, since time.Time) error {
+	data := struct {
+		Posts []model.Post
+		Since time.Time
+	}{Posts: posts, Since: since}
+
+	var body bytes.Buffer
+	if err := failureReportTemplate.Execute(&body, data); err != nil {
+		return fmt.Errorf("failed to render failure report: %w", err)
+	}
+	return s.send(fmt.Sprintf("LewdArchive: %d failed posts", len(posts)), body.Bytes())
+}
+
+func (s *EmailService) send(subject string, htmlBody []byte) error {
+	msg, err := s.buildMessage(subject, htmlBody)
+	if err != nil {
+		return err
+	}
+
+	client, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return &permanentError{err: fmt.Errorf("smtp auth failed: %w", err)}
+		}
+	}
+	if err := client.Mail(s.from); err != nil {
+		return fmt.Errorf("smtp MAIL FROM failed: %w", err)
+	}
+	for _, rcpt := range s.to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s failed: %w", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return client.Quit()
+}
+
+// dial connects to the SMTP server using implicit TLS, STARTTLS or plain text.
+// The connection deadline bounds the whole conversation, not just the connect,
+// so a server that stops answering can't hang the job.
+func (s *EmailService) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	tlsConfig := &tls.Config{ServerName: s.host}
+
+	if s.tlsMode == EmailTLSImplicit {
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: smtpTimeout}, "tcp", addr, tlsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("smtp TLS connection failed: %w", err)
+		}
+		conn.SetDeadline(time.Now().Add(smtpTimeout))
+		client, err := smtp.NewClient(conn, s.host)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("smtp handshake failed: %w", err)
+		}
+		return client, nil
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, smtpTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("smtp connection failed: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("smtp handshake failed: %w", err)
+	}
+	if s.tlsMode == EmailTLSStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("smtp STARTTLS failed: %w", err)
+		}
+	}
+	return client, nil
+}
+
+func (s *EmailService) buildMessage(subject string, htmlBody []byte) ([]byte, error) {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&msg)
+	if _, err := qp.Write(htmlBody); err != nil {
+		return nil, fmt.Errorf("failed to encode email body: %w", err)
+	}
+	if err := qp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode email body: %w", err)
+	}
+	return msg.Bytes(), nil
+}
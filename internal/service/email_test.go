@@ -0,0 +1,50 @@
+package service
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmailSendTimesOutOnStalledServer(t *testing.T) {
+	defer func(timeout time.Duration) { smtpTimeout = timeout }(smtpTimeout)
+	smtpTimeout = 100 * time.Millisecond
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Greet and answer EHLO, then stop answering mid-conversation.
+		conn.Write([]byte("220 localhost ready\r\n"))
+		reader := bufio.NewReader(conn)
+		line, _ := reader.ReadString('\n')
+		if strings.HasPrefix(line, "EHLO") {
+			conn.Write([]byte("250 localhost\r\n"))
+		}
+		time.Sleep(5 * time.Second)
+	}()
+
+	s := NewEmailService(EmailConfig{
+		Host:    "127.0.0.1",
+		Port:    ln.Addr().(*net.TCPAddr).Port,
+		From:    "archive@example.com",
+		To:      []string{"me@example.com"},
+		TLSMode: EmailTLSNone,
+	})
+	started := time.Now()
+	if err := s.send("Subject", []byte("<p>Body</p>")); err == nil {
+		t.Fatal("send succeeded against a stalled server")
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("send took %s, want it bounded by the connection deadline", elapsed)
+	}
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+
+	"lewdarchive/internal/model"
+)
+
+const eventEmitTimeout = 5 * time.Second
+
+// EventEmitter publishes archive lifecycle events for downstream consumers.
+type EventEmitter interface {
+	Emit(ctx context.Context, event model.ArchiveEvent) error
+	Close() error
+}
+
+type EventConfig struct {
+	NATSURL           string
+	NATSSubjectPrefix string
+	RedisURL          string
+	RedisStream       string
+}
+
+// NewEventEmitter picks NATS when NATS_URL is set, then a Redis stream when
+// REDIS_URL is set, and otherwise returns a NoopEmitter.
+func NewEventEmitter(cfg EventConfig) (EventEmitter, error) {
+	switch {
+	case cfg.NATSURL != "":
+		return NewNATSEmitter(cfg.NATSURL, cfg.NATSSubjectPrefix)
+	case cfg.RedisURL != "":
+		return NewRedisStreamEmitter(cfg.RedisURL, cfg.RedisStream)
+	default:
+		return NoopEmitter{}, nil
+	}
+}
+
+// EmitEvent fills in the timestamp and logs failures; events are best-effort
+// and never interrupt archiving.
+func EmitEvent(emitter EventEmitter, event model.ArchiveEvent) {
+	if emitter == nil {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventEmitTimeout)
+	defer cancel()
+
+	if err := emitter.Emit(ctx, event); err != nil {
+		log.Printf("Error emitting %s event for %s: %v", event.EventType, event.PostHash, err)
+	}
+}
+
+type NoopEmitter struct{}
+
+func (NoopEmitter) Emit(ctx context.Context, event model.ArchiveEvent) error { return nil }
+
+func (NoopEmitter) Close() error { return nil }
+
+// NATSEmitter publishes each event as JSON on "<prefix>.<event_type>".
+type NATSEmitter struct {
+	conn          *nats.Conn
+	subjectPrefix string
+}
+
+func NewNATSEmitter(url, subjectPrefix string) (*NATSEmitter, error) {
+	conn, err := nats.Connect(url, nats.Name("lewdarchive"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	if subjectPrefix == "" {
+		subjectPrefix = "lewdarchive"
+	}
+
+	log.Printf("Publishing archive events to NATS %s (subject prefix %s)", url, subjectPrefix)
+	return &NATSEmitter{conn: conn, subjectPrefix: subjectPrefix}, nil
+}
+
+func (e *NATSEmitter) Emit(ctx context.Context, event model.ArchiveEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if err := e.conn.Publish(e.subjectPrefix+"."+event.EventType, data); err != nil {
+		return fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+	return e.conn.FlushWithContext(ctx)
+}
+
+func (e *NATSEmitter) Close() error {
+	return e.conn.Drain()
+}
+
+// RedisStreamEmitter appends each event to a Redis stream with the event type
+// and JSON payload as fields.
+type RedisStreamEmitter struct {
+	client *redis.Client
+	stream string
+}
+
+func NewRedisStreamEmitter(url, stream string) (*RedisStreamEmitter, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	if stream == "" {
+		stream = "lewdarchive:events"
+	}
+
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), eventEmitTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	log.Printf("Publishing archive events to Redis stream %s", stream)
+	return &RedisStreamEmitter{client: client, stream: stream}, nil
+}
+
+func (e *RedisStreamEmitter) Emit(ctx context.Context, event model.ArchiveEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	err = e.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: e.stream,
+		Values: map[string]interface{}{
+			"event_type": event.EventType,
+			"payload":    string(data),
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to add to Redis stream: %w", err)
+	}
+	return nil
+}
+
+func (e *RedisStreamEmitter) Close() error {
+	return e.client.Close()
+}
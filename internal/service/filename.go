@@ -0,0 +1,73 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// DefaultFilenameTemplate names a single file after the post title and
+// numbers the files of multi-file posts.
+const DefaultFilenameTemplate = `{{.Title}}{{if gt .Total 1}}-{{.Index}}{{end}}{{.Ext}}`
+
+// FilenameData is available to CHIBISAFE_FILENAME_TEMPLATE. Title and Author
+// are already sanitized for use in file names; Index starts at 1 and Date is
+// the publication date as YYYY-MM-DD.
+type FilenameData struct {
+	Title  string
+	Index  int
+	Total  int
+	Ext    string
+	Author string
+	Hash   string
+	Date   string
+}
+
+var defaultFilenameTemplate = template.Must(template.New("filename").Parse(DefaultFilenameTemplate))
+
+// ParseFilenameTemplate parses an upload file name template, falling back to
+// DefaultFilenameTemplate when text is empty. The template is executed once
+// against sample data so that mistakes surface at startup.
+func ParseFilenameTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultFilenameTemplate
+	}
+
+	tmpl, err := template.New("filename").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filename template: %w", err)
+	}
+
+	sample := FilenameData{
+		Title:  "title",
+		Index:  2,
+		Total:  3,
+		Ext:    ".jpg",
+		Author: "author",
+		Hash:   "0123456789abcdef",
+		Date:   "2006-01-02",
+	}
+	if _, err := renderFilename(tmpl, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderFilename executes the template and rejects results that are empty or
+// would escape the upload name into a path.
+func renderFilename(tmpl *template.Template, data FilenameData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("invalid filename template: %w", err)
+	}
+
+	filename := strings.TrimSpace(buf.String())
+	if filename == "" || filename == data.Ext {
+		return "", fmt.Errorf("filename template produced an empty name")
+	}
+	if strings.ContainsAny(filename, `/\`) {
+		return "", fmt.Errorf("filename template produced a path: %q", filename)
+	}
+	return filename, nil
+}
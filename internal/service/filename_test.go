@@ -0,0 +1,54 @@
+package service
+
+import "testing"
+
+func TestRenderFilename(t *testing.T) {
+	data := FilenameData{Title: "my-post", Ext: ".png", Author: "alice", Hash: "0123456789abcdef", Date: "2024-05-17"}
+	single, multi := data, data
+	single.Index, single.Total = 1, 1
+	multi.Index, multi.Total = 3, 12
+
+	tests := []struct {
+		name     string
+		template string
+		data     FilenameData
+		want     string
+	}{
+		{"default single file", "", single, "my-post.png"},
+		{"default multi file", "", multi, "my-post-3.png"},
+		{"date", "{{.Date}}-{{.Title}}{{.Ext}}", single, "2024-05-17-my-post.png"},
+		{"date multi file", "{{.Date}}-{{.Title}}{{if gt .Total 1}}-{{.Index}}{{end}}{{.Ext}}", multi, "2024-05-17-my-post-3.png"},
+		{"hash prefix", `{{slice .Hash 0 8}}-{{.Title}}{{.Ext}}`, single, "01234567-my-post.png"},
+		{"padded index", `{{.Author}}-{{printf "%03d" .Index}}{{.Ext}}`, multi, "alice-003.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseFilenameTemplate(tt.template)
+			if err != nil {
+				t.Fatalf("ParseFilenameTemplate: %v", err)
+			}
+			got, err := renderFilename(tmpl, tt.data)
+			if err != nil {
+				t.Fatalf("renderFilename: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("renderFilename = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilenameTemplateRejects(t *testing.T) {
+	for _, text := range []string{
+		"{{.Title",                     // parse error
+		"{{.Missing}}",                 // unknown field
+		"{{.Ext}}",                     // nothing but the extension
+		"   ",                          // blank
+		"{{.Date}}/{{.Title}}{{.Ext}}", // path
+		`{{.Author}}\{{.Title}}`,       // Windows path
+	} {
+		if _, err := ParseFilenameTemplate(text); err == nil {
+			t.Errorf("ParseFilenameTemplate(%q): got nil error", text)
+		}
+	}
+}
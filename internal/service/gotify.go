@@ -0,0 +1,130 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/utils"
+)
+
+// gotifyDefaultPriority is high enough for Gotify's Android client to show a
+// heads-up notification.
+const gotifyDefaultPriority = 5
+
+type GotifyService struct {
+	serverURL          string
+	appToken           string
+	categoryPriorities map[string]int
+	client             *http.Client
+}
+
+type GotifyConfig struct {
+	ServerURL string
+	AppToken  string
+	// CategoryPriorities maps category titles to Gotify priorities (0-10);
+	// "default" applies to categories without their own entry.
+	CategoryPriorities map[string]int
+}
+
+type gotifyMessage struct {
+	Title    string                 `json:"title"`
+	Message  string                 `json:"message"`
+	Priority int                    `json:"priority"`
+	Extras   map[string]interface{} `json:"extras,omitempty"`
+}
+
+// NewGotifyService returns nil when the server URL or app token is missing.
+func NewGotifyService(cfg GotifyConfig) *GotifyService {
+	if cfg.ServerURL == "" || cfg.AppToken == "" {
+		return nil
+	}
+	return &GotifyService{
+		serverURL:          strings.TrimSuffix(cfg.ServerURL, "/"),
+		appToken:           cfg.AppToken,
+		categoryPriorities: cfg.CategoryPriorities,
+		client:             &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *GotifyService) Name() string {
+	return "Gotify"
+}
+
+func (s *GotifyService) priorityFor(categoryTitle string) int {
+	if priority, ok := s.categoryPriorities[categoryTitle]; ok {
+		return priority
+	}
+	if priority, ok := s.categoryPriorities["default"]; ok {
+		return priority
+	}
+	return gotifyDefaultPriority
+}
+
+// Notify sends the entry with the priority of its feed category.
+func (s *GotifyService) Notify(feed model.Feed, entry model.Entry) error {
+	return s.Send(entry, feed.Category.Title)
+}
+
+// Send posts the entry URL and author with the priority of the category. The
+// preview image and click target are passed as client::notification extras
+// for the Android client.
+func (s *GotifyService) Send(entry model.Entry, categoryTitle string) error {
+	if categoryTitle == "" {
+		categoryTitle = "Uncategorized"
+	}
+	author := utils.CleanText(entry.Author)
+	if author == "" {
+		author = "Unknown"
+	}
+
+	notification := map[string]interface{}{
+		"click": map[string]string{"url": entry.URL},
+	}
+	if imageURL := entryImageURL(entry); imageURL != "" {
+		notification["bigImageUrl"] = imageURL
+	}
+
+	msg := gotifyMessage{
+		Title:    utils.CleanText(entry.Title),
+		Message:  entry.URL + "\nAuthor: " + author,
+		Priority: s.priorityFor(categoryTitle),
+		Extras: map[string]interface{}{
+			"client::display":      map[string]string{"contentType": "text/markdown"},
+			"client::notification": notification,
+		},
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal gotify message: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", s.serverURL+"/message", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create gotify request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", s.appToken)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("gotify request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		err := fmt.Errorf("gotify message failed: %d - %s", resp.StatusCode, string(respBody))
+		if resp.StatusCode < http.StatusInternalServerError {
+			return &permanentError{err: err}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"lewdarchive/internal/model"
+)
+
+func TestGotifySend(t *testing.T) {
+	var got gotifyMessage
+	var key string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/message" {
+			http.NotFound(w, r)
+			return
+		}
+		key = r.Header.Get("X-Gotify-Key")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding message: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	s := NewGotifyService(GotifyConfig{ServerURL: srv.URL + "/", AppToken: "token", CategoryPriorities: map[string]int{"Patreon": 8}})
+	entry := model.Entry{Title: "New post", URL: "https://example.com/post", Author: "Alice"}
+	if err := s.Send(entry, "Patreon"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if key != "token" {
+		t.Errorf("X-Gotify-Key = %q, want token", key)
+	}
+	if got.Title != "New post" || got.Message != "https://example.com/post\nAuthor: Alice" {
+		t.Errorf("message = %q / %q", got.Title, got.Message)
+	}
+	if got.Priority != 8 {
+		t.Errorf("priority = %d, want 8", got.Priority)
+	}
+	display, _ := got.Extras["client::display"].(map[string]interface{})
+	if display["contentType"] != "text/markdown" {
+		t.Errorf("extras = %v, want client::display.contentType text/markdown", got.Extras)
+	}
+
+	notification, _ := got.Extras["client::notification"].(map[string]interface{})
+	if click, _ := notification["click"].(map[string]interface{}); click["url"] != entry.URL {
+		t.Errorf("extras = %v, want client::notification.click.url %s", got.Extras, entry.URL)
+	}
+
+	if err := s.Send(entry, "Pixiv"); err != nil || got.Priority != gotifyDefaultPriority {
+		t.Errorf("Send to an unconfigured category = %v, priority %d, want %d", err, got.Priority, gotifyDefaultPriority)
+	}
+
+	// The dispatcher goes through Notify, which sends the same message.
+	feed := model.Feed{}
+	feed.Category.Title = "Patreon"
+	if err := s.Notify(feed, entry); err != nil || got.Priority != 8 || got.Message != "https://example.com/post\nAuthor: Alice" {
+		t.Errorf("Notify = %v, sent %q with priority %d, want the Send message with priority 8", err, got.Message, got.Priority)
+	}
+}
+
+func TestGotifySendErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	s := NewGotifyService(GotifyConfig{ServerURL: srv.URL, AppToken: "wrong"})
+	err := s.Send(model.Entry{URL: "https://example.com/post"}, "")
+	if _, ok := err.(*permanentError); !ok {
+		t.Errorf("Send with a rejected token = %v, want a permanent error", err)
+	}
+
+	srv.Close()
+	if err := s.Send(model.Entry{URL: "https://example.com/post"}, ""); err == nil {
+		t.Error("Send to an unreachable server: got nil error")
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// galleryDLVersionRetry is how long a failed gallery-dl version lookup is
+// cached; a successful one is kept until restart.
+const galleryDLVersionRetry = time.Minute
+
+// successClock remembers when calls to a dependency last succeeded.
+type successClock struct {
+	nanos atomic.Int64
+}
+
+func (c *successClock) record() {
+	c.nanos.Store(time.Now().UnixNano())
+}
+
+// get returns nil until a call succeeded.
+func (c *successClock) get() *time.Time {
+	nanos := c.nanos.Load()
+	if nanos == 0 {
+		return nil
+	}
+	t := time.Unix(0, nanos).UTC()
+	return &t
+}
+
+var galleryDLVersion struct {
+	mu        sync.Mutex
+	version   string
+	err       error
+	checkedAt time.Time
+}
+
+// GalleryDLVersion returns the output of gallery-dl --version, which also
+// tells whether gallery-dl is installed.
+func GalleryDLVersion(ctx context.Context) (string, error) {
+	galleryDLVersion.mu.Lock()
+	defer galleryDLVersion.mu.Unlock()
+
+	if galleryDLVersion.version != "" ||
+		(!galleryDLVersion.checkedAt.IsZero() && time.Since(galleryDLVersion.checkedAt) < galleryDLVersionRetry) {
+		return galleryDLVersion.version, galleryDLVersion.err
+	}
+
+	galleryDLVersion.checkedAt = time.Now()
+	out, err := exec.CommandContext(ctx, "gallery-dl", "--version").Output()
+	if err != nil {
+		galleryDLVersion.err = fmt.Errorf("gallery-dl unavailable: %w", err)
+		return "", galleryDLVersion.err
+	}
+	galleryDLVersion.version = strings.TrimSpace(string(out))
+	galleryDLVersion.err = nil
+	return galleryDLVersion.version, nil
+}
+
+// DirStatus describes an archive root directory.
+type DirStatus struct {
+	Path      string  `json:"path"`
+	Writable  bool    `json:"writable"`
+	FreeBytes *uint64 `json:"free_bytes,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// CheckDir reports whether a file can be created in dir, which is created
+// like the first download would, and how much space is left on its
+// filesystem.
+func CheckDir(dir string) DirStatus {
+	status := DirStatus{Path: dir}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	if free, err := freeSpace(dir); err == nil {
+		status.FreeBytes = &free
+	}
+
+	f, err := os.CreateTemp(dir, ".health-*")
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	f.Close()
+	os.Remove(f.Name())
+	status.Writable = true
+	return status
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package service
+
+import "errors"
+
+// freeSpace is not implemented where statfs doesn't exist.
+func freeSpace(dir string) (uint64, error) {
+	return 0, errors.New("free space not supported on this platform")
+}
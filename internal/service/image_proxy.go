@@ -0,0 +1,57 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ImageProxy rewrites the URL of a source image shown in a Discord embed, so
+// that viewers fetch it through a proxy rather than from the original CDN,
+// whose links may expire or refuse hotlinking.
+type ImageProxy interface {
+	ProxyURL(original string) string
+}
+
+// NoopProxy leaves image URLs untouched.
+type NoopProxy struct{}
+
+func (NoopProxy) ProxyURL(original string) string {
+	return original
+}
+
+// PrefixProxy prepends Base to image URLs, as expected by Camo-style proxies
+// and Cloudflare Image Resizing, e.g.
+// https://images.example.com/https://cdn.patreon.com/....
+type PrefixProxy struct {
+	Base string
+}
+
+func (p PrefixProxy) ProxyURL(original string) string {
+	if !strings.HasPrefix(original, "http://") && !strings.HasPrefix(original, "https://") {
+		return original
+	}
+	if strings.HasPrefix(original, p.Base) {
+		return original
+	}
+	return p.Base + original
+}
+
+// NewImageProxy returns a PrefixProxy for DISCORD_IMAGE_PROXY_URL, which must
+// be an http or https URL, or a NoopProxy when it is empty.
+func NewImageProxy(base string) (ImageProxy, error) {
+	if base == "" {
+		return NoopProxy{}, nil
+	}
+	proxyURL, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL.Scheme != "http" && proxyURL.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q, expected http or https", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", base)
+	}
+	return PrefixProxy{Base: base}, nil
+}
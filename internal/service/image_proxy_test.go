@@ -0,0 +1,78 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"lewdarchive/internal/model"
+)
+
+func TestPrefixProxy(t *testing.T) {
+	p := PrefixProxy{Base: "https://images.proxy/"}
+	tests := map[string]string{
+		"https://cdn.patreon.com/a.png":                      "https://images.proxy/https://cdn.patreon.com/a.png",
+		"http://example.com/b.jpg":                           "https://images.proxy/http://example.com/b.jpg",
+		"https://images.proxy/https://cdn.patreon.com/a.png": "https://images.proxy/https://cdn.patreon.com/a.png",
+		"attachment://icon.png":                              "attachment://icon.png",
+		"":                                                   "",
+	}
+	for original, want := range tests {
+		if got := p.ProxyURL(original); got != want {
+			t.Errorf("ProxyURL(%q) = %q, want %q", original, got, want)
+		}
+	}
+}
+
+func TestNewImageProxy(t *testing.T) {
+	if p, err := NewImageProxy(""); err != nil || p != (NoopProxy{}) {
+		t.Errorf("NewImageProxy(\"\") = %v, %v, want NoopProxy", p, err)
+	}
+	if p, err := NewImageProxy("https://images.proxy/"); err != nil || p != (PrefixProxy{Base: "https://images.proxy/"}) {
+		t.Errorf("NewImageProxy(https) = %v, %v, want PrefixProxy", p, err)
+	}
+	for _, base := range []string{"ftp://images.proxy/", "images.proxy", "https://", "://bad"} {
+		if _, err := NewImageProxy(base); err == nil {
+			t.Errorf("NewImageProxy(%q): got nil error", base)
+		}
+	}
+}
+
+func TestSendEmbedUsesImageProxy(t *testing.T) {
+	var payload DiscordEmbed
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("decoding embed JSON %q: %v", body, err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "message"}`))
+	}))
+	defer srv.Close()
+
+	s := NewDiscordService(DiscordConfig{
+		WebhookURL: srv.URL + "/api/webhooks/123/token",
+		ImageProxy: PrefixProxy{Base: "https://images.proxy/"},
+	}, nil)
+	entry := model.Entry{
+		Title:      "Post",
+		URL:        "https://www.patreon.com/posts/1",
+		Enclosures: []model.Enclosure{{URL: "https://cdn.patreon.com/preview.png", MimeType: "image/png"}},
+	}
+	if _, err := s.SendEmbed(model.Feed{}, entry); err != nil {
+		t.Fatalf("SendEmbed: %v", err)
+	}
+
+	if len(payload.Embeds) != 1 || payload.Embeds[0].Image == nil {
+		t.Fatalf("embeds = %+v, want one with an image", payload.Embeds)
+	}
+	if got, want := payload.Embeds[0].Image.URL, "https://images.proxy/https://cdn.patreon.com/preview.png"; got != want {
+		t.Errorf("image URL = %q, want %q", got, want)
+	}
+	if strings.HasPrefix(payload.Embeds[0].URL, "https://images.proxy/") {
+		t.Errorf("entry link %q was proxied, only images should be", payload.Embeds[0].URL)
+	}
+}
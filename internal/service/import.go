@@ -0,0 +1,111 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/utils"
+)
+
+// ImportSource is the source recorded for imported posts.
+const ImportSource = "import"
+
+// Import validates a record and stores it as a post unless one with the same
+// hash or URL exists. When the record has a Path the post is marked as
+// downloaded, with the directory's files recorded but left in place;
+// otherwise it stays pending and the new post is returned for the caller to
+// queue.
+func (s *ArchiveService) Import(record model.ImportRecord) (model.ImportResult, *model.Post) {
+	result := model.ImportResult{URL: strings.TrimSpace(record.URL)}
+	fail := func(err error) (model.ImportResult, *model.Post) {
+		result.Status = model.ImportStatusError
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	u, err := url.Parse(result.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fail(errors.New("url must be an absolute http(s) URL"))
+	}
+
+	result.Hash = strings.TrimSpace(record.Hash)
+	if result.Hash == "" {
+		sum := sha256.Sum256([]byte(result.URL))
+		result.Hash = hex.EncodeToString(sum[:])
+	}
+
+	publishedAt := time.Now()
+	if record.PublishedAt != "" {
+		var ok bool
+		if publishedAt, ok = utils.ParsePublishedAt(record.PublishedAt); !ok {
+			return fail(fmt.Errorf("invalid published_at %q", record.PublishedAt))
+		}
+	}
+
+	var archiveDir string
+	if record.Path != "" {
+		archiveDir = record.Path
+		if !filepath.IsAbs(archiveDir) {
+			archiveDir = filepath.Join(s.baseDirFor(record.Category), archiveDir)
+		}
+		info, err := os.Stat(archiveDir)
+		if err != nil || !info.IsDir() {
+			return fail(fmt.Errorf("directory %s not found", record.Path))
+		}
+	}
+
+	if exists, err := s.postRepo.ExistsByHash(result.Hash); err != nil {
+		return fail(err)
+	} else if exists {
+		result.Status = model.ImportStatusSkipped
+		result.Error = "hash already archived"
+		return result, nil
+	}
+	if exists, err := s.postRepo.ExistsByURL(result.URL); err != nil {
+		return fail(err)
+	} else if exists {
+		result.Status = model.ImportStatusSkipped
+		result.Error = "url already archived"
+		return result, nil
+	}
+
+	post := &model.Post{
+		SiteURL:       u.Scheme + "://" + u.Host,
+		Hash:          result.Hash,
+		Title:         strings.TrimSpace(record.Title),
+		URL:           result.URL,
+		PublishedAt:   publishedAt,
+		Author:        strings.TrimSpace(record.Author),
+		CategoryTitle: strings.TrimSpace(record.Category),
+		Source:        ImportSource,
+	}
+	if err := s.postRepo.Create(post); err != nil {
+		return fail(err)
+	}
+	result.Status = model.ImportStatusCreated
+	log.Printf("Post imported: %s - %s", post.Title, post.Hash)
+
+	if archiveDir == "" {
+		result.DownloadStatus = post.DownloadStatus
+		return result, post
+	}
+
+	s.recordDownloadSize(post, archiveDir)
+	if files, err := s.hashArchivedFiles(post, archiveDir); err != nil {
+		log.Printf("Error listing files of %s: %v", archiveDir, err)
+	} else {
+		s.recordFiles(post, files)
+	}
+	s.setDownloadStatus(post, model.DownloadStatusCompleted)
+	result.DownloadStatus = post.DownloadStatus
+	return result, nil
+}
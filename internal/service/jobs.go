@@ -0,0 +1,421 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/repository"
+)
+
+// gallery-dl exit status bits that retrying won't fix: usage errors, missing
+// or unsupported URLs, authentication and format errors.
+const (
+	galleryDLExitUsage       = 2
+	galleryDLExitHTTPError   = 4
+	galleryDLExitNotFound    = 8
+	galleryDLExitAuth        = 16
+	galleryDLExitFormat      = 32
+	galleryDLExitNoExtractor = 64
+)
+
+var (
+	// galleryDLHTTPStatusPattern matches the status of a gallery-dl HttpError,
+	// e.g. "HttpError: '404 Not Found' for ...".
+	galleryDLHTTPStatusPattern = regexp.MustCompile(`\b([45]\d\d) [A-Z][a-z]`)
+	// chibisafeStatusPattern matches the status in errors of the Chibisafe
+	// client, e.g. "upload failed: 413 - ...".
+	chibisafeStatusPattern = regexp.MustCompile(`: ([45]\d\d) - `)
+)
+
+// ErrJobNotFound is returned for an unknown job ID or a job that succeeded.
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobActive is returned when retrying a job that is already queued or
+// running.
+var ErrJobActive = errors.New("job already queued or running")
+
+// JobFilter narrows JobService.List. Zero values match everything.
+type JobFilter struct {
+	Type       model.JobType
+	Status     model.JobStatus
+	ErrorClass model.ErrorClass
+}
+
+func (f JobFilter) matches(job model.Job) bool {
+	return (f.Type == "" || job.Type == f.Type) &&
+		(f.Status == "" || job.Status == f.Status) &&
+		(f.ErrorClass == "" || job.ErrorClass == f.ErrorClass)
+}
+
+// JobService reports the downloads and Chibisafe uploads that have not
+// succeeded yet and retries them. Downloads go back to the archive workers,
+// uploads back to the retry queue.
+type JobService struct {
+	postRepo         *repository.PostRepository
+	downloadLogRepo  *repository.DownloadLogRepository
+	retryQueue       *repository.RetryQueueRepository
+	archiveService   *ArchiveService
+	maxUploadRetries int
+	triggerUploads   func()
+}
+
+// NewJobService returns a JobService. triggerUploads, when set, runs the
+// upload retry job right away after uploads were requeued.
+func NewJobService(postRepo *repository.PostRepository, downloadLogRepo *repository.DownloadLogRepository, retryQueue *repository.RetryQueueRepository, archiveService *ArchiveService, maxUploadRetries int, triggerUploads func()) *JobService {
+	return &JobService{
+		postRepo:         postRepo,
+		downloadLogRepo:  downloadLogRepo,
+		retryQueue:       retryQueue,
+		archiveService:   archiveService,
+		maxUploadRetries: maxUploadRetries,
+		triggerUploads:   triggerUploads,
+	}
+}
+
+// List returns the jobs matching the filter, downloads first.
+func (s *JobService) List(filter JobFilter) ([]model.Job, error) {
+	var jobs []model.Job
+	if filter.Type == "" || filter.Type == model.JobTypeDownload {
+		downloads, err := s.downloadJobs()
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, downloads...)
+	}
+	if filter.Type == "" || filter.Type == model.JobTypeUpload {
+		uploads, err := s.uploadJobs()
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, uploads...)
+	}
+
+	matching := []model.Job{}
+	for _, job := range jobs {
+		if filter.matches(job) {
+			matching = append(matching, job)
+		}
+	}
+	return matching, nil
+}
+
+// Get returns a job by ID.
+func (s *JobService) Get(id string) (*model.Job, error) {
+	jobType, key, err := parseJobID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if jobType == model.JobTypeDownload {
+		post, err := s.postRepo.GetByID(key)
+		if err == sql.ErrNoRows {
+			return nil, ErrJobNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if post.DownloadStatus == model.DownloadStatusCompleted && !s.archiveService.IsActive(post.ID) {
+			return nil, ErrJobNotFound
+		}
+		logs, err := s.downloadLogRepo.LatestByPostIDs([]int{post.ID})
+		if err != nil {
+			return nil, err
+		}
+		latest, ok := logs[post.ID]
+		job := s.downloadJob(*post, latest, ok)
+		return &job, nil
+	}
+
+	item, err := s.retryQueue.GetByID(key)
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	post, err := s.postRepo.GetByID(item.PostID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	job := s.uploadJob(*item, post)
+	return &job, nil
+}
+
+// Retry requeues a failed job and returns its new state. Jobs that are
+// already queued or running are left alone and fail with ErrJobActive.
+func (s *JobService) Retry(ctx context.Context, id string) (*model.Job, error) {
+	job, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != model.JobStatusFailed {
+		return job, ErrJobActive
+	}
+	if err := s.requeue(ctx, job); err != nil {
+		return job, err
+	}
+	if job.Type == model.JobTypeUpload && s.triggerUploads != nil {
+		s.triggerUploads()
+	}
+	return job, nil
+}
+
+// RetryAll requeues every failed job matching the filter, whose Status is
+// ignored, and returns their new state.
+func (s *JobService) RetryAll(ctx context.Context, filter JobFilter) ([]model.Job, error) {
+	filter.Status = model.JobStatusFailed
+	jobs, err := s.List(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	retried := []model.Job{}
+	var uploads bool
+	for _, job := range jobs {
+		if err := s.requeue(ctx, &job); err != nil {
+			if !errors.Is(err, ErrJobActive) {
+				log.Printf("Error retrying job %s: %v", job.ID, err)
+			}
+			continue
+		}
+		uploads = uploads || job.Type == model.JobTypeUpload
+		retried = append(retried, job)
+	}
+	if uploads && s.triggerUploads != nil {
+		s.triggerUploads()
+	}
+	log.Printf("Retried %d of %d failed jobs", len(retried), len(jobs))
+	return retried, nil
+}
+
+// requeue hands a failed job back to its worker and updates job to match.
+func (s *JobService) requeue(ctx context.Context, job *model.Job) error {
+	_, key, err := parseJobID(job.ID)
+	if err != nil {
+		return err
+	}
+
+	if job.Type == model.JobTypeUpload {
+		now := time.Now()
+		if err := s.retryQueue.Requeue(key, now); err != nil {
+			return err
+		}
+		job.Status = model.JobStatusQueued
+		job.Attempts = 0
+		job.NextAttemptAt = &now
+		return nil
+	}
+
+	post, err := s.postRepo.GetByID(key)
+	if err != nil {
+		return err
+	}
+	if !s.archiveService.claim(post.ID) {
+		return ErrJobActive
+	}
+	if err := s.postRepo.UpdateDownloadStatus(post.ID, model.DownloadStatusPending); err != nil {
+		s.archiveService.release(post.ID)
+		return err
+	}
+	post.DownloadStatus = model.DownloadStatusPending
+	// The queue may be full, so the download is handed over in the
+	// background; the claim keeps a second one from being queued meanwhile.
+	go s.archiveService.send(downloadJob{ctx: context.WithoutCancel(ctx), post: post}, DownloadPriorityHigh)
+	job.Status = model.JobStatusQueued
+	return nil
+}
+
+// downloadJobs returns a job for each post whose download has not completed.
+func (s *JobService) downloadJobs() ([]model.Job, error) {
+	var posts []model.Post
+	for _, status := range []model.DownloadStatus{
+		model.DownloadStatusRunning,
+		model.DownloadStatusPending,
+		model.DownloadStatusFailed,
+		model.DownloadStatusFinalFailed,
+	} {
+		batch, err := s.postRepo.List(repository.PostFilter{Status: status})
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, batch...)
+	}
+
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	logs, err := s.downloadLogRepo.LatestByPostIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]model.Job, 0, len(posts))
+	for _, post := range posts {
+		latest, ok := logs[post.ID]
+		jobs = append(jobs, s.downloadJob(post, latest, ok))
+	}
+	return jobs, nil
+}
+
+// downloadJob describes the download of a post. Pending and running posts
+// without a download in the worker queue were interrupted, e.g. by a
+// restart, and count as failed so they can be retried.
+func (s *JobService) downloadJob(post model.Post, latest model.DownloadLog, hasLog bool) model.Job {
+	updatedAt := post.UpdatedAt
+	job := model.Job{
+		ID:        fmt.Sprintf("%s-%d", model.JobTypeDownload, post.ID),
+		Type:      model.JobTypeDownload,
+		PostHash:  post.Hash,
+		PostTitle: post.Title,
+		Attempts:  post.DownloadAttempts,
+		UpdatedAt: &updatedAt,
+	}
+
+	switch {
+	case s.archiveService.IsActive(post.ID) && post.DownloadStatus == model.DownloadStatusRunning:
+		job.Status = model.JobStatusRunning
+		return job
+	case s.archiveService.IsActive(post.ID):
+		job.Status = model.JobStatusQueued
+		return job
+	}
+
+	job.Status = model.JobStatusFailed
+	switch {
+	case post.DownloadStatus == model.DownloadStatusPending || post.DownloadStatus == model.DownloadStatusRunning:
+		job.Error = "download interrupted before finishing"
+		job.ErrorClass = model.ErrorClassTransient
+	case hasLog && latest.ExitCode != 0:
+		job.ExitCode = latest.ExitCode
+		job.Error = lastLine(latest.StderrLines)
+		if job.Error == "" {
+			job.Error = "gallery-dl exited with code " + strconv.Itoa(latest.ExitCode)
+		}
+		job.ErrorClass = ClassifyDownloadError(latest.ExitCode, latest.StderrLines)
+	default:
+		// gallery-dl succeeded or never ran, so the archive step itself or
+		// the upload that follows failed.
+		job.Error = "archiving failed after the download, see the logs"
+		job.ErrorClass = model.ErrorClassTransient
+	}
+	return job
+}
+
+// uploadJobs returns a job for each upload in the retry queue.
+func (s *JobService) uploadJobs() ([]model.Job, error) {
+	items, err := s.retryQueue.List()
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make(map[int]*model.Post)
+	jobs := make([]model.Job, 0, len(items))
+	for _, item := range items {
+		post, ok := posts[item.PostID]
+		if !ok {
+			post, err = s.postRepo.GetByID(item.PostID)
+			if err != nil && err != sql.ErrNoRows {
+				return nil, err
+			}
+			posts[item.PostID] = post
+		}
+		jobs = append(jobs, s.uploadJob(item, post))
+	}
+	return jobs, nil
+}
+
+// uploadJob describes a queued upload, which has failed once it used up
+// MAX_UPLOAD_RETRIES. post is nil when the post no longer exists.
+func (s *JobService) uploadJob(item model.ChibisafeRetry, post *model.Post) model.Job {
+	nextAttemptAt := item.NextAttemptAt
+	job := model.Job{
+		ID:            fmt.Sprintf("%s-%d", model.JobTypeUpload, item.ID),
+		Type:          model.JobTypeUpload,
+		Status:        model.JobStatusQueued,
+		Filename:      item.Filename,
+		Attempts:      item.Attempts,
+		Error:         item.Error,
+		NextAttemptAt: &nextAttemptAt,
+	}
+	if post != nil {
+		job.PostHash = post.Hash
+		job.PostTitle = post.Title
+	}
+	if item.Attempts >= s.maxUploadRetries {
+		job.Status = model.JobStatusFailed
+		job.NextAttemptAt = nil
+	}
+	if item.Error != "" {
+		job.ErrorClass = ClassifyUploadError(item.Error)
+	}
+	return job
+}
+
+// parseJobID splits "download-<post id>" and "upload-<retry id>".
+func parseJobID(id string) (model.JobType, int, error) {
+	jobType, key, ok := strings.Cut(id, "-")
+	n, err := strconv.Atoi(key)
+	if !ok || err != nil || n <= 0 {
+		return "", 0, ErrJobNotFound
+	}
+	switch model.JobType(jobType) {
+	case model.JobTypeDownload, model.JobTypeUpload:
+		return model.JobType(jobType), n, nil
+	}
+	return "", 0, ErrJobNotFound
+}
+
+// ClassifyDownloadError tells from gallery-dl's exit status, and the HTTP
+// status it reports, whether a failed download may succeed when retried.
+func ClassifyDownloadError(exitCode int, stderr string) model.ErrorClass {
+	if exitCode == galleryDLExitUsage || exitCode&(galleryDLExitNotFound|galleryDLExitAuth|galleryDLExitFormat|galleryDLExitNoExtractor) != 0 {
+		return model.ErrorClassPermanent
+	}
+	if exitCode&galleryDLExitHTTPError != 0 {
+		if m := galleryDLHTTPStatusPattern.FindAllStringSubmatch(stderr, -1); m != nil {
+			status, _ := strconv.Atoi(m[len(m)-1][1])
+			return classifyHTTPStatus(status)
+		}
+	}
+	return model.ErrorClassTransient
+}
+
+// ClassifyUploadError tells from the error recorded in the retry queue
+// whether a failed upload may succeed when retried.
+func ClassifyUploadError(message string) model.ErrorClass {
+	if strings.HasPrefix(message, "local file unavailable") {
+		return model.ErrorClassPermanent
+	}
+	if m := chibisafeStatusPattern.FindStringSubmatch(message); m != nil {
+		status, _ := strconv.Atoi(m[1])
+		return classifyHTTPStatus(status)
+	}
+	return model.ErrorClassTransient
+}
+
+// classifyHTTPStatus treats server errors, timeouts and rate limits as
+// transient and other client errors as permanent.
+func classifyHTTPStatus(status int) model.ErrorClass {
+	switch {
+	case status >= 500, status == 408, status == 425, status == 429:
+		return model.ErrorClassTransient
+	case status >= 400:
+		return model.ErrorClassPermanent
+	}
+	return model.ErrorClassTransient
+}
+
+// lastLine returns the last non-blank line of s.
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
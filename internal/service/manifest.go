@@ -0,0 +1,95 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"lewdarchive/internal/model"
+)
+
+// ManifestFileName is the manifest written into every archive directory
+// after a successful download. Unlike .meta.json it describes the post and
+// its files without referring to database ids, so an archive can be imported
+// or re-synced from the directory alone.
+const ManifestFileName = "manifest.json"
+
+// Manifest is the content of manifest.json.
+type Manifest struct {
+	PostHash      string         `json:"post_hash"`
+	PostURL       string         `json:"post_url"`
+	Author        string         `json:"author"`
+	CategoryTitle string         `json:"category_title"`
+	Title         string         `json:"title"`
+	PublishedAt   time.Time      `json:"published_at"`
+	DownloadedAt  time.Time      `json:"downloaded_at"`
+	Files         []ManifestFile `json:"files"`
+}
+
+// ManifestFile describes a downloaded file. Name is relative to the archive
+// directory.
+type ManifestFile struct {
+	Name      string `json:"name"`
+	SizeBytes int64  `json:"size_bytes"`
+	SHA256    string `json:"sha256"`
+}
+
+// isArchiveMetadata reports whether a file in an archive directory was
+// written by LewdArchive rather than downloaded.
+func isArchiveMetadata(name string) bool {
+	return name == archiveMetaFile || name == ManifestFileName
+}
+
+// GenerateManifest writes manifest.json into archiveDir.
+func GenerateManifest(archiveDir string, post *model.Post, files []ManifestFile) error {
+	manifest := Manifest{
+		PostHash:      post.Hash,
+		PostURL:       post.URL,
+		Author:        post.Author,
+		CategoryTitle: post.CategoryTitle,
+		Title:         post.Title,
+		PublishedAt:   post.PublishedAt,
+		DownloadedAt:  time.Now().UTC(),
+		Files:         files,
+	}
+	if manifest.Files == nil {
+		manifest.Files = []ManifestFile{}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", ManifestFileName, err)
+	}
+	if err := os.WriteFile(filepath.Join(archiveDir, ManifestFileName), data, 0644); err != nil {
+		return fmt.Errorf("error writing %s in %s: %w", ManifestFileName, archiveDir, err)
+	}
+	return nil
+}
+
+// manifestFiles describes files as listed by hashArchivedFiles.
+func manifestFiles(files []archivedFile) []ManifestFile {
+	described := make([]ManifestFile, len(files))
+	for i, file := range files {
+		described[i] = ManifestFile{
+			Name:      file.relPath,
+			SizeBytes: file.SizeBytes,
+			SHA256:    file.SHA256,
+		}
+	}
+	return described
+}
+
+// ReadManifest reads the manifest.json of an archive directory.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s in %s: %w", ManifestFileName, dir, err)
+	}
+	return &manifest, nil
+}
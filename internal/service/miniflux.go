@@ -2,27 +2,130 @@ package service
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
+
+	"lewdarchive/internal/model"
+)
+
+const (
+	minifluxMaxAttempts    = 5
+	minifluxAttemptTimeout = 15 * time.Second
+	// minifluxRetryDelay is the wait after the first failed attempt; it grows
+	// by as much after every further one.
+	minifluxRetryDelay = 2 * time.Second
+)
+
+// MINIFLUX_ENTRY_ACTION values: what happens to an entry in Miniflux once it
+// has been saved.
+const (
+	MinifluxEntryActionRead     = "read"
+	MinifluxEntryActionStar     = "star"
+	MinifluxEntryActionReadStar = "read+star"
+	MinifluxEntryActionNone     = "none"
+)
+
+// MINIFLUX_ARCHIVED_STATUS values: the status an entry is set to once its post
+// has been archived successfully.
+const (
+	MinifluxEntryStatusRead    = "read"
+	MinifluxEntryStatusRemoved = "removed"
+)
+
+// Miniflux health statuses reported by Health.
+const (
+	MinifluxStatusOK           = "ok"
+	MinifluxStatusDegraded     = "degraded"
+	MinifluxStatusUnconfigured = "unconfigured"
 )
 
+const (
+	minifluxHealthTTL     = 30 * time.Second
+	minifluxHealthTimeout = 5 * time.Second
+)
+
+// minifluxTokenRefreshMargin is how long before its expiry an OAuth2 access
+// token is replaced, so requests in flight don't carry an expired token.
+const minifluxTokenRefreshMargin = time.Minute
+
+// ErrMinifluxEntryNotFound is returned when Miniflux no longer knows an entry.
+var ErrMinifluxEntryNotFound = fmt.Errorf("miniflux entry not found")
+
+// MinifluxHealth is the outcome of the last reachability probe.
+type MinifluxHealth struct {
+	Status      string     `json:"status"`
+	CheckedAt   *time.Time `json:"checked_at,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// MinifluxUser is the account the API credentials belong to.
+type MinifluxUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	IsAdmin  bool   `json:"is_admin"`
+}
+
 type MinifluxService struct {
-	apiURL   string
-	apiToken string
-	client   *http.Client
+	apiURL       string
+	apiToken     string
+	username     string
+	password     string
+	clientID     string
+	clientSecret string
+	tokenURL     string
+	client       *http.Client
+	retryDelay   time.Duration
+	health       MinifluxHealth
+	healthMu     sync.Mutex
+
+	accessToken string
+	tokenExpiry time.Time
+	tokenMu     sync.Mutex
+
+	lastSuccess successClock
+}
+
+type MinifluxConfig struct {
+	APIURL   string
+	APIToken string
+	// Username and Password authenticate with HTTP basic auth instead, for
+	// deployments that can't issue API tokens. The token wins when both are set.
+	Username string
+	Password string
+	// ClientID and ClientSecret fetch a Bearer token from TokenURL with the
+	// OAuth2 client_credentials grant. They take precedence over the API token
+	// and basic auth.
+	ClientID     string
+	ClientSecret string
+	TokenURL     string
 }
 
-func NewMinifluxService(apiURL, apiToken string) *MinifluxService {
-	if apiURL == "" || apiToken == "" {
-		log.Println("WARNING: Miniflux API URL or token not configured. Entry marking will be skipped.")
+// oauth2TokenResponse is the token endpoint response of RFC 6749 section 5.1.
+type oauth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func NewMinifluxService(cfg MinifluxConfig) *MinifluxService {
+	apiURL := cfg.APIURL
+	hasCredentials := cfg.APIToken != "" || (cfg.Username != "" && cfg.Password != "") ||
+		(cfg.ClientID != "" && cfg.ClientSecret != "" && cfg.TokenURL != "")
+	if apiURL == "" || !hasCredentials {
+		log.Println("WARNING: Miniflux API URL or credentials not configured. Entry marking will be skipped.")
 		return &MinifluxService{
 			apiURL:   apiURL,
-			apiToken: apiToken,
+			apiToken: cfg.APIToken,
 			client:   nil,
 		}
 	}
@@ -41,21 +144,53 @@ func NewMinifluxService(apiURL, apiToken string) *MinifluxService {
 	}
 
 	return &MinifluxService{
-		apiURL:   apiURL,
-		apiToken: apiToken,
-		client:   client,
+		apiURL:       apiURL,
+		apiToken:     cfg.APIToken,
+		username:     cfg.Username,
+		password:     cfg.Password,
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		tokenURL:     cfg.TokenURL,
+		client:       client,
+		retryDelay:   minifluxRetryDelay,
 	}
 }
 
-func (s *MinifluxService) MarkEntryAsRead(entryID int) error {
+// FeedIcon is a feed's favicon as stored by Miniflux.
+type FeedIcon struct {
+	MimeType string
+	Data     []byte
+}
+
+// IsConfigured reports whether API calls can be made.
+func (s *MinifluxService) IsConfigured() bool {
+	return s.client != nil
+}
+
+func (s *MinifluxService) MarkEntryAsRead(ctx context.Context, entryID int) error {
+	return s.MarkEntriesAsRead(ctx, []int64{int64(entryID)})
+}
+
+// MarkEntriesAsRead marks several entries as read with a single request.
+func (s *MinifluxService) MarkEntriesAsRead(ctx context.Context, entryIDs []int64) error {
+	return s.SetEntriesStatus(ctx, entryIDs, MinifluxEntryStatusRead)
+}
+
+// SetEntriesStatus sets the status (read, unread or removed) of several
+// entries with a single request.
+func (s *MinifluxService) SetEntriesStatus(ctx context.Context, entryIDs []int64, status string) error {
+	if len(entryIDs) == 0 {
+		return nil
+	}
+	subject := describeEntries(entryIDs)
 	if s.client == nil {
-		log.Printf("Miniflux client not configured, skipping mark as read for entry %d", entryID)
+		log.Printf("Miniflux client not configured, skipping mark as %s for %s", status, subject)
 		return nil
 	}
 
 	requestBody := map[string]interface{}{
-		"entry_ids": []int64{int64(entryID)},
-		"status":    "read",
+		"entry_ids": entryIDs,
+		"status":    status,
 	}
 
 	jsonBody, err := json.Marshal(requestBody)
@@ -63,62 +198,438 @@ func (s *MinifluxService) MarkEntryAsRead(entryID int) error {
 		return fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
-	log.Printf("Sending body to Miniflux for entry %d: %s", entryID, string(jsonBody))
+	log.Printf("Sending body to Miniflux for %s: %s", subject, string(jsonBody))
 
-	url := fmt.Sprintf("%s/entries", s.apiURL)
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonBody))
+	statusCode, responseBody, err := s.doRequestWithRetry(ctx, http.MethodPut, "/entries", jsonBody, subject)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Auth-Token", s.apiToken)
-	req.Header.Set("User-Agent", "LewdArchive/1.0")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Connection", "keep-alive")
+	if statusCode != http.StatusNoContent {
+		log.Printf("Miniflux API response - Status: %d, Body: %s", statusCode, string(responseBody))
+		return fmt.Errorf("unexpected status code %d: %s", statusCode, string(responseBody))
+	}
 
-	req.ContentLength = int64(len(jsonBody))
+	log.Printf("Successfully marked %s as %s in Miniflux (Status: %d)", subject, status, statusCode)
+	return nil
+}
 
-	var resp *http.Response
-	maxRetries := 5 
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		resp, err = s.client.Do(req)
-		if err == nil {
-			break
+// OnArchived returns an ArchiveService completion callback setting the entry
+// of every successfully archived post to status. Entries of failed downloads
+// are left untouched so they stay visible in Miniflux, as are posts that
+// didn't come from Miniflux. The request is bound to the context of the
+// download job, so cancelling the job also stops its retries.
+func (s *MinifluxService) OnArchived(status string) func(context.Context, ArchiveResult) {
+	return func(ctx context.Context, result ArchiveResult) {
+		if !result.Success || result.Post.EntryID == 0 {
+			return
 		}
+		entryIDs := []int64{int64(result.Post.EntryID)}
+		if err := s.SetEntriesStatus(ctx, entryIDs, status); err != nil {
+			log.Printf("Error marking entry %d as %s after archiving: %v", result.Post.EntryID, status, err)
+		}
+	}
+}
 
-		log.Printf("Attempt %d failed for entry %d: %v", attempt, entryID, err)
-		if attempt < maxRetries {
-			time.Sleep(time.Duration(attempt) * 2 * time.Second) 
+// describeEntries names the entries of a request in log messages.
+func describeEntries(entryIDs []int64) string {
+	if len(entryIDs) == 1 {
+		return fmt.Sprintf("entry %d", entryIDs[0])
+	}
+	return fmt.Sprintf("%d entries", len(entryIDs))
+}
+
+// ToggleBookmark flips the starred state of an entry.
+func (s *MinifluxService) ToggleBookmark(ctx context.Context, entryID int) error {
+	if s.client == nil {
+		log.Printf("Miniflux client not configured, skipping bookmark for entry %d", entryID)
+		return nil
+	}
+
+	statusCode, responseBody, err := s.doRequestWithRetry(ctx, http.MethodPut, fmt.Sprintf("/entries/%d/bookmark", entryID), nil, fmt.Sprintf("entry %d", entryID))
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusNoContent {
+		log.Printf("Miniflux API response - Status: %d, Body: %s", statusCode, string(responseBody))
+		return fmt.Errorf("unexpected status code %d: %s", statusCode, string(responseBody))
+	}
+
+	log.Printf("Entry %d successfully starred in Miniflux (Status: %d)", entryID, statusCode)
+	return nil
+}
+
+// FetchOriginalContent asks Miniflux to scrape the original article of an
+// entry and returns its full content, for feeds that only carry a teaser.
+func (s *MinifluxService) FetchOriginalContent(ctx context.Context, entryID int) (string, error) {
+	if s.client == nil {
+		log.Printf("Miniflux client not configured, skipping content fetch for entry %d", entryID)
+		return "", nil
+	}
+
+	statusCode, responseBody, err := s.doRequest(ctx, http.MethodGet, fmt.Sprintf("/entries/%d/fetch-content", entryID), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch content for entry %d: %w", entryID, err)
+	}
+	if statusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d fetching content for entry %d: %s", statusCode, entryID, string(responseBody))
+	}
+
+	var response struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return "", fmt.Errorf("failed to decode fetched content for entry %d: %w", entryID, err)
+	}
+	return response.Content, nil
+}
+
+// GetEntryByID returns the current state of an entry, including content the
+// scraper added after the webhook was sent.
+func (s *MinifluxService) GetEntryByID(ctx context.Context, entryID int) (*model.Entry, error) {
+	if s.client == nil {
+		return nil, fmt.Errorf("miniflux client not configured")
+	}
+
+	statusCode, responseBody, err := s.doRequest(ctx, http.MethodGet, fmt.Sprintf("/entries/%d", entryID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch entry %d: %w", entryID, err)
+	}
+	if statusCode == http.StatusNotFound {
+		return nil, ErrMinifluxEntryNotFound
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d fetching entry %d: %s", statusCode, entryID, string(responseBody))
+	}
+
+	var entry model.Entry
+	if err := json.Unmarshal(responseBody, &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode entry %d: %w", entryID, err)
+	}
+	return &entry, nil
+}
+
+// ListCategories returns every category of the Miniflux user.
+func (s *MinifluxService) ListCategories(ctx context.Context) ([]model.Category, error) {
+	var categories []model.Category
+	if err := s.getJSON(ctx, "/categories", &categories); err != nil {
+		return nil, fmt.Errorf("failed to list categories: %w", err)
+	}
+	return categories, nil
+}
+
+// ListFeeds returns every feed of the Miniflux user with its category.
+func (s *MinifluxService) ListFeeds(ctx context.Context) ([]model.Feed, error) {
+	var feeds []model.Feed
+	if err := s.getJSON(ctx, "/feeds", &feeds); err != nil {
+		return nil, fmt.Errorf("failed to list feeds: %w", err)
+	}
+	return feeds, nil
+}
+
+// getJSON decodes the response of a GET request that must answer 200.
+func (s *MinifluxService) getJSON(ctx context.Context, path string, v interface{}) error {
+	if s.client == nil {
+		return fmt.Errorf("miniflux client not configured")
+	}
+
+	statusCode, responseBody, err := s.doRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d: %s", statusCode, string(responseBody))
+	}
+	return json.Unmarshal(responseBody, v)
+}
+
+// GetUserInfo returns the user authenticated by the configured credentials
+// from GET /v1/me, which fails when they are wrong.
+func (s *MinifluxService) GetUserInfo(ctx context.Context) (*MinifluxUser, error) {
+	var user MinifluxUser
+	if err := s.getJSON(ctx, "/me", &user); err != nil {
+		return nil, fmt.Errorf("failed to get user info: %w", err)
+	}
+	return &user, nil
+}
 
-			req, err = http.NewRequest("PUT", url, bytes.NewBuffer(jsonBody))
-			if err != nil {
-				return fmt.Errorf("failed to recreate request: %w", err)
+// GetFeedEntries returns a page of a feed's entries, oldest first.
+func (s *MinifluxService) GetFeedEntries(ctx context.Context, feedID, offset, limit int) (*model.EntriesPage, error) {
+	if s.client == nil {
+		return nil, fmt.Errorf("miniflux client not configured")
+	}
+
+	path := fmt.Sprintf("/feeds/%d/entries?order=published_at&direction=asc&offset=%d&limit=%d", feedID, offset, limit)
+	statusCode, responseBody, err := s.doRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list entries of feed %d: %w", feedID, err)
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d listing entries of feed %d: %s", statusCode, feedID, string(responseBody))
+	}
+
+	var page model.EntriesPage
+	if err := json.Unmarshal(responseBody, &page); err != nil {
+		return nil, fmt.Errorf("failed to decode entries of feed %d: %w", feedID, err)
+	}
+	return &page, nil
+}
+
+// GetFeedIcon returns the icon Miniflux discovered for a feed, which also
+// covers feeds whose icon only exists as a site favicon. It returns nil without
+// an error when the feed has no icon.
+func (s *MinifluxService) GetFeedIcon(ctx context.Context, feedID int) (*FeedIcon, error) {
+	if s.client == nil {
+		return nil, fmt.Errorf("miniflux client not configured")
+	}
+
+	statusCode, responseBody, err := s.doRequest(ctx, http.MethodGet, fmt.Sprintf("/feeds/%d/icon", feedID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch icon of feed %d: %w", feedID, err)
+	}
+	if statusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d fetching icon of feed %d: %s", statusCode, feedID, string(responseBody))
+	}
+
+	var response struct {
+		Data     string `json:"data"`
+		MimeType string `json:"mime_type"`
+	}
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode icon of feed %d: %w", feedID, err)
+	}
+	return decodeFeedIcon(response.Data, response.MimeType)
+}
+
+// decodeFeedIcon decodes the icon data Miniflux returns, either a data URI or
+// "<mime type>;base64,<data>" next to a separate mime_type field.
+func decodeFeedIcon(data, mimeType string) (*FeedIcon, error) {
+	data = strings.TrimPrefix(data, "data:")
+	header, encoded, found := strings.Cut(data, ",")
+	if !found {
+		encoded, header = header, ""
+	}
+
+	if prefix, ok := strings.CutSuffix(header, ";base64"); ok && prefix != "" {
+		mimeType = prefix
+	}
+	if mimeType == "" {
+		return nil, fmt.Errorf("icon has no mime type")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode icon data: %w", err)
+	}
+	if len(decoded) == 0 {
+		return nil, nil
+	}
+	return &FeedIcon{MimeType: mimeType, Data: decoded}, nil
+}
+
+// Health probes GET /v1/me, which needs a valid token, at most once per
+// minifluxHealthTTL and otherwise returns the cached result.
+func (s *MinifluxService) Health(ctx context.Context) MinifluxHealth {
+	if s.client == nil {
+		return MinifluxHealth{Status: MinifluxStatusUnconfigured}
+	}
+
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+
+	if s.health.CheckedAt != nil && time.Since(*s.health.CheckedAt) < minifluxHealthTTL {
+		return s.health
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, minifluxHealthTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	s.health.CheckedAt = &now
+	statusCode, responseBody, err := s.doRequest(ctx, http.MethodGet, "/me", nil)
+	if err == nil && statusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status code %d: %s", statusCode, strings.TrimSpace(string(responseBody)))
+	}
+	if err != nil {
+		s.health.Status = MinifluxStatusDegraded
+		s.health.LastError = err.Error()
+		log.Printf("Miniflux health check failed: %v", err)
+		return s.health
+	}
+
+	s.health.Status = MinifluxStatusOK
+	s.health.LastSuccess = &now
+	s.health.LastError = ""
+	return s.health
+}
+
+// LastSuccess returns when an API request last succeeded, nil if none did
+// since startup.
+func (s *MinifluxService) LastSuccess() *time.Time {
+	return s.lastSuccess.get()
+}
+
+// Ping requests GET /v1/version, without the caching and retries of Health.
+func (s *MinifluxService) Ping(ctx context.Context) error {
+	statusCode, responseBody, err := s.doRequest(ctx, http.MethodGet, "/version", nil)
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d: %s", statusCode, strings.TrimSpace(string(responseBody)))
+	}
+	return nil
+}
+
+// doRequestWithRetry retries doRequest on network errors with a growing delay.
+// HTTP error statuses are returned to the caller without retrying, and a
+// cancelled context stops the retries immediately, including while waiting.
+func (s *MinifluxService) doRequestWithRetry(ctx context.Context, method, path string, body []byte, subject string) (int, []byte, error) {
+	var err error
+	for attempt := 1; attempt <= minifluxMaxAttempts; attempt++ {
+		var statusCode int
+		var responseBody []byte
+		statusCode, responseBody, err = s.doRequest(ctx, method, path, body)
+		if err == nil {
+			return statusCode, responseBody, nil
+		}
+		if ctx.Err() != nil {
+			return 0, nil, fmt.Errorf("request for %s cancelled: %w", subject, ctx.Err())
+		}
+
+		log.Printf("Attempt %d failed for %s: %v", attempt, subject, err)
+		if attempt < minifluxMaxAttempts {
+			timer := time.NewTimer(time.Duration(attempt) * s.retryDelay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return 0, nil, fmt.Errorf("request for %s cancelled: %w", subject, ctx.Err())
+			case <-timer.C:
 			}
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("X-Auth-Token", s.apiToken)
-			req.Header.Set("User-Agent", "LewdArchive/1.0")
-			req.Header.Set("Accept", "application/json")
-			req.Header.Set("Connection", "keep-alive")
-			req.ContentLength = int64(len(jsonBody))
 		}
 	}
+	return 0, nil, fmt.Errorf("failed to send request after %d attempts: %w", minifluxMaxAttempts, err)
+}
+
+// doRequest sends a single API request and reads the whole response. Every
+// call builds a fresh request so retries never reuse a consumed body, and is
+// bounded by minifluxAttemptTimeout as well as by ctx.
+func (s *MinifluxService) doRequest(ctx context.Context, method, path string, body []byte) (int, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, minifluxAttemptTimeout)
+	defer cancel()
+
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.apiURL+path, reqBody)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case s.clientID != "":
+		token, err := s.bearerToken(ctx)
+		if err != nil {
+			return 0, nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case s.apiToken != "":
+		req.Header.Set("X-Auth-Token", s.apiToken)
+	default:
+		req.SetBasicAuth(s.username, s.password)
+	}
+	req.Header.Set("User-Agent", "LewdArchive/1.0")
+	req.Header.Set("Accept", "application/json")
 
+	resp, err := s.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send request after %d attempts: %w", maxRetries, err)
+		return 0, nil, err
 	}
 	defer resp.Body.Close()
 
+	// A rejected access token may have been revoked before its expiry; drop
+	// it so that the retry fetches a new one.
+	if resp.StatusCode == http.StatusUnauthorized && s.clientID != "" {
+		s.invalidateToken()
+		return 0, nil, fmt.Errorf("access token rejected by Miniflux")
+	}
+
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Printf("Warning: Failed to read response body: %v", err)
 	}
+	if resp.StatusCode < http.StatusBadRequest {
+		s.lastSuccess.record()
+	}
+	return resp.StatusCode, responseBody, nil
+}
+
+// bearerToken returns the cached OAuth2 access token, fetching a new one with
+// the client_credentials grant when there is none yet or it is about to
+// expire. tokenMu is held during the fetch so concurrent requests share it.
+func (s *MinifluxService) bearerToken(ctx context.Context) (string, error) {
+	s.tokenMu.Lock()
+	defer s.tokenMu.Unlock()
 
-	if resp.StatusCode != http.StatusNoContent {
-		log.Printf("Miniflux API response - Status: %d, Body: %s", resp.StatusCode, string(responseBody))
-		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(responseBody))
+	if s.accessToken != "" && (s.tokenExpiry.IsZero() || time.Now().Add(minifluxTokenRefreshMargin).Before(s.tokenExpiry)) {
+		return s.accessToken, nil
 	}
 
-	log.Printf("Entry %d successfully marked as read in Miniflux (Status: %d)", entryID, resp.StatusCode)
-	return nil
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(s.clientID), url.QueryEscape(s.clientSecret))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var token oauth2TokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("token endpoint returned no access_token")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return "", fmt.Errorf("unsupported token type %q", token.TokenType)
+	}
+
+	s.accessToken = token.AccessToken
+	s.tokenExpiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		s.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	log.Printf("Fetched Miniflux access token (expires in %ds)", token.ExpiresIn)
+	return s.accessToken, nil
+}
+
+// invalidateToken forgets the cached access token.
+func (s *MinifluxService) invalidateToken() {
+	s.tokenMu.Lock()
+	defer s.tokenMu.Unlock()
+	s.accessToken = ""
+	s.tokenExpiry = time.Time{}
 }
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"lewdarchive/internal/model"
+)
+
+// newTestMiniflux returns a client of srv that retries without waiting.
+func newTestMiniflux(srv *httptest.Server) *MinifluxService {
+	s := NewMinifluxService(MinifluxConfig{APIURL: srv.URL, APIToken: "token"})
+	s.retryDelay = time.Millisecond
+	return s
+}
+
+// dropConnection fails a request the way a network error does, without any
+// response.
+func dropConnection(t *testing.T, w http.ResponseWriter) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		t.Errorf("hijack: %v", err)
+		return
+	}
+	conn.Close()
+}
+
+func TestMarkEntryAsReadRetriesWithFullBody(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := attempts.Add(1)
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("attempt %d: reading body: %v", n, err)
+		}
+		var payload struct {
+			EntryIDs []int64 `json:"entry_ids"`
+			Status   string  `json:"status"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil || len(payload.EntryIDs) != 1 || payload.EntryIDs[0] != 42 || payload.Status != "read" {
+			t.Errorf("attempt %d: body %q (ContentLength %d), want entry 42 marked read", n, body, r.ContentLength)
+		}
+		if n <= 2 {
+			dropConnection(t, w)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	if err := newTestMiniflux(srv).MarkEntryAsRead(context.Background(), 42); err != nil {
+		t.Fatalf("MarkEntryAsRead: %v", err)
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("got %d attempts, want 3", n)
+	}
+}
+
+func TestMarkEntryAsReadGivesUp(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		dropConnection(t, w)
+	}))
+	defer srv.Close()
+
+	if err := newTestMiniflux(srv).MarkEntryAsRead(context.Background(), 42); err == nil {
+		t.Fatal("MarkEntryAsRead: got nil error from a server dropping every request")
+	}
+	if n := attempts.Load(); n != minifluxMaxAttempts {
+		t.Errorf("got %d attempts, want %d", n, minifluxMaxAttempts)
+	}
+}
+
+func TestMarkEntryAsReadDoesNotRetryHTTPErrors(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	if err := newTestMiniflux(srv).MarkEntryAsRead(context.Background(), 42); err == nil {
+		t.Fatal("MarkEntryAsRead: got nil error for a 400 response")
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("got %d attempts, want 1", n)
+	}
+}
+
+func TestSetEntriesStatusCancelledMidRetry(t *testing.T) {
+	attempted := make(chan struct{}, minifluxMaxAttempts)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempted <- struct{}{}
+		dropConnection(t, w)
+	}))
+	defer srv.Close()
+
+	s := NewMinifluxService(MinifluxConfig{APIURL: srv.URL, APIToken: "token"})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-attempted
+		cancel()
+	}()
+
+	started := time.Now()
+	err := s.SetEntriesStatus(ctx, []int64{42}, MinifluxEntryStatusRead)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("SetEntriesStatus = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(started); elapsed >= minifluxRetryDelay {
+		t.Errorf("returned after %s, want before the %s retry delay ends", elapsed, minifluxRetryDelay)
+	}
+	if n := len(attempted); n != 0 {
+		t.Errorf("%d more attempts after cancelling", n)
+	}
+}
+
+func TestOnArchivedUsesJobContext(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result := ArchiveResult{Post: &model.Post{EntryID: 42}, Success: true}
+	newTestMiniflux(srv).OnArchived(MinifluxEntryStatusRead)(ctx, result)
+	if n := attempts.Load(); n != 0 {
+		t.Errorf("sent %d requests for a cancelled job, want 0", n)
+	}
+
+	newTestMiniflux(srv).OnArchived(MinifluxEntryStatusRead)(context.Background(), result)
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"lewdarchive/internal/model"
+)
+
+const (
+	notifyQueueSize = 100
+	notifyAttempts  = 3
+	notifyBackoff   = 5 * time.Second
+)
+
+// Notifier announces newly archived entries on a chat or push service.
+type Notifier interface {
+	Name() string
+	Notify(feed model.Feed, entry model.Entry) error
+}
+
+// retryAfterError is implemented by notifier errors that know how long the
+// remote service asked us to back off.
+type retryAfterError interface {
+	RetryAfter() time.Duration
+}
+
+// permanentError marks notifier failures that retrying won't fix, such as a
+// request the service rejected as invalid.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// ArchiveNotifier reports the outcome of archiving a post.
+type ArchiveNotifier interface {
+	Name() string
+	NotifyArchived(result ArchiveResult) error
+}
+
+// NotifierRoute limits a notifier to posts from the given categories. An
+// empty Categories list routes everything. Notifier receives new entries and
+// ArchiveNotifier archive results; either may be nil.
+type NotifierRoute struct {
+	Notifier        Notifier
+	ArchiveNotifier ArchiveNotifier
+	Categories      []string
+}
+
+// notification is either a new entry or, when result is set, an archive result.
+type notification struct {
+	feed   model.Feed
+	entry  model.Entry
+	result *ArchiveResult
+}
+
+func (n notification) title() string {
+	if n.result != nil {
+		return n.result.Post.Title
+	}
+	return n.entry.Title
+}
+
+// NotificationDispatcher fans entries out to the configured notifiers. Every
+// notifier has its own queue and worker so a slow or failing service doesn't
+// hold up the others.
+type NotificationDispatcher struct {
+	routes []*dispatchRoute
+}
+
+type dispatchRoute struct {
+	name            string
+	notifier        Notifier
+	archiveNotifier ArchiveNotifier
+	categories      map[string]bool
+	queue           chan notification
+}
+
+// NewNotificationDispatcher starts a worker per route. It returns nil when no
+// notifier is configured.
+func NewNotificationDispatcher(routes []NotifierRoute) *NotificationDispatcher {
+	if len(routes) == 0 {
+		return nil
+	}
+	d := &NotificationDispatcher{}
+	for _, route := range routes {
+		r := &dispatchRoute{
+			notifier:        route.Notifier,
+			archiveNotifier: route.ArchiveNotifier,
+			queue:           make(chan notification, notifyQueueSize),
+		}
+		if route.Notifier != nil {
+			r.name = route.Notifier.Name()
+		} else {
+			r.name = route.ArchiveNotifier.Name()
+		}
+		if len(route.Categories) > 0 {
+			r.categories = make(map[string]bool)
+			for _, category := range route.Categories {
+				r.categories[category] = true
+			}
+		}
+		d.routes = append(d.routes, r)
+		go r.worker()
+	}
+	return d
+}
+
+// Dispatch queues an entry for every notifier routed to its category. Entries
+// are dropped with a warning when a notifier's queue is full.
+func (d *NotificationDispatcher) Dispatch(feed model.Feed, entry model.Entry) {
+	for _, r := range d.routes {
+		if r.notifier != nil && r.accepts(feed.Category.Title) {
+			r.enqueue(notification{feed: feed, entry: entry})
+		}
+	}
+}
+
+// DispatchArchived queues an archive result for every archive notifier routed
+// to the post's category. It matches ArchiveService.OnComplete.
+func (d *NotificationDispatcher) DispatchArchived(_ context.Context, result ArchiveResult) {
+	for _, r := range d.routes {
+		if r.archiveNotifier != nil && r.accepts(result.Post.CategoryTitle) {
+			r.enqueue(notification{result: &result})
+		}
+	}
+}
+
+func (r *dispatchRoute) accepts(category string) bool {
+	return r.categories == nil || r.categories[category]
+}
+
+func (r *dispatchRoute) enqueue(n notification) {
+	select {
+	case r.queue <- n:
+	default:
+		log.Printf("WARNING: %s notification queue full, dropping '%s'", r.name, n.title())
+	}
+}
+
+func (r *dispatchRoute) send(n notification) error {
+	if n.result != nil {
+		return r.archiveNotifier.NotifyArchived(*n.result)
+	}
+	return r.notifier.Notify(n.feed, n.entry)
+}
+
+func (r *dispatchRoute) worker() {
+	for item := range r.queue {
+		var err error
+		for attempt := 1; attempt <= notifyAttempts; attempt++ {
+			if err = r.send(item); err == nil {
+				log.Printf("%s notification sent for '%s'", r.name, item.title())
+				break
+			}
+			var permanent *permanentError
+			if attempt == notifyAttempts || errors.As(err, &permanent) {
+				break
+			}
+
+			wait := notifyBackoff * time.Duration(attempt)
+			if ra, ok := err.(retryAfterError); ok && ra.RetryAfter() > 0 {
+				wait = ra.RetryAfter()
+			}
+			log.Printf("%s notification attempt %d/%d for '%s' failed: %v, retrying in %s", r.name, attempt, notifyAttempts, item.title(), err, wait)
+			time.Sleep(wait)
+		}
+		if err != nil {
+			log.Printf("Error sending %s notification for '%s': %v", r.name, item.title(), err)
+		}
+	}
+}
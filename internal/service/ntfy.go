@@ -0,0 +1,119 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/utils"
+)
+
+// ntfyDefaultPriority is ntfy's "default" level on its 1 (min) to 5 (urgent) scale.
+const ntfyDefaultPriority = 3
+
+type NtfyService struct {
+	serverURL          string
+	topic              string
+	token              string
+	categoryPriorities map[string]int
+	client             *http.Client
+}
+
+type NtfyConfig struct {
+	ServerURL string
+	Topic     string
+	Token     string
+	// CategoryPriorities maps category titles to ntfy priorities (1-5);
+	// "default" applies to categories without their own entry.
+	CategoryPriorities map[string]int
+}
+
+type ntfyMessage struct {
+	Topic    string `json:"topic"`
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Click    string `json:"click,omitempty"`
+	Attach   string `json:"attach,omitempty"`
+	Priority int    `json:"priority"`
+}
+
+// NewNtfyService returns nil when the server URL or topic is missing.
+func NewNtfyService(cfg NtfyConfig) *NtfyService {
+	if cfg.ServerURL == "" || cfg.Topic == "" {
+		return nil
+	}
+	return &NtfyService{
+		serverURL:          strings.TrimSuffix(cfg.ServerURL, "/"),
+		topic:              cfg.Topic,
+		token:              cfg.Token,
+		categoryPriorities: cfg.CategoryPriorities,
+		client:             &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *NtfyService) Name() string {
+	return "ntfy"
+}
+
+func (s *NtfyService) priorityFor(categoryTitle string) int {
+	if priority, ok := s.categoryPriorities[categoryTitle]; ok {
+		return priority
+	}
+	if priority, ok := s.categoryPriorities["default"]; ok {
+		return priority
+	}
+	return ntfyDefaultPriority
+}
+
+// Notify publishes the entry using ntfy's JSON API, which unlike the header
+// based one accepts non-ASCII titles.
+func (s *NtfyService) Notify(feed model.Feed, entry model.Entry) error {
+	category := feed.Category.Title
+	if category == "" {
+		category = "Uncategorized"
+	}
+	author := utils.CleanText(entry.Author)
+	if author == "" {
+		author = "Unknown"
+	}
+
+	msg := ntfyMessage{
+		Topic:    s.topic,
+		Title:    utils.CleanText(entry.Title),
+		Message:  fmt.Sprintf("by %s in %s", author, category),
+		Click:    entry.URL,
+		Attach:   entryImageURL(entry),
+		Priority: s.priorityFor(category),
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ntfy message: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", s.serverURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create ntfy request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ntfy request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("ntfy publish failed: %d - %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/repository"
+)
+
+const (
+	OutgoingEventReceived  = "received"
+	OutgoingEventCompleted = "completed"
+)
+
+// OutgoingWebhookService POSTs a JSON document per post to a user-provided
+// URL, e.g. an n8n or Home Assistant webhook.
+type OutgoingWebhookService struct {
+	url      string
+	secret   string
+	postRepo *repository.PostRepository
+	client   *http.Client
+}
+
+type OutgoingWebhookConfig struct {
+	URL string
+	// Secret signs the body with HMAC-SHA256, sent hex encoded in the
+	// X-LewdArchive-Signature header the same way Miniflux signs its webhooks.
+	Secret string
+}
+
+type outgoingWebhookPayload struct {
+	Event         string               `json:"event"`
+	Post          *model.Post          `json:"post"`
+	Enclosures    []model.Enclosure    `json:"enclosures,omitempty"`
+	Status        model.DownloadStatus `json:"status"`
+	Error         string               `json:"error,omitempty"`
+	Files         []string             `json:"files,omitempty"`
+	UploadedFiles []UploadedFile       `json:"uploaded_files,omitempty"`
+	ChibisafeURLs []string             `json:"chibisafe_urls,omitempty"`
+	Timestamp     time.Time            `json:"timestamp"`
+}
+
+// NewOutgoingWebhookService returns nil when no URL is configured.
+func NewOutgoingWebhookService(cfg OutgoingWebhookConfig, postRepo *repository.PostRepository) *OutgoingWebhookService {
+	if cfg.URL == "" {
+		return nil
+	}
+	return &OutgoingWebhookService{
+		url:      cfg.URL,
+		secret:   cfg.Secret,
+		postRepo: postRepo,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *OutgoingWebhookService) Name() string {
+	return "Outgoing webhook"
+}
+
+// Notify sends the "received" event for a newly saved entry.
+func (s *OutgoingWebhookService) Notify(feed model.Feed, entry model.Entry) error {
+	post, err := s.postRepo.GetByHash(entry.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to load post %s: %w", entry.Hash, err)
+	}
+
+	return s.send(outgoingWebhookPayload{
+		Event:      OutgoingEventReceived,
+		Post:       post,
+		Enclosures: entry.Enclosures,
+		Status:     post.DownloadStatus,
+		Timestamp:  time.Now().UTC(),
+	})
+}
+
+// NotifyArchived sends the "completed" event once downloading and uploading
+// finished, successfully or not.
+func (s *OutgoingWebhookService) NotifyArchived(result ArchiveResult) error {
+	payload := outgoingWebhookPayload{
+		Event:         OutgoingEventCompleted,
+		Post:          result.Post,
+		Status:        model.DownloadStatusCompleted,
+		Files:         archivedFiles(result.ArchiveDir),
+		UploadedFiles: result.UploadedFiles,
+		Timestamp:     time.Now().UTC(),
+	}
+	if !result.Success {
+		payload.Status = model.DownloadStatusFailed
+	}
+	if result.Err != nil {
+		payload.Error = result.Err.Error()
+	}
+	for _, file := range result.UploadedFiles {
+		if file.URL != "" {
+			payload.ChibisafeURLs = append(payload.ChibisafeURLs, file.URL)
+		}
+	}
+
+	return s.send(payload)
+}
+
+// archivedFiles lists the files left in an archive directory. It is empty when
+// the directory was cleaned up after uploading.
+func archivedFiles(dir string) []string {
+	if dir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && entry.Name() != archiveMetaFile {
+			files = append(files, entry.Name())
+		}
+	}
+	return files
+}
+
+func (s *OutgoingWebhookService) send(payload outgoingWebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return &permanentError{err: fmt.Errorf("failed to marshal outgoing webhook payload: %w", err)}
+	}
+
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: fmt.Errorf("failed to create outgoing webhook request: %w", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-LewdArchive-Event", payload.Event)
+	if s.secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.secret))
+		mac.Write(body)
+		req.Header.Set("X-LewdArchive-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("outgoing webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("outgoing webhook failed: %d - %s", resp.StatusCode, string(respBody))
+		if resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusTooManyRequests {
+			return &permanentError{err: err}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"lewdarchive/internal/model"
+)
+
+const (
+	pageFetchTimeout = 10 * time.Second
+	pageFetchMaxSize = 1 << 20
+)
+
+// contentImagePatterns are user-supplied regexes tried before the HTML
+// parser, for feeds whose image URLs don't look like images. They are set
+// once at startup by SetContentImagePatterns.
+var contentImagePatterns []*regexp.Regexp
+
+// SetContentImagePatterns compiles the custom image regexes. Each pattern must
+// have exactly one capture group holding the image URL.
+func SetContentImagePatterns(patterns []string) error {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := CompileContentImagePattern(pattern)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, re)
+	}
+	contentImagePatterns = compiled
+	return nil
+}
+
+// CompileContentImagePattern compiles a custom image regex, checking that it
+// has exactly one capture group.
+func CompileContentImagePattern(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content image regex %q: %w", pattern, err)
+	}
+	if re.NumSubexp() != 1 {
+		return nil, fmt.Errorf("content image regex %q must have exactly one capture group", pattern)
+	}
+	return re, nil
+}
+
+// entryImageURL picks the preview image for an entry: an image enclosure,
+// then an image in the content, then the linked page's og:image. It returns
+// "" when none is found.
+func entryImageURL(entry model.Entry) string {
+	return entryImageURLContext(context.Background(), entry)
+}
+
+// entryImageURLContext is entryImageURL with the page fetch also bounded by
+// ctx.
+func entryImageURLContext(ctx context.Context, entry model.Entry) string {
+	for _, enc := range entry.Enclosures {
+		if strings.HasPrefix(enc.MimeType, "image/") {
+			return enc.URL
+		}
+	}
+	if imageURL := extractImageFromContent(entry.Content, entry.URL); imageURL != "" {
+		return imageURL
+	}
+	return fetchPageImage(ctx, entry.URL)
+}
+
+// extractImageFromContent looks for a preview image in entry HTML. Custom
+// patterns are tried first. Otherwise candidates come from <img> (src, srcset,
+// data-src, data-srcset) and <source> elements, preferring URLs that look like
+// images, then from links to image files. Relative URLs are resolved against
+// baseURL.
+func extractImageFromContent(content, baseURL string) string {
+	for _, re := range contentImagePatterns {
+		if match := re.FindStringSubmatch(content); match != nil && match[1] != "" {
+			log.Printf("Found image from custom regex %s: %s", re, match[1])
+			return resolveURL(baseURL, html.UnescapeString(match[1]))
+		}
+	}
+
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		log.Printf("Error parsing entry content: %v", err)
+		return ""
+	}
+
+	var candidates, links []string
+	walkHTML(doc, func(n *html.Node) {
+		switch n.Data {
+		case "img", "source":
+			candidates = append(candidates, imageCandidates(n)...)
+		case "a":
+			if href := attr(n, "href"); isImageURL(href) {
+				links = append(links, href)
+			}
+		}
+	})
+
+	for _, candidate := range candidates {
+		if isImageURL(candidate) {
+			log.Printf("Found image from <img>/<source>: %s", candidate)
+			return resolveURL(baseURL, candidate)
+		}
+	}
+	if len(candidates) > 0 {
+		log.Printf("Found image from <img>/<source>: %s", candidates[0])
+		return resolveURL(baseURL, candidates[0])
+	}
+	if len(links) > 0 {
+		log.Printf("Found image from <a> tag: %s", links[0])
+		return resolveURL(baseURL, links[0])
+	}
+
+	return ""
+}
+
+// imageCandidates returns the usable image URLs of an <img> or <source>
+// element, best first: the largest srcset entry, lazy-loading attributes,
+// then the plain src.
+func imageCandidates(n *html.Node) []string {
+	var result []string
+	for _, key := range []string{"srcset", "data-srcset"} {
+		if best := largestFromSrcset(attr(n, key)); best != "" {
+			result = append(result, best)
+		}
+	}
+	for _, key := range []string{"data-src", "data-original", "src"} {
+		if value := strings.TrimSpace(attr(n, key)); value != "" {
+			result = append(result, value)
+		}
+	}
+
+	filtered := result[:0]
+	for _, candidate := range result {
+		if !strings.HasPrefix(candidate, "data:") {
+			filtered = append(filtered, candidate)
+		}
+	}
+	return filtered
+}
+
+// largestFromSrcset picks the candidate with the highest width descriptor, or
+// when there is none the highest density descriptor; entries without a
+// descriptor count as 1x. Widths and densities can't be compared, so any width
+// wins over the densities.
+func largestFromSrcset(srcset string) string {
+	var bestWidth, bestDensity string
+	var maxWidth, maxDensity float64
+	for _, item := range strings.Split(srcset, ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+
+		unit, value := byte('x'), 1.0
+		if len(fields) > 1 {
+			descriptor := strings.ToLower(fields[1])
+			if parsed, err := strconv.ParseFloat(descriptor[:len(descriptor)-1], 64); err == nil {
+				unit, value = descriptor[len(descriptor)-1], parsed
+			}
+		}
+		if unit == 'w' {
+			if bestWidth == "" || value > maxWidth {
+				bestWidth, maxWidth = fields[0], value
+			}
+		} else if bestDensity == "" || value > maxDensity {
+			bestDensity, maxDensity = fields[0], value
+		}
+	}
+	if bestWidth != "" {
+		return bestWidth
+	}
+	return bestDensity
+}
+
+// fetchPageImage downloads the entry page and reads its og:image or
+// twitter:image meta tag. The response is capped at pageFetchMaxSize.
+func fetchPageImage(ctx context.Context, pageURL string) string {
+	if pageURL == "" {
+		return ""
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		log.Printf("Error creating request for preview image: %v", err)
+		return ""
+	}
+	client := &http.Client{Timeout: pageFetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("Error fetching page for preview image: %v", err)
+		return ""
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Unexpected status %d fetching page for preview image", resp.StatusCode)
+		return ""
+	}
+
+	doc, err := html.Parse(io.LimitReader(resp.Body, pageFetchMaxSize))
+	if err != nil {
+		log.Printf("Error parsing page for preview image: %v", err)
+		return ""
+	}
+
+	meta := make(map[string]string)
+	walkHTML(doc, func(n *html.Node) {
+		if n.Data != "meta" {
+			return
+		}
+		key := attr(n, "property")
+		if key == "" {
+			key = attr(n, "name")
+		}
+		if content := strings.TrimSpace(attr(n, "content")); content != "" {
+			if _, seen := meta[key]; !seen {
+				meta[key] = content
+			}
+		}
+	})
+
+	for _, key := range []string{"og:image", "og:image:url", "twitter:image", "twitter:image:src"} {
+		if image, ok := meta[key]; ok {
+			log.Printf("Found image from %s meta tag: %s", key, image)
+			return resolveURL(pageURL, image)
+		}
+	}
+	return ""
+}
+
+func walkHTML(n *html.Node, visit func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		visit(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkHTML(c, visit)
+	}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func resolveURL(base, ref string) string {
+	refURL, err := url.Parse(ref)
+	if err != nil || refURL.IsAbs() || base == "" {
+		return ref
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	return baseURL.ResolveReference(refURL).String()
+}
+
+func isImageURL(url string) bool {
+	imageExtensions := []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp", ".svg", ".tiff", ".avif"}
+	urlLower := strings.ToLower(url)
+
+	for _, ext := range imageExtensions {
+		if strings.Contains(urlLower, ext) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package service
+
+import "testing"
+
+// setContentImagePatterns installs custom patterns for the duration of a test.
+func setContentImagePatterns(t *testing.T, patterns ...string) {
+	t.Helper()
+	if err := SetContentImagePatterns(patterns); err != nil {
+		t.Fatalf("SetContentImagePatterns: %v", err)
+	}
+	t.Cleanup(func() { contentImagePatterns = nil })
+}
+
+func TestExtractImageFromContentCustomRegex(t *testing.T) {
+	const uuidImage = "https://i.example.com/3f2b9c1e-8d4a-4f6b-9a7e-1c2d3e4f5a6b"
+	content := `<p>New set is up!</p><a href="` + uuidImage + `">view</a><img src="https://example.com/banner.png">`
+
+	if got := extractImageFromContent(content, "https://example.com/post"); got != "https://example.com/banner.png" {
+		t.Fatalf("without custom regex: got %q, want the built-in <img> match", got)
+	}
+
+	setContentImagePatterns(t, `nomatch-(\d+)`, `"(https://i\.example\.com/[0-9a-f-]{36})"`)
+	if got := extractImageFromContent(content, "https://example.com/post"); got != uuidImage {
+		t.Errorf("with custom regex: got %q, want %q", got, uuidImage)
+	}
+	if got := extractImageFromContent(`<img src="/relative.png">`, "https://example.com/post"); got != "https://example.com/relative.png" {
+		t.Errorf("no custom match: got %q, want the built-in fallback", got)
+	}
+}
+
+func TestExtractImageFromContentCustomRegexResolvesURL(t *testing.T) {
+	setContentImagePatterns(t, `data-image="([^"]+)"`)
+	got := extractImageFromContent(`<div data-image="/img?id=1&amp;size=large"></div>`, "https://example.com/post")
+	if want := "https://example.com/img?id=1&size=large"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSetContentImagePatternsValidation(t *testing.T) {
+	t.Cleanup(func() { contentImagePatterns = nil })
+	for _, pattern := range []string{`(unclosed`, `no-group`, `(two)(groups)`} {
+		if err := SetContentImagePatterns([]string{pattern}); err == nil {
+			t.Errorf("SetContentImagePatterns(%q): got nil error", pattern)
+		}
+	}
+	if err := SetContentImagePatterns([]string{`src="([^"]+)"`, `(?:https?:)?(//cdn\.example\.com/\S+)`}); err != nil {
+		t.Errorf("valid patterns: %v", err)
+	}
+}
+
+func TestLargestFromSrcset(t *testing.T) {
+	tests := []struct {
+		name   string
+		srcset string
+		want   string
+	}{
+		{"widths", "small.jpg 320w, large.jpg 1280w, medium.jpg 640w", "large.jpg"},
+		{"densities", "a.jpg, b.jpg 3x, c.jpg 2x", "b.jpg"},
+		{"width wins over larger density value", "wide.jpg 800w, dense.jpg 1000x", "wide.jpg"},
+		{"width wins over missing descriptor", "plain.jpg, wide.jpg 100w", "wide.jpg"},
+		{"unparseable descriptor counts as 1x", "a.jpg junk, b.jpg 0.5x", "a.jpg"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := largestFromSrcset(tt.srcset); got != tt.want {
+				t.Errorf("largestFromSrcset(%q) = %q, want %q", tt.srcset, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/utils"
+)
+
+const (
+	pushoverAPIURL = "https://api.pushover.net/1/messages.json"
+
+	pushoverMaxTitleLength   = 250
+	pushoverMaxMessageLength = 1024
+	// pushoverMaxAttachmentSize is the largest image Pushover accepts as an
+	// attachment. Larger preview images are left out.
+	pushoverMaxAttachmentSize = 5 * 1024 * 1024
+
+	// Emergency priority messages repeat every pushoverEmergencyRetry seconds
+	// until acknowledged or pushoverEmergencyExpire seconds have passed.
+	pushoverEmergencyPriority = 2
+	pushoverEmergencyRetry    = 60
+	pushoverEmergencyExpire   = 3600
+)
+
+type PushoverService struct {
+	apiURL             string
+	userKey            string
+	appToken           string
+	authorPriorities   map[string]int
+	categoryPriorities map[string]int
+	authorSounds       map[string]string
+	categorySounds     map[string]string
+	client             *http.Client
+}
+
+type PushoverConfig struct {
+	UserKey  string
+	AppToken string
+	// AuthorPriorities and CategoryPriorities map authors and category titles
+	// to Pushover priorities (-2 to 2). Authors take precedence, and the
+	// "default" category applies to entries matching neither.
+	AuthorPriorities   map[string]int
+	CategoryPriorities map[string]int
+	// AuthorSounds and CategorySounds pick Pushover sounds the same way. The
+	// user's default sound plays otherwise.
+	AuthorSounds   map[string]string
+	CategorySounds map[string]string
+}
+
+type pushoverResponse struct {
+	Status int      `json:"status"`
+	Errors []string `json:"errors"`
+}
+
+// NewPushoverService returns nil when the user key or app token is missing.
+func NewPushoverService(cfg PushoverConfig) *PushoverService {
+	if cfg.UserKey == "" || cfg.AppToken == "" {
+		return nil
+	}
+	return &PushoverService{
+		apiURL:             pushoverAPIURL,
+		userKey:            cfg.UserKey,
+		appToken:           cfg.AppToken,
+		authorPriorities:   cfg.AuthorPriorities,
+		categoryPriorities: cfg.CategoryPriorities,
+		authorSounds:       cfg.AuthorSounds,
+		categorySounds:     cfg.CategorySounds,
+		client:             &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *PushoverService) Name() string {
+	return "Pushover"
+}
+
+func (s *PushoverService) priorityFor(author, category string) int {
+	if priority, ok := s.authorPriorities[author]; ok {
+		return priority
+	}
+	if priority, ok := s.categoryPriorities[category]; ok {
+		return priority
+	}
+	return s.categoryPriorities["default"]
+}
+
+func (s *PushoverService) soundFor(author, category string) string {
+	if sound, ok := s.authorSounds[author]; ok {
+		return sound
+	}
+	if sound, ok := s.categorySounds[category]; ok {
+		return sound
+	}
+	return s.categorySounds["default"]
+}
+
+// Notify sends one message for the entry, with its preview image attached
+// when it can be downloaded and fits Pushover's attachment limit.
+func (s *PushoverService) Notify(feed model.Feed, entry model.Entry) error {
+	category := feed.Category.Title
+	if category == "" {
+		category = "Uncategorized"
+	}
+	author := utils.CleanText(entry.Author)
+	priority := s.priorityFor(author, category)
+	sound := s.soundFor(author, category)
+	if author == "" {
+		author = "Unknown"
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	fields := map[string]string{
+		"token":     s.appToken,
+		"user":      s.userKey,
+		"title":     utils.Truncate(utils.CleanText(entry.Title), pushoverMaxTitleLength),
+		"message":   utils.Truncate(fmt.Sprintf("by %s in %s", author, category), pushoverMaxMessageLength),
+		"url":       entry.URL,
+		"url_title": "Open post",
+		"priority":  strconv.Itoa(priority),
+	}
+	if sound != "" {
+		fields["sound"] = sound
+	}
+	if priority == pushoverEmergencyPriority {
+		fields["retry"] = strconv.Itoa(pushoverEmergencyRetry)
+		fields["expire"] = strconv.Itoa(pushoverEmergencyExpire)
+	}
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			return fmt.Errorf("failed to build pushover message: %w", err)
+		}
+	}
+
+	if imageURL := entryImageURL(entry); imageURL != "" {
+		if image, contentType, err := s.fetchAttachment(imageURL); err != nil {
+			log.Printf("Pushover could not attach %s, sending text only: %v", imageURL, err)
+		} else {
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Disposition", `form-data; name="attachment"; filename="preview"`)
+			header.Set("Content-Type", contentType)
+			part, err := form.CreatePart(header)
+			if err == nil {
+				_, err = part.Write(image)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to build pushover message: %w", err)
+			}
+		}
+	}
+	if err := form.Close(); err != nil {
+		return fmt.Errorf("failed to build pushover message: %w", err)
+	}
+
+	resp, err := s.client.Post(s.apiURL, form.FormDataContentType(), &body)
+	if err != nil {
+		return fmt.Errorf("pushover request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	var result pushoverResponse
+	json.Unmarshal(respBody, &result)
+	if resp.StatusCode == http.StatusOK && result.Status == 1 {
+		return nil
+	}
+
+	err = fmt.Errorf("pushover message failed: %d - %s", resp.StatusCode, strings.Join(result.Errors, "; "))
+	if len(result.Errors) == 0 {
+		err = fmt.Errorf("pushover message failed: %d - %s", resp.StatusCode, string(respBody))
+	}
+	// 4xx covers invalid requests and the exhausted monthly message limit
+	// (429), neither of which a retry fixes.
+	if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode < http.StatusInternalServerError {
+		return &permanentError{err: err}
+	}
+	return err
+}
+
+// fetchAttachment downloads a preview image of at most
+// pushoverMaxAttachmentSize bytes.
+func (s *PushoverService) fetchAttachment(imageURL string) ([]byte, string, error) {
+	resp, err := s.client.Get(imageURL)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, "", fmt.Errorf("not an image: %q", contentType)
+	}
+	if resp.ContentLength > pushoverMaxAttachmentSize {
+		return nil, "", fmt.Errorf("%d bytes exceeds the %d bytes limit", resp.ContentLength, pushoverMaxAttachmentSize)
+	}
+
+	image, err := io.ReadAll(io.LimitReader(resp.Body, pushoverMaxAttachmentSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(image) > pushoverMaxAttachmentSize {
+		return nil, "", fmt.Errorf("image exceeds the %d bytes limit", pushoverMaxAttachmentSize)
+	}
+	return image, contentType, nil
+}
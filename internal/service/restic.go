@@ -0,0 +1,131 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// ResticService backs up the archive directories to a restic repository and
+// prunes old snapshots afterwards.
+type ResticService struct {
+	repository string
+	password   string
+	paths      []string
+	keepDaily  int
+	keepWeekly int
+}
+
+type ResticConfig struct {
+	Repository string
+	Password   string
+	// Paths are the directories included in every snapshot.
+	Paths []string
+	// KeepDaily and KeepWeekly are passed to restic forget after each backup.
+	KeepDaily  int
+	KeepWeekly int
+}
+
+// ResticSummary holds the statistics restic reports at the end of a backup.
+type ResticSummary struct {
+	SnapshotID          string  `json:"snapshot_id"`
+	FilesNew            int     `json:"files_new"`
+	FilesChanged        int     `json:"files_changed"`
+	FilesUnmodified     int     `json:"files_unmodified"`
+	DataAdded           int64   `json:"data_added"`
+	TotalFilesProcessed int     `json:"total_files_processed"`
+	TotalBytesProcessed int64   `json:"total_bytes_processed"`
+	TotalDuration       float64 `json:"total_duration"`
+}
+
+// NewResticService returns nil when no repository is configured.
+func NewResticService(cfg ResticConfig) *ResticService {
+	if cfg.Repository == "" {
+		return nil
+	}
+	return &ResticService{
+		repository: cfg.Repository,
+		password:   cfg.Password,
+		paths:      cfg.Paths,
+		keepDaily:  cfg.KeepDaily,
+		keepWeekly: cfg.KeepWeekly,
+	}
+}
+
+// Backup snapshots the archive directories, logs the statistics and then
+// forgets and prunes snapshots outside the retention policy.
+func (s *ResticService) Backup(ctx context.Context) error {
+	if _, err := exec.LookPath("restic"); err != nil {
+		return fmt.Errorf("restic not found in PATH: %w", err)
+	}
+
+	args := append([]string{"backup", "--json"}, s.paths...)
+	stdout, err := s.run(ctx, args...)
+	if err != nil {
+		return fmt.Errorf("restic backup failed: %w", err)
+	}
+
+	summary, err := parseResticSummary(stdout)
+	if err != nil {
+		log.Printf("Warning: could not read restic backup summary: %v", err)
+	} else {
+		log.Printf("Restic snapshot %s: %d new files, %d changed files, %d bytes added",
+			summary.SnapshotID, summary.FilesNew, summary.FilesChanged, summary.DataAdded)
+	}
+
+	if _, err := s.run(ctx, "forget",
+		"--keep-daily", strconv.Itoa(s.keepDaily),
+		"--keep-weekly", strconv.Itoa(s.keepWeekly),
+		"--prune"); err != nil {
+		return fmt.Errorf("restic forget failed: %w", err)
+	}
+	log.Printf("Restic forget completed (keeping %d daily and %d weekly snapshots)", s.keepDaily, s.keepWeekly)
+	return nil
+}
+
+func (s *ResticService) run(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "restic", args...)
+	cmd.Env = append(os.Environ(),
+		"RESTIC_REPOSITORY="+s.repository,
+		"RESTIC_PASSWORD="+s.password,
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w\nOutput: %s", err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// parseResticSummary finds the summary message among the JSON lines that
+// restic backup --json prints.
+func parseResticSummary(output []byte) (*ResticSummary, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var message struct {
+			MessageType string `json:"message_type"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil || message.MessageType != "summary" {
+			continue
+		}
+
+		var summary ResticSummary
+		if err := json.Unmarshal(scanner.Bytes(), &summary); err != nil {
+			return nil, fmt.Errorf("failed to decode summary: %w", err)
+		}
+		return &summary, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no summary in restic output")
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/utils"
+)
+
+const slackMaxTitleLength = 256
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+type SlackService struct {
+	webhookURL       string
+	categoryWebhooks map[string]string
+	client           *http.Client
+}
+
+type SlackConfig struct {
+	WebhookURL       string
+	CategoryWebhooks map[string]string
+}
+
+// SlackError is returned when Slack rejects a webhook request.
+type SlackError struct {
+	StatusCode int
+	Body       string
+	retryAfter time.Duration
+}
+
+func (e *SlackError) Error() string {
+	return fmt.Sprintf("slack webhook failed: %d - %s", e.StatusCode, e.Body)
+}
+
+func (e *SlackError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// NewSlackService returns nil when no webhook is configured.
+func NewSlackService(cfg SlackConfig) *SlackService {
+	if cfg.WebhookURL == "" && len(cfg.CategoryWebhooks) == 0 {
+		return nil
+	}
+	return &SlackService{
+		webhookURL:       cfg.WebhookURL,
+		categoryWebhooks: cfg.CategoryWebhooks,
+		client:           &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *SlackService) Name() string {
+	return "Slack"
+}
+
+// webhookURLFor returns the destination webhook for a category, falling back
+// to SLACK_WEBHOOK_URL.
+func (s *SlackService) webhookURLFor(categoryTitle string) string {
+	if url, ok := s.categoryWebhooks[categoryTitle]; ok {
+		return url
+	}
+	return s.webhookURL
+}
+
+// Notify posts a Block Kit message with the linked title, an author/category
+// context line and the preview image.
+func (s *SlackService) Notify(feed model.Feed, entry model.Entry) error {
+	category := feed.Category.Title
+	if category == "" {
+		category = "Uncategorized"
+	}
+	webhookURL := s.webhookURLFor(feed.Category.Title)
+	if webhookURL == "" {
+		return nil
+	}
+
+	title := utils.Truncate(utils.CleanText(entry.Title), slackMaxTitleLength)
+	author := utils.CleanText(entry.Author)
+	if author == "" {
+		author = "Unknown"
+	}
+
+	blocks := []map[string]interface{}{
+		{
+			"type": "section",
+			"text": map[string]string{
+				"type": "mrkdwn",
+				"text": fmt.Sprintf("*<%s|%s>*", entry.URL, slackEscaper.Replace(title)),
+			},
+		},
+		{
+			"type": "context",
+			"elements": []map[string]string{
+				{"type": "mrkdwn", "text": fmt.Sprintf("by *%s* • %s", slackEscaper.Replace(author), slackEscaper.Replace(category))},
+			},
+		},
+	}
+	if imageURL := entryImageURL(entry); imageURL != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type":      "image",
+			"image_url": imageURL,
+			"alt_text":  title,
+		})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"text":   fmt.Sprintf("%s by %s", title, author),
+		"blocks": blocks,
+	})
+	if err != nil {
+		return &permanentError{err: fmt.Errorf("failed to marshal slack message: %w", err)}
+	}
+
+	resp, err := s.client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("slack request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	slackErr := &SlackError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			slackErr.retryAfter = time.Duration(seconds) * time.Second
+		}
+		return slackErr
+	}
+	if resp.StatusCode < http.StatusInternalServerError {
+		return &permanentError{err: slackErr}
+	}
+	return slackErr
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"lewdarchive/internal/model"
+	"lewdarchive/internal/utils"
+)
+
+const (
+	telegramAPIURL = "https://api.telegram.org"
+
+	// Telegram measures both limits on the visible text, after HTML entities
+	// have been parsed.
+	telegramMaxMessageLength = 4096
+	telegramMaxCaptionLength = 1024
+)
+
+type TelegramService struct {
+	apiURL   string
+	botToken string
+	chatID   string
+	client   *http.Client
+}
+
+type TelegramConfig struct {
+	BotToken string
+	ChatID   string
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// TelegramError is returned for requests the Bot API rejected.
+type TelegramError struct {
+	Code        int
+	Description string
+	retryAfter  time.Duration
+}
+
+func (e *TelegramError) Error() string {
+	return fmt.Sprintf("telegram API error %d: %s", e.Code, e.Description)
+}
+
+func (e *TelegramError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// NewTelegramService returns nil when the bot token or chat ID is missing.
+func NewTelegramService(cfg TelegramConfig) *TelegramService {
+	if cfg.BotToken == "" || cfg.ChatID == "" {
+		return nil
+	}
+	return &TelegramService{
+		apiURL:   telegramAPIURL,
+		botToken: cfg.BotToken,
+		chatID:   cfg.ChatID,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *TelegramService) Name() string {
+	return "Telegram"
+}
+
+// Notify sends the entry as a photo with caption when a preview image is
+// available and as a plain message otherwise. Images Telegram can't fetch
+// fall back to a plain message as well.
+func (s *TelegramService) Notify(feed model.Feed, entry model.Entry) error {
+	if imageURL := entryImageURL(entry); imageURL != "" {
+		err := s.call("sendPhoto", map[string]interface{}{
+			"chat_id":    s.chatID,
+			"photo":      imageURL,
+			"caption":    telegramCaption(feed, entry, telegramMaxCaptionLength),
+			"parse_mode": "HTML",
+		})
+		var tgErr *TelegramError
+		if !errors.As(err, &tgErr) || tgErr.Code != http.StatusBadRequest {
+			return err
+		}
+		log.Printf("Telegram could not send photo %s, sending text only: %v", imageURL, err)
+	}
+
+	return s.call("sendMessage", map[string]interface{}{
+		"chat_id":    s.chatID,
+		"text":       telegramCaption(feed, entry, telegramMaxMessageLength),
+		"parse_mode": "HTML",
+	})
+}
+
+// telegramCaption renders the HTML caption. Only the title is shortened to
+// make the visible text fit in maxLen.
+func telegramCaption(feed model.Feed, entry model.Entry, maxLen int) string {
+	category := feed.Category.Title
+	if category == "" {
+		category = "Uncategorized"
+	}
+	author := utils.CleanText(entry.Author)
+	if author == "" {
+		author = "Unknown"
+	}
+	author = utils.Truncate(author, 256)
+
+	const linkText = "Open post"
+	rest := fmt.Sprintf("\nby %s\n%s\n%s", author, category, linkText)
+	title := utils.Truncate(utils.CleanText(entry.Title), maxLen-utf8.RuneCountInString(rest))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<b>%s</b>\n", html.EscapeString(title))
+	fmt.Fprintf(&b, "by %s\n", html.EscapeString(author))
+	fmt.Fprintf(&b, "%s\n", html.EscapeString(category))
+	fmt.Fprintf(&b, `<a href="%s">%s</a>`, html.EscapeString(entry.URL), linkText)
+	return b.String()
+}
+
+func (s *TelegramService) call(method string, payload map[string]interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal telegram payload: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/bot%s/%s", s.apiURL, s.botToken, method)
+	resp, err := s.client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The error message contains the URL and with it the bot token.
+		return fmt.Errorf("telegram %s request failed: %s", method, strings.ReplaceAll(err.Error(), s.botToken, "<token>"))
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	var result telegramResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("telegram %s returned %d: %s", method, resp.StatusCode, string(respBody))
+	}
+	if !result.OK {
+		tgErr := &TelegramError{
+			Code:        result.ErrorCode,
+			Description: result.Description,
+			retryAfter:  time.Duration(result.Parameters.RetryAfter) * time.Second,
+		}
+		// A bad chat ID, token or message fails again on retry; only rate
+		// limits and server errors are worth waiting for.
+		if tgErr.Code >= 400 && tgErr.Code < 500 && tgErr.Code != http.StatusTooManyRequests {
+			return &permanentError{err: tgErr}
+		}
+		return tgErr
+	}
+	return nil
+}
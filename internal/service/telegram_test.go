@@ -0,0 +1,146 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"lewdarchive/internal/model"
+)
+
+// telegramCall is a Bot API request received by newTelegramServer.
+type telegramCall struct {
+	method  string
+	payload map[string]interface{}
+}
+
+// newTelegramServer fakes the Bot API, answering each method with the JSON
+// in responses, or ok when it has none.
+func newTelegramServer(t *testing.T, responses map[string]string) (*TelegramService, func() []telegramCall) {
+	t.Helper()
+	var mu sync.Mutex
+	var calls []telegramCall
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		calls = append(calls, telegramCall{method, payload})
+		mu.Unlock()
+
+		response, ok := responses[method]
+		if !ok {
+			response = `{"ok": true}`
+		}
+		var code struct {
+			ErrorCode int `json:"error_code"`
+		}
+		json.Unmarshal([]byte(response), &code)
+		if code.ErrorCode != 0 {
+			w.WriteHeader(code.ErrorCode)
+		}
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(srv.Close)
+
+	s := NewTelegramService(TelegramConfig{BotToken: "123:token", ChatID: "42"})
+	s.apiURL = srv.URL
+	return s, func() []telegramCall {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]telegramCall(nil), calls...)
+	}
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]+>`)
+
+// visibleLength is the length Telegram checks against its limits: the text
+// left once the HTML is parsed.
+func visibleLength(s string) int {
+	return utf8.RuneCountInString(html.UnescapeString(htmlTag.ReplaceAllString(s, "")))
+}
+
+func TestTelegramCaptionTruncated(t *testing.T) {
+	s, calls := newTelegramServer(t, nil)
+	entry := model.Entry{
+		Title:   strings.Repeat("Ä & <b> ", 300),
+		URL:     "https://example.com/post",
+		Author:  "Alice",
+		Content: `<img src="https://example.com/preview.jpg">`,
+	}
+	if err := s.Notify(model.Feed{}, entry); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	got := calls()
+	if len(got) != 1 || got[0].method != "sendPhoto" {
+		t.Fatalf("calls = %v, want a single sendPhoto", got)
+	}
+	caption, _ := got[0].payload["caption"].(string)
+	if n := visibleLength(caption); n > telegramMaxCaptionLength || n < telegramMaxCaptionLength-10 {
+		t.Errorf("caption is %d visible runes, want just under %d", n, telegramMaxCaptionLength)
+	}
+	if !strings.Contains(caption, "…</b>") || !strings.Contains(caption, "by Alice") || !strings.Contains(caption, `href="https://example.com/post"`) {
+		t.Errorf("caption lost its title ellipsis, author or link:\n%s", caption)
+	}
+}
+
+func TestTelegramPhotoFallsBackToMessage(t *testing.T) {
+	s, calls := newTelegramServer(t, map[string]string{
+		"sendPhoto": `{"ok": false, "error_code": 400, "description": "Bad Request: wrong file identifier/HTTP URL specified"}`,
+	})
+	entry := model.Entry{Title: "Post", URL: "https://example.com/post", Content: `<img src="https://example.com/missing.jpg">`}
+	if err := s.Notify(model.Feed{}, entry); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	got := calls()
+	if len(got) != 2 || got[0].method != "sendPhoto" || got[1].method != "sendMessage" {
+		t.Fatalf("calls = %v, want sendPhoto then sendMessage", got)
+	}
+	if text, _ := got[1].payload["text"].(string); !strings.Contains(text, "<b>Post</b>") {
+		t.Errorf("message text = %q, want the caption", text)
+	}
+}
+
+func TestTelegramErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		response       string
+		wantPermanent  bool
+		wantRetryAfter time.Duration
+	}{
+		{"rate limited", `{"ok": false, "error_code": 429, "description": "Too Many Requests: retry after 7", "parameters": {"retry_after": 7}}`, false, 7 * time.Second},
+		{"chat not found", `{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"}`, true, 0},
+		{"bad token", `{"ok": false, "error_code": 401, "description": "Unauthorized"}`, true, 0},
+		{"server error", `{"ok": false, "error_code": 502, "description": "Bad Gateway"}`, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTelegramServer(t, map[string]string{"sendMessage": tt.response})
+			// Nothing listens on port 1, so no preview image is found and
+			// the entry goes out as a message.
+			err := s.Notify(model.Feed{}, model.Entry{Title: "Post", URL: "http://127.0.0.1:1/post"})
+
+			var tgErr *TelegramError
+			if !errors.As(err, &tgErr) {
+				t.Fatalf("Notify = %v, want a TelegramError", err)
+			}
+			var permanent *permanentError
+			if errors.As(err, &permanent) != tt.wantPermanent {
+				t.Errorf("Notify = %v, permanent: %v, want %v", err, !tt.wantPermanent, tt.wantPermanent)
+			}
+			if ra, ok := err.(retryAfterError); (ok && ra.RetryAfter() != tt.wantRetryAfter) || (!ok && tt.wantRetryAfter != 0) {
+				t.Errorf("Notify = %v, want retry after %s", err, tt.wantRetryAfter)
+			}
+		})
+	}
+}
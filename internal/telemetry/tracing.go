@@ -0,0 +1,105 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"lewdarchive/internal/model"
+)
+
+const tracerName = "lewdarchive"
+
+type attributesKey struct{}
+
+// Setup installs an OTLP/HTTP trace exporter when endpoint is set. The exporter
+// reads OTEL_EXPORTER_OTLP_ENDPOINT and the other standard OTEL_EXPORTER_OTLP_*
+// variables itself, appending /v1/traces to the base URL. With an empty
+// endpoint the global no-op tracer stays in place. The returned function
+// flushes pending spans and must be called on shutdown.
+func Setup(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("lewdarchive"),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider.Shutdown, nil
+}
+
+// EntryAttributes describes the post and feed a span is working on.
+func EntryAttributes(feed model.Feed, entry model.Entry) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("post.hash", entry.Hash),
+		attribute.String("post.url", entry.URL),
+		attribute.String("post.author", entry.Author),
+		attribute.Int("feed.id", feed.ID),
+		attribute.String("feed.category", feed.Category.Title),
+	}
+}
+
+// PostAttributes describes a stored post.
+func PostAttributes(post *model.Post) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("post.hash", post.Hash),
+		attribute.String("post.url", post.URL),
+		attribute.String("post.author", post.Author),
+		attribute.Int("feed.id", post.FeedID),
+		attribute.String("feed.category", post.CategoryTitle),
+	}
+}
+
+// WithAttributes returns a context whose spans started through StartSpan all
+// carry attrs, so that child spans describe the same post as their parent.
+func WithAttributes(ctx context.Context, attrs ...attribute.KeyValue) context.Context {
+	inherited, _ := ctx.Value(attributesKey{}).([]attribute.KeyValue)
+	merged := make([]attribute.KeyValue, 0, len(inherited)+len(attrs))
+	merged = append(merged, inherited...)
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, attributesKey{}, merged)
+}
+
+// StartSpan starts a span carrying the context attributes plus attrs.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	inherited, _ := ctx.Value(attributesKey{}).([]attribute.KeyValue)
+	all := make([]attribute.KeyValue, 0, len(inherited)+len(attrs))
+	all = append(all, inherited...)
+	all = append(all, attrs...)
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(all...))
+}
+
+// EndSpan records err on the span, if any, and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// hashtagPattern matches "#tag" at the start of the text or after a character
+// that can't be part of a word or a URL, so fragments like page#top are left
+// alone. Tags may use any letters, e.g. Japanese ones on Fanbox.
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_/&#])#([\p{L}\p{N}_]+)`)
+
+var digitsPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// ExtractHashtags returns the distinct hashtags in HTML content, lowercased and
+// without the leading #, in order of appearance. Purely numeric tags such as
+// "#1" are ignored.
+func ExtractHashtags(content string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, match := range hashtagPattern.FindAllStringSubmatch(CleanText(content), -1) {
+		tag := strings.ToLower(match[1])
+		if seen[tag] || digitsPattern.MatchString(tag) {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// allowedHTML lists the elements kept by SanitizeHTML and their allowed
+// attributes.
+var allowedHTML = map[atom.Atom][]string{
+	atom.P:          nil,
+	atom.Br:         nil,
+	atom.Em:         nil,
+	atom.Strong:     nil,
+	atom.A:          {"href"},
+	atom.Img:        {"src", "alt"},
+	atom.Ul:         nil,
+	atom.Ol:         nil,
+	atom.Li:         nil,
+	atom.Blockquote: nil,
+}
+
+// droppedHTML lists the elements removed along with their content, since
+// their text is not meant to be read.
+var droppedHTML = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Math:     true,
+}
+
+// urlAttributes are checked by safeURL.
+var urlAttributes = map[string]bool{"href": true, "src": true}
+
+// SanitizeHTML keeps only an allowlist of formatting elements and attributes
+// from untrusted feed content. Other elements are unwrapped, keeping their
+// text, except scripts, styles and embeds which are removed entirely, as are
+// 1x1 tracking pixels and links to anything but http(s), mailto or relative
+// URLs.
+func SanitizeHTML(content string) string {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(content), body)
+	if err != nil {
+		return html.EscapeString(CleanText(content))
+	}
+
+	var sb strings.Builder
+	for _, n := range nodes {
+		writeSanitized(&sb, n)
+	}
+	return sb.String()
+}
+
+func writeSanitized(sb *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		sb.WriteString(html.EscapeString(n.Data))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	if droppedHTML[n.DataAtom] {
+		return
+	}
+
+	allowedAttrs, allowed := allowedHTML[n.DataAtom]
+	if allowed && n.DataAtom == atom.Img && isTrackingPixel(n) {
+		return
+	}
+
+	if allowed {
+		sb.WriteString("<" + n.Data)
+		for _, attr := range n.Attr {
+			if attr.Namespace != "" || !containsString(allowedAttrs, attr.Key) {
+				continue
+			}
+			if urlAttributes[attr.Key] && !safeURL(attr.Val) {
+				continue
+			}
+			sb.WriteString(" " + attr.Key + `="` + html.EscapeString(attr.Val) + `"`)
+		}
+		sb.WriteString(">")
+		if n.DataAtom == atom.Br || n.DataAtom == atom.Img {
+			return
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeSanitized(sb, c)
+	}
+
+	if allowed {
+		sb.WriteString("</" + n.Data + ">")
+	}
+}
+
+// isTrackingPixel reports whether an image is sized 1x1 or smaller.
+func isTrackingPixel(n *html.Node) bool {
+	var width, height string
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "width":
+			width = strings.TrimSuffix(strings.TrimSpace(attr.Val), "px")
+		case "height":
+			height = strings.TrimSuffix(strings.TrimSpace(attr.Val), "px")
+		}
+	}
+	tiny := func(v string) bool { return v == "0" || v == "1" }
+	return tiny(width) && tiny(height)
+}
+
+// safeURL accepts http(s), mailto and relative URLs.
+func safeURL(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SlugifyTitle turns a title into a readable, lowercase file name that never
+// contains path separators: every run of characters other than letters and
+// digits becomes a single hyphen and leading or trailing hyphens are dropped.
+// The result is cut to at most maxLen runes, at a word boundary when possible.
+// It returns "" when the title has no letters or digits.
+func SlugifyTitle(s string, maxLen int) string {
+	var sb strings.Builder
+	pendingHyphen := false
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pendingHyphen && sb.Len() > 0 {
+				sb.WriteRune('-')
+			}
+			pendingHyphen = false
+			sb.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		pendingHyphen = true
+	}
+
+	runes := []rune(sb.String())
+	if maxLen <= 0 || len(runes) <= maxLen {
+		return string(runes)
+	}
+
+	cut := runes[:maxLen]
+	if runes[maxLen] != '-' {
+		// The cut falls inside a word; drop the partial word if an earlier
+		// boundary exists.
+		for i := len(cut) - 1; i > 0; i-- {
+			if cut[i] == '-' {
+				cut = cut[:i]
+				break
+			}
+		}
+	}
+	return strings.Trim(string(cut), "-")
+}
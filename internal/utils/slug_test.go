@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSlugifyTitle(t *testing.T) {
+	tests := []struct {
+		in     string
+		maxLen int
+		want   string
+	}{
+		{"Hello World", 0, "hello-world"},
+		{"Hello-World", 0, "hello-world"},
+		{"  --Hello,   World!--  ", 0, "hello-world"},
+		{"../../etc/passwd", 0, "etc-passwd"},
+		{`C:\Users\me`, 0, "c-users-me"},
+		{"Ünïcödé Tïtle", 0, "ünïcödé-tïtle"},
+		{"!!!", 0, ""},
+		{"alpha beta gamma", 12, "alpha-beta"},
+		{"alpha beta gamma", 10, "alpha-beta"},
+		{"alphabetagamma", 5, "alpha"},
+		{"alpha beta", 6, "alpha"},
+	}
+	for _, tt := range tests {
+		if got := SlugifyTitle(tt.in, tt.maxLen); got != tt.want {
+			t.Errorf("SlugifyTitle(%q, %d) = %q, want %q", tt.in, tt.maxLen, got, tt.want)
+		}
+	}
+}
+
+func FuzzSlugifyTitle(f *testing.F) {
+	for _, seed := range []string{"Hello World", "../../etc/passwd", `a\b/c`, "\x00name", "日本語 タイトル", "--", "\xff\xfe"} {
+		f.Add(seed, 20)
+	}
+	f.Fuzz(func(t *testing.T, s string, maxLen int) {
+		got := SlugifyTitle(s, maxLen)
+		if strings.ContainsAny(got, `/\`+"\x00") {
+			t.Errorf("SlugifyTitle(%q, %d) = %q contains a path separator", s, maxLen, got)
+		}
+		if got == "." || got == ".." {
+			t.Errorf("SlugifyTitle(%q, %d) = %q is a relative path", s, maxLen, got)
+		}
+		if strings.HasPrefix(got, "-") || strings.HasSuffix(got, "-") || strings.Contains(got, "--") {
+			t.Errorf("SlugifyTitle(%q, %d) = %q has stray hyphens", s, maxLen, got)
+		}
+		if maxLen > 0 && utf8.RuneCountInString(got) > maxLen {
+			t.Errorf("SlugifyTitle(%q, %d) = %q is longer than %d runes", s, maxLen, got, maxLen)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("SlugifyTitle(%q, %d) = %q is not valid UTF-8", s, maxLen, got)
+		}
+	})
+}
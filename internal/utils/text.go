@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+	// \s only matches ASCII whitespace; \p{Z} adds the no-break space that
+	// &nbsp; decodes to.
+	whitespacePattern = regexp.MustCompile(`[\s\p{Z}]+`)
+)
+
+// CleanText turns feed-provided titles and names into plain text: markup is
+// removed, entities such as &amp; are decoded and whitespace is collapsed.
+// Tags are stripped before decoding so an escaped "&lt;preview&gt;" survives
+// as literal text.
+func CleanText(s string) string {
+	s = htmlTagPattern.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	s = whitespacePattern.ReplaceAllString(s, " ")
+	return strings.TrimSpace(s)
+}
+
+// Truncate shortens s to at most maxLen runes, ending with an ellipsis when
+// anything was cut.
+func Truncate(s string, maxLen int) string {
+	runes := []rune(s)
+	if len(runes) <= maxLen {
+		return s
+	}
+	if maxLen <= 1 {
+		return string(runes[:maxLen])
+	}
+	return strings.TrimSpace(string(runes[:maxLen-1])) + "…"
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCleanText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"R-18 &amp; WIP &lt;preview&gt;", "R-18 & WIP <preview>"},
+		{`New set <img src="https://example.com/a.png"> out now`, "New set out now"},
+		{"<b>Bold</b> <i>and</i>\n\n\tspaced   out", "Bold and spaced out"},
+		{"&quot;Quoted&quot; &#39;title&#39; &#x2764;", `"Quoted" 'title' ❤`},
+		{"&amp;lt;b&amp;gt;", "&lt;b&gt;"},
+		{"Tom &amp Jerry", "Tom & Jerry"},
+		{"<p></p>", ""},
+		{"  plain title  ", "plain title"},
+		{"日本語&nbsp;タイトル", "日本語 タイトル"},
+	}
+	for _, tt := range tests {
+		if got := CleanText(tt.in); got != tt.want {
+			t.Errorf("CleanText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	tests := []struct {
+		in     string
+		maxLen int
+		want   string
+	}{
+		{"short", 256, "short"},
+		{strings.Repeat("a", 256), 256, strings.Repeat("a", 256)},
+		{long, 256, strings.Repeat("a", 255) + "…"},
+		{"word ending here", 6, "word…"},
+		{"日本語タイトル", 4, "日本語…"},
+		{"abc", 1, "a"},
+		{"abc", 0, ""},
+	}
+	for _, tt := range tests {
+		got := Truncate(tt.in, tt.maxLen)
+		if got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.in, tt.maxLen, got, tt.want)
+		}
+		if n := utf8.RuneCountInString(got); n > tt.maxLen {
+			t.Errorf("Truncate(%q, %d) is %d runes long", tt.in, tt.maxLen, n)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrFFmpegNotFound is returned by GenerateThumbnail when ffmpeg is not on PATH.
+var ErrFFmpegNotFound = errors.New("ffmpeg not found in PATH")
+
+// thumbnailTimeout bounds an ffmpeg run, which can stall on a corrupt video.
+var thumbnailTimeout = 30 * time.Second
+
+// GenerateThumbnail grabs the frame at one second into the video and writes it
+// as <video_basename>_thumb.jpg to a new temporary directory. The caller owns
+// the returned file and should remove its directory when done. ffmpeg is
+// killed if it runs for longer than 30 seconds.
+func GenerateThumbnail(videoPath string) (string, error) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return "", ErrFFmpegNotFound
+	}
+
+	dir, err := os.MkdirTemp("", "lewdarchive-thumb-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp dir: %w", err)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(videoPath), filepath.Ext(videoPath))
+	output := filepath.Join(dir, base+"_thumb.jpg")
+
+	ctx, cancel := context.WithTimeout(context.Background(), thumbnailTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-y", "-loglevel", "error", "-i", videoPath, "-ss", "00:00:01", "-vframes", "1", output)
+	// Don't wait on the output pipes of children ffmpeg may have left behind.
+	cmd.WaitDelay = time.Second
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("ffmpeg timed out after %s on %s", thumbnailTimeout, videoPath)
+		}
+		return "", fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	// ffmpeg exits cleanly without writing a frame for clips shorter than
+	// the seek offset.
+	if _, err := os.Stat(output); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("ffmpeg produced no thumbnail for %s", videoPath)
+	}
+
+	return output, nil
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeFFmpeg puts an ffmpeg running script first on PATH.
+func fakeFFmpeg(t *testing.T, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestGenerateThumbnailTimeout(t *testing.T) {
+	fakeFFmpeg(t, "sleep 10")
+	defer func(timeout time.Duration) { thumbnailTimeout = timeout }(thumbnailTimeout)
+	thumbnailTimeout = 100 * time.Millisecond
+
+	started := time.Now()
+	path, err := GenerateThumbnail(filepath.Join(t.TempDir(), "stalled.mp4"))
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("GenerateThumbnail = %q, %v, want a timeout error", path, err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("returned after %s, want soon after the %s timeout", elapsed, thumbnailTimeout)
+	}
+}
+
+func TestGenerateThumbnail(t *testing.T) {
+	// The output path is the last argument.
+	fakeFFmpeg(t, `for last; do :; done; echo frame > "$last"`)
+
+	path, err := GenerateThumbnail(filepath.Join(t.TempDir(), "clip.mp4"))
+	if err != nil {
+		t.Fatalf("GenerateThumbnail: %v", err)
+	}
+	defer os.RemoveAll(filepath.Dir(path))
+	if filepath.Base(path) != "clip_thumb.jpg" {
+		t.Errorf("thumbnail = %s, want clip_thumb.jpg", path)
+	}
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"strings"
+	"time"
+)
+
+// publishedAtLayouts are tried in order after RFC3339. They cover the odd
+// offsets and missing timezones some feeds deliver through Miniflux.
+var publishedAtLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05-07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02",
+}
+
+// ParsePublishedAt parses a feed date. Values without a timezone are treated
+// as UTC. The boolean is false when no known layout matched.
+func ParsePublishedAt(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	for _, layout := range publishedAtLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// postChildTables lists the tables referencing posts by post_id. Foreign keys
+// are not enforced, so their rows are removed along with the post.
+var postChildTables = []string{"download_log", "chibisafe_retry_queue", "uploads", "post_files", "post_tags"}
+
+// duplicateURLPosts selects every post but the oldest of each URL archived
+// more than once.
+const duplicateURLPosts = `
+	SELECT id FROM posts
+	WHERE url != '' AND id NOT IN (SELECT MIN(id) FROM posts WHERE url != '' GROUP BY url)
+`
+
+// countDuplicateURLs returns the number of posts DeduplicateURLs would delete.
+func countDuplicateURLs(db *sql.DB) (int64, error) {
+	var n int64
+	if err := db.QueryRow("SELECT COUNT(*) FROM (" + duplicateURLPosts + ")").Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count duplicate URLs: %w", err)
+	}
+	return n, nil
+}
+
+// DeduplicateURLsFile runs DeduplicateURLs on the database at dbPath, which
+// NewSQLite refuses to open while duplicate URLs are left.
+func DeduplicateURLsFile(dbPath string) (int64, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if err := createTables(db); err != nil {
+		return 0, fmt.Errorf("failed to create tables: %w", err)
+	}
+	return DeduplicateURLs(db)
+}
+
+// DeduplicateURLs deletes the posts whose URL was already archived, keeping
+// the oldest post of each URL, along with their tags, files, uploads, retries
+// and download log. Every deleted post is logged. Their archive directories
+// are left on disk. It returns the number of posts removed.
+func DeduplicateURLs(db *sql.DB) (int64, error) {
+	n, err := countDuplicateURLs(db)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := logDuplicateURLs(tx); err != nil {
+		return 0, err
+	}
+
+	for _, table := range postChildTables {
+		query := fmt.Sprintf("DELETE FROM %s WHERE post_id IN (%s)", table, duplicateURLPosts)
+		if _, err := tx.Exec(query); err != nil {
+			return 0, fmt.Errorf("failed to delete duplicate %s rows: %w", table, err)
+		}
+	}
+	result, err := tx.Exec("DELETE FROM posts WHERE id IN (" + duplicateURLPosts + ")")
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete duplicate posts: %w", err)
+	}
+	if n, err = result.RowsAffected(); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit: %w", err)
+	}
+
+	log.Printf("Removed %d posts whose URL was already archived", n)
+	return n, nil
+}
+
+// logDuplicateURLs logs the posts DeduplicateURLs is about to delete along
+// with the post each duplicates.
+func logDuplicateURLs(tx *sql.Tx) error {
+	rows, err := tx.Query(`
+		SELECT p.id, (SELECT MIN(id) FROM posts WHERE url = p.url), p.url
+		FROM posts p WHERE p.id IN (` + duplicateURLPosts + `)
+		ORDER BY p.id`)
+	if err != nil {
+		return fmt.Errorf("failed to list duplicate posts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, keptID int64
+		var url string
+		if err := rows.Scan(&id, &keptID, &url); err != nil {
+			return fmt.Errorf("failed to list duplicate posts: %w", err)
+		}
+		log.Printf("Deleting post %d, a duplicate of post %d (%s)", id, keptID, url)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,27 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Ping checks that the database answers a query.
+func Ping(ctx context.Context, db *sql.DB) error {
+	var one int
+	if err := db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		return fmt.Errorf("database unreachable: %w", err)
+	}
+	return nil
+}
+
+// CheckWritable commits a write to the health_probe table, which fails when
+// the database file or its directory is read-only or the disk is full even
+// though reads still work.
+func CheckWritable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "INSERT OR REPLACE INTO health_probe (id, checked_at) VALUES (1, CURRENT_TIMESTAMP)")
+	if err != nil {
+		return fmt.Errorf("database not writable: %w", err)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"log"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -18,6 +19,16 @@ func NewSQLite(dbPath string) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to create tables: %w", err)
 	}
 
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	if err := setupSearch(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to set up search: %w", err)
+	}
+
 	return db, nil
 }
 
@@ -40,9 +51,152 @@ func createTables(db *sql.DB) error {
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_posts_hash ON posts(hash);
-	CREATE INDEX IF NOT EXISTS idx_posts_url ON posts(url);
 	CREATE INDEX IF NOT EXISTS idx_posts_published_at ON posts(published_at);
-	CREATE INDEX IF NOT EXISTS idx_posts_author ON posts(author);
+
+	CREATE TABLE IF NOT EXISTS download_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		post_id INTEGER NOT NULL,
+		started_at DATETIME NOT NULL,
+		finished_at DATETIME NOT NULL,
+		exit_code INTEGER NOT NULL,
+		stdout_lines TEXT,
+		stderr_lines TEXT,
+		files_downloaded INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_download_log_post_id ON download_log(post_id);
+
+	CREATE TABLE IF NOT EXISTS chibisafe_retry_queue (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		post_id INTEGER NOT NULL,
+		local_file_path TEXT NOT NULL,
+		filename TEXT NOT NULL,
+		album_uuid TEXT NOT NULL,
+		tag_uuid TEXT,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME NOT NULL,
+		error TEXT,
+		FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_chibisafe_retry_queue_next_attempt ON chibisafe_retry_queue(next_attempt_at);
+
+	CREATE TABLE IF NOT EXISTS uploads (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		post_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		uuid TEXT NOT NULL,
+		url TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_uploads_post_id ON uploads(post_id);
+
+	CREATE TABLE IF NOT EXISTS post_files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		post_id INTEGER NOT NULL,
+		path TEXT NOT NULL,
+		name TEXT NOT NULL,
+		size_bytes BIGINT NOT NULL,
+		sha256 TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (post_id, path),
+		FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS file_hashes (
+		file_hash TEXT PRIMARY KEY,
+		chibisafe_uuid TEXT NOT NULL,
+		chibisafe_url TEXT,
+		uploaded_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key TEXT PRIMARY KEY,
+		received_at DATETIME NOT NULL,
+		response_status INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		payload_hash TEXT NOT NULL,
+		source TEXT NOT NULL DEFAULT '',
+		event_type TEXT NOT NULL,
+		entry_count INTEGER NOT NULL,
+		duplicate BOOLEAN NOT NULL DEFAULT 0,
+		received_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_payload_hash ON webhook_deliveries(payload_hash, received_at);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_received_at ON webhook_deliveries(received_at);
+
+	CREATE TABLE IF NOT EXISTS post_tags (
+		post_id INTEGER NOT NULL,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (post_id, tag),
+		FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_post_tags_tag ON post_tags(tag);
+
+	-- Synced from Miniflux and keyed by its IDs, which posts.category_id and
+	-- posts.feed_id refer to. Posts can arrive before the next sync, so the
+	-- references are not declared as constraints.
+	CREATE TABLE IF NOT EXISTS categories (
+		id INTEGER PRIMARY KEY,
+		title TEXT NOT NULL,
+		synced_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS feeds (
+		id INTEGER PRIMARY KEY,
+		title TEXT NOT NULL,
+		site_url TEXT,
+		feed_url TEXT NOT NULL,
+		category_id INTEGER,
+		synced_at DATETIME NOT NULL,
+		FOREIGN KEY (category_id) REFERENCES categories(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_feeds_category_id ON feeds(category_id);
+
+	-- Per-feed author and URL filters applied to new entries. feed_id is a
+	-- Miniflux feed ID, possibly not synced yet.
+	CREATE TABLE IF NOT EXISTS feed_filters (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		feed_id INTEGER NOT NULL,
+		filter_type TEXT NOT NULL,
+		pattern TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_feed_filters_feed_id ON feed_filters(feed_id);
+
+	-- Discord forum threads opened per author, by webhook ID rather than URL
+	-- so the webhook token is not stored. Webhooks can't list threads, so
+	-- without this a restart would open new ones.
+	CREATE TABLE IF NOT EXISTS discord_forum_threads (
+		webhook_id TEXT NOT NULL,
+		thread_name TEXT NOT NULL,
+		thread_id TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (webhook_id, thread_name)
+	);
+
+	-- When scheduled jobs that report over a window last completed, so the
+	-- window survives restarts.
+	CREATE TABLE IF NOT EXISTS job_runs (
+		name TEXT PRIMARY KEY,
+		last_run_at DATETIME NOT NULL
+	);
+
+	-- Single row rewritten by CheckWritable.
+	CREATE TABLE IF NOT EXISTS health_probe (
+		id INTEGER PRIMARY KEY,
+		checked_at DATETIME NOT NULL
+	);
 	`
 
 	if _, err := db.Exec(query); err != nil {
@@ -50,4 +204,195 @@ func createTables(db *sql.DB) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// columnMigrations lists columns added to existing tables after their initial
+// CREATE TABLE. They are applied in order and skipped when already present.
+// backfill, when set, runs once right after the column is added to give the
+// existing rows a value other than the default.
+var columnMigrations = []struct {
+	table      string
+	column     string
+	definition string
+	backfill   string
+}{
+	{"posts", "discord_message_id", "TEXT", ""},
+	{"posts", "discord_webhook_url", "TEXT", ""},
+	// Posts archived before download tracking are done, not waiting to be
+	// downloaded again.
+	{"posts", "download_status", "TEXT NOT NULL DEFAULT 'pending'", "UPDATE posts SET download_status = 'completed'"},
+	{"posts", "download_attempts", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"posts", "download_status_updated_at", "DATETIME", ""},
+	{"posts", "source", "TEXT", ""},
+	{"posts", "download_size_bytes", "BIGINT", ""},
+	{"posts", "feed_id", "INTEGER", ""},
+	{"posts", "download_completed_at", "DATETIME", ""},
+	{"posts", "upload_completed_at", "DATETIME", ""},
+	{"uploads", "local_name", "TEXT", ""},
+}
+
+// indexMigrations create the indexes added since the tables were first
+// created, including those on migrated columns, which don't exist yet when
+// createTables runs against an older database.
+var indexMigrations = []string{
+	"CREATE INDEX IF NOT EXISTS idx_posts_site_url ON posts(site_url)",
+	"CREATE INDEX IF NOT EXISTS idx_posts_status ON posts(download_status)",
+	"CREATE INDEX IF NOT EXISTS idx_posts_category_title ON posts(category_title)",
+	// Its author prefix serves the author-only lookups too, so it replaces
+	// idx_posts_author.
+	"CREATE INDEX IF NOT EXISTS idx_posts_author_category ON posts(author, category_title)",
+	"DROP INDEX IF EXISTS idx_posts_author",
+	"CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts(created_at)",
+	"CREATE INDEX IF NOT EXISTS idx_posts_feed_id ON posts(feed_id)",
+	// Creating the unique index fails while duplicate URLs exist, so migrate
+	// refuses to run until DeduplicateURLs removed them. It replaces the
+	// plain idx_posts_url.
+	"CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_url_unique ON posts(url) WHERE url != ''",
+	"DROP INDEX IF EXISTS idx_posts_url",
+}
+
+func migrate(db *sql.DB) error {
+	for _, m := range columnMigrations {
+		added, err := addColumnIfMissing(db, m.table, m.column, m.definition)
+		if err != nil {
+			return err
+		}
+		if added && m.backfill != "" {
+			if _, err := db.Exec(m.backfill); err != nil {
+				return fmt.Errorf("failed to backfill column %s.%s: %w", m.table, m.column, err)
+			}
+		}
+	}
+	duplicates, err := countDuplicateURLs(db)
+	if err != nil {
+		return err
+	}
+	if duplicates > 0 {
+		return fmt.Errorf("%d posts have the URL of an older post, which prevents making posts.url unique; "+
+			"start the server once with -dedupe-urls to delete them, keeping the oldest post of each URL", duplicates)
+	}
+	for _, query := range indexMigrations {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+	return nil
+}
+
+// searchTriggers keep posts_fts, an external-content FTS5 index of posts, in
+// sync with the posts table.
+var searchTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS posts_fts_insert AFTER INSERT ON posts BEGIN
+		INSERT INTO posts_fts (rowid, title, content, author) VALUES (new.id, new.title, new.content, new.author);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS posts_fts_delete AFTER DELETE ON posts BEGIN
+		INSERT INTO posts_fts (posts_fts, rowid, title, content, author) VALUES ('delete', old.id, old.title, old.content, old.author);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS posts_fts_update AFTER UPDATE OF title, content, author ON posts BEGIN
+		INSERT INTO posts_fts (posts_fts, rowid, title, content, author) VALUES ('delete', old.id, old.title, old.content, old.author);
+		INSERT INTO posts_fts (rowid, title, content, author) VALUES (new.id, new.title, new.content, new.author);
+	END`,
+}
+
+// setupSearch creates the full-text index of posts and rebuilds it whenever
+// its triggers were missing, i.e. on first setup or after running without
+// FTS5. SQLite builds without FTS5 (go-sqlite3 needs the sqlite_fts5 build
+// tag) only lose search: the triggers are dropped so that writes to posts
+// keep working.
+func setupSearch(db *sql.DB) error {
+	var fts5 bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5); err != nil {
+		return fmt.Errorf("failed to check for FTS5: %w", err)
+	}
+	if !fts5 {
+		log.Printf("WARNING: SQLite was built without FTS5, full-text search is disabled")
+		for _, name := range []string{"posts_fts_insert", "posts_fts_delete", "posts_fts_update"} {
+			if _, err := db.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+				return fmt.Errorf("failed to drop search trigger %s: %w", name, err)
+			}
+		}
+		return nil
+	}
+
+	var triggers int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'posts_fts_%'").Scan(&triggers)
+	if err != nil {
+		return fmt.Errorf("failed to inspect search triggers: %w", err)
+	}
+
+	_, err = db.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(title, content, author, content='posts', content_rowid='id')")
+	if err != nil {
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
+
+	for _, query := range searchTriggers {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to create search trigger: %w", err)
+		}
+	}
+
+	if triggers < len(searchTriggers) {
+		if _, err := db.Exec("INSERT INTO posts_fts (posts_fts) VALUES ('rebuild')"); err != nil {
+			return fmt.Errorf("failed to build search index: %w", err)
+		}
+	}
+	return nil
+}
+
+// addColumnIfMissing adds a column unless it exists and reports whether it
+// did.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) (bool, error) {
+	exists, err := columnExists(db, table, column)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)
+	if _, err := db.Exec(query); err != nil {
+		return false, fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return true, nil
+}
+
+// CheckMigrated reports an error unless every column migration was applied.
+func CheckMigrated(db *sql.DB) error {
+	for _, m := range columnMigrations {
+		exists, err := columnExists(db, m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("column %s.%s is missing", m.table, m.column)
+		}
+	}
+	return nil
+}
+
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrateMarksExistingPostsCompleted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	old, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// posts as created before download tracking.
+	_, err = old.Exec(`CREATE TABLE posts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		site_url TEXT NOT NULL,
+		entry_id INTEGER NOT NULL,
+		hash TEXT NOT NULL UNIQUE,
+		title TEXT NOT NULL,
+		url TEXT NOT NULL,
+		published_at DATETIME NOT NULL,
+		content TEXT,
+		author TEXT,
+		category_id INTEGER,
+		category_title TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO posts (site_url, entry_id, hash, title, url, published_at) VALUES ('', 1, 'old', 'Old', 'https://example.com/old', CURRENT_TIMESTAMP)`)
+	old.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := NewSQLite(path)
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`INSERT INTO posts (site_url, entry_id, hash, title, url, published_at) VALUES ('', 2, 'new', 'New', 'https://example.com/new', CURRENT_TIMESTAMP)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"old": "completed", "new": "pending"}
+	for hash, status := range want {
+		var got string
+		if err := db.QueryRow("SELECT download_status FROM posts WHERE hash = ?", hash).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != status {
+			t.Errorf("post %s download_status = %q, want %q", hash, got, status)
+		}
+	}
+
+	// Reopening must not touch posts pending since the column was added.
+	db.Close()
+	db, err = NewSQLite(path)
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	var got string
+	if err := db.QueryRow("SELECT download_status FROM posts WHERE hash = 'new'").Scan(&got); err != nil || got != "pending" {
+		t.Errorf("after reopening, new post download_status = %q, %v, want pending", got, err)
+	}
+	db.Close()
+}
+
+func TestDuplicateURLsBlockMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := NewSQLite(path)
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	// Recreate a database from before posts.url was unique.
+	_, err = db.Exec(`DROP INDEX idx_posts_url_unique;
+	INSERT INTO posts (id, site_url, entry_id, hash, title, url, published_at) VALUES
+		(1, '', 1, 'a', 'A', 'https://example.com/post', CURRENT_TIMESTAMP),
+		(2, '', 2, 'b', 'B', 'https://example.com/post', CURRENT_TIMESTAMP),
+		(3, '', 3, 'c', 'C', 'https://example.com/other', CURRENT_TIMESTAMP);
+	INSERT INTO post_tags (post_id, tag) VALUES (1, 'kept'), (2, 'deleted')`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewSQLite(path); err == nil || !strings.Contains(err.Error(), "-dedupe-urls") {
+		t.Fatalf("NewSQLite with duplicate URLs = %v, want an error pointing to -dedupe-urls", err)
+	}
+
+	n, err := DeduplicateURLsFile(path)
+	if err != nil || n != 1 {
+		t.Fatalf("DeduplicateURLsFile = %d, %v, want 1 post removed", n, err)
+	}
+
+	db, err = NewSQLite(path)
+	if err != nil {
+		t.Fatalf("NewSQLite after deduplicating: %v", err)
+	}
+	defer db.Close()
+	var posts, tags int
+	db.QueryRow("SELECT COUNT(*) FROM posts WHERE id IN (1, 3)").Scan(&posts)
+	db.QueryRow("SELECT COUNT(*) FROM post_tags").Scan(&tags)
+	if posts != 2 || tags != 1 {
+		t.Errorf("kept %d of the 2 posts and %d tags, want the oldest post of each URL and its tag", posts, tags)
+	}
+}